@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"temprest/geolocationapi"
+	"time"
+)
+
+// commands are the CLI subcommands, running the binary without one starts the HTTP server
+var commands = map[string]func(args []string) error{
+	"export-locations": exportLocationsCommand,
+	"import-locations": importLocationsCommand,
+	"location-report":  locationReportCommand,
+	"nmea-simulate":    nmeaSimulateCommand,
+	"fetch-timezones":  fetchTimeZonesCommand,
+	"fetch-gazetteer":  fetchGazetteerCommand,
+}
+
+// runCommand runs a CLI subcommand and returns the process exit code
+func runCommand(args []string) int {
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		fmt.Fprintln(os.Stderr, "usage: temprest [export-locations|import-locations|location-report|nmea-simulate|fetch-timezones|fetch-gazetteer] [flags]")
+		return 2
+	}
+	if err := command(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// formatFromPath guesses an exchange format from a file extension
+func formatFromPath(path string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+}
+
+// exportLocationsCommand writes every location as KML, GPX or GeoJSON to a file or stdout
+func exportLocationsCommand(args []string) error {
+	flags := flag.NewFlagSet("export-locations", flag.ContinueOnError)
+	format := flags.String("format", "", "kml, gpx or geojson, defaults to the output file extension")
+	output := flags.String("o", "", "output file, defaults to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = formatFromPath(*output)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	// The command line runs with database access, so it exports exact positions
+	ctx, cancel := context.WithTimeout(geolocationapi.WithPrivilegedAudience(context.Background(), true), 5*time.Minute)
+	defer cancel()
+	return geolocationapi.ExportLocations(ctx, w, *format, nil)
+}
+
+// importLocationsCommand upserts the locations of a KML, GPX or GeoJSON file, or stdin, and prints the report
+func importLocationsCommand(args []string) error {
+	flags := flag.NewFlagSet("import-locations", flag.ContinueOnError)
+	format := flags.String("format", "", "kml, gpx or geojson, defaults to the input file extension")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+		if *format == "" {
+			*format = formatFromPath(path)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	report, err := geolocationapi.ImportLocations(ctx, r, *format)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// locationReportCommand writes which locations fall inside each community area as JSON or CSV to a file or stdout
+func locationReportCommand(args []string) error {
+	flags := flag.NewFlagSet("location-report", flag.ContinueOnError)
+	format := flags.String("format", "", "json or csv, defaults to the output file extension or json")
+	output := flags.String("o", "", "output file, defaults to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = formatFromPath(*output)
+	}
+	if *format == "" {
+		*format = geolocationapi.ReportFormatJSON
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	// The command line runs with database access, so it places locations by their exact positions
+	ctx, cancel := context.WithTimeout(geolocationapi.WithPrivilegedAudience(context.Background(), true), 5*time.Minute)
+	defer cancel()
+	return geolocationapi.WriteLocationJoinReport(ctx, w, *format)
+}
+
+// nmeaSimulateCommand streams the NMEA sentences of a simulated GPS device to the NMEA listener or stdout
+func nmeaSimulateCommand(args []string) error {
+	flags := flag.NewFlagSet("nmea-simulate", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:"+geolocationapi.NMEAPort(), "address of the NMEA listener, - writes to stdout")
+	sim := geolocationapi.NMEASimulation{}
+	flags.StringVar(&sim.DeviceID, "device", "", "device id sent in a $PDEVID sentence, the listener uses the IP address without it")
+	flags.StringVar(&sim.Secret, "secret", "", "secret of the device sent with its id")
+	flags.Float64Var(&sim.Latitude, "lat", 0, "start latitude")
+	flags.Float64Var(&sim.Longitude, "lng", 0, "start longitude")
+	flags.Float64Var(&sim.Altitude, "alt", 0, "altitude in meters above sea level")
+	flags.Float64Var(&sim.Speed, "speed", 0, "speed in meters per second")
+	flags.Float64Var(&sim.Heading, "heading", 0, "heading in degrees clockwise from north")
+	flags.DurationVar(&sim.Interval, "interval", time.Second, "time between fixes")
+	flags.IntVar(&sim.Count, "count", 0, "number of fixes to send, 0 sends until interrupted")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *addr != "-" {
+		conn, err := net.Dial("tcp", *addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		w = conn
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return geolocationapi.SimulateNMEA(ctx, w, sim)
+}
+
+// fetchTimeZonesCommand downloads the time zone boundaries to Geocoder.TimeZonePath
+func fetchTimeZonesCommand(args []string) error {
+	flags := flag.NewFlagSet("fetch-timezones", flag.ContinueOnError)
+	release := flags.String("release", geolocationapi.DefaultTimeZoneRelease, "timezone-boundary-builder release to download")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	path, err := geolocationapi.FetchTimeZones(ctx, *release)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("time zone boundaries of release %s written to %s\n", *release, path)
+	return nil
+}
+
+// fetchGazetteerCommand downloads the GeoNames gazetteer to Geocoder.GazetteerPath and the admin code
+// and country files to their configured paths
+func fetchGazetteerCommand(args []string) error {
+	flags := flag.NewFlagSet("fetch-gazetteer", flag.ContinueOnError)
+	dataset := flags.String("dataset", geolocationapi.DefaultGazetteerDataset, "GeoNames cities dump to download: cities500, cities1000, cities5000 or cities15000")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	paths, err := geolocationapi.FetchGazetteer(ctx, *dataset)
+	for _, path := range paths {
+		fmt.Printf("gazetteer file written to %s\n", path)
+	}
+	return err
+}
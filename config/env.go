@@ -22,10 +22,23 @@ func init() {
 	initializeConfig()
 }
 
+// findConfigBasePath returns the config directory of the working directory, or of the nearest parent
+// that has one, so package tests running in their own directory read the same configuration
+func findConfigBasePath() string {
+	path := "./config/"
+	for i := 0; i < 4; i++ {
+		if _, err := os.Stat(path + "env.json"); err == nil {
+			return path
+		}
+		path = "../" + strings.TrimPrefix(path, "./")
+	}
+	return "./config/"
+}
+
 func initializeConfig() {
 
-	var configBasePath string = "./config/"
-	env := getEnvironment()
+	var configBasePath string = findConfigBasePath()
+	env := getEnvironment(configBasePath)
 
 	// Get config file
 	var pathForConfig = configBasePath + "config-" + env
@@ -50,13 +63,13 @@ func initializeConfig() {
 	}
 }
 
-func getEnvironment() string {
+func getEnvironment(configBasePath string) string {
 
 	fmt.Println("config:reading environment")
 
 	var environment string
 
-	envData, envErr := ioutil.ReadFile("./config/env.json")
+	envData, envErr := ioutil.ReadFile(configBasePath + "env.json")
 
 	if envErr != nil {
 		fmt.Println("Error in reading environment json file")
@@ -15,6 +15,98 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/geolocationapi/analytics/heatmap": {
+            "get": {
+                "description": "Counts locations, or tracked member positions, per square or hexagonal grid cell inside a bounding box, optionally limited to a community's area or members",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "analytics"
+                ],
+                "summary": "Get a density heatmap",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "minLng,minLat,maxLng,maxLat",
+                        "name": "bbox",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Cell size in meters at the centre of the box, defaults to 64 cells across",
+                        "name": "resolution",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "square (default) or hex",
+                        "name": "grid",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "locations (default) or positions",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only count locations in this community's geofence, or positions of its members",
+                        "name": "communityId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start of the position time range (RFC 3339), defaults to 24 hours ago",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the position time range (RFC 3339), defaults to now",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are counted by their obfuscated position without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Heatmap"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/geolocationapi/community": {
             "get": {
                 "description": "Retrieves all Community from the MongoDB collection",
@@ -28,6 +120,26 @@ const docTemplate = `{
                     "Community"
                 ],
                 "summary": "Get all Community",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633",
+                        "name": "crs",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -67,6 +179,18 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/geolocationapi.Community"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633",
+                        "name": "crs",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -91,39 +215,29 @@ const docTemplate = `{
                 }
             }
         },
-        "/geolocationapi/community/{id}": {
+        "/geolocationapi/community.geojson": {
             "get": {
-                "description": "Retrieves a community from the MongoDB collection by its ID",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Returns every community as a feature of a GeoJSON FeatureCollection, with its boundary as a Polygon or its location as a Point",
                 "produces": [
-                    "application/json"
+                    "application/geo+json"
                 ],
                 "tags": [
                     "Community"
                 ],
-                "summary": "Get a community by ID",
+                "summary": "Export communities as GeoJSON",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "community found",
-                        "schema": {
-                            "$ref": "#/definitions/geolocationapi.Community"
-                        }
-                    },
-                    "404": {
-                        "description": "Not Found",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/geolocationapi.GeoJSONFeatureCollection"
                         }
                     },
                     "500": {
@@ -133,42 +247,68 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Updates a community name in the MongoDB collection by its ID",
+            }
+        },
+        "/geolocationapi/community/import/csv": {
+            "post": {
+                "description": "Streams a CSV upload and upserts a community with its embedded location by id for every row, keeping the members and boundary of existing communities",
                 "consumes": [
-                    "application/json"
+                    "text/csv"
                 ],
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/csv"
                 ],
                 "tags": [
                     "Community"
                 ],
-                "summary": "Update a community by ID",
+                "summary": "Import communities from CSV",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Updated community object",
-                        "name": "updatedCommunity",
+                        "description": "CSV rows",
+                        "name": "file",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/geolocationapi.Community"
+                            "type": "string"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Field to column mapping, fields are id, name, latitude, longitude, coordinates, locationId, locationName and geofenceRadius",
+                        "name": "mapping",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Whether the first row is a header: auto (default), true or false",
+                        "name": "header",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Column delimiter, a single character or tab (default ,)",
+                        "name": "delimiter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Validate the rows without writing them",
+                        "name": "dryRun",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Report format: json (default) or csv to download the rejected rows",
+                        "name": "report",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "community updated",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/geolocationapi.Community"
+                            "$ref": "#/definitions/geolocationapi.ImportReport"
                         }
                     },
                     "400": {
@@ -177,12 +317,6 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -190,28 +324,42 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Deletes a community from the MongoDB collection by its ID",
+            }
+        },
+        "/geolocationapi/community/location-report": {
+            "get": {
+                "description": "Joins every location against the community boundaries, or the radius around the community location when there is no boundary, and streams the location ids and counts per community and the unassigned locations",
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
                 "tags": [
                     "Community"
                 ],
-                "summary": "Delete a community by ID",
+                "summary": "Report which locations fall inside each community area",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "json (default) or csv",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are placed by their obfuscated position without one",
+                        "name": "X-API-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.LocationJoinReport"
+                        }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "string"
                         }
@@ -225,9 +373,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/geolocationapi/location": {
+        "/geolocationapi/community/recommend": {
             "get": {
-                "description": "Retrieves all locations from the MongoDB collection",
+                "description": "Ranks communities by distance from their boundary or location, member count and open seats for a role, leaving out communities the member already belongs to",
                 "consumes": [
                     "application/json"
                 ],
@@ -235,57 +383,71 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "locations"
+                    "Community"
+                ],
+                "summary": "Recommend communities near a position",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "Latitude",
+                        "name": "lat",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Longitude",
+                        "name": "lng",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of communities to return (default 10)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Only recommend communities within this many meters (default 50000)",
+                        "name": "maxDistance",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Leave out communities this membership ID already belongs to",
+                        "name": "memberId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only recommend communities with an open seat for this role",
+                        "name": "role",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Scoring function: balanced (default), distance or size",
+                        "name": "scorer",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private community locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
                 ],
-                "summary": "Get all locations",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/geolocationapi.Location"
+                                "$ref": "#/definitions/geolocationapi.CommunityRecommendation"
                             }
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "type": "string"
-                        }
-                    }
-                }
-            },
-            "post": {
-                "description": "Creates a new location and adds it to the MongoDB collection",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "locations"
-                ],
-                "summary": "Create a new location",
-                "parameters": [
-                    {
-                        "description": "Location object to be created",
-                        "name": "Location",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/geolocationapi.Location"
-                        }
-                    }
-                ],
-                "responses": {
-                    "201": {
-                        "description": "location created",
-                        "schema": {
-                            "$ref": "#/definitions/geolocationapi.Location"
-                        }
-                    },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
@@ -301,9 +463,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/geolocationapi/location/{id}": {
+        "/geolocationapi/community/{id}": {
             "get": {
-                "description": "Retrieves a location from the MongoDB collection by its ID",
+                "description": "Retrieves a community from the MongoDB collection by its ID",
                 "consumes": [
                     "application/json"
                 ],
@@ -311,9 +473,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "locations"
+                    "Community"
                 ],
-                "summary": "Get a location by ID",
+                "summary": "Get a community by ID",
                 "parameters": [
                     {
                         "type": "string",
@@ -321,13 +483,31 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633",
+                        "name": "crs",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "location found",
+                        "description": "community found",
                         "schema": {
-                            "$ref": "#/definitions/geolocationapi.Location"
+                            "$ref": "#/definitions/geolocationapi.Community"
                         }
                     },
                     "404": {
@@ -345,7 +525,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Updates a location name in the MongoDB collection by its ID",
+                "description": "Updates a community name and boundary in the MongoDB collection by its ID",
                 "consumes": [
                     "application/json"
                 ],
@@ -353,9 +533,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "locations"
+                    "Community"
                 ],
-                "summary": "Update a location by ID",
+                "summary": "Update a community by ID",
                 "parameters": [
                     {
                         "type": "string",
@@ -365,20 +545,32 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Updated location data",
-                        "name": "updateData",
+                        "description": "Updated community object",
+                        "name": "updatedCommunity",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/geolocationapi.Location"
+                            "$ref": "#/definitions/geolocationapi.Community"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633",
+                        "name": "crs",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "location updated",
+                        "description": "community updated",
                         "schema": {
-                            "$ref": "#/definitions/geolocationapi.Location"
+                            "$ref": "#/definitions/geolocationapi.Community"
                         }
                     },
                     "400": {
@@ -402,11 +594,11 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Deletes a location from the MongoDB collection by its ID",
+                "description": "Deletes a community from the MongoDB collection by its ID",
                 "tags": [
-                    "locations"
+                    "Community"
                 ],
-                "summary": "Delete a location by ID",
+                "summary": "Delete a community by ID",
                 "parameters": [
                     {
                         "type": "string",
@@ -427,7 +619,7 @@ const docTemplate = `{
                         }
                     },
                     "500": {
-                        "description": "Int",
+                        "description": "Internal Server Error",
                         "schema": {
                             "type": "string"
                         }
@@ -435,9 +627,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/geolocationapi/membership": {
+        "/geolocationapi/community/{id}/geofence-events": {
             "get": {
-                "description": "Retrieves all membership from the MongoDB collection",
+                "description": "Returns the enter, exit and dwell events of a community, newest first",
                 "consumes": [
                     "application/json"
                 ],
@@ -445,19 +637,58 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "membership"
+                    "geofence"
+                ],
+                "summary": "Get the geofence events of a community",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Community ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return events of this type: enter, exit or dwell",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return events at or after this time (RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return events at or before this time (RFC 3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of events (default 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get all membership",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/geolocationapi.Membership"
+                                "$ref": "#/definitions/geolocationapi.GeofenceEvent"
                             }
                         }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -465,35 +696,51 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "post": {
-                "description": "Creates a new membership and adds it to the MongoDB collection",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/geolocationapi/community/{id}/service-area": {
+            "get": {
+                "description": "Returns a GeoJSON FeatureCollection whose first feature is a polygon approximating the geodesic circle of the given distance around the community location, split into a MultiPolygon along the antimeridian, followed by a Point feature for every location inside it, nearest first",
                 "produces": [
-                    "application/json"
+                    "application/geo+json"
                 ],
                 "tags": [
-                    "membership"
+                    "Community"
                 ],
-                "summary": "Create a new membership",
+                "summary": "Get the service area of a community",
                 "parameters": [
                     {
-                        "description": "Membership object to be created",
-                        "name": "Membership",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/geolocationapi.Membership"
-                        }
+                        "type": "string",
+                        "description": "Community ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Radius of the service area in meters",
+                        "name": "distance",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of polygon vertices, defaults to the configured segment count",
+                        "name": "segments",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are placed by their obfuscated position without one",
+                        "name": "X-API-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "membership created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/geolocationapi.Membership"
+                            "$ref": "#/definitions/geolocationapi.GeoJSONFeatureCollection"
                         }
                     },
                     "400": {
@@ -502,6 +749,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "404": {
+                        "description": "Item not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -511,9 +764,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/geolocationapi/membership/{id}": {
+        "/geolocationapi/community/{id}/spatial-stats": {
             "get": {
-                "description": "Retrieves a membership from the MongoDB collection by its ID",
+                "description": "Returns the centroid, convex hull and bounding box of the members' home locations, with the average and largest distance from the community location",
                 "consumes": [
                     "application/json"
                 ],
@@ -521,23 +774,29 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "membership"
+                    "Community"
                 ],
-                "summary": "Get a membership by ID",
+                "summary": "Get spatial statistics of a community",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "ID",
+                        "description": "Community ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "membership found",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/geolocationapi.Membership"
+                            "$ref": "#/definitions/geolocationapi.CommunitySpatialStats"
                         }
                     },
                     "404": {
@@ -553,9 +812,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Updates a membership role in the MongoDB collection by its ID",
+            }
+        },
+        "/geolocationapi/geocode/elevation": {
+            "get": {
+                "description": "Reads the ground elevation in meters from the offline SRTM and GeoTIFF elevation tiles, interpolating between samples",
                 "consumes": [
                     "application/json"
                 ],
@@ -563,32 +824,30 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "membership"
+                    "geocode"
                 ],
-                "summary": "Update a membership by ID",
+                "summary": "Get the elevation of a position",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "ID",
-                        "name": "id",
-                        "in": "path",
+                        "type": "number",
+                        "description": "Latitude",
+                        "name": "lat",
+                        "in": "query",
                         "required": true
                     },
                     {
-                        "description": "Updated Membership data",
-                        "name": "updateData",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/geolocationapi.Membership"
-                        }
+                        "type": "number",
+                        "description": "Longitude",
+                        "name": "lng",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Membership updated",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/geolocationapi.Membership"
+                            "$ref": "#/definitions/geolocationapi.ElevationResult"
                         }
                     },
                     "400": {
@@ -603,41 +862,64 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "503": {
+                        "description": "Service Unavailable",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
             },
-            "delete": {
-                "description": "Deletes a location from the MongoDB collection by its ID",
+            "post": {
+                "description": "Reads the ground elevation of every position from the offline elevation tiles, the elevation is null where the tiles have no data",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "membership"
+                    "geocode"
                 ],
-                "summary": "Delete a membership by ID",
+                "summary": "Get the elevation of several positions",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Positions to look up",
+                        "name": "points",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.ElevationPoint"
+                            }
+                        }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.ElevationResult"
+                            }
+                        }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "500": {
-                        "description": "Int",
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
                         "schema": {
                             "type": "string"
                         }
@@ -645,9 +927,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/healthcheck": {
+        "/geolocationapi/geocode/reverse": {
             "get": {
-                "description": "Get a simple healthcheck message",
+                "description": "Returns the nearest place from the offline gazetteer with its admin regions and country",
                 "consumes": [
                     "application/json"
                 ],
@@ -655,12 +937,46 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "healthcheck"
+                    "geocode"
+                ],
+                "summary": "Reverse geocode a position",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "Latitude",
+                        "name": "lat",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Longitude",
+                        "name": "lng",
+                        "in": "query",
+                        "required": true
+                    }
                 ],
-                "summary": "Get a healthcheck message",
                 "responses": {
                     "200": {
-                        "description": "success",
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.ReverseGeocodeResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
                         "schema": {
                             "type": "string"
                         }
@@ -668,9 +984,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/hello": {
+        "/geolocationapi/geocode/timezone": {
             "get": {
-                "description": "Get a simple hello message",
+                "description": "Looks up the IANA time zone from the offline time zone boundaries and returns its current UTC offset, or the offset at a given time",
                 "consumes": [
                     "application/json"
                 ],
@@ -678,44 +994,2490 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "hello"
+                    "geocode"
+                ],
+                "summary": "Get the time zone of a position",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "Latitude",
+                        "name": "lat",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Longitude",
+                        "name": "lng",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time to compute the offset for (default now)",
+                        "name": "at",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get a hello message",
                 "responses": {
                     "200": {
-                        "description": "Hello, world!",
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.TimeZoneResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "geolocationapi.Community": {
-            "type": "object",
-            "properties": {
-                "id": {
-                    "type": "string"
-                },
-                "location": {
-                    "$ref": "#/definitions/geolocationapi.Location"
-                },
-                "members": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/geolocationapi.Membership"
-                    }
-                },
-                "name": {
-                    "type": "string"
-                }
-            }
         },
-        "geolocationapi.Location": {
+        "/geolocationapi/geofence/reports": {
+            "post": {
+                "description": "Evaluates one position or a batch of member positions against the community geofences and stores the enter, exit and dwell events they trigger",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "geofence"
+                ],
+                "summary": "Report positions for geofencing",
+                "parameters": [
+                    {
+                        "description": "Position or array of positions",
+                        "name": "positions",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.TrackedPosition"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "events triggered by the reports",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.GeofenceEvent"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location": {
+            "get": {
+                "description": "Retrieves all locations from the MongoDB collection, optionally filtered by geohash prefix and address fields",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Get all locations",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only return locations whose geohash starts with this prefix",
+                        "name": "geohash",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return locations whose street contains this text",
+                        "name": "street",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return locations in this locality, ignoring case",
+                        "name": "locality",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return locations in this region, ignoring case",
+                        "name": "region",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return locations whose postal code starts with this value",
+                        "name": "postalCode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return locations in this ISO 3166-1 alpha-2 country",
+                        "name": "countryCode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633",
+                        "name": "crs",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.Location"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a new location and adds it to the MongoDB collection",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Create a new location",
+                "parameters": [
+                    {
+                        "description": "Location object to be created",
+                        "name": "Location",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Location"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Fill a missing name from the offline gazetteer (defaults to Geocoder.FillMissingNames)",
+                        "name": "fillName",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633",
+                        "name": "crs",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "location created",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Location"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location.geojson": {
+            "get": {
+                "description": "Returns every location as a Point feature of a GeoJSON FeatureCollection",
+                "produces": [
+                    "application/geo+json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Export locations as GeoJSON",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only export locations in minLng,minLat,maxLng,maxLat",
+                        "name": "bbox",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.GeoJSONFeatureCollection"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location.gpx": {
+            "get": {
+                "description": "Returns every location as a GPX waypoint with its name and description",
+                "produces": [
+                    "application/gpx+xml"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Export locations as GPX",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only export locations in minLng,minLat,maxLng,maxLat",
+                        "name": "bbox",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "GPX document",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location.kml": {
+            "get": {
+                "description": "Returns every location as a Point placemark with its name and description",
+                "produces": [
+                    "application/vnd.google-earth.kml+xml"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Export locations as KML",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only export locations in minLng,minLat,maxLng,maxLat",
+                        "name": "bbox",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "KML document",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/clusters": {
+            "get": {
+                "description": "Groups locations into clusters for the given bounding box and zoom level",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Get location clusters for a map view",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bounding box as minLng,minLat,maxLng,maxLat",
+                        "name": "bbox",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Map zoom level",
+                        "name": "zoom",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are clustered by their obfuscated position without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.LocationCluster"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/duplicates": {
+            "get": {
+                "description": "Groups locations that are close to each other and have similar names, e.g. \"Central Park\" and \"Central park NYC\" a few meters apart",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Find duplicate locations",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "Largest distance in meters between duplicates (default 100)",
+                        "name": "maxDistance",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Lowest name similarity between 0 and 1 of duplicates (default 0.6)",
+                        "name": "minSimilarity",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.DuplicateGroup"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/geohash/neighbors/{hash}": {
+            "get": {
+                "description": "Returns the eight geohash cells surrounding a geohash at the same precision",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Get the neighbors of a geohash",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Geohash",
+                        "name": "hash",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "neighbors found",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.GeohashNeighbors"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/import": {
+            "post": {
+                "description": "Upserts a location for every Point feature of a FeatureCollection by id, the name comes from the name property, and reports the outcome of each feature",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Import locations from GeoJSON",
+                "parameters": [
+                    {
+                        "description": "FeatureCollection of Point features",
+                        "name": "features",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.GeoJSONFeatureCollection"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.ImportReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/import/csv": {
+            "post": {
+                "description": "Streams a CSV upload and upserts a location by id for every row, keeping the fields of existing locations whose columns are unmapped or empty, and reporting rejected rows",
+                "consumes": [
+                    "text/csv"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Import locations from CSV",
+                "parameters": [
+                    {
+                        "description": "CSV rows",
+                        "name": "file",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Field to column mapping such as id=site_id,name=Site Name,latitude=3, fields are id, name, latitude, longitude, coordinates, street, locality, region, postalCode, countryCode and privacy",
+                        "name": "mapping",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Whether the first row is a header: auto (default), true or false",
+                        "name": "header",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Column delimiter, a single character or tab (default ,)",
+                        "name": "delimiter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Validate the rows without writing them",
+                        "name": "dryRun",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Report format: json (default) or csv to download the rejected rows",
+                        "name": "report",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.ImportReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/import/gpx": {
+            "post": {
+                "description": "Upserts a location for every GPX waypoint and reports the outcome of each waypoint. Existing locations keep the address, privacy level and other fields the waypoint does not carry",
+                "consumes": [
+                    "application/gpx+xml"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Import locations from GPX",
+                "parameters": [
+                    {
+                        "description": "GPX document",
+                        "name": "file",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.ImportReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/import/kml": {
+            "post": {
+                "description": "Upserts a location for every Point placemark, using the placemark id attribute as the location id, and reports the outcome of each placemark. Existing locations keep the address, privacy level and other fields the placemark does not carry",
+                "consumes": [
+                    "application/vnd.google-earth.kml+xml"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Import locations from KML",
+                "parameters": [
+                    {
+                        "description": "KML document",
+                        "name": "file",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.ImportReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/merge": {
+            "post": {
+                "description": "Keeps the target location, points every community and membership that embeds or references a source location at the target and deletes the sources",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Merge duplicate locations",
+                "parameters": [
+                    {
+                        "description": "Location to keep and duplicates to merge into it",
+                        "name": "merge",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.LocationMergeRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, a private target is obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.LocationMergeResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/nearest": {
+            "get": {
+                "description": "Returns the k closest locations from the in-process spatial index, using the database until the index is loaded",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Get the nearest locations to a point",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "Latitude",
+                        "name": "lat",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Longitude",
+                        "name": "lng",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of locations to return (default 5)",
+                        "name": "k",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Only return locations within this many meters",
+                        "name": "maxDistance",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return locations whose geohash starts with this prefix",
+                        "name": "geohash",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return locations whose name contains this text",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.NearestLocation"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/search": {
+            "get": {
+                "description": "Fuzzy, accent-insensitive name search with prefix autocomplete, optionally including gazetteer places and biased toward a point",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Search locations by name",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search text",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of results (default 10)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also search the offline gazetteer",
+                        "name": "includeGazetteer",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Latitude to bias results toward",
+                        "name": "lat",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Longitude to bias results toward",
+                        "name": "lng",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.SearchResult"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/location/{id}": {
+            "get": {
+                "description": "Retrieves a location from the MongoDB collection by its ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Get a location by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are obfuscated without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633",
+                        "name": "crs",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "location found",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Location"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Updates a location name, and its address, privacy and elevation when they are given, in the MongoDB collection by its ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Update a location by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated location data",
+                        "name": "updateData",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Location"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633",
+                        "name": "crs",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "location updated",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Location"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a location from the MongoDB collection by its ID",
+                "tags": [
+                    "locations"
+                ],
+                "summary": "Delete a location by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Int",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/membership": {
+            "get": {
+                "description": "Retrieves all membership from the MongoDB collection",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "membership"
+                ],
+                "summary": "Get all membership",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.Membership"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a new membership and adds it to the MongoDB collection",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "membership"
+                ],
+                "summary": "Create a new membership",
+                "parameters": [
+                    {
+                        "description": "Membership object to be created",
+                        "name": "Membership",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Membership"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "membership created",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Membership"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/membership/{id}": {
+            "get": {
+                "description": "Retrieves a membership from the MongoDB collection by its ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "membership"
+                ],
+                "summary": "Get a membership by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "membership found",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Membership"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Updates a membership role in the MongoDB collection by its ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "membership"
+                ],
+                "summary": "Update a membership by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated Membership data",
+                        "name": "updateData",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Membership"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Membership updated",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Membership"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a location from the MongoDB collection by its ID",
+                "tags": [
+                    "membership"
+                ],
+                "summary": "Delete a membership by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Int",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/membership/{id}/geofence-events": {
+            "get": {
+                "description": "Returns the enter, exit and dwell events of a member, newest first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "geofence"
+                ],
+                "summary": "Get the geofence events of a member",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Member ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return events of this type: enter, exit or dwell",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return events at or after this time (RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only return events at or before this time (RFC 3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of events (default 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.GeofenceEvent"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/membership/{id}/track": {
+            "get": {
+                "description": "Returns the positions of a member between two times in chronological order",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "positions"
+                ],
+                "summary": "Get the track of a member",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Member ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start time (RFC 3339), defaults to 24 hours ago",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End time (RFC 3339), defaults to now",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of positions",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.TrackedPosition"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/positions": {
+            "post": {
+                "description": "Stores one position or a batch of member positions in the positions time series collection",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "positions"
+                ],
+                "summary": "Ingest tracked positions",
+                "parameters": [
+                    {
+                        "description": "Position or array of positions",
+                        "name": "positions",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.TrackedPosition"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "positions stored",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.PositionIngestResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/positions/latest": {
+            "get": {
+                "description": "Returns the most recent position of each member, optionally limited to the given member IDs",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "positions"
+                ],
+                "summary": "Get the latest position of members",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Member IDs",
+                        "name": "memberId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.TrackedPosition"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/tiles/{layer}/{z}/{x}/{y}.mvt": {
+            "get": {
+                "description": "Encodes locations as points or community boundaries as polygons into a Mapbox Vector Tile",
+                "produces": [
+                    "application/vnd.mapbox-vector-tile"
+                ],
+                "tags": [
+                    "tiles"
+                ],
+                "summary": "Get a Mapbox Vector Tile",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Layer name (locations or communities)",
+                        "name": "layer",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Zoom level",
+                        "name": "z",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Tile column",
+                        "name": "x",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Tile row",
+                        "name": "y",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Privileged API key, private locations are placed by their obfuscated position without one",
+                        "name": "X-API-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "vector tile",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "204": {
+                        "description": "Empty tile"
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/tracks": {
+            "get": {
+                "description": "Retrieves track summaries without their points, optionally for one community",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tracks"
+                ],
+                "summary": "Get tracks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only return tracks of this community",
+                        "name": "communityId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/geolocationapi.Track"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Stores a community track uploaded as GPX or as a GeoJSON LineString and computes its distance, elevation gain and duration",
+                "consumes": [
+                    "application/json",
+                    "application/gpx+xml"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tracks"
+                ],
+                "summary": "Upload a track",
+                "parameters": [
+                    {
+                        "description": "GeoJSON LineString feature or GPX document",
+                        "name": "track",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.GeoJSONFeature"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Track ID, generated when missing",
+                        "name": "id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Track name, overrides the name in the upload",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Owning community ID, required unless the GeoJSON properties have it",
+                        "name": "communityId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "track created",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Track"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/geolocationapi/tracks/{id}": {
+            "get": {
+                "description": "Retrieves a track, optionally simplified, as JSON or exported to GeoJSON, GPX or KML",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/geo+json",
+                    "application/gpx+xml",
+                    "application/vnd.google-earth.kml+xml"
+                ],
+                "tags": [
+                    "tracks"
+                ],
+                "summary": "Get a track by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Simplification tolerance in meters",
+                        "name": "simplify",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Simplification algorithm: douglas-peucker (default) or visvalingam",
+                        "name": "algorithm",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Export format: geojson, gpx or kml",
+                        "name": "export",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/geolocationapi.Track"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a track from the MongoDB collection by its ID",
+                "tags": [
+                    "tracks"
+                ],
+                "summary": "Delete a track by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthcheck": {
+            "get": {
+                "description": "Get a simple healthcheck message",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "healthcheck"
+                ],
+                "summary": "Get a healthcheck message",
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/hello": {
+            "get": {
+                "description": "Get a simple hello message",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "hello"
+                ],
+                "summary": "Get a hello message",
+                "responses": {
+                    "200": {
+                        "description": "Hello, world!",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "geolocationapi.Address": {
+            "type": "object",
+            "properties": {
+                "countryCode": {
+                    "description": "CountryCode is an ISO 3166-1 alpha-2 code",
+                    "type": "string"
+                },
+                "locality": {
+                    "type": "string"
+                },
+                "postalCode": {
+                    "type": "string"
+                },
+                "region": {
+                    "type": "string"
+                },
+                "street": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.AdminRegion": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.BoundingBox": {
+            "type": "object",
+            "properties": {
+                "maxLat": {
+                    "type": "number"
+                },
+                "maxLng": {
+                    "type": "number"
+                },
+                "minLat": {
+                    "type": "number"
+                },
+                "minLng": {
+                    "type": "number"
+                }
+            }
+        },
+        "geolocationapi.Community": {
+            "type": "object",
+            "properties": {
+                "boundary": {
+                    "description": "Boundary is the optional area of the community",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/geolocationapi.Polygon"
+                        }
+                    ]
+                },
+                "geofenceRadius": {
+                    "description": "GeofenceRadius in meters around Location is used as the geofence when there is no boundary",
+                    "type": "number"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "location": {
+                    "$ref": "#/definitions/geolocationapi.Location"
+                },
+                "members": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/geolocationapi.Membership"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "roleLimits": {
+                    "description": "RoleLimits optionally caps how many members may hold each role, unfilled seats are vacancies",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "geolocationapi.CommunityLocations": {
+            "type": "object",
+            "properties": {
+                "communityId": {
+                    "type": "string"
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "locationIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "radius": {
+                    "type": "number"
+                },
+                "zone": {
+                    "description": "Zone is boundary, or radius when the community has no boundary and Radius meters around its location is used",
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.CommunityRecommendation": {
+            "type": "object",
+            "properties": {
+                "community": {
+                    "$ref": "#/definitions/geolocationapi.Community"
+                },
+                "distance": {
+                    "type": "number"
+                },
+                "members": {
+                    "type": "integer"
+                },
+                "score": {
+                    "type": "number"
+                },
+                "vacancies": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "geolocationapi.CommunitySpatialStats": {
+            "type": "object",
+            "properties": {
+                "averageDistance": {
+                    "description": "AverageDistance is the mean distance in meters between the community location and the home locations",
+                    "type": "number"
+                },
+                "boundingBox": {
+                    "description": "BoundingBox has a west edge greater than the east edge when it crosses the antimeridian",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/geolocationapi.BoundingBox"
+                        }
+                    ]
+                },
+                "centroid": {
+                    "description": "Centroid is the spherical mean of the home locations",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/geolocationapi.LatLng"
+                        }
+                    ]
+                },
+                "communityId": {
+                    "type": "string"
+                },
+                "computedAt": {
+                    "type": "string"
+                },
+                "convexHull": {
+                    "description": "ConvexHull is omitted when fewer than three home locations are distinct and not collinear",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/geolocationapi.Polygon"
+                        }
+                    ]
+                },
+                "farthestMember": {
+                    "$ref": "#/definitions/geolocationapi.MemberDistance"
+                },
+                "locatedMembers": {
+                    "type": "integer"
+                },
+                "members": {
+                    "description": "Members counts every membership, LocatedMembers those with a home location that exists",
+                    "type": "integer"
+                }
+            }
+        },
+        "geolocationapi.DuplicateGroup": {
+            "type": "object",
+            "properties": {
+                "locations": {
+                    "description": "Locations are ordered with the suggested location first",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/geolocationapi.Location"
+                    }
+                },
+                "maxDistance": {
+                    "description": "MaxDistance is the largest distance in meters and MinSimilarity the lowest name similarity\nof the pairs that linked the group",
+                    "type": "number"
+                },
+                "minSimilarity": {
+                    "type": "number"
+                },
+                "suggestedId": {
+                    "description": "SuggestedID is the location linked to most others in the group, a natural merge target",
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.ElevationPoint": {
+            "type": "object",
+            "properties": {
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                }
+            }
+        },
+        "geolocationapi.ElevationResult": {
+            "type": "object",
+            "properties": {
+                "elevation": {
+                    "type": "number"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                },
+                "source": {
+                    "description": "Source is the tile file the elevation was read from",
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.GazetteerPlace": {
+            "type": "object",
+            "properties": {
+                "admin1Code": {
+                    "type": "string"
+                },
+                "admin2Code": {
+                    "type": "string"
+                },
+                "alternateNames": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "asciiName": {
+                    "type": "string"
+                },
+                "countryCode": {
+                    "type": "string"
+                },
+                "featureClass": {
+                    "type": "string"
+                },
+                "featureCode": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "population": {
+                    "type": "integer"
+                },
+                "timeZone": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.GeoJSONFeature": {
+            "type": "object",
+            "properties": {
+                "geometry": {
+                    "$ref": "#/definitions/geolocationapi.GeoJSONGeometry"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "properties": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.GeoJSONFeatureCollection": {
+            "type": "object",
+            "properties": {
+                "features": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/geolocationapi.GeoJSONFeature"
+                    }
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.GeoJSONGeometry": {
+            "type": "object",
+            "properties": {
+                "coordinates": {
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.GeofenceEvent": {
+            "type": "object",
+            "properties": {
+                "communityId": {
+                    "type": "string"
+                },
+                "detectedAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                },
+                "memberId": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "description": "Timestamp is when the member crossed the geofence, DetectedAt is when the crossing was confirmed",
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.GeohashNeighbors": {
+            "type": "object",
+            "properties": {
+                "e": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "n": {
+                    "type": "string"
+                },
+                "ne": {
+                    "type": "string"
+                },
+                "nw": {
+                    "type": "string"
+                },
+                "s": {
+                    "type": "string"
+                },
+                "se": {
+                    "type": "string"
+                },
+                "sw": {
+                    "type": "string"
+                },
+                "w": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.Heatmap": {
+            "type": "object",
+            "properties": {
+                "cells": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/geolocationapi.HeatmapCell"
+                    }
+                },
+                "grid": {
+                    "type": "string"
+                },
+                "maxCount": {
+                    "type": "integer"
+                },
+                "resolution": {
+                    "description": "Resolution is the cell size in meters at the centre of the box",
+                    "type": "number"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "geolocationapi.HeatmapCell": {
+            "type": "object",
+            "properties": {
+                "boundary": {
+                    "type": "array",
+                    "items": {
+                        "type": "array",
+                        "items": {
+                            "type": "number"
+                        }
+                    }
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                }
+            }
+        },
+        "geolocationapi.ImportReport": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/geolocationapi.ImportResult"
+                    }
+                },
+                "truncated": {
+                    "description": "Truncated is set when there were more results than the report keeps",
+                    "type": "boolean"
+                },
+                "updated": {
+                    "type": "integer"
+                },
+                "valid": {
+                    "type": "integer"
+                }
+            }
+        },
+        "geolocationapi.ImportResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.LatLng": {
             "type": "object",
             "properties": {
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                }
+            }
+        },
+        "geolocationapi.Location": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "description": "Address is the optional structured postal address, normalized on write",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/geolocationapi.Address"
+                        }
+                    ]
+                },
+                "coordinates": {
+                    "description": "Coordinates accepts a pair in any supported input format, a bare geohash needs at least five\ncharacters, and holds the ?format= rendering in responses",
+                    "type": "string"
+                },
+                "crs": {
+                    "description": "CRS names the ?crs= system of a response, whose longitude holds x and latitude holds y",
+                    "type": "string"
+                },
+                "description": {
+                    "description": "Description is free text carried over from KML and GPX files",
+                    "type": "string"
+                },
+                "elevation": {
+                    "description": "Elevation in meters above sea level is looked up on write from the elevation tiles when not given",
+                    "type": "number"
+                },
+                "geohash": {
+                    "description": "Geohash is computed on write with the configured precision",
+                    "type": "string"
+                },
                 "id": {
                     "type": "string"
                 },
@@ -727,6 +3489,116 @@ const docTemplate = `{
                 },
                 "name": {
                     "type": "string"
+                },
+                "privacy": {
+                    "description": "Privacy is exact (the default), neighborhood or city, callers without elevated rights only see\nthe position of neighborhood and city locations blurred to that level",
+                    "type": "string"
+                },
+                "timeZone": {
+                    "description": "TimeZone is the IANA time zone of the position, resolved on write from the time zone boundaries",
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.LocationCluster": {
+            "type": "object",
+            "properties": {
+                "bbox": {
+                    "$ref": "#/definitions/geolocationapi.BoundingBox"
+                },
+                "count": {
+                    "type": "integer"
+                },
+                "ids": {
+                    "description": "IDs is only filled for clusters up to Clustering.SmallClusterSize locations",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                }
+            }
+        },
+        "geolocationapi.LocationJoinReport": {
+            "type": "object",
+            "properties": {
+                "assigned": {
+                    "type": "integer"
+                },
+                "communities": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/geolocationapi.CommunityLocations"
+                    }
+                },
+                "generatedAt": {
+                    "type": "string"
+                },
+                "locations": {
+                    "type": "integer"
+                },
+                "unassigned": {
+                    "$ref": "#/definitions/geolocationapi.UnassignedLocations"
+                }
+            }
+        },
+        "geolocationapi.LocationMergeRequest": {
+            "type": "object",
+            "properties": {
+                "sourceIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "targetId": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.LocationMergeResult": {
+            "type": "object",
+            "properties": {
+                "communitiesUpdated": {
+                    "type": "integer"
+                },
+                "location": {
+                    "$ref": "#/definitions/geolocationapi.Location"
+                },
+                "membershipsUpdated": {
+                    "type": "integer"
+                },
+                "removed": {
+                    "description": "Removed lists the source locations that existed and were deleted",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "geolocationapi.MemberDistance": {
+            "type": "object",
+            "properties": {
+                "distance": {
+                    "type": "number"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "locationId": {
+                    "type": "string"
+                },
+                "longitude": {
+                    "type": "number"
+                },
+                "memberId": {
+                    "type": "string"
                 }
             }
         },
@@ -736,6 +3608,10 @@ const docTemplate = `{
                 "communityId": {
                     "type": "string"
                 },
+                "homeLocationId": {
+                    "description": "HomeLocationID optionally references the Location the member lives at",
+                    "type": "string"
+                },
                 "id": {
                     "type": "string"
                 },
@@ -743,6 +3619,243 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "geolocationapi.NearestLocation": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "description": "Address is the optional structured postal address, normalized on write",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/geolocationapi.Address"
+                        }
+                    ]
+                },
+                "coordinates": {
+                    "description": "Coordinates accepts a pair in any supported input format, a bare geohash needs at least five\ncharacters, and holds the ?format= rendering in responses",
+                    "type": "string"
+                },
+                "crs": {
+                    "description": "CRS names the ?crs= system of a response, whose longitude holds x and latitude holds y",
+                    "type": "string"
+                },
+                "description": {
+                    "description": "Description is free text carried over from KML and GPX files",
+                    "type": "string"
+                },
+                "distance": {
+                    "type": "number"
+                },
+                "elevation": {
+                    "description": "Elevation in meters above sea level is looked up on write from the elevation tiles when not given",
+                    "type": "number"
+                },
+                "geohash": {
+                    "description": "Geohash is computed on write with the configured precision",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "privacy": {
+                    "description": "Privacy is exact (the default), neighborhood or city, callers without elevated rights only see\nthe position of neighborhood and city locations blurred to that level",
+                    "type": "string"
+                },
+                "timeZone": {
+                    "description": "TimeZone is the IANA time zone of the position, resolved on write from the time zone boundaries",
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.Polygon": {
+            "type": "object",
+            "properties": {
+                "coordinates": {
+                    "type": "array",
+                    "items": {
+                        "type": "array",
+                        "items": {
+                            "type": "array",
+                            "items": {
+                                "type": "number"
+                            }
+                        }
+                    }
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.PositionIngestResult": {
+            "type": "object",
+            "properties": {
+                "inserted": {
+                    "type": "integer"
+                }
+            }
+        },
+        "geolocationapi.ReverseGeocodeResult": {
+            "type": "object",
+            "properties": {
+                "admin1": {
+                    "$ref": "#/definitions/geolocationapi.AdminRegion"
+                },
+                "admin2": {
+                    "$ref": "#/definitions/geolocationapi.AdminRegion"
+                },
+                "country": {
+                    "$ref": "#/definitions/geolocationapi.AdminRegion"
+                },
+                "distance": {
+                    "type": "number"
+                },
+                "place": {
+                    "$ref": "#/definitions/geolocationapi.GazetteerPlace"
+                }
+            }
+        },
+        "geolocationapi.SearchResult": {
+            "type": "object",
+            "properties": {
+                "distance": {
+                    "type": "number"
+                },
+                "location": {
+                    "$ref": "#/definitions/geolocationapi.Location"
+                },
+                "place": {
+                    "$ref": "#/definitions/geolocationapi.GazetteerPlace"
+                },
+                "score": {
+                    "type": "number"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.TimeZoneResult": {
+            "type": "object",
+            "properties": {
+                "abbreviation": {
+                    "type": "string"
+                },
+                "dst": {
+                    "type": "boolean"
+                },
+                "localTime": {
+                    "type": "string"
+                },
+                "timeZone": {
+                    "type": "string"
+                },
+                "utcOffset": {
+                    "type": "string"
+                },
+                "utcOffsetSeconds": {
+                    "type": "integer"
+                }
+            }
+        },
+        "geolocationapi.Track": {
+            "type": "object",
+            "properties": {
+                "communityId": {
+                    "type": "string"
+                },
+                "distance": {
+                    "description": "Distance in meters, elevation gain in meters and duration in seconds are computed on upload\nfrom the full resolution points",
+                    "type": "number"
+                },
+                "duration": {
+                    "type": "number"
+                },
+                "elevationGain": {
+                    "type": "number"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "points": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/geolocationapi.TrackPoint"
+                    }
+                }
+            }
+        },
+        "geolocationapi.TrackPoint": {
+            "type": "object",
+            "properties": {
+                "elevation": {
+                    "type": "number"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.TrackedPosition": {
+            "type": "object",
+            "properties": {
+                "accuracy": {
+                    "type": "number"
+                },
+                "altitude": {
+                    "type": "number"
+                },
+                "heading": {
+                    "type": "number"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                },
+                "memberId": {
+                    "type": "string"
+                },
+                "speed": {
+                    "type": "number"
+                },
+                "timestamp": {
+                    "type": "string"
+                }
+            }
+        },
+        "geolocationapi.UnassignedLocations": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "locationIds": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,255 @@
+package geolocationapi
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Address is the optional structured postal address of a location
+type Address struct {
+	Street     string `json:"street,omitempty" bson:"street,omitempty"`
+	Locality   string `json:"locality,omitempty" bson:"locality,omitempty"`
+	Region     string `json:"region,omitempty" bson:"region,omitempty"`
+	PostalCode string `json:"postalCode,omitempty" bson:"postalcode,omitempty"`
+	// CountryCode is an ISO 3166-1 alpha-2 code
+	CountryCode string `json:"countryCode,omitempty" bson:"countrycode,omitempty"`
+}
+
+// isoCountryCodes holds every assigned ISO 3166-1 alpha-2 code
+var isoCountryCodes = func() map[string]bool {
+	codes := map[string]bool{}
+	for _, code := range strings.Fields(`
+		AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS
+		BT BV BW BY BZ CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE
+		EG EH ER ES ET FI FJ FK FM FO FR GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM
+		HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN KP KR KW KY KZ LA LB LC
+		LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ NA
+		NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS RU RW
+		SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO
+		TR TT TV TW TZ UA UG UM US UY UZ VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW`) {
+		codes[code] = true
+	}
+	return codes
+}()
+
+// postalCodeFormat validates the postal codes of one country, the pattern runs on the upper-cased
+// code with spaces and dashes removed and format rebuilds the canonical spelling from its groups
+type postalCodeFormat struct {
+	pattern *regexp.Regexp
+	format  func(groups []string) string
+}
+
+// joinPostalGroups writes the pattern groups separated by sep
+func joinPostalGroups(sep string) func(groups []string) string {
+	return func(groups []string) string { return strings.Join(groups[1:], sep) }
+}
+
+// postalCodeFormats covers the countries whose postal codes have a fixed shape, codes of other
+// countries are only upper-cased and trimmed
+var postalCodeFormats = map[string]postalCodeFormat{
+	"US": {regexp.MustCompile(`^(\d{5})(\d{4})?$`), func(g []string) string {
+		if g[2] == "" {
+			return g[1]
+		}
+		return g[1] + "-" + g[2]
+	}},
+	"CA": {regexp.MustCompile(`^([ABCEGHJ-NPRSTVXY]\d[A-Z])(\d[A-Z]\d)$`), joinPostalGroups(" ")},
+	"GB": {regexp.MustCompile(`^([A-Z]{1,2}\d[A-Z\d]?)(\d[A-Z]{2})$`), joinPostalGroups(" ")},
+	"IE": {regexp.MustCompile(`^([AC-FHKNPRTV-Y]\d{2}|D6W)([0-9AC-FHKNPRTV-Y]{4})$`), joinPostalGroups(" ")},
+	"NL": {regexp.MustCompile(`^([1-9]\d{3})([A-Z]{2})$`), joinPostalGroups(" ")},
+	"SE": {regexp.MustCompile(`^(\d{3})(\d{2})$`), joinPostalGroups(" ")},
+	"CZ": {regexp.MustCompile(`^(\d{3})(\d{2})$`), joinPostalGroups(" ")},
+	"SK": {regexp.MustCompile(`^(\d{3})(\d{2})$`), joinPostalGroups(" ")},
+	"GR": {regexp.MustCompile(`^(\d{3})(\d{2})$`), joinPostalGroups(" ")},
+	"PL": {regexp.MustCompile(`^(\d{2})(\d{3})$`), joinPostalGroups("-")},
+	"PT": {regexp.MustCompile(`^(\d{4})(\d{3})$`), joinPostalGroups("-")},
+	"JP": {regexp.MustCompile(`^(\d{3})(\d{4})$`), joinPostalGroups("-")},
+	"BR": {regexp.MustCompile(`^(\d{5})(\d{3})$`), joinPostalGroups("-")},
+	"DE": {regexp.MustCompile(`^(\d{5})$`), joinPostalGroups("")},
+	"FR": {regexp.MustCompile(`^(\d{5})$`), joinPostalGroups("")},
+	"IT": {regexp.MustCompile(`^(\d{5})$`), joinPostalGroups("")},
+	"ES": {regexp.MustCompile(`^(\d{5})$`), joinPostalGroups("")},
+	"FI": {regexp.MustCompile(`^(\d{5})$`), joinPostalGroups("")},
+	"MX": {regexp.MustCompile(`^(\d{5})$`), joinPostalGroups("")},
+	"AU": {regexp.MustCompile(`^(\d{4})$`), joinPostalGroups("")},
+	"AT": {regexp.MustCompile(`^(\d{4})$`), joinPostalGroups("")},
+	"BE": {regexp.MustCompile(`^(\d{4})$`), joinPostalGroups("")},
+	"CH": {regexp.MustCompile(`^(\d{4})$`), joinPostalGroups("")},
+	"DK": {regexp.MustCompile(`^(\d{4})$`), joinPostalGroups("")},
+	"NO": {regexp.MustCompile(`^(\d{4})$`), joinPostalGroups("")},
+	"NZ": {regexp.MustCompile(`^(\d{4})$`), joinPostalGroups("")},
+	"ZA": {regexp.MustCompile(`^(\d{4})$`), joinPostalGroups("")},
+	"IN": {regexp.MustCompile(`^([1-9]\d{5})$`), joinPostalGroups("")},
+	"CN": {regexp.MustCompile(`^(\d{6})$`), joinPostalGroups("")},
+	"RU": {regexp.MustCompile(`^(\d{6})$`), joinPostalGroups("")},
+	"SG": {regexp.MustCompile(`^(\d{6})$`), joinPostalGroups("")},
+}
+
+// postalCodeSeparators are removed before a postal code is matched against its country's pattern
+var postalCodeSeparators = strings.NewReplacer(" ", "", "-", "")
+
+// streetAbbreviations expands the street types and directions forms commonly abbreviate
+var streetAbbreviations = map[string]string{
+	"st": "Street", "str": "Street", "ave": "Avenue", "av": "Avenue", "rd": "Road", "blvd": "Boulevard",
+	"dr": "Drive", "ln": "Lane", "ct": "Court", "pl": "Place", "sq": "Square", "hwy": "Highway",
+	"pkwy": "Parkway", "ter": "Terrace", "cres": "Crescent", "cir": "Circle", "trl": "Trail", "hts": "Heights",
+	"n": "North", "s": "South", "e": "East", "w": "West", "ne": "Northeast", "nw": "Northwest",
+	"se": "Southeast", "sw": "Southwest",
+}
+
+// streetDirections are the abbreviations that may also start a street, the others only end it
+var streetDirections = map[string]bool{"n": true, "s": true, "e": true, "w": true, "ne": true, "nw": true, "se": true, "sw": true}
+
+// normalizeAddress tidies the spelling of an address in place and validates its country and postal code
+func normalizeAddress(a *Address) error {
+	a.Street = normalizeStreet(a.Street)
+	a.Locality = normalizeAddressWords(a.Locality)
+	// Region codes such as NY or QLD are written in capitals, ny is taken as a code but Uri is not
+	region := strings.TrimSpace(a.Region)
+	if len(region) == 2 || len(region) == 3 && region == strings.ToUpper(region) {
+		a.Region = strings.ToUpper(region)
+	} else {
+		a.Region = normalizeAddressWords(region)
+	}
+
+	a.CountryCode = strings.ToUpper(strings.TrimSpace(a.CountryCode))
+	if a.CountryCode != "" && !isoCountryCodes[a.CountryCode] {
+		return fmt.Errorf("unknown ISO 3166-1 alpha-2 country code %q", a.CountryCode)
+	}
+
+	postalCode, err := normalizePostalCode(a.PostalCode, a.CountryCode)
+	if err != nil {
+		return err
+	}
+	a.PostalCode = postalCode
+	return nil
+}
+
+// normalizePostalCode upper-cases a postal code and rewrites it in its country's canonical form
+func normalizePostalCode(code, countryCode string) (string, error) {
+	code = strings.ToUpper(strings.Join(strings.Fields(code), " "))
+	if code == "" {
+		return "", nil
+	}
+	format, ok := postalCodeFormats[countryCode]
+	if !ok {
+		return code, nil
+	}
+	groups := format.pattern.FindStringSubmatch(postalCodeSeparators.Replace(code))
+	if groups == nil {
+		return "", fmt.Errorf("postal code %q is not valid in %s", code, countryCode)
+	}
+	return format.format(groups), nil
+}
+
+// normalizeStreet collapses spaces, fixes the casing and expands abbreviated street types and directions
+func normalizeStreet(street string) string {
+	words := strings.Fields(normalizeAddressWords(street))
+	keys := make([]string, len(words))
+	first := -1
+	for i, word := range words {
+		keys[i] = strings.ToLower(strings.TrimRight(word, "."))
+		if first < 0 && strings.IndexFunc(word, unicode.IsDigit) < 0 {
+			first = i
+		}
+	}
+	last := len(words) - 1
+	for i, key := range keys {
+		expanded, ok := streetAbbreviations[key]
+		if !ok || i == first && i == last {
+			continue
+		}
+		// A direction leads or ends the street name, a street type ends it or comes before a final
+		// direction, so "St Mary St" keeps its leading Saint
+		if streetDirections[key] && (i == first || i == last) ||
+			!streetDirections[key] && (i == last || i == last-1 && streetDirections[keys[last]]) {
+			words[i] = expanded
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// normalizeAddressWords collapses spaces and capitalizes words typed entirely in upper or lower case,
+// mixed case such as McDonald is kept as written
+func normalizeAddressWords(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		if word != strings.ToUpper(word) && word != strings.ToLower(word) {
+			continue
+		}
+		// Words with digits are house numbers, units or ordinals: 12B and A1 in capitals, 1st in lower case
+		if strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+			if isOrdinal(strings.ToLower(word)) {
+				words[i] = strings.ToLower(word)
+			} else {
+				words[i] = strings.ToUpper(word)
+			}
+			continue
+		}
+		runes := []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// isOrdinal reports whether a lower-case word is a number with an English ordinal suffix such as 1st or 22nd
+func isOrdinal(word string) bool {
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		number := strings.TrimSuffix(word, suffix)
+		if number != word && number != "" && strings.Trim(number, "0123456789") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// addressFilter builds a query on the address fields from the street, locality, region, postalCode
+// and countryCode query parameters: street matches part of the street, locality and region match the
+// whole value ignoring case and postalCode matches a prefix of the normalized code
+func addressFilter(query url.Values) (bson.M, error) {
+	filter := bson.M{}
+	if value := strings.TrimSpace(query.Get("countryCode")); value != "" {
+		code := strings.ToUpper(value)
+		if !isoCountryCodes[code] {
+			return nil, fmt.Errorf("unknown ISO 3166-1 alpha-2 country code %q", value)
+		}
+		filter["address.countrycode"] = code
+	}
+	if value := strings.TrimSpace(query.Get("postalCode")); value != "" {
+		// A complete code is normalized like stored codes, a partial one is compared as typed
+		code, err := normalizePostalCode(value, strings.ToUpper(query.Get("countryCode")))
+		if err != nil {
+			code = strings.ToUpper(strings.Join(strings.Fields(value), " "))
+		}
+		filter["address.postalcode"] = bson.M{"$regex": "^" + regexp.QuoteMeta(code)}
+	}
+	if value := strings.TrimSpace(query.Get("street")); value != "" {
+		filter["address.street"] = bson.M{"$regex": regexp.QuoteMeta(normalizeStreet(value)), "$options": "i"}
+	}
+	for param, field := range map[string]string{"locality": "address.locality", "region": "address.region"} {
+		if value := strings.TrimSpace(query.Get(param)); value != "" {
+			filter[field] = bson.M{"$regex": "^" + regexp.QuoteMeta(strings.Join(strings.Fields(value), " ")) + "$", "$options": "i"}
+		}
+	}
+	return filter, nil
+}
+
+// validateLocationAddress normalizes the address of a location, an empty address is dropped
+func validateLocationAddress(l *Location) error {
+	if l.Address == nil {
+		return nil
+	}
+	if err := normalizeAddress(l.Address); err != nil {
+		return err
+	}
+	if *l.Address == (Address{}) {
+		l.Address = nil
+	}
+	return nil
+}
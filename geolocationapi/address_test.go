@@ -0,0 +1,115 @@
+package geolocationapi
+
+import "testing"
+
+func TestNormalizeStreet(t *testing.T) {
+	tests := []struct {
+		name, street, want string
+	}{
+		{"empty", "", ""},
+		{"street type", "123 main st", "123 Main Street"},
+		{"leading saint is kept", "St Mary St", "St Mary Street"},
+		{"saint inside the name is kept", "Rue St Denis", "Rue St Denis"},
+		{"lone abbreviation is the name", "st", "St"},
+		{"leading direction", "100 N Main St", "100 North Main Street"},
+		{"street type before a final direction", "1600 pennsylvania ave nw", "1600 Pennsylvania Avenue Northwest"},
+		{"ordinal and trailing dots", "42 W. 23RD ST.", "42 West 23rd Street"},
+		{"unit and house number", "unit 4b  12 high st", "Unit 4B 12 High Street"},
+		{"mixed case is kept", "12 McDonald Blvd", "12 McDonald Boulevard"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeStreet(tt.street); got != tt.want {
+				t.Errorf("normalizeStreet(%q) = %q, want %q", tt.street, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAddressWords(t *testing.T) {
+	tests := []struct {
+		name, words, want string
+	}{
+		{"empty", "", ""},
+		{"upper case", "NEW YORK", "New York"},
+		{"lower case and spaces", "  san   francisco ", "San Francisco"},
+		{"mixed case is kept", "McAllen", "McAllen"},
+		{"non-ASCII", "ÉCOLE", "École"},
+		{"ordinals", "1ST 2nd 33RD 4TH", "1st 2nd 33rd 4th"},
+		{"house numbers and units", "12b a1", "12B A1"},
+		{"number that is not an ordinal", "1stb", "1STB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeAddressWords(tt.words); got != tt.want {
+				t.Errorf("normalizeAddressWords(%q) = %q, want %q", tt.words, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizePostalCode(t *testing.T) {
+	tests := []struct {
+		name, code, countryCode, want string
+		wantErr                       bool
+	}{
+		{"empty", "  ", "DE", "", false},
+		{"unknown country is upper-cased", " abc   123 ", "", "ABC 123", false},
+		{"country without a format", "ab-12", "LU", "AB-12", false},
+		{"US ZIP", "12345", "US", "12345", false},
+		{"US ZIP+4", "123456789", "US", "12345-6789", false},
+		{"US too short", "1234", "US", "", true},
+		{"GB", "sw1a1aa", "GB", "SW1A 1AA", false},
+		{"CA", "k1a 0b1", "CA", "K1A 0B1", false},
+		{"CA letter D is not used", "d1a 0b1", "CA", "", true},
+		{"IE Eircode", "d6w x123", "IE", "D6W X123", false},
+		{"NL", "1234ab", "NL", "1234 AB", false},
+		{"NL leading zero", "0123 AB", "NL", "", true},
+		{"PL", "00 950", "PL", "00-950", false},
+		{"JP", "1000001", "JP", "100-0001", false},
+		{"FR separators removed", "75 008", "FR", "75008", false},
+		{"DE letters", "1011A", "DE", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizePostalCode(tt.code, tt.countryCode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizePostalCode(%q, %q) error = %v, wantErr %v", tt.code, tt.countryCode, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizePostalCode(%q, %q) = %q, want %q", tt.code, tt.countryCode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address Address
+		want    Address
+		wantErr bool
+	}{
+		{"two-letter region code", Address{Region: "ny", CountryCode: "us"}, Address{Region: "NY", CountryCode: "US"}, false},
+		{"three-letter region code in capitals", Address{Region: "QLD", CountryCode: "AU"}, Address{Region: "QLD", CountryCode: "AU"}, false},
+		{"three lower-case letters are a name", Address{Region: "uri", CountryCode: "CH"}, Address{Region: "Uri", CountryCode: "CH"}, false},
+		{"three mixed-case letters are kept", Address{Region: "Uri", CountryCode: "CH"}, Address{Region: "Uri", CountryCode: "CH"}, false},
+		{"region name", Address{Region: "NEW SOUTH WALES", CountryCode: "AU"}, Address{Region: "New South Wales", CountryCode: "AU"}, false},
+		{"every field", Address{Street: "10 downing st", Locality: "LONDON", PostalCode: "sw1a2aa", CountryCode: " gb "},
+			Address{Street: "10 Downing Street", Locality: "London", PostalCode: "SW1A 2AA", CountryCode: "GB"}, false},
+		{"unknown country", Address{CountryCode: "XX"}, Address{}, true},
+		{"postal code invalid in the country", Address{PostalCode: "ABC", CountryCode: "DE"}, Address{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.address
+			err := normalizeAddress(&a)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && a != tt.want {
+				t.Errorf("normalizeAddress() = %+v, want %+v", a, tt.want)
+			}
+		})
+	}
+}
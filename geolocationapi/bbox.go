@@ -0,0 +1,111 @@
+package geolocationapi
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// BoundingBox is an area given as west, south, east and north edges in decimal degrees
+type BoundingBox struct {
+	MinLng float64 `json:"minLng"`
+	MinLat float64 `json:"minLat"`
+	MaxLng float64 `json:"maxLng"`
+	MaxLat float64 `json:"maxLat"`
+}
+
+// parseBBox parses a "minLng,minLat,maxLng,maxLat" query value,
+// a west edge greater than the east edge crosses the antimeridian
+func parseBBox(s string) (BoundingBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+	}
+
+	var values [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BoundingBox{}, errors.New("bbox values must be numbers")
+		}
+		values[i] = v
+	}
+
+	box := BoundingBox{MinLng: values[0], MinLat: values[1], MaxLng: values[2], MaxLat: values[3]}
+	if err := validateCoordinate(box.MinLat, true); err != nil {
+		return BoundingBox{}, err
+	}
+	if err := validateCoordinate(box.MaxLat, true); err != nil {
+		return BoundingBox{}, err
+	}
+	if err := validateCoordinate(box.MinLng, false); err != nil {
+		return BoundingBox{}, err
+	}
+	if err := validateCoordinate(box.MaxLng, false); err != nil {
+		return BoundingBox{}, err
+	}
+	if box.MinLat > box.MaxLat {
+		return BoundingBox{}, errors.New("bbox minLat must not be greater than maxLat")
+	}
+	return box, nil
+}
+
+// Contains reports whether a position lies inside the box
+func (b BoundingBox) Contains(lat, lng float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLng <= b.MaxLng {
+		return lng >= b.MinLng && lng <= b.MaxLng
+	}
+	return lng >= b.MinLng || lng <= b.MaxLng
+}
+
+// Extend grows the box to include a position
+func (b *BoundingBox) Extend(lat, lng float64) {
+	if lat < b.MinLat {
+		b.MinLat = lat
+	}
+	if lat > b.MaxLat {
+		b.MaxLat = lat
+	}
+	if lng < b.MinLng {
+		b.MinLng = lng
+	}
+	if lng > b.MaxLng {
+		b.MaxLng = lng
+	}
+}
+
+// Union grows the box to include another box
+func (b *BoundingBox) Union(other BoundingBox) {
+	b.Extend(other.MinLat, other.MinLng)
+	b.Extend(other.MaxLat, other.MaxLng)
+}
+
+// pointBBox returns a zero-size box around a position
+func pointBBox(lat, lng float64) BoundingBox {
+	return BoundingBox{MinLng: lng, MinLat: lat, MaxLng: lng, MaxLat: lat}
+}
+
+// radiusBBox returns a box around every position within radius meters, spanning all longitudes
+// when the circle reaches a pole or the antimeridian
+func radiusBBox(lat, lng, radius float64) BoundingBox {
+	return padBBox(pointBBox(lat, lng), radius)
+}
+
+// padBBox grows a box by meters on every side, spanning all longitudes when the grown box reaches a
+// pole or the antimeridian
+func padBBox(box BoundingBox, meters float64) BoundingBox {
+	dLat := meters / metersPerDegree
+	padded := BoundingBox{MinLat: math.Max(-90, box.MinLat-dLat), MaxLat: math.Min(90, box.MaxLat+dLat), MinLng: -180, MaxLng: 180}
+	if padded.MinLat > -90 && padded.MaxLat < 90 && box.MinLng <= box.MaxLng {
+		// The box is widest in longitude at its latitude furthest from the equator
+		dLng := meters / (metersPerDegree * math.Cos(math.Max(math.Abs(padded.MinLat), math.Abs(padded.MaxLat))*math.Pi/180))
+		if box.MinLng-dLng >= -180 && box.MaxLng+dLng <= 180 {
+			padded.MinLng, padded.MaxLng = box.MinLng-dLng, box.MaxLng+dLng
+		}
+	}
+	return padded
+}
@@ -0,0 +1,267 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"temprest/config"
+	"time"
+)
+
+// Clustering defaults used when the Clustering config section is missing
+const (
+	defaultClusterRadius           = 40
+	defaultClusterExtent           = 512
+	defaultClusterMaxZoom          = 16
+	defaultClusterSmallClusterSize = 10
+)
+
+// LocationCluster is a group of locations shown as one marker at a zoom level
+type LocationCluster struct {
+	Latitude  float64     `json:"latitude"`
+	Longitude float64     `json:"longitude"`
+	Count     int         `json:"count"`
+	BBox      BoundingBox `json:"bbox"`
+	// IDs is only filled for clusters up to Clustering.SmallClusterSize locations
+	IDs []string `json:"ids,omitempty"`
+}
+
+// clusterNode is a point or cluster in projected unit Web Mercator space
+type clusterNode struct {
+	x, y  float64
+	count int
+	bbox  BoundingBox
+	ids   []string
+}
+
+// clusterOptions configures the hierarchical clustering
+type clusterOptions struct {
+	radius           float64
+	extent           float64
+	minZoom          int
+	maxZoom          int
+	smallClusterSize int
+}
+
+// loadClusterOptions reads the clustering options from config
+func loadClusterOptions() clusterOptions {
+	opts := clusterOptions{
+		radius:           config.GetFloat64("Clustering.Radius"),
+		extent:           config.GetFloat64("Clustering.Extent"),
+		minZoom:          config.GetInt("Clustering.MinZoom"),
+		maxZoom:          config.GetInt("Clustering.MaxZoom"),
+		smallClusterSize: config.GetInt("Clustering.SmallClusterSize"),
+	}
+	if opts.radius <= 0 {
+		opts.radius = defaultClusterRadius
+	}
+	if opts.extent <= 0 {
+		opts.extent = defaultClusterExtent
+	}
+	if opts.maxZoom <= 0 {
+		opts.maxZoom = defaultClusterMaxZoom
+	}
+	if opts.minZoom < 0 || opts.minZoom > opts.maxZoom {
+		opts.minZoom = 0
+	}
+	if opts.smallClusterSize <= 0 {
+		opts.smallClusterSize = defaultClusterSmallClusterSize
+	}
+	return opts
+}
+
+// buildClusterLevels clusters locations for every zoom from maxZoom+1 (single points) down to minZoom
+func buildClusterLevels(locations []Location, opts clusterOptions) map[int][]clusterNode {
+	levels := make(map[int][]clusterNode, opts.maxZoom-opts.minZoom+2)
+
+	points := make([]clusterNode, 0, len(locations))
+	for _, l := range locations {
+		points = append(points, clusterNode{
+			x:     mercatorX(l.Longitude),
+			y:     mercatorY(l.Latitude),
+			count: 1,
+			bbox:  pointBBox(l.Latitude, l.Longitude),
+			ids:   []string{l.ID},
+		})
+	}
+	levels[opts.maxZoom+1] = points
+
+	// Each level merges the clusters of the level above it
+	for z := opts.maxZoom; z >= opts.minZoom; z-- {
+		levels[z] = clusterLevel(levels[z+1], z, opts)
+	}
+	return levels
+}
+
+// clusterLevel merges nodes that lie within the cluster radius of each other at a zoom level
+func clusterLevel(nodes []clusterNode, zoom int, opts clusterOptions) []clusterNode {
+	r := opts.radius / (opts.extent * math.Pow(2, float64(zoom)))
+
+	// Bucket nodes into a grid with cells the size of the radius
+	type cell struct{ x, y int }
+	grid := make(map[cell][]int)
+	for i, n := range nodes {
+		c := cell{int(math.Floor(n.x / r)), int(math.Floor(n.y / r))}
+		grid[c] = append(grid[c], i)
+	}
+
+	visited := make([]bool, len(nodes))
+	clusters := make([]clusterNode, 0, len(nodes))
+	for i, n := range nodes {
+		if visited[i] {
+			continue
+		}
+		visited[i] = true
+
+		merged := n
+		wx, wy := n.x*float64(n.count), n.y*float64(n.count)
+		cx, cy := int(math.Floor(n.x/r)), int(math.Floor(n.y/r))
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				for _, j := range grid[cell{cx + dx, cy + dy}] {
+					if visited[j] {
+						continue
+					}
+					other := nodes[j]
+					if (other.x-n.x)*(other.x-n.x)+(other.y-n.y)*(other.y-n.y) > r*r {
+						continue
+					}
+					visited[j] = true
+					wx += other.x * float64(other.count)
+					wy += other.y * float64(other.count)
+					merged.count += other.count
+					merged.bbox.Union(other.bbox)
+					if merged.count <= opts.smallClusterSize {
+						merged.ids = append(append([]string{}, merged.ids...), other.ids...)
+					} else {
+						merged.ids = nil
+					}
+				}
+			}
+		}
+		merged.x = wx / float64(merged.count)
+		merged.y = wy / float64(merged.count)
+		clusters = append(clusters, merged)
+	}
+	return clusters
+}
+
+// locationClusterCache holds a cluster hierarchy per audience until locations change, callers without
+// elevated rights get the hierarchy of the obfuscated positions
+type locationClusterCache struct {
+	mu     sync.Mutex
+	opts   clusterOptions
+	levels map[bool]map[int][]clusterNode
+}
+
+var clusterCache = &locationClusterCache{}
+
+// get returns the clusters of a zoom level for the audience of ctx, building the hierarchy from the
+// database when needed
+func (c *locationClusterCache) get(ctx context.Context, zoom int) ([]clusterNode, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	privileged := isPrivileged(ctx)
+	if c.levels[privileged] == nil {
+		locations, err := loadAllLocations(ctx)
+		if err != nil {
+			return nil, err
+		}
+		obfuscateLocations(ctx, locations)
+		if c.levels == nil {
+			c.opts = loadClusterOptions()
+			c.levels = map[bool]map[int][]clusterNode{}
+		}
+		c.levels[privileged] = buildClusterLevels(locations, c.opts)
+	}
+
+	if zoom < c.opts.minZoom {
+		zoom = c.opts.minZoom
+	}
+	if zoom > c.opts.maxZoom+1 {
+		zoom = c.opts.maxZoom + 1
+	}
+	return c.levels[privileged][zoom], nil
+}
+
+// invalidate drops the cached hierarchies, they are rebuilt on the next request
+func (c *locationClusterCache) invalidate() {
+	c.mu.Lock()
+	c.levels = nil
+	c.mu.Unlock()
+}
+
+// GetLocationClusters godoc
+// @Summary Get location clusters for a map view
+// @Description Groups locations into clusters for the given bounding box and zoom level
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param bbox query string true "Bounding box as minLng,minLat,maxLng,maxLat"
+// @Param zoom query int true "Map zoom level"
+// @Param X-API-Key header string false "Privileged API key, private locations are clustered by their obfuscated position without one"
+// @Success 200 {object} []LocationCluster
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location/clusters [get]
+func GetLocationClusters(w http.ResponseWriter, r *http.Request) {
+	// Parse the bounding box and zoom level
+	bbox, err := parseBBox(r.URL.Query().Get("bbox"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid bbox: %v", err)
+		return
+	}
+	zoom, err := strconv.Atoi(r.URL.Query().Get("zoom"))
+	if err != nil || zoom < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid zoom: must be a non-negative integer")
+		return
+	}
+
+	// Get the MongoDB context, keeping the audience of the request
+	ctx, cancel := context.WithTimeout(WithPrivilegedAudience(context.Background(), isPrivileged(r.Context())), 10*time.Second)
+	defer cancel()
+
+	// Get the clusters of the zoom level from the cache
+	nodes, err := clusterCache.get(ctx, zoom)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error building clusters: %v", err)
+		return
+	}
+
+	// Keep the clusters whose centroid is inside the bounding box
+	clusters := []LocationCluster{}
+	for _, n := range nodes {
+		lat, lng := mercatorLat(n.y), mercatorLng(n.x)
+		if !bbox.Contains(lat, lng) {
+			continue
+		}
+		clusters = append(clusters, LocationCluster{
+			Latitude:  lat,
+			Longitude: lng,
+			Count:     n.count,
+			BBox:      n.bbox,
+			IDs:       n.ids,
+		})
+	}
+
+	// Marshal clusters to JSON
+	jsonData, err := json.Marshal(clusters)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
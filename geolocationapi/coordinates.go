@@ -0,0 +1,352 @@
+package geolocationapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Supported values for the ?format= query parameter
+const (
+	CoordinateFormatDecimal  = "decimal"
+	CoordinateFormatDMS      = "dms"
+	CoordinateFormatDM       = "dm"
+	CoordinateFormatGeohash  = "geohash"
+	CoordinateFormatPlusCode = "pluscode"
+	CoordinateFormatUTM      = "utm"
+	CoordinateFormatMGRS     = "mgrs"
+)
+
+// coordinateNumberPattern matches the numeric parts of a coordinate component
+var coordinateNumberPattern = regexp.MustCompile(`\d+(?:\.\d+)?`)
+
+// minCoordinateGeohashLength is the shortest bare geohash a coordinates string is read as, shorter
+// words made only of geohash characters such as "berg" are rejected instead of decoding to a cell
+// tens of kilometres wide, longer words such as "budget" still decode as geohashes
+const minCoordinateGeohashLength = 5
+
+// hemispherePattern finds the first hemisphere letter that ends the first half of a pair
+var hemispherePattern = regexp.MustCompile(`[NSEWnsew]`)
+
+// UnmarshalJSON accepts latitude/longitude as numbers or strings (decimal, DMS, decimal-minutes),
+// or a single "coordinates" string in any supported format. When the caller sets CRS to a projected
+// system before decoding, latitude and longitude are read as plain northing and easting numbers.
+func (l *Location) UnmarshalJSON(data []byte) error {
+	type locationAlias Location
+	aux := struct {
+		*locationAlias
+		Latitude  json.RawMessage `json:"latitude"`
+		Longitude json.RawMessage `json:"longitude"`
+		// The crs of a response is ignored so it can be sent back, ?crs= decides how a body is read
+		CRS json.RawMessage `json:"crs"`
+	}{locationAlias: (*locationAlias)(l)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	var err error
+	projected := isProjectedCRS(l.CRS)
+	if len(aux.Latitude) > 0 {
+		if projected {
+			err = json.Unmarshal(aux.Latitude, &l.Latitude)
+		} else {
+			l.Latitude, err = parseCoordinateJSON(aux.Latitude, true)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid latitude: %v", err)
+		}
+	}
+	if len(aux.Longitude) > 0 {
+		if projected {
+			err = json.Unmarshal(aux.Longitude, &l.Longitude)
+		} else {
+			l.Longitude, err = parseCoordinateJSON(aux.Longitude, false)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid longitude: %v", err)
+		}
+	}
+
+	// A coordinates string takes precedence over separate fields, it names its own format so it is
+	// never reprojected
+	if strings.TrimSpace(l.Coordinates) != "" {
+		if l.Latitude, l.Longitude, err = parseCoordinates(l.Coordinates); err != nil {
+			return fmt.Errorf("invalid coordinates: %v", err)
+		}
+		l.Coordinates = ""
+		l.CRS = ""
+	}
+	return nil
+}
+
+// parseCoordinateJSON parses a latitude or longitude given as a JSON number or string
+func parseCoordinateJSON(raw json.RawMessage, isLatitude bool) (float64, error) {
+	var value float64
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, validateCoordinate(value, isLatitude)
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return 0, errors.New("must be a number or a string")
+	}
+	if strings.TrimSpace(text) == "" {
+		return 0, nil
+	}
+	return parseCoordinateText(text, isLatitude)
+}
+
+// parseCoordinateText parses a latitude or longitude written in decimal degrees, DMS or DM
+func parseCoordinateText(text string, isLatitude bool) (float64, error) {
+	value, hemisphere, err := parseCoordinateComponent(text)
+	if err != nil {
+		return 0, err
+	}
+	if isLatitude && (hemisphere == 'E' || hemisphere == 'W') {
+		return 0, errors.New("latitude cannot use an E/W hemisphere")
+	}
+	if !isLatitude && (hemisphere == 'N' || hemisphere == 'S') {
+		return 0, errors.New("longitude cannot use an N/S hemisphere")
+	}
+	return value, validateCoordinate(value, isLatitude)
+}
+
+// validateCoordinate checks a latitude or longitude is in range
+func validateCoordinate(value float64, isLatitude bool) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return errors.New("must be a finite number")
+	}
+	if isLatitude && (value < -90 || value > 90) {
+		return errors.New("latitude must be between -90 and 90")
+	}
+	if !isLatitude && (value < -180 || value > 180) {
+		return errors.New("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// parseCoordinates normalizes a coordinate pair in any supported format to decimal degrees
+func parseCoordinates(s string) (lat, lng float64, err error) {
+	s = strings.TrimSpace(s)
+	compact := strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+
+	// Try every format the string could be, keeping the first error if none of them succeed
+	var parsers []func(string) (float64, float64, error)
+	if isPlusCode(s) {
+		parsers = append(parsers, decodePlusCode)
+	}
+	if utmPattern.MatchString(s) {
+		parsers = append(parsers, parseUTM)
+	}
+	if mgrsPattern.MatchString(compact) {
+		parsers = append(parsers, parseMGRS)
+	}
+	if !strings.ContainsAny(s, " ,;") && len(s) >= minCoordinateGeohashLength && isGeohash(s) && strings.IndexFunc(s, isLetter) >= 0 {
+		parsers = append(parsers, decodeGeohash)
+	}
+	parsers = append(parsers, parseCoordinatePair)
+
+	var firstErr error
+	for _, parse := range parsers {
+		lat, lng, err = parse(s)
+		if err == nil {
+			break
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err != nil {
+		return 0, 0, firstErr
+	}
+
+	if err = validateCoordinate(lat, true); err != nil {
+		return 0, 0, err
+	}
+	if err = validateCoordinate(lng, false); err != nil {
+		return 0, 0, err
+	}
+	return lat, lng, nil
+}
+
+// parseCoordinatePair parses "lat,lng", "lat lng" or a DMS/decimal-minutes pair
+func parseCoordinatePair(s string) (lat, lng float64, err error) {
+	var first, second string
+	switch {
+	case strings.ContainsAny(s, ",;"):
+		parts := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' })
+		if len(parts) != 2 {
+			return 0, 0, errors.New("expected exactly two values separated by a comma")
+		}
+		first, second = parts[0], parts[1]
+	case hemispherePattern.MatchString(s):
+		// Split after the first hemisphere letter when it is a suffix, or before the second when prefixes are used
+		loc := hemispherePattern.FindAllStringIndex(s, -1)
+		if len(loc) != 2 {
+			return 0, 0, errors.New("expected one hemisphere letter per value")
+		}
+		if strings.TrimSpace(s[:loc[0][0]]) == "" {
+			first, second = s[:loc[1][0]], s[loc[1][0]:]
+		} else {
+			first, second = s[:loc[0][1]], s[loc[0][1]:]
+		}
+	default:
+		parts := strings.Fields(s)
+		if len(parts) != 2 {
+			return 0, 0, errors.New("unrecognised coordinate format")
+		}
+		first, second = parts[0], parts[1]
+	}
+
+	a, hemA, err := parseCoordinateComponent(first)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, hemB, err := parseCoordinateComponent(second)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Values are latitude first unless the hemispheres say otherwise
+	if (hemA == 'E' || hemA == 'W') && (hemB == 0 || hemB == 'N' || hemB == 'S') {
+		return b, a, nil
+	}
+	if (hemA == 'N' || hemA == 'S') && (hemB == 'N' || hemB == 'S') || (hemA == 'E' || hemA == 'W') && (hemB == 'E' || hemB == 'W') {
+		return 0, 0, errors.New("both values use the same axis")
+	}
+	return a, b, nil
+}
+
+// parseCoordinateComponent parses one decimal, DMS or decimal-minutes value and its hemisphere letter
+func parseCoordinateComponent(s string) (value float64, hemisphere byte, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, errors.New("empty coordinate value")
+	}
+
+	upper := strings.ToUpper(s)
+	if idx := strings.IndexAny(upper, "NSEW"); idx >= 0 {
+		hemisphere = upper[idx]
+		if strings.LastIndexAny(upper, "NSEW") != idx {
+			return 0, 0, errors.New("more than one hemisphere letter in " + s)
+		}
+	}
+
+	numbers := coordinateNumberPattern.FindAllString(s, -1)
+	if len(numbers) == 0 || len(numbers) > 3 {
+		return 0, 0, errors.New("unrecognised coordinate value: " + s)
+	}
+
+	parts := make([]float64, len(numbers))
+	for i, n := range numbers {
+		if parts[i], err = strconv.ParseFloat(n, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	for i := 1; i < len(parts); i++ {
+		if parts[i] >= 60 {
+			return 0, 0, errors.New("minutes and seconds must be below 60 in " + s)
+		}
+	}
+
+	value = parts[0]
+	if len(parts) > 1 {
+		value += parts[1] / 60
+	}
+	if len(parts) > 2 {
+		value += parts[2] / 3600
+	}
+
+	negative := strings.HasPrefix(s, "-") || hemisphere == 'S' || hemisphere == 'W'
+	if strings.HasPrefix(s, "-") && (hemisphere == 'S' || hemisphere == 'W') {
+		return 0, 0, errors.New("negative value with a southern or western hemisphere in " + s)
+	}
+	if negative {
+		value = -value
+	}
+	return value, hemisphere, nil
+}
+
+// isLetter reports whether r is an ASCII letter
+func isLetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// formatCoordinates renders a latitude/longitude pair in the requested format
+func formatCoordinates(lat, lng float64, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case CoordinateFormatDecimal:
+		return fmt.Sprintf("%.6f,%.6f", lat, lng), nil
+	case CoordinateFormatDMS:
+		return formatDMS(lat, 'N', 'S') + " " + formatDMS(lng, 'E', 'W'), nil
+	case CoordinateFormatDM:
+		return formatDM(lat, 'N', 'S') + " " + formatDM(lng, 'E', 'W'), nil
+	case CoordinateFormatGeohash:
+		return encodeGeohash(lat, lng, geohashMaxPrecision), nil
+	case CoordinateFormatPlusCode:
+		return encodePlusCode(lat, lng, plusCodePairLength), nil
+	case CoordinateFormatUTM:
+		u, err := latLngToUTM(lat, lng)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	case CoordinateFormatMGRS:
+		return latLngToMGRS(lat, lng)
+	}
+	return "", errors.New("unsupported coordinate format: " + format)
+}
+
+// formatDMS renders a value as degrees, minutes and seconds, e.g. 40°26'46.0"N
+func formatDMS(value float64, positive, negative byte) string {
+	hemisphere := positive
+	if value < 0 {
+		hemisphere = negative
+	}
+	// Round to tenths of a second before splitting so 59.95" does not render as 60.0"
+	tenths := int64(math.Round(math.Abs(value) * 36000))
+	degrees := tenths / 36000
+	minutes := tenths % 36000 / 600
+	seconds := float64(tenths%600) / 10
+	return fmt.Sprintf("%d°%d'%.1f\"%c", degrees, minutes, seconds, hemisphere)
+}
+
+// formatDM renders a value as degrees and decimal minutes, e.g. 40°26.767'N
+func formatDM(value float64, positive, negative byte) string {
+	hemisphere := positive
+	if value < 0 {
+		hemisphere = negative
+	}
+	thousandths := int64(math.Round(math.Abs(value) * 60000))
+	degrees := thousandths / 60000
+	minutes := float64(thousandths%60000) / 1000
+	return fmt.Sprintf("%d°%.3f'%c", degrees, minutes, hemisphere)
+}
+
+// validateCoordinateFormat checks the ?format= value is supported, an empty value is allowed
+func validateCoordinateFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	_, err := formatCoordinates(0, 0, format)
+	return err
+}
+
+// formatLocationCoordinates fills the Coordinates field of a location when a format is requested,
+// positions the format cannot represent (UTM near the poles) are left empty
+func formatLocationCoordinates(l *Location, format string) {
+	if format == "" {
+		return
+	}
+	formatted, err := formatCoordinates(l.Latitude, l.Longitude, format)
+	if err != nil {
+		l.Coordinates = ""
+		return
+	}
+	l.Coordinates = formatted
+}
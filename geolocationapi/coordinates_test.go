@@ -0,0 +1,129 @@
+package geolocationapi
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseCoordinates(t *testing.T) {
+	budgetLat, budgetLng, _ := decodeGeohash("budget")
+	tests := []struct {
+		name     string
+		input    string
+		lat, lng float64
+	}{
+		{"decimal comma", "40.446, -79.982", 40.446, -79.982},
+		{"decimal space", "40.446 -79.982", 40.446, -79.982},
+		{"decimal semicolon", "-33.8688;151.2093", -33.8688, 151.2093},
+		{"DMS suffix", `40°26'46"N 79°58'56"W`, 40.446111, -79.982222},
+		{"DMS prefix", `S 33°52'7.7" E 151°12'33.5"`, -33.868806, 151.209306},
+		{"DMS longitude first", `79°58'56"W 40°26'46"N`, 40.446111, -79.982222},
+		{"DM", "40°26.767'N, 79°58.933'W", 40.446117, -79.982217},
+		{"DM southern hemisphere", "22 54.408 S 43 10.374 W", -22.9068, -43.1729},
+		{"geohash", "u4pruydqqvj", 57.64911, 10.40744},
+		{"geohash made of a word", "budget", budgetLat, budgetLng},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lng, err := parseCoordinates(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(lat-tt.lat) > 1e-5 || math.Abs(lng-tt.lng) > 1e-5 {
+				t.Errorf("parseCoordinates(%q) = %v, %v, want %v, %v", tt.input, lat, lng, tt.lat, tt.lng)
+			}
+		})
+	}
+}
+
+func TestParseCoordinatesRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"decimal commas", "40,446 -79,982"},
+		{"three values", "1 2 3"},
+		{"latitude out of range", "91, 0"},
+		{"longitude out of range", "0, 181"},
+		{"same axis", `40°26'46"N 40°26'46"N`},
+		{"minutes of 60", "40°60'N, 10°E"},
+		{"negative southern value", "-40 S, 10 E"},
+		{"geohash shorter than the minimum", "berg"},
+		{"short plus code", "Q23M+4M"},
+		{"plus code separator in the wrong place", "87G8Q2+3M4M"},
+		{"UTM without a northing", "17T 589000"},
+		{"UTM band I", "17I 589000 4477000"},
+		{"MGRS zone 61", "61T NE 89000 77000"},
+		{"MGRS digits of unequal length", "17T NE 8900 77000"},
+		{"MGRS column letter of another zone", "17T AE 89000 77000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if lat, lng, err := parseCoordinates(tt.input); err == nil {
+				t.Errorf("parseCoordinates(%q) = %v, %v, want an error", tt.input, lat, lng)
+			}
+		})
+	}
+}
+
+func TestCoordinatesRoundTrip(t *testing.T) {
+	points := []struct {
+		name     string
+		lat, lng float64
+	}{
+		{"north west", 40.446111, -79.982222},
+		{"north east", 52.520008, 13.404954},
+		{"south east", -33.868820, 151.209296},
+		{"south west", -22.906847, -43.172897},
+		{"Norway zone exception", 60.391263, 5.322054},
+	}
+	formats := []string{CoordinateFormatDecimal, CoordinateFormatDMS, CoordinateFormatDM, CoordinateFormatGeohash,
+		CoordinateFormatPlusCode, CoordinateFormatUTM, CoordinateFormatMGRS}
+	for _, p := range points {
+		for _, format := range formats {
+			t.Run(p.name+" "+format, func(t *testing.T) {
+				formatted, err := formatCoordinates(p.lat, p.lng, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lat, lng, err := parseCoordinates(formatted)
+				if err != nil {
+					t.Fatalf("parseCoordinates(%q): %v", formatted, err)
+				}
+				// Every format resolves to 1e-4 degrees or better, about 10 m
+				if math.Abs(lat-p.lat) > 1e-4 || math.Abs(lng-p.lng) > 1e-4 {
+					t.Errorf("%q parsed to %v, %v, want %v, %v", formatted, lat, lng, p.lat, p.lng)
+				}
+			})
+		}
+	}
+}
+
+func TestParseUTMAndMGRSVariants(t *testing.T) {
+	tests := []struct {
+		name        string
+		input, same string
+	}{
+		{"UTM metre suffixes", "17T 589000mE 4477000mN", "17T 589000 4477000"},
+		{"UTM lower case band", "56h 334369 6250948", "56H 334369 6250948"},
+		{"MGRS without spaces", "17TNE8900077000", "17T NE 89000 77000"},
+		{"MGRS 1 km precision is the centre of the square", "17T NE 89 77", "17T NE 89500 77500"},
+		{"MGRS southern hemisphere", "56HLH3436950948", "56H LH 34369 50948"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lng, err := parseCoordinates(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantLat, wantLng, err := parseCoordinates(tt.same)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(lat-wantLat) > 1e-5 || math.Abs(lng-wantLng) > 1e-5 {
+				t.Errorf("%q = %v, %v, %q = %v, %v", tt.input, lat, lng, tt.same, wantLat, wantLng)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package geolocationapi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Coordinate reference systems supported by the ?crs= query parameter, UTM zones are
+// EPSG:326zz in the northern and EPSG:327zz in the southern hemisphere
+const (
+	CRSWGS84       = "EPSG:4326"
+	CRSWebMercator = "EPSG:3857"
+)
+
+// EPSG codes of the WGS84 UTM zones are these bases plus the zone number
+const (
+	epsgUTMNorth = 32600
+	epsgUTMSouth = 32700
+)
+
+// webMercatorCircumference is the width of the Web Mercator plane in meters
+const webMercatorCircumference = 2 * math.Pi * wgs84SemiMajorAxis
+
+// coordinateSystem is a parsed ?crs= value, the zero value means no crs was requested
+type coordinateSystem struct {
+	code     string
+	utmZone  int
+	utmNorth bool
+}
+
+// parseCRS parses EPSG:4326, EPSG:3857 or a UTM zone, given as EPSG:n, n or urn:ogc:def:crs:EPSG::n
+func parseCRS(value string) (coordinateSystem, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	if s == "" {
+		return coordinateSystem{}, nil
+	}
+	s = strings.TrimPrefix(s, "URN:OGC:DEF:CRS:EPSG::")
+	s = strings.TrimPrefix(s, "EPSG:")
+	code, err := strconv.Atoi(s)
+	switch {
+	case err != nil:
+	case code == 4326:
+		return coordinateSystem{code: CRSWGS84}, nil
+	case code == 3857:
+		return coordinateSystem{code: CRSWebMercator}, nil
+	case code > epsgUTMNorth && code <= epsgUTMNorth+60:
+		return coordinateSystem{code: fmt.Sprintf("EPSG:%d", code), utmZone: code - epsgUTMNorth, utmNorth: true}, nil
+	case code > epsgUTMSouth && code <= epsgUTMSouth+60:
+		return coordinateSystem{code: fmt.Sprintf("EPSG:%d", code), utmZone: code - epsgUTMSouth}, nil
+	}
+	return coordinateSystem{}, fmt.Errorf("unsupported crs %q, use %s, %s or a UTM zone such as EPSG:32633", value, CRSWGS84, CRSWebMercator)
+}
+
+// projected reports whether positions of the system are x/y meters rather than longitude/latitude
+func (c coordinateSystem) projected() bool {
+	return c.code != "" && c.code != CRSWGS84
+}
+
+// forward converts a WGS84 position to x/y in the system, longitude/latitude for EPSG:4326
+func (c coordinateSystem) forward(lat, lng float64) (x, y float64, err error) {
+	switch {
+	case c.code == CRSWebMercator:
+		// Latitudes beyond the Web Mercator square are clamped to its edge, as map tiles do
+		return (mercatorX(lng) - 0.5) * webMercatorCircumference, (0.5 - mercatorY(lat)) * webMercatorCircumference, nil
+	case c.utmZone != 0:
+		if lat < -80 || lat > 84 {
+			return 0, 0, errors.New("UTM is only defined between 80°S and 84°N")
+		}
+		easting, northing := latLngToUTMZone(lat, lng, c.utmZone)
+		// latLngToUTMZone picks the false northing from the latitude, the crs decides it here
+		if lat < 0 {
+			northing -= utmFalseNorthing
+		}
+		if !c.utmNorth {
+			northing += utmFalseNorthing
+		}
+		return easting, northing, nil
+	}
+	return lng, lat, nil
+}
+
+// inverse converts x/y in the system back to a WGS84 position
+func (c coordinateSystem) inverse(x, y float64) (lat, lng float64, err error) {
+	if math.IsNaN(x) || math.IsInf(x, 0) || math.IsNaN(y) || math.IsInf(y, 0) {
+		return 0, 0, errors.New("coordinates must be finite numbers")
+	}
+	switch {
+	case c.code == CRSWebMercator:
+		lat, lng = mercatorLat(0.5-y/webMercatorCircumference), mercatorLng(x/webMercatorCircumference+0.5)
+	case c.utmZone != 0:
+		if lat, lng, err = utmToLatLng(c.utmZone, c.utmNorth, x, y); err != nil {
+			return 0, 0, err
+		}
+	default:
+		lat, lng = y, x
+	}
+	if err := validateCoordinate(lat, true); err != nil {
+		return 0, 0, fmt.Errorf("position is outside %s: %v", c.code, err)
+	}
+	if err := validateCoordinate(lng, false); err != nil {
+		return 0, 0, fmt.Errorf("position is outside %s: %v", c.code, err)
+	}
+	return lat, lng, nil
+}
+
+// isProjectedCRS reports whether a crs code names a projected system, used while decoding a body
+// whose latitude and longitude hold northing and easting
+func isProjectedCRS(code string) bool {
+	c, err := parseCRS(code)
+	return err == nil && c.projected()
+}
+
+// transformLocationCRS rewrites the position of a location in the requested system for a response,
+// longitude holds x and latitude holds y, and crs names the system
+func transformLocationCRS(l *Location, c coordinateSystem) error {
+	if c.code == "" {
+		return nil
+	}
+	x, y, err := c.forward(l.Latitude, l.Longitude)
+	if err != nil {
+		return fmt.Errorf("location %s: %v", l.ID, err)
+	}
+	l.Longitude, l.Latitude = x, y
+	l.CRS = c.code
+	return nil
+}
+
+// transformPolygonCRS rewrites the [longitude, latitude] positions of a polygon as [x, y]
+func transformPolygonCRS(p *Polygon, c coordinateSystem) error {
+	if !c.projected() {
+		return nil
+	}
+	for _, ring := range p.Coordinates {
+		for _, position := range ring {
+			if len(position) < 2 {
+				continue
+			}
+			x, y, err := c.forward(position[1], position[0])
+			if err != nil {
+				return err
+			}
+			position[0], position[1] = x, y
+		}
+	}
+	return nil
+}
+
+// transformCommunityCRS rewrites the location and boundary of a community in the requested system
+func transformCommunityCRS(com *Community, c coordinateSystem) error {
+	if err := transformLocationCRS(&com.Location, c); err != nil {
+		return err
+	}
+	if com.Boundary != nil {
+		if err := transformPolygonCRS(com.Boundary, c); err != nil {
+			return fmt.Errorf("community %s boundary: %v", com.ID, err)
+		}
+	}
+	return nil
+}
+
+// locationToWGS84 converts a decoded location whose crs names a projected system back to the
+// WGS84 longitude and latitude it is stored with
+func locationToWGS84(l *Location) error {
+	c, err := parseCRS(l.CRS)
+	l.CRS = ""
+	if err != nil || !c.projected() {
+		return err
+	}
+	l.Latitude, l.Longitude, err = c.inverse(l.Longitude, l.Latitude)
+	return err
+}
+
+// polygonToWGS84 converts the [x, y] positions of a decoded polygon back to [longitude, latitude]
+func polygonToWGS84(p *Polygon, c coordinateSystem) error {
+	if !c.projected() {
+		return nil
+	}
+	for i, ring := range p.Coordinates {
+		for _, position := range ring {
+			if len(position) < 2 {
+				return fmt.Errorf("ring %d has a position without x and y", i)
+			}
+			lat, lng, err := c.inverse(position[0], position[1])
+			if err != nil {
+				return err
+			}
+			position[0], position[1] = lng, lat
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package geolocationapi
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseCRS(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    coordinateSystem
+		wantErr bool
+	}{
+		{"", coordinateSystem{}, false},
+		{"EPSG:4326", coordinateSystem{code: CRSWGS84}, false},
+		{"epsg:3857", coordinateSystem{code: CRSWebMercator}, false},
+		{"3857", coordinateSystem{code: CRSWebMercator}, false},
+		{"urn:ogc:def:crs:EPSG::32633", coordinateSystem{code: "EPSG:32633", utmZone: 33, utmNorth: true}, false},
+		{" EPSG:32756 ", coordinateSystem{code: "EPSG:32756", utmZone: 56}, false},
+		{"EPSG:32600", coordinateSystem{}, true},
+		{"EPSG:32661", coordinateSystem{}, true},
+		{"EPSG:27700", coordinateSystem{}, true},
+		{"WGS84", coordinateSystem{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCRS(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCRS(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCRS(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCoordinateSystemForward(t *testing.T) {
+	tests := []struct {
+		name     string
+		crs      string
+		lat, lng float64
+		x, y     float64
+	}{
+		{"web mercator origin", CRSWebMercator, 0, 0, 0, 0},
+		{"web mercator antimeridian", CRSWebMercator, 0, 180, 20037508.34, 0},
+		{"web mercator london", CRSWebMercator, 51.5074, -0.1278, -14226.63, 6711542.47},
+		{"utm central meridian", "EPSG:32633", 0, 15, 500000, 0},
+		{"utm south false northing", "EPSG:32733", 0, 15, 500000, 10000000},
+		{"utm meridian arc", "EPSG:32633", 52.52, 15, 500000, 5818876.66},
+		{"wgs84 keeps longitude and latitude", CRSWGS84, 52.52, 13.405, 13.405, 52.52},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCRS(tt.crs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			x, y, err := c.forward(tt.lat, tt.lng)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(x-tt.x) > 1 || math.Abs(y-tt.y) > 1 {
+				t.Errorf("forward(%v, %v) = %v, %v, want %v, %v", tt.lat, tt.lng, x, y, tt.x, tt.y)
+			}
+		})
+	}
+}
+
+func TestCoordinateSystemRoundTrip(t *testing.T) {
+	tests := []struct {
+		crs      string
+		lat, lng float64
+	}{
+		{CRSWebMercator, 52.52, 13.405},
+		{CRSWebMercator, -41.2865, 174.7762},
+		{"EPSG:32633", 52.52, 13.405},
+		{"EPSG:32756", -33.8688, 151.2093},
+		{"EPSG:32718", -12.0464, -77.0428},
+	}
+	for _, tt := range tests {
+		c, err := parseCRS(tt.crs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, y, err := c.forward(tt.lat, tt.lng)
+		if err != nil {
+			t.Fatalf("%s forward(%v, %v): %v", tt.crs, tt.lat, tt.lng, err)
+		}
+		lat, lng, err := c.inverse(x, y)
+		if err != nil {
+			t.Fatalf("%s inverse(%v, %v): %v", tt.crs, x, y, err)
+		}
+		if math.Abs(lat-tt.lat) > 1e-6 || math.Abs(lng-tt.lng) > 1e-6 {
+			t.Errorf("%s round trip of %v,%v = %v,%v", tt.crs, tt.lat, tt.lng, lat, lng)
+		}
+	}
+}
+
+func TestCoordinateSystemErrors(t *testing.T) {
+	utm, _ := parseCRS("EPSG:32633")
+	for _, lat := range []float64{84.5, -80.5} {
+		if _, _, err := utm.forward(lat, 15); err == nil {
+			t.Errorf("forward(%v, 15) in UTM succeeded", lat)
+		}
+	}
+	mercator, _ := parseCRS(CRSWebMercator)
+	tests := []struct {
+		name string
+		c    coordinateSystem
+		x, y float64
+	}{
+		{"not a number", mercator, math.NaN(), 0},
+		{"infinite", utm, 500000, math.Inf(1)},
+		{"beyond the web mercator plane", mercator, 3 * webMercatorCircumference, 0},
+		{"latitude beyond the pole", coordinateSystem{code: CRSWGS84}, 13, 91},
+	}
+	for _, tt := range tests {
+		if _, _, err := tt.c.inverse(tt.x, tt.y); err == nil {
+			t.Errorf("%s: inverse(%v, %v) succeeded", tt.name, tt.x, tt.y)
+		}
+	}
+}
@@ -0,0 +1,595 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"temprest/config"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CSV import defaults used when the Import config section is missing
+const (
+	defaultImportBatchSize         = 1000
+	defaultImportMaxReportedErrors = 1000
+)
+
+// csvImportRecord is a row turned into a write
+type csvImportRecord struct {
+	id    string
+	model mongo.WriteModel
+	// location holds the imported fields of a locations row
+	location Location
+}
+
+// csvImportTarget describes how CSV rows become documents of one collection
+type csvImportTarget struct {
+	collection string
+	// fields in their default column order, aliases are other header names accepted for a field
+	fields  []string
+	aliases map[string][]string
+	build   func(values map[string]string) (csvImportRecord, error)
+	// saved runs once the records of a batch are stored
+	saved func(ctx context.Context, records []csvImportRecord)
+}
+
+var locationCSVTarget = csvImportTarget{
+	collection: "locations",
+	fields:     []string{"id", "name", "latitude", "longitude", "coordinates", "street", "locality", "region", "postalCode", "countryCode", "privacy", "elevation"},
+	aliases: map[string][]string{
+		"latitude":    {"lat"},
+		"longitude":   {"lng", "lon", "long"},
+		"coordinates": {"coords", "position"},
+		"street":      {"address"},
+		"locality":    {"city", "town"},
+		"region":      {"state", "province"},
+		"postalCode":  {"zip", "postcode", "postal_code"},
+		"countryCode": {"country"},
+		"elevation":   {"altitude", "ele", "alt"},
+	},
+	build: buildLocationCSVRecord,
+	saved: func(ctx context.Context, records []csvImportRecord) {
+		locations := make([]Location, len(records))
+		for i, record := range records {
+			locations[i] = record.location
+		}
+		onImportedLocationsSaved(ctx, locations)
+	},
+}
+
+var communityCSVTarget = csvImportTarget{
+	collection: "communities",
+	fields:     []string{"id", "name", "latitude", "longitude", "coordinates", "locationId", "locationName", "geofenceRadius"},
+	aliases: map[string][]string{
+		"latitude":    {"lat"},
+		"longitude":   {"lng", "lon", "long"},
+		"coordinates": {"coords", "position"},
+	},
+	build: buildCommunityCSVRecord,
+	saved: func(context.Context, []csvImportRecord) { onCommunityChanged() },
+}
+
+// csvRowPosition reads the position of a row from the coordinates column or the latitude and longitude columns
+func csvRowPosition(values map[string]string) (lat, lng float64, err error) {
+	if values["coordinates"] != "" {
+		return parseCoordinates(values["coordinates"])
+	}
+	if values["latitude"] == "" || values["longitude"] == "" {
+		return 0, 0, errors.New("latitude and longitude, or coordinates, are required")
+	}
+	if lat, err = parseCoordinateText(values["latitude"], true); err != nil {
+		return 0, 0, fmt.Errorf("invalid latitude: %v", err)
+	}
+	if lng, err = parseCoordinateText(values["longitude"], false); err != nil {
+		return 0, 0, fmt.Errorf("invalid longitude: %v", err)
+	}
+	return lat, lng, nil
+}
+
+// buildLocationCSVRecord upserts a location by id, setting the fields of the row and keeping the
+// fields of an existing location that are unmapped or empty
+func buildLocationCSVRecord(values map[string]string) (csvImportRecord, error) {
+	l := Location{ID: values["id"], Name: values["name"], Privacy: values["privacy"]}
+	if l.ID == "" {
+		l.ID = primitive.NewObjectID().Hex()
+	}
+	var err error
+	if l.Latitude, l.Longitude, err = csvRowPosition(values); err != nil {
+		return csvImportRecord{}, err
+	}
+	// The address columns of a row replace the address as a whole, it is kept when they are all empty
+	l.Address = &Address{
+		Street:      values["street"],
+		Locality:    values["locality"],
+		Region:      values["region"],
+		PostalCode:  values["postalCode"],
+		CountryCode: values["countryCode"],
+	}
+	if err := validateLocationAddress(&l); err != nil {
+		return csvImportRecord{}, fmt.Errorf("invalid address: %v", err)
+	}
+	if err := validatePrivacyLevel(&l); err != nil {
+		return csvImportRecord{}, err
+	}
+	if value := values["elevation"]; value != "" {
+		elevation, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return csvImportRecord{}, errors.New("elevation must be a number of meters")
+		}
+		l.Elevation = &elevation
+		if err := validateLocationElevation(&l); err != nil {
+			return csvImportRecord{}, err
+		}
+	}
+	setLocationDerivedFields(&l)
+
+	model := mongo.NewUpdateOneModel().SetFilter(bson.M{"id": l.ID}).SetUpdate(locationImportUpdate(l, values["privacy"] != "")).SetUpsert(true)
+	return csvImportRecord{id: l.ID, model: model, location: l}, nil
+}
+
+// buildCommunityCSVRecord sets the name, location and geofence radius of a community by id,
+// keeping the members and boundary of an existing community
+func buildCommunityCSVRecord(values map[string]string) (csvImportRecord, error) {
+	id := values["id"]
+	if id == "" {
+		id = primitive.NewObjectID().Hex()
+	}
+	location := Location{ID: values["locationId"], Name: values["locationName"]}
+	var err error
+	if location.Latitude, location.Longitude, err = csvRowPosition(values); err != nil {
+		return csvImportRecord{}, err
+	}
+	setLocationDerivedFields(&location)
+
+	set := bson.M{"name": values["name"], "location": location}
+	if value := values["geofenceRadius"]; value != "" {
+		radius, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(radius >= 0) || math.IsInf(radius, 0) {
+			return csvImportRecord{}, errors.New("geofenceRadius must be a positive number of meters")
+		}
+		set["geofenceradius"] = radius
+	}
+	update := bson.M{"$set": set, "$setOnInsert": bson.M{"members": []Membership{}}}
+	model := mongo.NewUpdateOneModel().SetFilter(bson.M{"id": id}).SetUpdate(update).SetUpsert(true)
+	return csvImportRecord{id: id, model: model}, nil
+}
+
+// parseCSVDelimiter reads the delimiter parameter, "tab" and "\t" stand for a tab
+func parseCSVDelimiter(value string) (rune, error) {
+	switch value {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	delimiter, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || delimiter == '"' || delimiter == '\r' || delimiter == '\n' || delimiter == utf8.RuneError {
+		return 0, errors.New("delimiter must be a single character other than a quote or line break")
+	}
+	return delimiter, nil
+}
+
+// parseCSVMapping reads a "field=column,field=column" mapping, a column is a header name or a 1-based index
+func parseCSVMapping(value string, target csvImportTarget) (map[string]string, error) {
+	mapping := map[string]string{}
+	if value == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("mapping entry %q must be field=column", pair)
+		}
+		known := false
+		for _, f := range target.fields {
+			if strings.EqualFold(f, field) {
+				field, known = f, true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(target.fields, ", "))
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+// looksLikeCSVHeader reports whether a first row names columns rather than holding data
+func looksLikeCSVHeader(record []string, mapping map[string]string, target csvImportTarget) bool {
+	names := map[string]bool{}
+	for _, field := range target.fields {
+		names[strings.ToLower(field)] = true
+		for _, alias := range target.aliases[field] {
+			names[alias] = true
+		}
+	}
+	for _, column := range mapping {
+		if _, err := strconv.Atoi(column); err != nil {
+			names[strings.ToLower(column)] = true
+		}
+	}
+	for _, cell := range record {
+		if names[strings.ToLower(strings.TrimSpace(cell))] {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveCSVColumns maps each field to a column index using the mapping and the header, without a
+// header or mapping the columns are taken in the default field order
+func resolveCSVColumns(header []string, mapping map[string]string, target csvImportTarget) (map[string]int, error) {
+	headerIndex := map[string]int{}
+	for i, name := range header {
+		headerIndex[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	columns := map[string]int{}
+	for _, field := range target.fields {
+		if column, ok := mapping[field]; ok {
+			if i, found := headerIndex[strings.ToLower(column)]; found {
+				columns[field] = i
+				continue
+			}
+			index, err := strconv.Atoi(column)
+			if err != nil || index < 1 {
+				return nil, fmt.Errorf("column %q of field %s is not in the header", column, field)
+			}
+			columns[field] = index - 1
+			continue
+		}
+
+		if header != nil {
+			for _, name := range append([]string{field}, target.aliases[field]...) {
+				if i, found := headerIndex[strings.ToLower(name)]; found {
+					columns[field] = i
+					break
+				}
+			}
+		} else if len(mapping) == 0 {
+			columns[field] = len(columns)
+		}
+	}
+
+	_, hasCoordinates := columns["coordinates"]
+	_, hasLatitude := columns["latitude"]
+	_, hasLongitude := columns["longitude"]
+	if !hasCoordinates && !(hasLatitude && hasLongitude) {
+		return nil, errors.New("no latitude and longitude or coordinates column")
+	}
+	return columns, nil
+}
+
+// csvImport streams the rows of an upload into a collection in batches
+type csvImport struct {
+	target    csvImportTarget
+	dryRun    bool
+	batchSize int
+	maxErrors int
+	report    ImportReport
+	// rejected receives every rejected row when an error report file is requested
+	rejected *csv.Writer
+	batch    []csvPendingRow
+	batchIDs map[string]bool
+}
+
+// csvPendingRow is a valid row waiting for its batch to be written
+type csvPendingRow struct {
+	row    int
+	record []string
+	csvImportRecord
+}
+
+// reject records a row that could not be imported
+func (c *csvImport) reject(row int, id string, record []string, err error) {
+	c.report.Failed++
+	if len(c.report.Results) < c.maxErrors {
+		c.report.Results = append(c.report.Results, ImportResult{Index: row, ID: id, Status: ImportError, Error: err.Error()})
+	} else {
+		c.report.Truncated = true
+	}
+	if c.rejected != nil {
+		c.rejected.Write(append([]string{strconv.Itoa(row), id, err.Error()}, record...))
+	}
+}
+
+// add queues a valid row, writing the batch first when it is full or already has the same id
+func (c *csvImport) add(pending csvPendingRow) error {
+	if len(c.batch) >= c.batchSize || c.batchIDs[pending.id] {
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+	c.batch = append(c.batch, pending)
+	c.batchIDs[pending.id] = true
+	return nil
+}
+
+// flush writes the queued rows with one unordered bulk write and records the outcome of each
+func (c *csvImport) flush() error {
+	batch := c.batch
+	c.batch = c.batch[:0]
+	c.batchIDs = map[string]bool{}
+	if len(batch) == 0 {
+		return nil
+	}
+	if c.dryRun {
+		c.report.Valid += len(batch)
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, len(batch))
+	for i, pending := range batch {
+		models[i] = pending.model
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := client.Database("geolocapi").Collection(c.target.collection).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+
+	failed := map[int]error{}
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed[writeErr.Index] = errors.New(writeErr.Message)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	var saved []csvImportRecord
+	for i, pending := range batch {
+		if writeErr, ok := failed[i]; ok {
+			c.reject(pending.row, pending.id, pending.record, writeErr)
+			continue
+		}
+		if _, created := result.UpsertedIDs[int64(i)]; created {
+			c.report.Created++
+		} else {
+			c.report.Updated++
+		}
+		saved = append(saved, pending.csvImportRecord)
+	}
+	if len(saved) > 0 {
+		c.target.saved(ctx, saved)
+	}
+	return nil
+}
+
+// importCSV streams an upload into the target collection and writes the JSON report, or the
+// rejected rows as a CSV file when report=csv
+func importCSV(w http.ResponseWriter, r *http.Request, target csvImportTarget) {
+	query := r.URL.Query()
+
+	// Parse the import parameters
+	delimiter, err := parseCSVDelimiter(query.Get("delimiter"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid delimiter: %v", err)
+		return
+	}
+	mapping, err := parseCSVMapping(query.Get("mapping"), target)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid mapping: %v", err)
+		return
+	}
+	header := strings.ToLower(query.Get("header"))
+	if header == "" {
+		header = "auto"
+	}
+	if header != "auto" && header != "true" && header != "false" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid header: must be auto, true or false")
+		return
+	}
+	var dryRun bool
+	if value := query.Get("dryRun"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid dryRun: must be true or false")
+			return
+		}
+	}
+	reportFormat := strings.ToLower(query.Get("report"))
+	if reportFormat != "" && reportFormat != "json" && reportFormat != "csv" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid report: must be json or csv")
+		return
+	}
+
+	// Check if the MongoDB client is nil
+	if client == nil && !dryRun {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	c := &csvImport{
+		target:    target,
+		dryRun:    dryRun,
+		batchSize: config.GetInt("Import.BatchSize"),
+		maxErrors: config.GetInt("Import.MaxReportedErrors"),
+		report:    ImportReport{Results: []ImportResult{}},
+		batchIDs:  map[string]bool{},
+	}
+	if c.batchSize <= 0 {
+		c.batchSize = defaultImportBatchSize
+	}
+	if c.maxErrors <= 0 {
+		c.maxErrors = defaultImportMaxReportedErrors
+	}
+
+	// Rejected rows go to a temporary file so the error report does not have to fit in memory
+	var rejectedFile *os.File
+	if reportFormat == "csv" {
+		if rejectedFile, err = os.CreateTemp("", "rejected-*.csv"); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Error creating error report: %v", err)
+			return
+		}
+		defer os.Remove(rejectedFile.Name())
+		defer rejectedFile.Close()
+		c.rejected = csv.NewWriter(rejectedFile)
+	}
+
+	reader := csv.NewReader(r.Body)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+
+	// Work out the columns from the first row
+	first, err := reader.Read()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error reading CSV: %v", err)
+		return
+	}
+	var headerRow []string
+	if header == "true" || header == "auto" && looksLikeCSVHeader(first, mapping, target) {
+		headerRow = first
+	}
+	columns, err := resolveCSVColumns(headerRow, mapping, target)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid columns: %v", err)
+		return
+	}
+	if c.rejected != nil {
+		c.rejected.Write(append([]string{"row", "id", "error"}, headerRow...))
+	}
+
+	// Stream the rows
+	row := 1
+	record := first
+	if headerRow != nil {
+		record = nil
+	}
+	for {
+		if record == nil {
+			row++
+			record, err = reader.Read()
+			if err == io.EOF {
+				break
+			}
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				c.reject(row, "", record, err)
+				record = nil
+				continue
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Error reading CSV at row %d: %v", row, err)
+				return
+			}
+		}
+
+		values := make(map[string]string, len(columns))
+		for field, i := range columns {
+			if i < len(record) {
+				values[field] = strings.TrimSpace(record[i])
+			}
+		}
+		built, err := target.build(values)
+		if err != nil {
+			c.reject(row, values["id"], record, err)
+		} else if err := c.add(csvPendingRow{row: row, record: record, csvImportRecord: built}); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Error writing rows before row %d: %v", row, err)
+			return
+		}
+		record = nil
+	}
+	if err := c.flush(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error writing rows: %v", err)
+		return
+	}
+
+	// Send the rejected rows as a CSV file with the totals in headers
+	if c.rejected != nil {
+		c.rejected.Flush()
+		if _, err := rejectedFile.Seek(0, io.SeekStart); err != nil || c.rejected.Error() != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Error reading error report")
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="rejected-rows.csv"`)
+		w.Header().Set("X-Import-Created", strconv.Itoa(c.report.Created))
+		w.Header().Set("X-Import-Updated", strconv.Itoa(c.report.Updated))
+		w.Header().Set("X-Import-Valid", strconv.Itoa(c.report.Valid))
+		w.Header().Set("X-Import-Failed", strconv.Itoa(c.report.Failed))
+		io.Copy(w, rejectedFile)
+		return
+	}
+
+	// Marshal the report to JSON
+	jsonData, err := json.Marshal(c.report)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
+
+// ImportLocationsCSV godoc
+// @Summary Import locations from CSV
+// @Description Streams a CSV upload and upserts a location by id for every row, keeping the fields of existing locations whose columns are unmapped or empty, and reporting rejected rows
+// @Tags locations
+// @Accept text/csv
+// @Produce json,text/csv
+// @Param file body string true "CSV rows"
+// @Param mapping query string false "Field to column mapping such as id=site_id,name=Site Name,latitude=3, fields are id, name, latitude, longitude, coordinates, street, locality, region, postalCode, countryCode and privacy"
+// @Param header query string false "Whether the first row is a header: auto (default), true or false"
+// @Param delimiter query string false "Column delimiter, a single character or tab (default ,)"
+// @Param dryRun query bool false "Validate the rows without writing them"
+// @Param report query string false "Report format: json (default) or csv to download the rejected rows"
+// @Success 200 {object} ImportReport
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location/import/csv [post]
+func ImportLocationsCSV(w http.ResponseWriter, r *http.Request) {
+	importCSV(w, r, locationCSVTarget)
+}
+
+// ImportCommunitiesCSV godoc
+// @Summary Import communities from CSV
+// @Description Streams a CSV upload and upserts a community with its embedded location by id for every row, keeping the members and boundary of existing communities
+// @Tags Community
+// @Accept text/csv
+// @Produce json,text/csv
+// @Param file body string true "CSV rows"
+// @Param mapping query string false "Field to column mapping, fields are id, name, latitude, longitude, coordinates, locationId, locationName and geofenceRadius"
+// @Param header query string false "Whether the first row is a header: auto (default), true or false"
+// @Param delimiter query string false "Column delimiter, a single character or tab (default ,)"
+// @Param dryRun query bool false "Validate the rows without writing them"
+// @Param report query string false "Report format: json (default) or csv to download the rejected rows"
+// @Success 200 {object} ImportReport
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/community/import/csv [post]
+func ImportCommunitiesCSV(w http.ResponseWriter, r *http.Request) {
+	importCSV(w, r, communityCSVTarget)
+}
@@ -2,8 +2,12 @@ package geolocationapi
 
 import (
 	"context"
+	"errors"
 	"log"
+	"temprest/logging"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -19,4 +23,83 @@ func init() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	ensureIndexes()
+
+	// Warm the in-process spatial index in the background
+	go locationIndex.load()
+	go backfillLatestPositions()
+}
+
+// ensureIndexes creates the indexes used by the API, failures are logged and do not stop startup
+func ensureIndexes() {
+	indexCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Geohash prefix queries on locations
+	_, err := client.Database("geolocapi").Collection("locations").Indexes().CreateOne(indexCtx, mongo.IndexModel{
+		Keys: bson.D{{Key: "geohash", Value: 1}},
+	})
+	if err != nil {
+		logging.DoLoggingLevelBasedLogs(logging.Warn, "", logging.EnrichErrorWithStackTrace(errors.New("error creating geohash index: "+err.Error())))
+	}
+
+	// Address filters on the location list
+	_, err = client.Database("geolocapi").Collection("locations").Indexes().CreateOne(indexCtx, mongo.IndexModel{
+		Keys: bson.D{{Key: "address.countrycode", Value: 1}, {Key: "address.postalcode", Value: 1}},
+	})
+	if err != nil {
+		logging.DoLoggingLevelBasedLogs(logging.Warn, "", logging.EnrichErrorWithStackTrace(errors.New("error creating address index: "+err.Error())))
+	}
+
+	// Geofence event queries per community and per member, newest first
+	_, err = client.Database("geolocapi").Collection("geofenceevents").Indexes().CreateMany(indexCtx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "communityid", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "memberid", Value: 1}, {Key: "timestamp", Value: -1}}},
+	})
+	if err != nil {
+		logging.DoLoggingLevelBasedLogs(logging.Warn, "", logging.EnrichErrorWithStackTrace(errors.New("error creating geofence event indexes: "+err.Error())))
+	}
+
+	// Time series collection for tracked member positions
+	if err := ensurePositionsCollection(indexCtx); err != nil {
+		logging.DoLoggingLevelBasedLogs(logging.Warn, "", logging.EnrichErrorWithStackTrace(errors.New("error creating positions collection: "+err.Error())))
+	}
+}
+
+// loadAllLocations reads every document of the locations collection
+func loadAllLocations(ctx context.Context) ([]Location, error) {
+	if client == nil {
+		return nil, errors.New("MongoDB client is not initialized")
+	}
+
+	cursor, err := client.Database("geolocapi").Collection("locations").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var locations []Location
+	if err := cursor.All(ctx, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// loadAllCommunities reads every document of the communities collection
+func loadAllCommunities(ctx context.Context) ([]Community, error) {
+	if client == nil {
+		return nil, errors.New("MongoDB client is not initialized")
+	}
+
+	cursor, err := client.Database("geolocapi").Collection("communities").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var communities []Community
+	if err := cursor.All(ctx, &communities); err != nil {
+		return nil, err
+	}
+	return communities, nil
 }
@@ -0,0 +1,53 @@
+package geolocationapi
+
+import "math"
+
+// earthRadiusMeters is the mean Earth radius used for great-circle distances
+const earthRadiusMeters = 6371008.8
+
+// haversineMeters returns the great-circle distance between two positions in meters
+func haversineMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lng2 - lng1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// destinationPoint returns the position distance meters from a start along a great circle leaving at
+// bearing degrees clockwise from north, the longitude is not normalized so it may pass ±180
+func destinationPoint(lat, lng, bearing, distance float64) (float64, float64) {
+	phi1, lambda1 := lat*math.Pi/180, lng*math.Pi/180
+	theta, delta := bearing*math.Pi/180, distance/earthRadiusMeters
+
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1), math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+	return phi2 * 180 / math.Pi, lambda2 * 180 / math.Pi
+}
+
+// distanceToBBoxMeters returns the distance from a position to the closest point of a box,
+// zero when the position is inside it
+func distanceToBBoxMeters(lat, lng float64, box BoundingBox) float64 {
+	if lng >= box.MinLng && lng <= box.MaxLng {
+		return haversineMeters(lat, lng, math.Min(math.Max(lat, box.MinLat), box.MaxLat), lng)
+	}
+
+	// Pick the nearer edge, measuring across the antimeridian when that is shorter
+	edge := box.MinLng
+	if math.Abs(math.Remainder(lng-box.MaxLng, 360)) < math.Abs(math.Remainder(lng-box.MinLng, 360)) {
+		edge = box.MaxLng
+	}
+
+	// Along a meridian the distance has a single extremum where the great circle from the position
+	// meets it at a right angle. Within 90° of longitude that is the closest point, poleward of the
+	// position, so clamping the latitude alone would overestimate the distance. Further away it is
+	// the furthest point and the closest one is an end of the edge.
+	cosDelta := math.Cos((lng - edge) * math.Pi / 180)
+	if cosDelta <= 0 {
+		return math.Min(haversineMeters(lat, lng, box.MinLat, edge), haversineMeters(lat, lng, box.MaxLat, edge))
+	}
+	closestLat := math.Atan(math.Tan(lat*math.Pi/180)/cosDelta) * 180 / math.Pi
+	return haversineMeters(lat, lng, math.Min(math.Max(closestLat, box.MinLat), box.MaxLat), edge)
+}
@@ -0,0 +1,400 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"temprest/config"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Duplicate detection defaults used when the Duplicates config section is missing
+const (
+	defaultDuplicateMaxDistance   = 100
+	defaultDuplicateMinSimilarity = 0.6
+)
+
+// DuplicateGroup is a set of locations that are probably the same place
+type DuplicateGroup struct {
+	// SuggestedID is the location linked to most others in the group, a natural merge target
+	SuggestedID string `json:"suggestedId"`
+	// Locations are ordered with the suggested location first
+	Locations []Location `json:"locations"`
+	// MaxDistance is the largest distance in meters and MinSimilarity the lowest name similarity
+	// of the pairs that linked the group
+	MaxDistance   float64 `json:"maxDistance"`
+	MinSimilarity float64 `json:"minSimilarity"`
+}
+
+// LocationMergeRequest names the location to keep and the duplicates to fold into it
+type LocationMergeRequest struct {
+	TargetID  string   `json:"targetId"`
+	SourceIDs []string `json:"sourceIds"`
+}
+
+// LocationMergeResult is the surviving location and the documents rewritten to point at it
+type LocationMergeResult struct {
+	Location Location `json:"location"`
+	// Removed lists the source locations that existed and were deleted
+	Removed            []string `json:"removed"`
+	CommunitiesUpdated int64    `json:"communitiesUpdated"`
+	MembershipsUpdated int64    `json:"membershipsUpdated"`
+}
+
+// duplicateLink is a pair of locations close enough with names similar enough to be the same place
+type duplicateLink struct {
+	a, b       int
+	distance   float64
+	similarity float64
+}
+
+// nameSimilarity rates how alike two folded names are between 0 and 1
+func nameSimilarity(a, b string, trigramsA, trigramsB map[string]struct{}) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	score := 0.6*editSimilarity(a, b) + 0.4*trigramSimilarity(trigramsA, trigramsB)
+
+	// One name extending the other, e.g. "central park" and "central park nyc", is a strong hint
+	shorter, longer := strings.Fields(a), strings.Fields(b)
+	if len(shorter) > len(longer) {
+		shorter, longer = longer, shorter
+	}
+	words := make(map[string]bool, len(longer))
+	for _, word := range longer {
+		words[word] = true
+	}
+	contained := true
+	for _, word := range shorter {
+		contained = contained && words[word]
+	}
+	if contained {
+		score = math.Max(score, 0.9)
+	}
+	return score
+}
+
+// findDuplicateGroups links every pair of locations within maxDistance meters whose names are at
+// least minSimilarity alike and returns the connected groups, largest first
+func findDuplicateGroups(locations []Location, maxDistance, minSimilarity float64) []DuplicateGroup {
+	n := len(locations)
+	names := make([]string, n)
+	grams := make([]map[string]struct{}, n)
+	ids := make([]string, n)
+	boxes := make([]BoundingBox, n)
+	items := make([]int, n)
+	for i, l := range locations {
+		names[i] = foldText(l.Name)
+		grams[i] = trigrams(names[i])
+		ids[i] = l.ID
+		boxes[i] = pointBBox(l.Latitude, l.Longitude)
+		items[i] = i
+	}
+	var tree rtree[int]
+	tree.Load(ids, boxes, items)
+
+	// Union-find over the linked pairs
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	var links []duplicateLink
+	degree := make([]int, n)
+	for i, l := range locations {
+		// Only look at later locations so every pair is compared once
+		for _, near := range tree.Nearest(l.Latitude, l.Longitude, n, maxDistance, func(j int) bool { return j > i }) {
+			j := near.Item
+			similarity := nameSimilarity(names[i], names[j], grams[i], grams[j])
+			if similarity < minSimilarity {
+				continue
+			}
+			links = append(links, duplicateLink{a: i, b: j, distance: near.Distance, similarity: similarity})
+			degree[i]++
+			degree[j]++
+			parent[find(i)] = find(j)
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range locations {
+		if degree[i] > 0 {
+			members[find(i)] = append(members[find(i)], i)
+		}
+	}
+	groups := make(map[int]*DuplicateGroup, len(members))
+	for root, indexes := range members {
+		sort.Slice(indexes, func(x, y int) bool {
+			if degree[indexes[x]] != degree[indexes[y]] {
+				return degree[indexes[x]] > degree[indexes[y]]
+			}
+			return locations[indexes[x]].ID < locations[indexes[y]].ID
+		})
+		group := &DuplicateGroup{MinSimilarity: 1}
+		for _, i := range indexes {
+			group.Locations = append(group.Locations, locations[i])
+		}
+		group.SuggestedID = group.Locations[0].ID
+		groups[root] = group
+	}
+	for _, link := range links {
+		group := groups[find(link.a)]
+		group.MaxDistance = math.Max(group.MaxDistance, link.distance)
+		group.MinSimilarity = math.Min(group.MinSimilarity, link.similarity)
+	}
+
+	result := make([]DuplicateGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i].Locations) != len(result[j].Locations) {
+			return len(result[i].Locations) > len(result[j].Locations)
+		}
+		return result[i].SuggestedID < result[j].SuggestedID
+	})
+	return result
+}
+
+// mergeLocations folds the source locations into the target: the target keeps its own fields and
+// takes a description from the sources when it has none, every community embedding or membership
+// referencing a source is pointed at the target and then the sources are deleted. References are
+// rewritten before anything is deleted so a failed merge can simply be retried.
+func mergeLocations(ctx context.Context, req LocationMergeRequest) (LocationMergeResult, error) {
+	db := client.Database("geolocapi")
+	locations := db.Collection("locations")
+
+	var target Location
+	if err := locations.FindOne(ctx, bson.M{"id": req.TargetID}).Decode(&target); err != nil {
+		return LocationMergeResult{}, err
+	}
+	cursor, err := locations.Find(ctx, bson.M{"id": bson.M{"$in": req.SourceIDs}})
+	if err != nil {
+		return LocationMergeResult{}, err
+	}
+	var sources []Location
+	if err := cursor.All(ctx, &sources); err != nil {
+		return LocationMergeResult{}, err
+	}
+
+	// Fill in what the target is missing
+	removed := make([]string, 0, len(sources))
+	for _, source := range sources {
+		removed = append(removed, source.ID)
+		if target.Description == "" && source.Description != "" {
+			target.Description = source.Description
+		}
+	}
+	setLocationDerivedFields(&target)
+	if _, err := locations.ReplaceOne(ctx, bson.M{"id": target.ID}, target); err != nil {
+		return LocationMergeResult{}, err
+	}
+
+	// Communities embed a copy of their location, refresh the copies of the target as well
+	result := LocationMergeResult{Location: target, Removed: removed}
+	embedded := append([]string{target.ID}, req.SourceIDs...)
+	update, err := db.Collection("communities").UpdateMany(ctx,
+		bson.M{"location.id": bson.M{"$in": embedded}},
+		bson.M{"$set": bson.M{"location": target}})
+	if err != nil {
+		return result, err
+	}
+	result.CommunitiesUpdated = update.ModifiedCount
+
+	// Memberships embedded in communities reference home locations too
+	update, err = db.Collection("communities").UpdateMany(ctx,
+		bson.M{"members.homelocationid": bson.M{"$in": req.SourceIDs}},
+		bson.M{"$set": bson.M{"members.$[member].homelocationid": target.ID}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"member.homelocationid": bson.M{"$in": req.SourceIDs}},
+		}}))
+	if err != nil {
+		return result, err
+	}
+	result.CommunitiesUpdated += update.ModifiedCount
+
+	update, err = db.Collection("memberships").UpdateMany(ctx,
+		bson.M{"homelocationid": bson.M{"$in": req.SourceIDs}},
+		bson.M{"$set": bson.M{"homelocationid": target.ID}})
+	if err != nil {
+		return result, err
+	}
+	result.MembershipsUpdated = update.ModifiedCount
+
+	if _, err := locations.DeleteMany(ctx, bson.M{"id": bson.M{"$in": req.SourceIDs}}); err != nil {
+		return result, err
+	}
+
+	// Keep caches and the spatial index in step with this change
+	for _, id := range removed {
+		onLocationDeleted(id)
+	}
+	onLocationSaved(target)
+	onCommunityChanged()
+	onMembershipChanged()
+	return result, nil
+}
+
+// GetLocationDuplicates godoc
+// @Summary Find duplicate locations
+// @Description Groups locations that are close to each other and have similar names, e.g. "Central Park" and "Central park NYC" a few meters apart
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param maxDistance query number false "Largest distance in meters between duplicates (default 100)"
+// @Param minSimilarity query number false "Lowest name similarity between 0 and 1 of duplicates (default 0.6)"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Success 200 {object} []DuplicateGroup
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location/duplicates [get]
+func GetLocationDuplicates(w http.ResponseWriter, r *http.Request) {
+	// Parse the thresholds
+	maxDistance := configFloat("Duplicates.MaxDistance", defaultDuplicateMaxDistance)
+	if value := r.URL.Query().Get("maxDistance"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(parsed > 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid maxDistance: must be a positive number of meters")
+			return
+		}
+		maxDistance = parsed
+	}
+	minSimilarity := config.GetFloat64("Duplicates.MinSimilarity")
+	if minSimilarity <= 0 || minSimilarity > 1 {
+		minSimilarity = defaultDuplicateMinSimilarity
+	}
+	if value := r.URL.Query().Get("minSimilarity"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(parsed >= 0 && parsed <= 1) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid minSimilarity: must be between 0 and 1")
+			return
+		}
+		minSimilarity = parsed
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Compare every location with its neighbours
+	locations, err := loadAllLocations(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error finding locations: %v", err)
+		return
+	}
+	// Group by the positions the caller may see, otherwise the maxDistance threshold and the
+	// reported distances would reveal how far apart private locations really are
+	obfuscateLocations(r.Context(), locations)
+	groups := findDuplicateGroups(locations, maxDistance, minSimilarity)
+
+	// Marshal groups to JSON
+	jsonData, err := json.Marshal(groups)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
+
+// MergeLocations godoc
+// @Summary Merge duplicate locations
+// @Description Keeps the target location, points every community and membership that embeds or references a source location at the target and deletes the sources
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param merge body LocationMergeRequest true "Location to keep and duplicates to merge into it"
+// @Param X-API-Key header string false "Privileged API key, a private target is obfuscated without one"
+// @Success 200 {object} LocationMergeResult
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location/merge [post]
+func MergeLocations(w http.ResponseWriter, r *http.Request) {
+	// Decode the request body
+	var req LocationMergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error decoding request body: %v", err)
+		return
+	}
+	if req.TargetID == "" || len(req.SourceIDs) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "targetId and at least one of sourceIds are required")
+		return
+	}
+	for _, id := range req.SourceIDs {
+		if id == req.TargetID {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "sourceIds must not contain targetId")
+			return
+		}
+	}
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Merge the locations
+	result, err := mergeLocations(ctx, req)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Item not found"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error merging locations: %v", err)
+		return
+	}
+
+	// Hide the exact position of a private target from callers without elevated rights
+	obfuscateLocation(r.Context(), &result.Location)
+
+	// Marshal the result to JSON
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
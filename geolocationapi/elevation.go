@@ -0,0 +1,551 @@
+package geolocationapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"temprest/config"
+	"temprest/logging"
+	"time"
+)
+
+// Elevation defaults used when the Elevation config section is missing
+const (
+	defaultElevationCacheSize    = 256
+	defaultElevationMaxBatchSize = 1000
+	defaultElevationMaxBodyBytes = 1 << 20
+)
+
+// SRTM height files hold 1201 (3 arc-second) or 3601 (1 arc-second) rows of big-endian int16 samples,
+// voids are -32768
+const (
+	hgtVoid      = -32768
+	hgtSampleLen = 2
+)
+
+// Elevations outside this range in meters are rejected on write
+const (
+	minElevation = -12000
+	maxElevation = 12000
+)
+
+// ElevationPoint is a position of a batch elevation request
+type ElevationPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// ElevationResult is the ground elevation of a position in meters above sea level, null where the
+// elevation tiles have no data
+type ElevationResult struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Elevation *float64 `json:"elevation"`
+	// Source is the tile file the elevation was read from
+	Source string `json:"source,omitempty"`
+}
+
+// errElevationNotConfigured is returned when Elevation.Path is not set
+var errElevationNotConfigured = errors.New("elevation tiles are not configured")
+
+// hgtNamePattern matches SRTM tile names such as N40W074.hgt, named after their south west corner
+var hgtNamePattern = regexp.MustCompile(`^([NS])(\d{2})([EW])(\d{3})\.HGT$`)
+
+// demTile is an elevation raster whose samples are read on demand in chunks of rows or tiles
+type demTile struct {
+	path string
+	name string
+	// originLng and originLat are the centre of the first sample, stepLng and stepLat the sample spacing in degrees
+	originLng, originLat float64
+	stepLng, stepLat     float64
+	cols, rows           int
+	chunkWidth           int
+	chunkHeight          int
+	readChunk            func(file io.ReaderAt, index int) ([]float64, error)
+}
+
+// demIndex holds the elevation tiles in an R-tree of their extents
+type demIndex struct {
+	tree rtree[*demTile]
+}
+
+// elevationRetryInterval is how long a failed or empty load is remembered before the tiles are
+// indexed again, so tiles added after the server started are picked up without a restart
+const elevationRetryInterval = time.Minute
+
+var (
+	elevationMu       sync.Mutex
+	loadedElevation   *demIndex
+	elevationErr      error
+	elevationFailedAt time.Time
+)
+
+// getElevationTiles indexes the configured elevation tiles the first time they are needed, a failed
+// load is retried once elevationRetryInterval has passed
+func getElevationTiles() (*demIndex, error) {
+	elevationMu.Lock()
+	defer elevationMu.Unlock()
+
+	if loadedElevation != nil {
+		return loadedElevation, nil
+	}
+	if elevationErr != nil && time.Since(elevationFailedAt) < elevationRetryInterval {
+		return nil, elevationErr
+	}
+	loadedElevation, elevationErr = loadElevationTiles(config.GetString("Elevation.Path"))
+	if elevationErr != nil {
+		elevationFailedAt = time.Now()
+		if elevationErr != errElevationNotConfigured {
+			logging.DoLoggingLevelBasedLogs(logging.Error, "", logging.EnrichErrorWithStackTrace(errors.New("error loading elevation tiles: "+elevationErr.Error())))
+		}
+	}
+	return loadedElevation, elevationErr
+}
+
+// loadElevationTiles indexes the SRTM .hgt and GeoTIFF files below a directory, only their layout
+// is read and files that cannot be used are skipped with a warning
+func loadElevationTiles(dir string) (*demIndex, error) {
+	if dir == "" {
+		return nil, errElevationNotConfigured
+	}
+
+	var ids []string
+	var boxes []BoundingBox
+	var items []*demTile
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		var tile *demTile
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".hgt":
+			tile, err = openHGTTile(path)
+		case ".tif", ".tiff":
+			tile, err = openGeoTIFFTile(path)
+		default:
+			return nil
+		}
+		if err != nil {
+			logging.DoLoggingLevelBasedLogs(logging.Warn, fmt.Sprintf("skipping elevation tile %s: %v", path, err), nil)
+			return nil
+		}
+		ids = append(ids, path)
+		boxes = append(boxes, tile.bounds())
+		items = append(items, tile)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no usable .hgt or GeoTIFF files below %s", dir)
+	}
+
+	index := &demIndex{}
+	index.tree.Load(ids, boxes, items)
+	logging.DoLoggingLevelBasedLogs(logging.Info, fmt.Sprintf("elevation tiles loaded with %d files", len(items)), nil)
+	return index, nil
+}
+
+// openHGTTile reads the corner of an SRTM tile from its name and the resolution from its size
+func openHGTTile(path string) (*demTile, error) {
+	name := filepath.Base(path)
+	m := hgtNamePattern.FindStringSubmatch(strings.ToUpper(name))
+	if m == nil {
+		return nil, errors.New("name must look like N40W074.hgt")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	size := int(math.Round(math.Sqrt(float64(info.Size() / hgtSampleLen))))
+	if size < 2 || int64(size*size*hgtSampleLen) != info.Size() {
+		return nil, fmt.Errorf("unexpected size of %d bytes", info.Size())
+	}
+
+	lat, _ := strconv.Atoi(m[2])
+	lng, _ := strconv.Atoi(m[4])
+	if m[1] == "S" {
+		lat = -lat
+	}
+	if m[3] == "W" {
+		lng = -lng
+	}
+	step := 1 / float64(size-1)
+	return &demTile{
+		path:        path,
+		name:        name,
+		originLng:   float64(lng),
+		originLat:   float64(lat + 1),
+		stepLng:     step,
+		stepLat:     step,
+		cols:        size,
+		rows:        size,
+		chunkWidth:  size,
+		chunkHeight: 1,
+		readChunk: func(file io.ReaderAt, row int) ([]float64, error) {
+			data := make([]byte, size*hgtSampleLen)
+			if _, err := file.ReadAt(data, int64(row*size*hgtSampleLen)); err != nil {
+				return nil, err
+			}
+			samples := make([]int16, size)
+			if err := binary.Read(bytes.NewReader(data), binary.BigEndian, samples); err != nil {
+				return nil, err
+			}
+			values := make([]float64, size)
+			for i, sample := range samples {
+				values[i] = float64(sample)
+				if sample == hgtVoid {
+					values[i] = math.NaN()
+				}
+			}
+			return values, nil
+		},
+	}, nil
+}
+
+// openGeoTIFFTile reads the layout of a GeoTIFF elevation file
+func openGeoTIFFTile(path string) (*demTile, error) {
+	t, err := openGeoTIFF(path)
+	if err != nil {
+		return nil, err
+	}
+	return &demTile{
+		path:        path,
+		name:        filepath.Base(path),
+		originLng:   t.originLng,
+		originLat:   t.originLat,
+		stepLng:     t.stepLng,
+		stepLat:     t.stepLat,
+		cols:        t.width,
+		rows:        t.height,
+		chunkWidth:  t.chunkWidth,
+		chunkHeight: t.chunkHeight,
+		readChunk:   t.readChunk,
+	}, nil
+}
+
+// bounds returns the area covered by a tile, half a sample beyond the outer samples so there is no
+// gap between neighbouring tiles whose samples are pixel centres
+func (t *demTile) bounds() BoundingBox {
+	return BoundingBox{
+		MinLat: t.originLat - (float64(t.rows)-0.5)*t.stepLat,
+		MaxLat: t.originLat + t.stepLat/2,
+		MinLng: t.originLng - t.stepLng/2,
+		MaxLng: t.originLng + (float64(t.cols)-0.5)*t.stepLng,
+	}
+}
+
+// demChunkKey identifies a decoded chunk of a tile
+type demChunkKey struct {
+	path  string
+	index int
+}
+
+// demChunkCache keeps recently decoded chunks, evicting the oldest once Elevation.CacheSize is reached
+type demChunkCache struct {
+	mu     sync.Mutex
+	chunks map[demChunkKey][]float64
+	order  []demChunkKey
+}
+
+// elevationChunks is the process wide cache of decoded elevation samples
+var elevationChunks = &demChunkCache{chunks: map[demChunkKey][]float64{}}
+
+// get returns a decoded chunk of a tile, reading it from disk when it is not cached
+func (c *demChunkCache) get(t *demTile, index int) ([]float64, error) {
+	key := demChunkKey{path: t.path, index: index}
+	c.mu.Lock()
+	values, ok := c.chunks[key]
+	c.mu.Unlock()
+	if ok {
+		return values, nil
+	}
+
+	file, err := os.Open(t.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if values, err = t.readChunk(file, index); err != nil {
+		return nil, err
+	}
+
+	size := config.GetInt("Elevation.CacheSize")
+	if size <= 0 {
+		size = defaultElevationCacheSize
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.chunks[key]; !ok {
+		for len(c.order) >= size {
+			delete(c.chunks, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.chunks[key] = values
+		c.order = append(c.order, key)
+	}
+	return values, nil
+}
+
+// sample returns the value at a column and row of a tile, NaN for voids
+func (t *demTile) sample(col, row int) (float64, error) {
+	chunksAcross := (t.cols + t.chunkWidth - 1) / t.chunkWidth
+	values, err := elevationChunks.get(t, row/t.chunkHeight*chunksAcross+col/t.chunkWidth)
+	if err != nil {
+		return 0, err
+	}
+	offset := row%t.chunkHeight*t.chunkWidth + col%t.chunkWidth
+	if offset >= len(values) {
+		return math.NaN(), nil
+	}
+	return values[offset], nil
+}
+
+// elevation interpolates bilinearly between the four samples around a position, voids are left out
+// and ok is false when all four are voids
+func (t *demTile) elevation(lat, lng float64) (value float64, ok bool, err error) {
+	x := math.Max(0, math.Min(float64(t.cols-1), (lng-t.originLng)/t.stepLng))
+	y := math.Max(0, math.Min(float64(t.rows-1), (t.originLat-lat)/t.stepLat))
+	col := int(math.Min(math.Floor(x), float64(t.cols-2)))
+	row := int(math.Min(math.Floor(y), float64(t.rows-2)))
+	fx, fy := x-float64(col), y-float64(row)
+
+	var sum, weights float64
+	for _, corner := range [4]struct {
+		dx, dy int
+		weight float64
+	}{
+		{0, 0, (1 - fx) * (1 - fy)},
+		{1, 0, fx * (1 - fy)},
+		{0, 1, (1 - fx) * fy},
+		{1, 1, fx * fy},
+	} {
+		v, err := t.sample(col+corner.dx, row+corner.dy)
+		if err != nil {
+			return 0, false, err
+		}
+		if math.IsNaN(v) || corner.weight == 0 {
+			continue
+		}
+		sum += v * corner.weight
+		weights += corner.weight
+	}
+	if weights == 0 {
+		return 0, false, nil
+	}
+	return sum / weights, true, nil
+}
+
+// lookup returns the elevation of a position from the finest tile covering it that has data there
+func (i *demIndex) lookup(lat, lng float64) (ElevationResult, error) {
+	result := ElevationResult{Latitude: lat, Longitude: lng}
+	var candidates []*demTile
+	i.tree.Search(pointBBox(lat, lng), func(t *demTile) bool {
+		candidates = append(candidates, t)
+		return true
+	})
+	sort.Slice(candidates, func(a, b int) bool { return candidates[a].stepLat < candidates[b].stepLat })
+
+	for _, t := range candidates {
+		value, ok, err := t.elevation(lat, lng)
+		if err != nil {
+			return result, fmt.Errorf("%s: %v", t.name, err)
+		}
+		if ok {
+			// Round to centimeters, finer digits are noise for any elevation model
+			value = math.Round(value*100) / 100
+			result.Elevation = &value
+			result.Source = t.name
+			break
+		}
+	}
+	return result, nil
+}
+
+// lookupElevation returns the elevation of a position from the configured tiles
+func lookupElevation(lat, lng float64) (ElevationResult, error) {
+	index, err := getElevationTiles()
+	if err != nil {
+		return ElevationResult{Latitude: lat, Longitude: lng}, err
+	}
+	return index.lookup(lat, lng)
+}
+
+// validateLocationElevation checks a given elevation is a plausible number of meters
+func validateLocationElevation(l *Location) error {
+	if l.Elevation == nil {
+		return nil
+	}
+	e := *l.Elevation
+	if math.IsNaN(e) || math.IsInf(e, 0) || e < minElevation || e > maxElevation {
+		return fmt.Errorf("elevation must be between %d and %d meters", minElevation, maxElevation)
+	}
+	return nil
+}
+
+// setLocationElevation looks up the elevation of a location that has none, it is left empty when
+// the tiles are unavailable or have no data at the position
+func setLocationElevation(l *Location) {
+	if l.Elevation != nil {
+		return
+	}
+	result, err := lookupElevation(l.Latitude, l.Longitude)
+	if err != nil {
+		if err != errElevationNotConfigured {
+			logging.DoLoggingLevelBasedLogs(logging.Warn, "could not look up elevation: "+err.Error(), nil)
+		}
+		return
+	}
+	l.Elevation = result.Elevation
+}
+
+// GetElevation godoc
+// @Summary Get the elevation of a position
+// @Description Reads the ground elevation in meters from the offline SRTM and GeoTIFF elevation tiles, interpolating between samples
+// @Tags geocode
+// @Accept json
+// @Produce json
+// @Param lat query number true "Latitude"
+// @Param lng query number true "Longitude"
+// @Success 200 {object} ElevationResult
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 503 {string} string "Service Unavailable"
+// @Router /geolocationapi/geocode/elevation [get]
+func GetElevation(w http.ResponseWriter, r *http.Request) {
+	// Parse the query point
+	lat, lng, err := parseLatLngQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid point: %v", err)
+		return
+	}
+
+	// Look up the elevation
+	result, err := lookupElevation(lat, lng)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "Elevation lookup is unavailable: %v", err)
+		return
+	}
+	if result.Elevation == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("No elevation data at this position"))
+		return
+	}
+
+	// Marshal result to JSON
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
+
+// GetElevations godoc
+// @Summary Get the elevation of several positions
+// @Description Reads the ground elevation of every position from the offline elevation tiles, the elevation is null where the tiles have no data
+// @Tags geocode
+// @Accept json
+// @Produce json
+// @Param points body []ElevationPoint true "Positions to look up"
+// @Success 200 {object} []ElevationResult
+// @Failure 400 {string} string "Bad Request"
+// @Failure 413 {string} string "Request Entity Too Large"
+// @Failure 503 {string} string "Service Unavailable"
+// @Router /geolocationapi/geocode/elevation [post]
+func GetElevations(w http.ResponseWriter, r *http.Request) {
+	// Limit the size of the request body before decoding it
+	maxBytes := limitRequestBody(w, r, "Elevation.MaxBodyBytes", defaultElevationMaxBodyBytes)
+
+	// Decode the request body into points
+	var points []ElevationPoint
+	err := json.NewDecoder(r.Body).Decode(&points)
+	if writeBodyTooLarge(w, err, maxBytes) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error decoding request body: %v", err)
+		return
+	}
+
+	// Check the batch size
+	maxBatch := config.GetInt("Elevation.MaxBatchSize")
+	if maxBatch <= 0 {
+		maxBatch = defaultElevationMaxBatchSize
+	}
+	if len(points) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No points in request body")
+		return
+	}
+	if len(points) > maxBatch {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		fmt.Fprintf(w, "Batch of %d points exceeds the limit of %d", len(points), maxBatch)
+		return
+	}
+
+	// Validate every point before looking any of them up
+	for i, p := range points {
+		if err := validateCoordinate(p.Latitude, true); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid point at index %d: %v", i, err)
+			return
+		}
+		if err := validateCoordinate(p.Longitude, false); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid point at index %d: %v", i, err)
+			return
+		}
+	}
+
+	// Look up the elevations
+	index, err := getElevationTiles()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "Elevation lookup is unavailable: %v", err)
+		return
+	}
+	results := make([]ElevationResult, len(points))
+	for i, p := range points {
+		if results[i], err = index.lookup(p.Latitude, p.Longitude); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "Elevation lookup is unavailable: %v", err)
+			return
+		}
+	}
+
+	// Marshal results to JSON
+	jsonData, err := json.Marshal(results)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
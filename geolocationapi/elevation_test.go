@@ -0,0 +1,73 @@
+package geolocationapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetElevationsRejectsLargeBodies(t *testing.T) {
+	point := `{"latitude":46.5197,"longitude":6.6323},`
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"malformed", `[{"latitude":`, http.StatusBadRequest},
+		{"empty batch", `[]`, http.StatusBadRequest},
+		{"body over the byte limit", "[" + strings.Repeat(point, defaultElevationMaxBodyBytes/len(point)+1) + "]", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			GetElevations(w, httptest.NewRequest(http.MethodPost, "/geolocationapi/geocode/elevation", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestLoadElevationTiles(t *testing.T) {
+	empty := t.TempDir()
+	withTile := t.TempDir()
+	// A 3 arc-second SRTM tile at a constant 100 m
+	samples := bytes.Repeat([]byte{0, 100}, 1201*1201)
+	if err := os.WriteFile(filepath.Join(withTile, "N46E006.hgt"), samples, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		wantErr bool
+	}{
+		{"not configured", "", true},
+		{"missing directory", filepath.Join(empty, "missing"), true},
+		// An empty load is an error so getElevationTiles retries it instead of keeping it
+		{"no tiles", empty, true},
+		{"one tile", withTile, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, err := loadElevationTiles(tt.dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadElevationTiles error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			result, err := index.lookup(46.5197, 6.6323)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Elevation == nil || *result.Elevation != 100 {
+				t.Errorf("elevation = %v, want 100", result.Elevation)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package geolocationapi
+
+// onLocationSaved keeps the in-process caches and indexes in step with a created or updated location
+func onLocationSaved(l Location) {
+	clusterCache.invalidate()
+	tiles.invalidate(TileLayerLocations)
+	locationIndex.upsert(l)
+	communityStats.invalidate()
+}
+
+// onLocationDeleted keeps the in-process caches and indexes in step with a deleted location
+func onLocationDeleted(id string) {
+	clusterCache.invalidate()
+	tiles.invalidate(TileLayerLocations)
+	locationIndex.remove(id)
+	communityStats.invalidate()
+}
+
+// onCommunityChanged keeps the in-process caches in step with a created, updated or deleted community
+func onCommunityChanged() {
+	tiles.invalidate(TileLayerCommunities)
+	geofences.invalidate()
+	communityStats.invalidate()
+}
+
+// onMembershipChanged keeps the in-process caches in step with a created, updated or deleted membership
+func onMembershipChanged() {
+	communityStats.invalidate()
+}
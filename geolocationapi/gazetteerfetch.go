@@ -0,0 +1,139 @@
+package geolocationapi
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"temprest/config"
+)
+
+// DefaultGazetteerDataset is the GeoNames cities dump fetched when none is given, places with a
+// population of at least 15000
+const DefaultGazetteerDataset = "cities15000"
+
+// geoNamesDumpURL is the directory of the GeoNames dump files
+const geoNamesDumpURL = "https://download.geonames.org/export/dump/"
+
+// FetchGazetteer downloads a GeoNames cities dump to Geocoder.GazetteerPath, and the admin code and
+// country files to Geocoder.Admin1Path, Admin2Path and CountryInfoPath when they are configured. It
+// returns the paths written. Every file is only replaced once the download parses, so a failed fetch
+// keeps the files in use.
+func FetchGazetteer(ctx context.Context, dataset string) ([]string, error) {
+	path := config.GetString("Geocoder.GazetteerPath")
+	if path == "" {
+		return nil, errGazetteerNotConfigured
+	}
+
+	// The places come as a zip archive holding a text file of the same name
+	err := fetchGeoNamesFile(ctx, dataset+".zip", path, func(download string) error {
+		extracted, err := extractGazetteer(download, dataset)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(extracted)
+		places, err := readGazetteerPlaces(extracted)
+		if err != nil {
+			return err
+		}
+		if len(places) == 0 {
+			return fmt.Errorf("%s has no places", dataset)
+		}
+		return os.Rename(extracted, download)
+	})
+	if err != nil {
+		return nil, err
+	}
+	written := []string{path}
+
+	// Region and country names are plain text files
+	codeFiles := []struct {
+		key, name              string
+		codeColumn, nameColumn int
+	}{
+		{"Geocoder.Admin1Path", "admin1CodesASCII.txt", 0, 1},
+		{"Geocoder.Admin2Path", "admin2Codes.txt", 0, 1},
+		{"Geocoder.CountryInfoPath", "countryInfo.txt", 0, 4},
+	}
+	for _, file := range codeFiles {
+		target := config.GetString(file.key)
+		if target == "" {
+			continue
+		}
+		err := fetchGeoNamesFile(ctx, file.name, target, func(download string) error {
+			codes, err := readGeoNamesCodes(download, file.codeColumn, file.nameColumn)
+			if err != nil {
+				return err
+			}
+			if len(codes) == 0 {
+				return fmt.Errorf("%s has no codes", file.name)
+			}
+			return nil
+		})
+		if err != nil {
+			return written, err
+		}
+		written = append(written, target)
+	}
+	return written, nil
+}
+
+// extractGazetteer extracts the text file of a GeoNames dump archive next to it and returns its path
+func extractGazetteer(archive, dataset string) (string, error) {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a zip archive: %v", dataset, err)
+	}
+	defer reader.Close()
+	for _, f := range reader.File {
+		if f.Name != dataset+".txt" {
+			continue
+		}
+		extracted, err := os.CreateTemp(filepath.Dir(archive), ".geonames-*.txt")
+		if err != nil {
+			return "", err
+		}
+		err = extractZipFile(f, extracted)
+		if closeErr := extracted.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(extracted.Name())
+			return "", fmt.Errorf("extracting %s: %v", f.Name, err)
+		}
+		return extracted.Name(), nil
+	}
+	return "", fmt.Errorf("%s has no %s.txt", dataset, dataset)
+}
+
+// fetchGeoNamesFile downloads a file of the GeoNames dump next to path, lets prepare check or
+// convert the download in place and then moves it to path
+func fetchGeoNamesFile(ctx context.Context, name, path string, prepare func(download string) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	// Download next to the target so the final rename stays on one file system
+	download, err := os.CreateTemp(dir, ".geonames-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(download.Name())
+	defer download.Close()
+	if err := downloadURL(ctx, geoNamesDumpURL+name, download); err != nil {
+		return err
+	}
+	if err := download.Close(); err != nil {
+		return err
+	}
+
+	if err := prepare(download.Name()); err != nil {
+		return err
+	}
+	if err := os.Chmod(download.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(download.Name(), path)
+}
@@ -0,0 +1,336 @@
+package geolocationapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"temprest/config"
+	"temprest/logging"
+	"time"
+)
+
+// GazetteerPlace is a named place loaded from a GeoNames style gazetteer
+type GazetteerPlace struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	AsciiName      string   `json:"asciiName,omitempty"`
+	AlternateNames []string `json:"alternateNames,omitempty"`
+	Latitude       float64  `json:"latitude"`
+	Longitude      float64  `json:"longitude"`
+	FeatureClass   string   `json:"featureClass,omitempty"`
+	FeatureCode    string   `json:"featureCode,omitempty"`
+	CountryCode    string   `json:"countryCode,omitempty"`
+	Admin1Code     string   `json:"admin1Code,omitempty"`
+	Admin2Code     string   `json:"admin2Code,omitempty"`
+	Population     int64    `json:"population,omitempty"`
+	TimeZone       string   `json:"timeZone,omitempty"`
+}
+
+// AdminRegion is an administrative division or country
+type AdminRegion struct {
+	Code string `json:"code"`
+	Name string `json:"name,omitempty"`
+}
+
+// ReverseGeocodeResult is the nearest place to a position with its regions
+type ReverseGeocodeResult struct {
+	Place    GazetteerPlace `json:"place"`
+	Distance float64        `json:"distance"`
+	Admin1   *AdminRegion   `json:"admin1,omitempty"`
+	Admin2   *AdminRegion   `json:"admin2,omitempty"`
+	Country  *AdminRegion   `json:"country,omitempty"`
+}
+
+// errGazetteerNotConfigured is returned when Geocoder.GazetteerPath is not set
+var errGazetteerNotConfigured = errors.New("gazetteer is not configured")
+
+// gazetteer holds the places and region names of the configured GeoNames files
+type gazetteer struct {
+	places    []GazetteerPlace
+	tree      rtree[*GazetteerPlace]
+	admin1    map[string]string
+	admin2    map[string]string
+	countries map[string]string
+}
+
+// gazetteerRetryInterval is how long a failed load is remembered before the gazetteer is read again,
+// so files fetched after the server started are picked up without a restart
+const gazetteerRetryInterval = time.Minute
+
+var (
+	gazetteerMu       sync.Mutex
+	loadedGazetteer   *gazetteer
+	gazetteerErr      error
+	gazetteerFailedAt time.Time
+)
+
+// getGazetteer loads the configured gazetteer the first time it is needed, a failed load is retried
+// once gazetteerRetryInterval has passed
+func getGazetteer() (*gazetteer, error) {
+	gazetteerMu.Lock()
+	defer gazetteerMu.Unlock()
+
+	if loadedGazetteer != nil {
+		return loadedGazetteer, nil
+	}
+	if gazetteerErr != nil && time.Since(gazetteerFailedAt) < gazetteerRetryInterval {
+		return nil, gazetteerErr
+	}
+	loadedGazetteer, gazetteerErr = loadGazetteer()
+	if gazetteerErr != nil {
+		gazetteerFailedAt = time.Now()
+		if gazetteerErr != errGazetteerNotConfigured {
+			logging.DoLoggingLevelBasedLogs(logging.Error, "", logging.EnrichErrorWithStackTrace(errors.New("error loading gazetteer: "+gazetteerErr.Error())))
+		}
+	}
+	return loadedGazetteer, gazetteerErr
+}
+
+// loadGazetteer reads the gazetteer and optional admin code and country files
+func loadGazetteer() (*gazetteer, error) {
+	path := config.GetString("Geocoder.GazetteerPath")
+	if path == "" {
+		return nil, errGazetteerNotConfigured
+	}
+
+	g := &gazetteer{}
+	var err error
+	if g.places, err = readGazetteerPlaces(path); err != nil {
+		return nil, err
+	}
+	if len(g.places) == 0 {
+		return nil, fmt.Errorf("%s has no places", path)
+	}
+	if g.admin1, err = readGeoNamesCodes(config.GetString("Geocoder.Admin1Path"), 0, 1); err != nil {
+		return nil, err
+	}
+	if g.admin2, err = readGeoNamesCodes(config.GetString("Geocoder.Admin2Path"), 0, 1); err != nil {
+		return nil, err
+	}
+	// countryInfo.txt has the ISO code in the first column and the name in the fifth
+	if g.countries, err = readGeoNamesCodes(config.GetString("Geocoder.CountryInfoPath"), 0, 4); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(g.places))
+	boxes := make([]BoundingBox, len(g.places))
+	items := make([]*GazetteerPlace, len(g.places))
+	for i := range g.places {
+		p := &g.places[i]
+		ids[i] = p.ID
+		boxes[i] = pointBBox(p.Latitude, p.Longitude)
+		items[i] = p
+	}
+	g.tree.Load(ids, boxes, items)
+
+	logging.DoLoggingLevelBasedLogs(logging.Info, fmt.Sprintf("gazetteer loaded with %d places", len(g.places)), nil)
+	return g, nil
+}
+
+// readGazetteerPlaces parses a GeoNames dump (geonameid, name, asciiname, alternatenames, latitude,
+// longitude, feature class, feature code, country code, cc2, admin1, admin2, admin3, admin4,
+// population, elevation, dem, timezone, modification date)
+func readGazetteerPlaces(path string) ([]GazetteerPlace, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s does not exist, download it with the fetch-gazetteer command", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var places []GazetteerPlace
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		columns := strings.Split(text, "\t")
+		if len(columns) < 9 {
+			return nil, fmt.Errorf("%s:%d: expected at least 9 tab separated columns", path, line)
+		}
+		lat, errLat := strconv.ParseFloat(columns[4], 64)
+		lng, errLng := strconv.ParseFloat(columns[5], 64)
+		if errLat != nil || errLng != nil {
+			return nil, fmt.Errorf("%s:%d: invalid coordinates", path, line)
+		}
+
+		place := GazetteerPlace{
+			ID:           columns[0],
+			Name:         columns[1],
+			AsciiName:    columns[2],
+			Latitude:     lat,
+			Longitude:    lng,
+			FeatureClass: columns[6],
+			FeatureCode:  columns[7],
+			CountryCode:  columns[8],
+		}
+		if columns[3] != "" {
+			place.AlternateNames = strings.Split(columns[3], ",")
+		}
+		if len(columns) > 11 {
+			place.Admin1Code = columns[10]
+			place.Admin2Code = columns[11]
+		}
+		if len(columns) > 14 {
+			place.Population, _ = strconv.ParseInt(columns[14], 10, 64)
+		}
+		if len(columns) > 17 {
+			place.TimeZone = columns[17]
+		}
+		places = append(places, place)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return places, nil
+}
+
+// readGeoNamesCodes reads a tab separated code to name file, an empty path gives an empty map
+func readGeoNamesCodes(path string, codeColumn, nameColumn int) (map[string]string, error) {
+	codes := map[string]string{}
+	if path == "" {
+		return codes, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s does not exist, download it with the fetch-gazetteer command", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		columns := strings.Split(text, "\t")
+		if len(columns) <= nameColumn || len(columns) <= codeColumn {
+			continue
+		}
+		codes[columns[codeColumn]] = columns[nameColumn]
+	}
+	return codes, scanner.Err()
+}
+
+// reverse returns the nearest populated place to a position
+func (g *gazetteer) reverse(lat, lng float64) (ReverseGeocodeResult, bool) {
+	nearest := g.tree.Nearest(lat, lng, 1, 0, nil)
+	if len(nearest) == 0 {
+		return ReverseGeocodeResult{}, false
+	}
+
+	place := *nearest[0].Item
+	result := ReverseGeocodeResult{Place: place, Distance: nearest[0].Distance}
+	if place.CountryCode != "" {
+		result.Country = &AdminRegion{Code: place.CountryCode, Name: g.countries[place.CountryCode]}
+	}
+	if place.Admin1Code != "" {
+		code := place.CountryCode + "." + place.Admin1Code
+		result.Admin1 = &AdminRegion{Code: code, Name: g.admin1[code]}
+		if place.Admin2Code != "" {
+			code += "." + place.Admin2Code
+			result.Admin2 = &AdminRegion{Code: code, Name: g.admin2[code]}
+		}
+	}
+	return result, true
+}
+
+// reverseGeocodeName returns a display name for a position such as "Pittsburgh, Pennsylvania, United States"
+func reverseGeocodeName(lat, lng float64) (string, error) {
+	g, err := getGazetteer()
+	if err != nil {
+		return "", err
+	}
+	result, ok := g.reverse(lat, lng)
+	if !ok {
+		return "", errors.New("gazetteer is empty")
+	}
+
+	parts := []string{result.Place.Name}
+	for _, region := range []*AdminRegion{result.Admin1, result.Country} {
+		if region != nil && region.Name != "" {
+			parts = append(parts, region.Name)
+		}
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// shouldFillLocationName reports whether CreateLocation should reverse geocode a missing name,
+// the fillName query parameter overrides Geocoder.FillMissingNames
+func shouldFillLocationName(r *http.Request) bool {
+	if value := r.URL.Query().Get("fillName"); value != "" {
+		fill, err := strconv.ParseBool(value)
+		return err == nil && fill
+	}
+	return config.GetBool("Geocoder.FillMissingNames")
+}
+
+// GetReverseGeocode godoc
+// @Summary Reverse geocode a position
+// @Description Returns the nearest place from the offline gazetteer with its admin regions and country
+// @Tags geocode
+// @Accept json
+// @Produce json
+// @Param lat query number true "Latitude"
+// @Param lng query number true "Longitude"
+// @Success 200 {object} ReverseGeocodeResult
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 503 {string} string "Service Unavailable"
+// @Router /geolocationapi/geocode/reverse [get]
+func GetReverseGeocode(w http.ResponseWriter, r *http.Request) {
+	// Parse the query point
+	lat, lng, err := parseLatLngQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid point: %v", err)
+		return
+	}
+
+	// Load the gazetteer
+	g, err := getGazetteer()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "Reverse geocoding is unavailable: %v", err)
+		return
+	}
+
+	// Find the nearest place
+	result, ok := g.reverse(lat, lng)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("No place found"))
+		return
+	}
+
+	// Marshal result to JSON
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
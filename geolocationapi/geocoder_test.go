@@ -0,0 +1,65 @@
+package geolocationapi
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractGazetteer(t *testing.T) {
+	berlin := "2950159\tBerlin\tBerlin\tBerlin,Berlino\t52.52437\t13.41053\tP\tPPLC\tDE\t\t16\t00\t\t\t3426354\t\t74\tEurope/Berlin\t2022-01-01\n"
+	tests := []struct {
+		name    string
+		entries map[string]string
+		places  int
+		wantErr bool
+	}{
+		{"dump", map[string]string{"cities15000.txt": berlin}, 1, false},
+		{"wrong entry", map[string]string{"cities500.txt": berlin}, 0, true},
+		{"empty dump", map[string]string{"cities15000.txt": ""}, 0, true},
+		{"broken row", map[string]string{"cities15000.txt": "2950159\tBerlin\n"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "cities15000.zip")
+			file, err := os.Create(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			zw := zip.NewWriter(file)
+			for name, content := range tt.entries {
+				entry, err := zw.Create(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				entry.Write([]byte(content))
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			extracted, err := extractGazetteer(archive, "cities15000")
+			var places []GazetteerPlace
+			if err == nil {
+				defer os.Remove(extracted)
+				places, err = readGazetteerPlaces(extracted)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(places) != tt.places {
+				t.Errorf("got %d places, want %d", len(places), tt.places)
+			}
+		})
+	}
+}
+
+func TestReadGazetteerPlacesMissingFile(t *testing.T) {
+	_, err := readGazetteerPlaces(filepath.Join(t.TempDir(), "cities15000.txt"))
+	if err == nil || !strings.Contains(err.Error(), "fetch-gazetteer") {
+		t.Errorf("error = %v, want a hint at the fetch-gazetteer command", err)
+	}
+}
@@ -0,0 +1,485 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"temprest/config"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Geofence defaults used when the Geofence config section is missing
+const (
+	defaultGeofenceRadius        = 500.0
+	defaultGeofenceEventLimit    = 100
+	defaultGeofenceMaxEventLimit = 1000
+)
+
+// Geofence event types
+const (
+	GeofenceEventEnter = "enter"
+	GeofenceEventExit  = "exit"
+	GeofenceEventDwell = "dwell"
+)
+
+// GeofenceEvent records a member entering, leaving or dwelling in a community geofence
+type GeofenceEvent struct {
+	ID          string  `json:"id"`
+	Type        string  `json:"type"`
+	MemberID    string  `json:"memberId"`
+	CommunityID string  `json:"communityId"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	// Timestamp is when the member crossed the geofence, DetectedAt is when the crossing was confirmed
+	Timestamp  time.Time `json:"timestamp"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// geofence is the area of one community, its boundary or a radius around its location
+type geofence struct {
+	communityID string
+	boundary    *Polygon
+	lat, lng    float64
+	radius      float64
+}
+
+// communityGeofence returns the geofence of a community, falling back to Geofence.DefaultRadius
+// around its location when it has neither a boundary nor a radius
+func communityGeofence(c Community) geofence {
+	f := geofence{communityID: c.ID, boundary: c.Boundary, lat: c.Location.Latitude, lng: c.Location.Longitude, radius: c.GeofenceRadius}
+	if f.boundary == nil && f.radius <= 0 {
+		f.radius = config.GetFloat64("Geofence.DefaultRadius")
+		if f.radius <= 0 {
+			f.radius = defaultGeofenceRadius
+		}
+	}
+	return f
+}
+
+// bounds returns a box around the geofence
+func (f geofence) bounds() BoundingBox {
+	if f.boundary != nil {
+		return f.boundary.bounds()
+	}
+	return radiusBBox(f.lat, f.lng, f.radius)
+}
+
+func (f geofence) contains(lat, lng float64) bool {
+	if f.boundary != nil {
+		return f.boundary.contains(lat, lng)
+	}
+	return haversineMeters(f.lat, f.lng, lat, lng) <= f.radius
+}
+
+// geofenceKey identifies the state of one member in one geofence
+type geofenceKey struct {
+	memberID    string
+	communityID string
+}
+
+// geofenceState tracks a member against one geofence, a crossing stays pending until the member
+// has stayed on the new side for the debounce time
+type geofenceState struct {
+	inside       bool
+	enteredAt    time.Time
+	dwellEmitted bool
+	last         time.Time
+	pending      *TrackedPosition
+}
+
+// geofenceOptions holds the debounce and dwell times
+type geofenceOptions struct {
+	enterDebounce time.Duration
+	exitDebounce  time.Duration
+	dwellTime     time.Duration
+}
+
+// geofenceEngine evaluates position reports against the community geofences, the member states are
+// kept in memory so a restart starts every member outside
+type geofenceEngine struct {
+	mu     sync.Mutex
+	fences []geofence
+	loaded bool
+	states map[geofenceKey]*geofenceState
+}
+
+var geofences = &geofenceEngine{states: map[geofenceKey]*geofenceState{}}
+
+// invalidate reloads the geofences on the next report
+func (e *geofenceEngine) invalidate() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.loaded = false
+}
+
+// load reads the community geofences and forgets states of communities that are gone, the caller holds mu
+func (e *geofenceEngine) load(ctx context.Context) error {
+	communities, err := loadAllCommunities(ctx)
+	if err != nil {
+		return err
+	}
+	e.setCommunities(communities)
+	return nil
+}
+
+// setCommunities replaces the geofences, members keep their state in communities whose area changed
+// and their next report decides against the new area, the caller holds mu
+func (e *geofenceEngine) setCommunities(communities []Community) {
+	e.fences = make([]geofence, 0, len(communities))
+	known := make(map[string]bool, len(communities))
+	for _, c := range communities {
+		e.fences = append(e.fences, communityGeofence(c))
+		known[c.ID] = true
+	}
+	for key := range e.states {
+		if !known[key.communityID] {
+			delete(e.states, key)
+		}
+	}
+	e.loaded = true
+}
+
+// evaluate runs reports through the geofences in time order and returns the events they trigger
+func (e *geofenceEngine) evaluate(ctx context.Context, reports []TrackedPosition, opts geofenceOptions) ([]GeofenceEvent, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.loaded {
+		if err := e.load(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].Timestamp.Before(reports[j].Timestamp) })
+
+	events := []GeofenceEvent{}
+	detectedAt := time.Now().UTC()
+	for i := range reports {
+		report := &reports[i]
+		for _, f := range e.fences {
+			key := geofenceKey{memberID: report.MemberID, communityID: f.communityID}
+			inside := f.contains(report.Latitude, report.Longitude)
+			state, ok := e.states[key]
+			if !ok {
+				// Members only get a state once they are seen inside
+				if !inside {
+					continue
+				}
+				state = &geofenceState{}
+				e.states[key] = state
+			}
+
+			// Late reports cannot change what was already decided
+			if report.Timestamp.Before(state.last) {
+				continue
+			}
+			state.last = report.Timestamp
+
+			for _, event := range state.step(report, inside, opts) {
+				event.ID = primitive.NewObjectID().Hex()
+				event.CommunityID = f.communityID
+				event.DetectedAt = detectedAt
+				events = append(events, event)
+			}
+			if !state.inside && state.pending == nil {
+				delete(e.states, key)
+			}
+		}
+	}
+	return events, nil
+}
+
+// step moves the state with one report and returns the events it triggers
+func (s *geofenceState) step(report *TrackedPosition, inside bool, opts geofenceOptions) []GeofenceEvent {
+	var events []GeofenceEvent
+
+	if inside == s.inside {
+		// Back on the confirmed side, the crossing was jitter
+		s.pending = nil
+	} else {
+		if s.pending == nil {
+			pending := *report
+			s.pending = &pending
+		}
+		debounce := opts.exitDebounce
+		if inside {
+			debounce = opts.enterDebounce
+		}
+		if report.Timestamp.Sub(s.pending.Timestamp) >= debounce {
+			eventType := GeofenceEventExit
+			if inside {
+				eventType = GeofenceEventEnter
+				s.enteredAt = s.pending.Timestamp
+				s.dwellEmitted = false
+			}
+			events = append(events, GeofenceEvent{
+				Type:      eventType,
+				MemberID:  report.MemberID,
+				Latitude:  s.pending.Latitude,
+				Longitude: s.pending.Longitude,
+				Timestamp: s.pending.Timestamp,
+			})
+			s.inside = inside
+			s.pending = nil
+		}
+	}
+
+	if s.inside && s.pending == nil && !s.dwellEmitted && opts.dwellTime > 0 && report.Timestamp.Sub(s.enteredAt) >= opts.dwellTime {
+		events = append(events, GeofenceEvent{
+			Type:      GeofenceEventDwell,
+			MemberID:  report.MemberID,
+			Latitude:  report.Latitude,
+			Longitude: report.Longitude,
+			Timestamp: report.Timestamp,
+		})
+		s.dwellEmitted = true
+	}
+	return events
+}
+
+// geofenceEventsCollection returns the collection of stored geofence events
+func geofenceEventsCollection() *mongo.Collection {
+	return client.Database("geolocapi").Collection("geofenceevents")
+}
+
+// ReportGeofencePositions godoc
+// @Summary Report positions for geofencing
+// @Description Evaluates one position or a batch of member positions against the community geofences and stores the enter, exit and dwell events they trigger
+// @Tags geofence
+// @Accept json
+// @Produce json
+// @Param positions body []TrackedPosition true "Position or array of positions"
+// @Success 200 {object} []GeofenceEvent "events triggered by the reports"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 413 {string} string "Request Entity Too Large"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/geofence/reports [post]
+func ReportGeofencePositions(w http.ResponseWriter, r *http.Request) {
+	// Limit the size of the request body before decoding it, as for ingested positions
+	maxBytes := limitRequestBody(w, r, "Positions.MaxBodyBytes", defaultPositionMaxBodyBytes)
+
+	// Decode the request body into reports
+	reports, err := decodePositions(r)
+	if writeBodyTooLarge(w, err, maxBytes) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error decoding request body: %v", err)
+		return
+	}
+
+	// Check the batch size
+	maxBatch := config.GetInt("Positions.MaxBatchSize")
+	if maxBatch <= 0 {
+		maxBatch = defaultPositionMaxBatchSize
+	}
+	if len(reports) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No positions in request body")
+		return
+	}
+	if len(reports) > maxBatch {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		fmt.Fprintf(w, "Batch of %d positions exceeds the limit of %d", len(reports), maxBatch)
+		return
+	}
+
+	// Validate every report before evaluating any of them
+	for i := range reports {
+		if err := reports[i].validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid position at index %d: %v", i, err)
+			return
+		}
+		reports[i].Timestamp = reports[i].Timestamp.UTC()
+	}
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Evaluate the reports
+	opts := geofenceOptions{
+		enterDebounce: config.GetDuration("Geofence.EnterDebounce"),
+		exitDebounce:  config.GetDuration("Geofence.ExitDebounce"),
+		dwellTime:     config.GetDuration("Geofence.DwellTime"),
+	}
+	events, err := geofences.evaluate(ctx, reports, opts)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error evaluating geofences: %v", err)
+		return
+	}
+
+	// Store the events
+	if len(events) > 0 {
+		documents := make([]interface{}, len(events))
+		for i := range events {
+			documents[i] = events[i]
+		}
+		if _, err := geofenceEventsCollection().InsertMany(ctx, documents); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Error inserting geofence events: %v", err)
+			return
+		}
+	}
+
+	// Marshal events to JSON
+	jsonData, err := json.Marshal(events)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
+
+// GetCommunityGeofenceEvents godoc
+// @Summary Get the geofence events of a community
+// @Description Returns the enter, exit and dwell events of a community, newest first
+// @Tags geofence
+// @Accept json
+// @Produce json
+// @Param id path string true "Community ID"
+// @Param type query string false "Only return events of this type: enter, exit or dwell"
+// @Param from query string false "Only return events at or after this time (RFC 3339)"
+// @Param to query string false "Only return events at or before this time (RFC 3339)"
+// @Param limit query int false "Maximum number of events (default 100)"
+// @Success 200 {object} []GeofenceEvent
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/community/{id}/geofence-events [get]
+func GetCommunityGeofenceEvents(w http.ResponseWriter, r *http.Request) {
+	writeGeofenceEvents(w, r, "communityid")
+}
+
+// GetMemberGeofenceEvents godoc
+// @Summary Get the geofence events of a member
+// @Description Returns the enter, exit and dwell events of a member, newest first
+// @Tags geofence
+// @Accept json
+// @Produce json
+// @Param id path string true "Member ID"
+// @Param type query string false "Only return events of this type: enter, exit or dwell"
+// @Param from query string false "Only return events at or after this time (RFC 3339)"
+// @Param to query string false "Only return events at or before this time (RFC 3339)"
+// @Param limit query int false "Maximum number of events (default 100)"
+// @Success 200 {object} []GeofenceEvent
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/membership/{id}/geofence-events [get]
+func GetMemberGeofenceEvents(w http.ResponseWriter, r *http.Request) {
+	writeGeofenceEvents(w, r, "memberid")
+}
+
+// writeGeofenceEvents answers an event query filtered on field matching the id URL parameter
+func writeGeofenceEvents(w http.ResponseWriter, r *http.Request, field string) {
+	query := r.URL.Query()
+	filter := bson.M{field: chi.URLParam(r, "id")}
+
+	// Parse the type filter
+	if eventType := query.Get("type"); eventType != "" {
+		if eventType != GeofenceEventEnter && eventType != GeofenceEventExit && eventType != GeofenceEventDwell {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid type: must be %s, %s or %s", GeofenceEventEnter, GeofenceEventExit, GeofenceEventDwell)
+			return
+		}
+		filter["type"] = eventType
+	}
+
+	// Parse the time range
+	timeRange := bson.M{}
+	for _, bound := range []struct{ param, operator string }{{"from", "$gte"}, {"to", "$lte"}} {
+		if value := query.Get(bound.param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Invalid %s: %v", bound.param, err)
+				return
+			}
+			timeRange[bound.operator] = t
+		}
+	}
+	if len(timeRange) > 0 {
+		filter["timestamp"] = timeRange
+	}
+
+	// Parse the limit
+	maxLimit := config.GetInt64("Geofence.MaxEventLimit")
+	if maxLimit <= 0 {
+		maxLimit = defaultGeofenceMaxEventLimit
+	}
+	limit := int64(defaultGeofenceEventLimit)
+	if value := query.Get("limit"); value != "" {
+		requested, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || requested < 1 || requested > maxLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid limit: must be between 1 and %d", maxLimit)
+			return
+		}
+		limit = requested
+	}
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Find the events, newest first
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(limit)
+	cursor, err := geofenceEventsCollection().Find(ctx, filter, findOptions)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error retrieving geofence events: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	events := []GeofenceEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error decoding geofence events: %v", err)
+		return
+	}
+
+	// Marshal events to JSON
+	jsonData, err := json.Marshal(events)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
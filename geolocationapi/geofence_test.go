@@ -0,0 +1,132 @@
+package geolocationapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportGeofencePositionsRejectsLargeBodies(t *testing.T) {
+	position := `{"memberId":"m1","latitude":52.52,"longitude":13.40,"timestamp":"2024-03-09T12:00:00Z"},`
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"malformed", `[{"memberId":`, http.StatusBadRequest},
+		{"empty batch", `[]`, http.StatusBadRequest},
+		{"body over the byte limit", "[" + strings.Repeat(position, defaultPositionMaxBodyBytes/len(position)+1) + "]", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ReportGeofencePositions(w, httptest.NewRequest(http.MethodPost, "/geolocationapi/geofence/reports", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+// geofenceTestReport is a position report of member m1 inside or outside the test geofence at a
+// number of seconds after the start
+type geofenceTestReport struct {
+	seconds int
+	inside  bool
+}
+
+// runGeofenceReports feeds reports one at a time into an engine and returns the events as type@seconds
+func runGeofenceReports(t *testing.T, e *geofenceEngine, start time.Time, reports []geofenceTestReport) []string {
+	t.Helper()
+	opts := geofenceOptions{enterDebounce: 30 * time.Second, exitDebounce: time.Minute, dwellTime: 10 * time.Minute}
+	outsideLat, outsideLng := destinationPoint(52.52, 13.40, 0, 1000)
+	var got []string
+	for _, r := range reports {
+		report := TrackedPosition{MemberID: "m1", Latitude: outsideLat, Longitude: outsideLng, Timestamp: start.Add(time.Duration(r.seconds) * time.Second)}
+		if r.inside {
+			report.Latitude, report.Longitude = 52.52, 13.40
+		}
+		events, err := e.evaluate(context.Background(), []TrackedPosition{report}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, event := range events {
+			if event.CommunityID != "c1" || event.MemberID != "m1" {
+				t.Errorf("event %+v is not for m1 in c1", event)
+			}
+			got = append(got, fmt.Sprintf("%s@%v", event.Type, event.Timestamp.Sub(start).Seconds()))
+		}
+	}
+	return got
+}
+
+func TestGeofenceEngineEvents(t *testing.T) {
+	start := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		reports []geofenceTestReport
+		want    []string
+	}{
+		{"enter after the debounce", []geofenceTestReport{{0, true}, {40, true}}, []string{"enter@0"}},
+		{"visit shorter than the enter debounce", []geofenceTestReport{{0, true}, {10, false}, {50, false}}, nil},
+		{"excursion shorter than the exit debounce", []geofenceTestReport{{0, true}, {40, true}, {100, false}, {130, true}, {200, false}, {240, true}, {400, true}},
+			[]string{"enter@0"}},
+		{"enter then dwell once", []geofenceTestReport{{0, true}, {40, true}, {300, true}, {660, true}, {1200, true}},
+			[]string{"enter@0", "dwell@660"}},
+		{"exit after the debounce", []geofenceTestReport{{0, true}, {40, true}, {100, false}, {130, false}, {160, false}, {400, false}},
+			[]string{"enter@0", "exit@100"}},
+		{"exit then enter again", []geofenceTestReport{{0, true}, {40, true}, {100, false}, {160, false}, {200, true}, {230, true}},
+			[]string{"enter@0", "exit@100", "enter@200"}},
+		{"late report", []geofenceTestReport{{0, true}, {40, true}, {100, false}, {50, true}, {160, false}},
+			[]string{"enter@0", "exit@100"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &geofenceEngine{states: map[geofenceKey]*geofenceState{}}
+			e.setCommunities([]Community{{ID: "c1", Location: Location{Latitude: 52.52, Longitude: 13.40}, GeofenceRadius: 200}})
+			got := runGeofenceReports(t, e, start, tt.reports)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeofenceEngineCommunityChanges(t *testing.T) {
+	start := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	// The outside test position is 1000 m north of the community location
+	square := &Polygon{Coordinates: [][][]float64{{{13.38, 52.51}, {13.42, 52.51}, {13.42, 52.54}, {13.38, 52.54}, {13.38, 52.51}}}}
+	tests := []struct {
+		name    string
+		changed []Community
+		want    []string
+	}{
+		{"radius grows over the member", []Community{{ID: "c1", Location: Location{Latitude: 52.52, Longitude: 13.40}, GeofenceRadius: 2000}}, nil},
+		{"radius shrinks", []Community{{ID: "c1", Location: Location{Latitude: 52.52, Longitude: 13.40}, GeofenceRadius: 100}}, []string{"exit@100"}},
+		{"boundary replaces the radius", []Community{{ID: "c1", Location: Location{Latitude: 52.52, Longitude: 13.40}, Boundary: square}}, nil},
+		{"community removed", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &geofenceEngine{states: map[geofenceKey]*geofenceState{}}
+			e.setCommunities([]Community{{ID: "c1", Location: Location{Latitude: 52.52, Longitude: 13.40}, GeofenceRadius: 1500}})
+			// The member enters the large geofence and stays inside it at the outside test position
+			if got := runGeofenceReports(t, e, start, []geofenceTestReport{{0, true}, {40, true}}); fmt.Sprint(got) != "[enter@0]" {
+				t.Fatalf("events before the change = %v", got)
+			}
+
+			e.setCommunities(tt.changed)
+			got := runGeofenceReports(t, e, start, []geofenceTestReport{{100, false}, {130, false}, {160, false}})
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("events after the change = %v, want %v", got, tt.want)
+			}
+			if tt.changed == nil && len(e.states) != 0 {
+				t.Errorf("states of a removed community were kept: %v", e.states)
+			}
+		})
+	}
+}
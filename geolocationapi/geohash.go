@@ -0,0 +1,188 @@
+package geolocationapi
+
+import (
+	"errors"
+	"strings"
+	"temprest/config"
+)
+
+// geohashBase32 is the alphabet used by geohash strings
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohashMaxPrecision is the longest geohash we encode or accept
+const geohashMaxPrecision = 12
+
+// defaultGeohashPrecision is used when Geohash.Precision is not configured, roughly 5m cells
+const defaultGeohashPrecision = 9
+
+// encodeGeohash encodes a latitude/longitude pair into a geohash of the given precision
+func encodeGeohash(lat, lng float64, precision int) string {
+	if precision < 1 {
+		precision = 1
+	}
+	if precision > geohashMaxPrecision {
+		precision = geohashMaxPrecision
+	}
+
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+
+	var hash strings.Builder
+	bit, ch := 0, 0
+	evenBit := true
+	for hash.Len() < precision {
+		// Even bits bisect longitude, odd bits bisect latitude
+		if evenBit {
+			mid := (lngRange[0] + lngRange[1]) / 2
+			if lng >= mid {
+				ch = ch<<1 | 1
+				lngRange[0] = mid
+			} else {
+				ch = ch << 1
+				lngRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if lat >= mid {
+				ch = ch<<1 | 1
+				latRange[0] = mid
+			} else {
+				ch = ch << 1
+				latRange[1] = mid
+			}
+		}
+		evenBit = !evenBit
+
+		bit++
+		if bit == 5 {
+			hash.WriteByte(geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+// geohashBounds returns the south-west and north-east corners of the cell covered by a geohash
+func geohashBounds(hash string) (minLat, minLng, maxLat, maxLng float64, err error) {
+	if hash == "" || len(hash) > geohashMaxPrecision {
+		return 0, 0, 0, 0, errors.New("invalid geohash length")
+	}
+
+	minLat, maxLat = -90, 90
+	minLng, maxLng = -180, 180
+	evenBit := true
+	for _, c := range strings.ToLower(hash) {
+		idx := strings.IndexRune(geohashBase32, c)
+		if idx < 0 {
+			return 0, 0, 0, 0, errors.New("invalid geohash character: " + string(c))
+		}
+		for n := 4; n >= 0; n-- {
+			bitN := idx >> uint(n) & 1
+			if evenBit {
+				mid := (minLng + maxLng) / 2
+				if bitN == 1 {
+					minLng = mid
+				} else {
+					maxLng = mid
+				}
+			} else {
+				mid := (minLat + maxLat) / 2
+				if bitN == 1 {
+					minLat = mid
+				} else {
+					maxLat = mid
+				}
+			}
+			evenBit = !evenBit
+		}
+	}
+	return minLat, minLng, maxLat, maxLng, nil
+}
+
+// decodeGeohash returns the centre of the cell covered by a geohash
+func decodeGeohash(hash string) (lat, lng float64, err error) {
+	minLat, minLng, maxLat, maxLng, err := geohashBounds(hash)
+	if err != nil {
+		return 0, 0, err
+	}
+	return (minLat + maxLat) / 2, (minLng + maxLng) / 2, nil
+}
+
+// isGeohash reports whether s only contains geohash characters
+func isGeohash(s string) bool {
+	if s == "" || len(s) > geohashMaxPrecision {
+		return false
+	}
+	for _, c := range strings.ToLower(s) {
+		if !strings.ContainsRune(geohashBase32, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// GeohashNeighbors holds a geohash cell and the eight cells surrounding it
+type GeohashNeighbors struct {
+	Hash      string `json:"hash"`
+	North     string `json:"n,omitempty"`
+	NorthEast string `json:"ne,omitempty"`
+	East      string `json:"e"`
+	SouthEast string `json:"se,omitempty"`
+	South     string `json:"s,omitempty"`
+	SouthWest string `json:"sw,omitempty"`
+	West      string `json:"w"`
+	NorthWest string `json:"nw,omitempty"`
+}
+
+// geohashNeighbors returns the cells adjacent to a geohash at the same precision,
+// cells beyond the poles are left empty and longitude wraps around the antimeridian
+func geohashNeighbors(hash string) (GeohashNeighbors, error) {
+	hash = strings.ToLower(hash)
+	minLat, minLng, maxLat, maxLng, err := geohashBounds(hash)
+	if err != nil {
+		return GeohashNeighbors{}, err
+	}
+
+	lat, lng := (minLat+maxLat)/2, (minLng+maxLng)/2
+	dLat, dLng := maxLat-minLat, maxLng-minLng
+	neighbor := func(latSteps, lngSteps float64) string {
+		nLat := lat + latSteps*dLat
+		if nLat > 90 || nLat < -90 {
+			return ""
+		}
+		nLng := lng + lngSteps*dLng
+		if nLng >= 180 {
+			nLng -= 360
+		}
+		if nLng < -180 {
+			nLng += 360
+		}
+		return encodeGeohash(nLat, nLng, len(hash))
+	}
+
+	return GeohashNeighbors{
+		Hash:      hash,
+		North:     neighbor(1, 0),
+		NorthEast: neighbor(1, 1),
+		East:      neighbor(0, 1),
+		SouthEast: neighbor(-1, 1),
+		South:     neighbor(-1, 0),
+		SouthWest: neighbor(-1, -1),
+		West:      neighbor(0, -1),
+		NorthWest: neighbor(1, -1),
+	}, nil
+}
+
+// locationGeohashPrecision returns the configured geohash precision for stored locations
+func locationGeohashPrecision() int {
+	precision := config.GetInt("Geohash.Precision")
+	if precision < 1 || precision > geohashMaxPrecision {
+		return defaultGeohashPrecision
+	}
+	return precision
+}
+
+// setLocationGeohash computes and stores the geohash of a location
+func setLocationGeohash(l *Location) {
+	l.Geohash = encodeGeohash(l.Latitude, l.Longitude, locationGeohashPrecision())
+}
@@ -0,0 +1,103 @@
+package geolocationapi
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEncodeGeohash(t *testing.T) {
+	tests := []struct {
+		lat, lng  float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{42.6, -5.6, 5, "ezs42"},
+		{-25.382708, -49.265506, 8, "6gkzwgjz"},
+		{0, 0, 4, "s000"},
+		{90, 180, 3, "zzz"},
+		{-90, -180, 3, "000"},
+		{57.64911, 10.40744, 0, "u"},
+		{57.64911, 10.40744, 20, "u4pruydqqvj8"},
+	}
+	for _, tt := range tests {
+		if got := encodeGeohash(tt.lat, tt.lng, tt.precision); got != tt.want {
+			t.Errorf("encodeGeohash(%v, %v, %d) = %q, want %q", tt.lat, tt.lng, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestGeohashBounds(t *testing.T) {
+	tests := []struct {
+		hash    string
+		wantErr bool
+	}{
+		{"u4pruydqqvj", false},
+		{"EZS42", false},
+		{"s", false},
+		{"", true},
+		{"u4pruydqqvj00", true},
+		{"u4pa", true},
+	}
+	for _, tt := range tests {
+		minLat, minLng, maxLat, maxLng, err := geohashBounds(tt.hash)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("geohashBounds(%q) error = %v, wantErr %v", tt.hash, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		// The centre encodes back to the same cell
+		lat, lng := (minLat+maxLat)/2, (minLng+maxLng)/2
+		if got := encodeGeohash(lat, lng, len(tt.hash)); got != strings.ToLower(tt.hash) {
+			t.Errorf("centre of %q encodes to %q", tt.hash, got)
+		}
+		// Cells alternate between square and twice as wide as tall in degrees
+		ratio := (maxLng - minLng) / (maxLat - minLat)
+		if math.Abs(ratio-1) > 1e-9 && math.Abs(ratio-2) > 1e-9 {
+			t.Errorf("cell of %q is %v times as wide as tall", tt.hash, ratio)
+		}
+	}
+}
+
+func TestDecodeGeohash(t *testing.T) {
+	lat, lng, err := decodeGeohash("u4pruydqqvj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(lat-57.64911) > 1e-5 || math.Abs(lng-10.40744) > 1e-5 {
+		t.Errorf("decodeGeohash = %v,%v, want 57.64911,10.40744", lat, lng)
+	}
+}
+
+func TestGeohashNeighbors(t *testing.T) {
+	tests := []struct {
+		hash string
+		want GeohashNeighbors
+	}{
+		{"dqcjq", GeohashNeighbors{Hash: "dqcjq", North: "dqcjw", NorthEast: "dqcjx", East: "dqcjr", SouthEast: "dqcjp",
+			South: "dqcjn", SouthWest: "dqcjj", West: "dqcjm", NorthWest: "dqcjt"}},
+		// Longitude wraps around the antimeridian and nothing lies beyond the north pole
+		{"zz", GeohashNeighbors{Hash: "zz", East: "bp", South: "zy", SouthEast: "bn", SouthWest: "zw", West: "zx"}},
+	}
+	for _, tt := range tests {
+		got, err := geohashNeighbors(tt.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("geohashNeighbors(%q) = %+v, want %+v", tt.hash, got, tt.want)
+		}
+	}
+}
+
+func TestIsGeohash(t *testing.T) {
+	tests := map[string]bool{"u33d": true, "U33D": true, "": false, "u33a": false, "u33di": false, "0123456789bcd": false}
+	for s, want := range tests {
+		if got := isGeohash(s); got != want {
+			t.Errorf("isGeohash(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
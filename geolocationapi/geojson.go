@@ -0,0 +1,250 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GeoJSONGeometry is a GeoJSON geometry, coordinates are kept raw so every geometry type fits
+type GeoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates" swaggertype:"array,number"`
+}
+
+// GeoJSONFeature is a GeoJSON feature
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	Geometry   *GeoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONFeatureCollection is a GeoJSON feature collection
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// geoJSONObject reads the type of any GeoJSON object along with the members of every object type
+type geoJSONObject struct {
+	Type        string                 `json:"type"`
+	ID          json.RawMessage        `json:"id"`
+	Coordinates json.RawMessage        `json:"coordinates"`
+	Geometry    *GeoJSONGeometry       `json:"geometry"`
+	Properties  map[string]interface{} `json:"properties"`
+	Features    []geoJSONObject        `json:"features"`
+}
+
+// newGeoJSONGeometry builds a geometry from coordinates of any shape
+func newGeoJSONGeometry(geometryType string, coordinates interface{}) (*GeoJSONGeometry, error) {
+	raw, err := json.Marshal(coordinates)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoJSONGeometry{Type: geometryType, Coordinates: raw}, nil
+}
+
+// geoJSONID returns a feature id that may be a string or a number as a string
+func geoJSONID(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	return string(raw)
+}
+
+// featureProperties returns the JSON fields of a record as feature properties, leaving out the
+// fields carried by the geometry
+func featureProperties(record interface{}, omit ...string) map[string]interface{} {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	properties := map[string]interface{}{}
+	if err := json.Unmarshal(data, &properties); err != nil {
+		return map[string]interface{}{}
+	}
+	for _, name := range omit {
+		delete(properties, name)
+	}
+	return properties
+}
+
+// locationFeature converts a location to a GeoJSON Point feature, the elevation is its third coordinate
+func locationFeature(l Location) (GeoJSONFeature, error) {
+	position := []float64{l.Longitude, l.Latitude}
+	if l.Elevation != nil {
+		position = append(position, *l.Elevation)
+	}
+	geometry, err := newGeoJSONGeometry("Point", position)
+	if err != nil {
+		return GeoJSONFeature{}, err
+	}
+	properties := featureProperties(l, "latitude", "longitude", "elevation", "coordinates")
+	return GeoJSONFeature{Type: "Feature", ID: l.ID, Geometry: geometry, Properties: properties}, nil
+}
+
+// communityFeature converts a community to a GeoJSON feature, a Polygon of its boundary or a Point
+// at its location when it has none
+func communityFeature(c Community) (GeoJSONFeature, error) {
+	var geometry *GeoJSONGeometry
+	var err error
+	if c.Boundary != nil {
+		geometry, err = newGeoJSONGeometry("Polygon", c.Boundary.Coordinates)
+	} else {
+		geometry, err = newGeoJSONGeometry("Point", []float64{c.Location.Longitude, c.Location.Latitude})
+	}
+	if err != nil {
+		return GeoJSONFeature{}, err
+	}
+	properties := featureProperties(c, "boundary")
+	return GeoJSONFeature{Type: "Feature", ID: c.ID, Geometry: geometry, Properties: properties}, nil
+}
+
+// propertyString reads a string or number property as a string
+func propertyString(properties map[string]interface{}, name string) string {
+	switch v := properties[name].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// writeFeatureCollection writes features as a GeoJSON FeatureCollection
+func writeFeatureCollection(w http.ResponseWriter, features []GeoJSONFeature) {
+	// Marshal the feature collection to JSON
+	jsonData, err := json.Marshal(GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/geo+json")
+	// Write JSON response
+	w.Write(jsonData)
+}
+
+// ExportLocationsGeoJSON godoc
+// @Summary Export locations as GeoJSON
+// @Description Returns every location as a Point feature of a GeoJSON FeatureCollection
+// @Tags locations
+// @Produce application/geo+json
+// @Param bbox query string false "Only export locations in minLng,minLat,maxLng,maxLat"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Success 200 {object} GeoJSONFeatureCollection
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location.geojson [get]
+func ExportLocationsGeoJSON(w http.ResponseWriter, r *http.Request) {
+	exportLocationsHTTP(w, r, LocationFormatGeoJSON)
+}
+
+// ExportCommunitiesGeoJSON godoc
+// @Summary Export communities as GeoJSON
+// @Description Returns every community as a feature of a GeoJSON FeatureCollection, with its boundary as a Polygon or its location as a Point
+// @Tags Community
+// @Produce application/geo+json
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Success 200 {object} GeoJSONFeatureCollection
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/community.geojson [get]
+func ExportCommunitiesGeoJSON(w http.ResponseWriter, r *http.Request) {
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Load the communities
+	communities, err := loadAllCommunities(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error retrieving communities: %v", err)
+		return
+	}
+
+	// Convert them to features
+	features := []GeoJSONFeature{}
+	for _, c := range communities {
+		// Hide the exact position of a private community location from callers without elevated rights
+		obfuscateCommunity(r.Context(), &c)
+		feature, err := communityFeature(c)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Error converting community %v: %v", c.ID, err)
+			return
+		}
+		features = append(features, feature)
+	}
+
+	writeFeatureCollection(w, features)
+}
+
+// ImportLocationsGeoJSON godoc
+// @Summary Import locations from GeoJSON
+// @Description Upserts a location for every Point feature of a FeatureCollection by id, the name comes from the name property, and reports the outcome of each feature
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param features body GeoJSONFeatureCollection true "FeatureCollection of Point features"
+// @Success 200 {object} ImportReport
+// @Failure 400 {string} string "Bad Request"
+// @Failure 413 {string} string "Request Entity Too Large"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location/import [post]
+func ImportLocationsGeoJSON(w http.ResponseWriter, r *http.Request) {
+	importLocationsHTTP(w, r, LocationFormatGeoJSON)
+}
+
+// featureLocation reads a location from a Point feature, the id comes from the feature or its
+// properties and is generated when both are missing
+func featureLocation(feature geoJSONObject) (Location, error) {
+	l := Location{ID: geoJSONID(feature.ID)}
+	if l.ID == "" {
+		l.ID = propertyString(feature.Properties, "id")
+	}
+	if l.ID == "" {
+		l.ID = primitive.NewObjectID().Hex()
+	}
+	l.Name = propertyString(feature.Properties, "name")
+	l.Description = propertyString(feature.Properties, "description")
+	l.Privacy = propertyString(feature.Properties, "privacy")
+	if value, ok := feature.Properties["address"]; ok {
+		// Round trip the property so exported features import with their address
+		data, err := json.Marshal(value)
+		if err == nil {
+			var address Address
+			if json.Unmarshal(data, &address) == nil {
+				l.Address = &address
+			}
+		}
+	}
+
+	if feature.Type != "Feature" || feature.Geometry == nil {
+		return l, errors.New("not a feature with a geometry")
+	}
+	if feature.Geometry.Type != "Point" {
+		return l, fmt.Errorf("unsupported geometry type %q, expected Point", feature.Geometry.Type)
+	}
+	var position []float64
+	if err := json.Unmarshal(feature.Geometry.Coordinates, &position); err != nil || len(position) < 2 {
+		return l, errors.New("Point needs longitude and latitude coordinates")
+	}
+	l.Longitude, l.Latitude = position[0], position[1]
+	if len(position) > 2 {
+		l.Elevation = &position[2]
+	}
+	return l, nil
+}
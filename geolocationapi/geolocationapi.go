@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"temprest/logging"
 
 	"time"
 
@@ -20,6 +22,24 @@ type Location struct {
 	Name      string  `json:"name"`
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
+	// Description is free text carried over from KML and GPX files
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	// Address is the optional structured postal address, normalized on write
+	Address *Address `json:"address,omitempty" bson:"address,omitempty"`
+	// Elevation in meters above sea level is looked up on write from the elevation tiles when not given
+	Elevation *float64 `json:"elevation,omitempty" bson:"elevation,omitempty"`
+	// Geohash is computed on write with the configured precision
+	Geohash string `json:"geohash"`
+	// Privacy is exact (the default), neighborhood or city, callers without elevated rights only see
+	// the position of neighborhood and city locations blurred to that level
+	Privacy string `json:"privacy,omitempty" bson:"privacy,omitempty"`
+	// TimeZone is the IANA time zone of the position, resolved on write from the time zone boundaries
+	TimeZone string `json:"timeZone,omitempty" bson:"timezone,omitempty"`
+	// Coordinates accepts a pair in any supported input format, a bare geohash needs at least five
+	// characters, and holds the ?format= rendering in responses
+	Coordinates string `json:"coordinates,omitempty" bson:"-"`
+	// CRS names the ?crs= system of a response, whose longitude holds x and latitude holds y
+	CRS string `json:"crs,omitempty" bson:"-"`
 }
 
 // Membership represents a memebership
@@ -27,6 +47,8 @@ type Membership struct {
 	ID          string `json:"id"`
 	CommunityID string `json:"communityId"`
 	Role        string `json:"role"`
+	// HomeLocationID optionally references the Location the member lives at
+	HomeLocationID string `json:"homeLocationId,omitempty" bson:"homelocationid,omitempty"`
 }
 
 // Community represents a community
@@ -35,12 +57,25 @@ type Community struct {
 	Name     string       `json:"name"`
 	Location Location     `json:"location"`
 	Members  []Membership `json:"members"`
+	// Boundary is the optional area of the community
+	Boundary *Polygon `json:"boundary,omitempty" bson:"boundary,omitempty"`
+	// GeofenceRadius in meters around Location is used as the geofence when there is no boundary
+	GeofenceRadius float64 `json:"geofenceRadius,omitempty" bson:"geofenceradius,omitempty"`
+	// RoleLimits optionally caps how many members may hold each role, unfilled seats are vacancies
+	RoleLimits map[string]int `json:"roleLimits,omitempty" bson:"rolelimits,omitempty"`
 }
 
 var location []Location
 var membership []Membership
 var community []Community
 
+// setLocationDerivedFields computes the fields that follow from the coordinates of a location
+func setLocationDerivedFields(l *Location) {
+	setLocationGeohash(l)
+	setLocationTimeZone(l)
+	setLocationElevation(l)
+}
+
 // Endpoints For Location
 
 // CreateLocation godoc
@@ -50,18 +85,74 @@ var community []Community
 // @Accept json
 // @Produce json
 // @Param Location body Location true "Location object to be created"
+// @Param format query string false "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs"
+// @Param fillName query bool false "Fill a missing name from the offline gazetteer (defaults to Geocoder.FillMissingNames)"
+// @Param crs query string false "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633"
 // @Success 201 {object} Location "location created"
 // @Failure 400 {string} string "Bad Request"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /geolocationapi/location [post]
 func CreateLocation(w http.ResponseWriter, r *http.Request) {
-	var newItem Location
-	err := json.NewDecoder(r.Body).Decode(&newItem)
+	// Validate the requested coordinate format
+	format := r.URL.Query().Get("format")
+	if err := validateCoordinateFormat(format); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in format parameter: %v", err)
+		return
+	}
+
+	// Parse the requested coordinate reference system
+	crs, err := parseCRS(r.URL.Query().Get("crs"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
+	// Projected coordinates in the body are read in the requested reference system
+	newItem := Location{CRS: crs.code}
+	err = json.NewDecoder(r.Body).Decode(&newItem)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "Error decoding request body: %v", err)
 		return
 	}
+	// Convert them back to WGS84 for storage
+	if err := locationToWGS84(&newItem); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid position: %v", err)
+		return
+	}
+
+	// Fill a missing name from the gazetteer when requested
+	if strings.TrimSpace(newItem.Name) == "" && shouldFillLocationName(r) {
+		name, err := reverseGeocodeName(newItem.Latitude, newItem.Longitude)
+		if err != nil {
+			logging.DoLoggingLevelBasedLogs(logging.Warn, "could not fill location name: "+err.Error(), nil)
+		} else {
+			newItem.Name = name
+		}
+	}
+
+	// Normalize and validate the address
+	if err := validateLocationAddress(&newItem); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid address: %v", err)
+		return
+	}
+	if err := validatePrivacyLevel(&newItem); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid privacy: %v", err)
+		return
+	}
+	if err := validateLocationElevation(&newItem); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid elevation: %v", err)
+		return
+	}
+
+	// Compute the geohash, time zone and missing elevation from the coordinates
+	setLocationDerivedFields(&newItem)
 
 	// Add the new item to the items slice
 	location = append(location, newItem)
@@ -74,6 +165,18 @@ func CreateLocation(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Error inserting into database: %v", err)
 		return
 	}
+	// Keep caches and the spatial index in step with this change
+	onLocationSaved(newItem)
+
+	// Render coordinates in the requested format
+	formatLocationCoordinates(&newItem, format)
+	// Transform coordinates to the requested reference system
+	if err := transformLocationCRS(&newItem, crs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Marshal item to JSON
 	jsonData, err := json.Marshal(newItem)
 	if err != nil {
@@ -96,6 +199,9 @@ func CreateLocation(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param id path string true "ID"
+// @Param format query string false "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Param crs query string false "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633"
 // @Success 200 {object} Location "location found"
 // @Failure 404 {string} string "Not Found"
 // @Failure 500 {string} string "Internal Server Error"
@@ -104,6 +210,22 @@ func GetLocationByID(w http.ResponseWriter, r *http.Request) {
 	// Get the ID parameter from the URL
 	id := chi.URLParam(r, "id")
 
+	// Validate the requested coordinate format
+	format := r.URL.Query().Get("format")
+	if err := validateCoordinateFormat(format); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in format parameter: %v", err)
+		return
+	}
+
+	// Parse the requested coordinate reference system
+	crs, err := parseCRS(r.URL.Query().Get("crs"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Check if the MongoDB client is nil
 	if client == nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -120,7 +242,7 @@ func GetLocationByID(w http.ResponseWriter, r *http.Request) {
 
 	// Find the document by ID in the collection
 	var foundItem Location
-	err := collection.FindOne(ctx, bson.M{"id": id}).Decode(&foundItem)
+	err = collection.FindOne(ctx, bson.M{"id": id}).Decode(&foundItem)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			// If no document is found, return 404 Not Found
@@ -134,6 +256,18 @@ func GetLocationByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Hide the exact position of private locations from callers without elevated rights
+	obfuscateLocation(r.Context(), &foundItem)
+
+	// Render coordinates in the requested format
+	formatLocationCoordinates(&foundItem, format)
+	// Transform coordinates to the requested reference system
+	if err := transformLocationCRS(&foundItem, crs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Marshal item to JSON
 	jsonData, err := json.Marshal(foundItem)
 	if err != nil {
@@ -150,14 +284,39 @@ func GetLocationByID(w http.ResponseWriter, r *http.Request) {
 
 // GetLocation godoc
 // @Summary Get all locations
-// @Description Retrieves all locations from the MongoDB collection
+// @Description Retrieves all locations from the MongoDB collection, optionally filtered by geohash prefix and address fields
 // @Tags locations
 // @Accept  json
 // @Produce  json
+// @Param geohash query string false "Only return locations whose geohash starts with this prefix"
+// @Param street query string false "Only return locations whose street contains this text"
+// @Param locality query string false "Only return locations in this locality, ignoring case"
+// @Param region query string false "Only return locations in this region, ignoring case"
+// @Param postalCode query string false "Only return locations whose postal code starts with this value"
+// @Param countryCode query string false "Only return locations in this ISO 3166-1 alpha-2 country"
+// @Param format query string false "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Param crs query string false "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633"
 // @Success 200 {object} []Location
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /geolocationapi/location [get]
 func GetLocation(w http.ResponseWriter, r *http.Request) {
+	// Validate the requested coordinate format
+	format := r.URL.Query().Get("format")
+	if err := validateCoordinateFormat(format); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in format parameter: %v", err)
+		return
+	}
+
+	// Parse the requested coordinate reference system
+	crs, err := parseCRS(r.URL.Query().Get("crs"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Check if the MongoDB client is nil
 	if client == nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -172,8 +331,26 @@ func GetLocation(w http.ResponseWriter, r *http.Request) {
 	// Get the locations collection
 	collection := client.Database("geolocapi").Collection("locations")
 
+	// Build the filter, optionally restricted to a geohash prefix
+	filter, err := addressFilter(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid address filter: %v", err)
+		return
+	}
+	prefix := strings.ToLower(r.URL.Query().Get("geohash"))
+	if prefix != "" {
+		if !isGeohash(prefix) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid geohash prefix: %v", prefix)
+			return
+		}
+		filter["geohash"] = bson.M{"$regex": "^" + prefix}
+	}
+	restrictPrivateLocationFilter(r.Context(), filter)
+
 	// Find all documents in the collection
-	cursor, err := collection.Find(ctx, bson.M{})
+	cursor, err := collection.Find(ctx, filter)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, "Error retrieving locations: %v", err)
@@ -202,6 +379,20 @@ func GetLocation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Hide the exact position of private locations from callers without elevated rights
+	obfuscateLocations(r.Context(), locations)
+	locations = dropHiddenGeohashMatches(locations, prefix)
+
+	// Render coordinates in the requested format and reference system
+	for i := range locations {
+		formatLocationCoordinates(&locations[i], format)
+		if err := transformLocationCRS(&locations[i], crs); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Error in crs parameter: %v", err)
+			return
+		}
+	}
+
 	// Marshal the slice of locations to JSON and send it in the response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(locations); err != nil {
@@ -213,12 +404,14 @@ func GetLocation(w http.ResponseWriter, r *http.Request) {
 
 // UpdateLocationbyID godoc
 // @Summary Update a location by ID
-// @Description Updates a location name in the MongoDB collection by its ID
+// @Description Updates a location name, and its address, privacy and elevation when they are given, in the MongoDB collection by its ID
 // @Tags locations
 // @Accept json
 // @Produce json
 // @Param id path string true "ID"
 // @Param updateData body Location true "Updated location data"
+// @Param format query string false "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs"
+// @Param crs query string false "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633"
 // @Success 200 {object} Location "location updated"
 // @Failure 400 {string} string "Bad Request"
 // @Failure 404 {string} string "Not Found"
@@ -228,6 +421,22 @@ func UpdateLocationByID(w http.ResponseWriter, r *http.Request) {
 	// Get the ID parameter from the URL
 	id := chi.URLParam(r, "id")
 
+	// Validate the requested coordinate format
+	format := r.URL.Query().Get("format")
+	if err := validateCoordinateFormat(format); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in format parameter: %v", err)
+		return
+	}
+
+	// Parse the requested coordinate reference system
+	crs, err := parseCRS(r.URL.Query().Get("crs"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Check if the MongoDB client is nil
 	if client == nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -244,7 +453,7 @@ func UpdateLocationByID(w http.ResponseWriter, r *http.Request) {
 
 	// Find the document by ID in the collection
 	var foundItem Location
-	err := collection.FindOne(ctx, bson.M{"id": id}).Decode(&foundItem)
+	err = collection.FindOne(ctx, bson.M{"id": id}).Decode(&foundItem)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			// If no document is found, return 404 Not Found
@@ -259,7 +468,7 @@ func UpdateLocationByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Decode the request body into updatedData
-	var updatedData Location
+	updatedData := Location{CRS: crs.code}
 	err = json.NewDecoder(r.Body).Decode(&updatedData)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -270,6 +479,33 @@ func UpdateLocationByID(w http.ResponseWriter, r *http.Request) {
 	// Update the foundItem fields
 	foundItem.Name = updatedData.Name
 	// Update other fields as needed
+	if updatedData.Address != nil {
+		if err := validateLocationAddress(&updatedData); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid address: %v", err)
+			return
+		}
+		foundItem.Address = updatedData.Address
+	}
+	if updatedData.Privacy != "" {
+		if err := validatePrivacyLevel(&updatedData); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid privacy: %v", err)
+			return
+		}
+		foundItem.Privacy = updatedData.Privacy
+	}
+	if updatedData.Elevation != nil {
+		if err := validateLocationElevation(&updatedData); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid elevation: %v", err)
+			return
+		}
+		foundItem.Elevation = updatedData.Elevation
+	}
+
+	// Recompute the geohash, time zone and missing elevation so older documents pick them up on write
+	setLocationDerivedFields(&foundItem)
 
 	// Update the document in the collection
 	_, err = collection.ReplaceOne(ctx, bson.M{"id": id}, foundItem)
@@ -279,6 +515,21 @@ func UpdateLocationByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep caches and the spatial index in step with this change
+	onLocationSaved(foundItem)
+
+	// Hide the exact position of private locations from callers without elevated rights
+	obfuscateLocation(r.Context(), &foundItem)
+
+	// Render coordinates in the requested format
+	formatLocationCoordinates(&foundItem, format)
+	// Transform coordinates to the requested reference system
+	if err := transformLocationCRS(&foundItem, crs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Marshal updated item to JSON
 	jsonData, err := json.Marshal(foundItem)
 	if err != nil {
@@ -336,10 +587,50 @@ func DeleteLocationByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep caches and the spatial index in step with this change
+	onLocationDeleted(id)
+
 	// Set response status code
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// GetGeohashNeighbors godoc
+// @Summary Get the neighbors of a geohash
+// @Description Returns the eight geohash cells surrounding a geohash at the same precision
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param hash path string true "Geohash"
+// @Success 200 {object} GeohashNeighbors "neighbors found"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location/geohash/neighbors/{hash} [get]
+func GetGeohashNeighbors(w http.ResponseWriter, r *http.Request) {
+	// Get the geohash parameter from the URL
+	hash := chi.URLParam(r, "hash")
+
+	// Compute the surrounding cells
+	neighbors, err := geohashNeighbors(hash)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid geohash: %v", err)
+		return
+	}
+
+	// Marshal neighbors to JSON
+	jsonData, err := json.Marshal(neighbors)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
+
 // Endpoints For Membership
 
 // CreateMembership godoc
@@ -377,6 +668,13 @@ func CreateMembership(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Check the home location exists
+	if err := checkHomeLocation(ctx, newMember.HomeLocationID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in homeLocationId: %v", err)
+		return
+	}
+
 	// Get the memberships collection
 	collection := client.Database("geolocapi").Collection("memberships")
 
@@ -388,6 +686,7 @@ func CreateMembership(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Error creating membership: %v", err)
 		return
 	}
+	onMembershipChanged()
 
 	// Marshal newMember to JSON
 	jsonData, err := json.Marshal(newMember)
@@ -573,18 +872,30 @@ func UpdateMembershipByID(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Check the home location exists
+	if err := checkHomeLocation(ctx, updatedData.HomeLocationID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in homeLocationId: %v", err)
+		return
+	}
+
 	// Get the memberships collection
 	collection := client.Database("geolocapi").Collection("memberships")
 
 	// Update the membership in the database
 	filter := bson.M{"id": id}
-	update := bson.M{"$set": bson.M{"role": updatedData.Role}} // Update the role field, you can add more fields as needed
+	fields := bson.M{"role": updatedData.Role} // Update the role field, you can add more fields as needed
+	if updatedData.HomeLocationID != "" {
+		fields["homelocationid"] = updatedData.HomeLocationID
+	}
+	update := bson.M{"$set": fields}
 	_, err = collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, "Error updating membership: %v", err)
 		return
 	}
+	onMembershipChanged()
 
 	// Respond with updated membership data
 	updatedData.ID = id // Ensure that the ID remains the same
@@ -642,6 +953,7 @@ func DeleteMembershipByID(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Error deleting membership: %v", err)
 		return
 	}
+	onMembershipChanged()
 
 	// Set response status code
 	w.WriteHeader(http.StatusNoContent)
@@ -656,21 +968,42 @@ func DeleteMembershipByID(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param community body Community true "Community object to be created"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Param crs query string false "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633"
 // @Success 201 {object} Community "community created"
 // @Failure 400 {string} string "Bad Request"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /geolocationapi/community [post]
 func CreateCommunity(w http.ResponseWriter, r *http.Request) {
-	// Initialize a new community variable
-	var com Community
+	// Parse the requested coordinate reference system
+	crs, err := parseCRS(r.URL.Query().Get("crs"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
+	// Initialize a new community variable, projected coordinates are read in the requested reference system
+	com := Community{Location: Location{CRS: crs.code}}
 
 	// Decode the request body into the community variable
-	err := json.NewDecoder(r.Body).Decode(&com)
+	err = json.NewDecoder(r.Body).Decode(&com)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "Error decoding request body: %v", err)
 		return
 	}
+	// Convert them back to WGS84 for storage
+	if err := locationToWGS84(&com.Location); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid position: %v", err)
+		return
+	}
+	if err := validatePrivacyLevel(&com.Location); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid privacy: %v", err)
+		return
+	}
 
 	// Check if the MongoDB client is nil
 	if client == nil {
@@ -683,6 +1016,33 @@ func CreateCommunity(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Validate the boundary when one is given
+	if com.Boundary != nil {
+		if err := polygonToWGS84(com.Boundary, crs); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid boundary: %v", err)
+			return
+		}
+		if err := validatePolygon(com.Boundary); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid boundary: %v", err)
+			return
+		}
+	}
+	if com.GeofenceRadius < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid geofenceRadius: must not be negative")
+		return
+	}
+	if err := validateRoleLimits(com.RoleLimits); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid roleLimits: %v", err)
+		return
+	}
+
+	// Compute the geohash, time zone and missing elevation of the embedded location
+	setLocationDerivedFields(&com.Location)
+
 	// Get the communities collection
 	collection := client.Database("geolocapi").Collection("communities")
 
@@ -695,6 +1055,18 @@ func CreateCommunity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep caches in step with this change
+	onCommunityChanged()
+
+	// Hide the exact position of a private community location from callers without elevated rights
+	obfuscateCommunity(r.Context(), &com)
+	// Transform coordinates to the requested reference system
+	if err := transformCommunityCRS(&com, crs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Marshal newMember to JSON
 	jsonData, err := json.Marshal(com)
 	if err != nil {
@@ -718,6 +1090,9 @@ func CreateCommunity(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param id path string true "ID"
+// @Param format query string false "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Param crs query string false "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633"
 // @Success 200 {object} Community "community found"
 // @Failure 404 {string} string "Not Found"
 // @Failure 500 {string} string "Internal Server Error"
@@ -726,6 +1101,22 @@ func GetCommunityByID(w http.ResponseWriter, r *http.Request) {
 	// Get the community ID from the URL parameter
 	id := chi.URLParam(r, "id")
 
+	// Validate the requested coordinate format
+	format := r.URL.Query().Get("format")
+	if err := validateCoordinateFormat(format); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in format parameter: %v", err)
+		return
+	}
+
+	// Parse the requested coordinate reference system
+	crs, err := parseCRS(r.URL.Query().Get("crs"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Check if the MongoDB client is nil
 	if client == nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -742,7 +1133,7 @@ func GetCommunityByID(w http.ResponseWriter, r *http.Request) {
 
 	// Find the community document by its ID
 	var foundItem Community
-	err := collection.FindOne(ctx, bson.M{"id": id}).Decode(&foundItem)
+	err = collection.FindOne(ctx, bson.M{"id": id}).Decode(&foundItem)
 	if err != nil {
 		// Check if the error is due to document not found
 		if err == mongo.ErrNoDocuments {
@@ -756,6 +1147,18 @@ func GetCommunityByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Hide the exact position of a private community location from callers without elevated rights
+	obfuscateCommunity(r.Context(), &foundItem)
+
+	// Render coordinates in the requested format
+	formatLocationCoordinates(&foundItem.Location, format)
+	// Transform coordinates to the requested reference system
+	if err := transformCommunityCRS(&foundItem, crs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Marshal the found community document to JSON
 	jsonData, err := json.Marshal(foundItem)
 	if err != nil {
@@ -776,10 +1179,29 @@ func GetCommunityByID(w http.ResponseWriter, r *http.Request) {
 // @Tags Community
 // @Accept  json
 // @Produce  json
+// @Param format query string false "Render coordinates as decimal, dms, dm, geohash, pluscode, utm or mgrs"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Param crs query string false "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633"
 // @Success 200 {object} []Community
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /geolocationapi/community [get]
 func GetCommunity(w http.ResponseWriter, r *http.Request) {
+	// Validate the requested coordinate format
+	format := r.URL.Query().Get("format")
+	if err := validateCoordinateFormat(format); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in format parameter: %v", err)
+		return
+	}
+
+	// Parse the requested coordinate reference system
+	crs, err := parseCRS(r.URL.Query().Get("crs"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Check if the MongoDB client is nil
 	if client == nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -827,6 +1249,17 @@ func GetCommunity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Hide private community locations and render coordinates in the requested format and reference system
+	for i := range communities {
+		obfuscateCommunity(r.Context(), &communities[i])
+		formatLocationCoordinates(&communities[i].Location, format)
+		if err := transformCommunityCRS(&communities[i], crs); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Error in crs parameter: %v", err)
+			return
+		}
+	}
+
 	// Marshal the retrieved community documents to JSON
 	jsonData, err := json.Marshal(communities)
 	if err != nil {
@@ -843,12 +1276,14 @@ func GetCommunity(w http.ResponseWriter, r *http.Request) {
 
 // UpdateCommunityByID godoc
 // @Summary Update a community by ID
-// @Description Updates a community name in the MongoDB collection by its ID
+// @Description Updates a community name and boundary in the MongoDB collection by its ID
 // @Tags Community
 // @Accept json
 // @Produce json
 // @Param id path string true "ID"
 // @Param updatedCommunity body Community true "Updated community object"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Param crs query string false "Coordinate reference system of positions: EPSG:4326 (default), EPSG:3857 or a UTM zone such as EPSG:32633"
 // @Success 200 {object} Community "community updated"
 // @Failure 400 {string} string "Bad Request"
 // @Failure 404 {string} string "Not Found"
@@ -857,6 +1292,14 @@ func GetCommunity(w http.ResponseWriter, r *http.Request) {
 func UpdateCommunityByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
+	// Parse the requested coordinate reference system
+	crs, err := parseCRS(r.URL.Query().Get("crs"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Check if the MongoDB client is nil
 	if client == nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -875,8 +1318,8 @@ func UpdateCommunityByID(w http.ResponseWriter, r *http.Request) {
 	filter := bson.M{"id": id}
 
 	// Define an update to set the fields of the updated community document
-	var updatedData Community
-	err := json.NewDecoder(r.Body).Decode(&updatedData)
+	updatedData := Community{Location: Location{CRS: crs.code}}
+	err = json.NewDecoder(r.Body).Decode(&updatedData)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "Error decoding request body: %v", err)
@@ -890,6 +1333,55 @@ func UpdateCommunityByID(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	// Replace the privacy level of the embedded location when one is given, exact removes it
+	if updatedData.Location.Privacy != "" {
+		if err := validatePrivacyLevel(&updatedData.Location); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid privacy: %v", err)
+			return
+		}
+		if updatedData.Location.Privacy == "" {
+			update["$unset"] = bson.M{"location.privacy": ""}
+		} else {
+			update["$set"].(bson.M)["location.privacy"] = updatedData.Location.Privacy
+		}
+	}
+
+	// Replace the boundary when one is given
+	if updatedData.Boundary != nil {
+		if err := polygonToWGS84(updatedData.Boundary, crs); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid boundary: %v", err)
+			return
+		}
+		if err := validatePolygon(updatedData.Boundary); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid boundary: %v", err)
+			return
+		}
+		update["$set"].(bson.M)["boundary"] = updatedData.Boundary
+	}
+
+	// Replace the geofence radius when one is given
+	if updatedData.GeofenceRadius < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid geofenceRadius: must not be negative")
+		return
+	}
+	if updatedData.GeofenceRadius > 0 {
+		update["$set"].(bson.M)["geofenceradius"] = updatedData.GeofenceRadius
+	}
+
+	// Replace the role limits when they are given
+	if updatedData.RoleLimits != nil {
+		if err := validateRoleLimits(updatedData.RoleLimits); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid roleLimits: %v", err)
+			return
+		}
+		update["$set"].(bson.M)["rolelimits"] = updatedData.RoleLimits
+	}
+
 	// Perform the update operation
 	_, err = collection.UpdateOne(ctx, filter, update)
 	if err != nil {
@@ -898,6 +1390,9 @@ func UpdateCommunityByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep caches in step with this change
+	onCommunityChanged()
+
 	// Get the updated community document
 	updatedCommunity := Community{}
 	err = collection.FindOne(ctx, filter).Decode(&updatedCommunity)
@@ -907,6 +1402,15 @@ func UpdateCommunityByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Hide the exact position of a private community location from callers without elevated rights
+	obfuscateCommunity(r.Context(), &updatedCommunity)
+	// Transform coordinates to the requested reference system
+	if err := transformCommunityCRS(&updatedCommunity, crs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error in crs parameter: %v", err)
+		return
+	}
+
 	// Marshal the updated community document to JSON
 	jsonData, err := json.Marshal(updatedCommunity)
 	if err != nil {
@@ -959,6 +1463,9 @@ func DeleteCommunityByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep caches in step with this change
+	onCommunityChanged()
+
 	// Set response status code
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,112 @@
+package geolocationapi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Polygon is a GeoJSON polygon, each ring is a closed list of [longitude, latitude] positions
+// and the first ring is the exterior
+type Polygon struct {
+	Type        string        `json:"type"`
+	Coordinates [][][]float64 `json:"coordinates"`
+}
+
+// validatePolygon checks a polygon is well formed and closes any open rings
+func validatePolygon(p *Polygon) error {
+	if p.Type == "" {
+		p.Type = "Polygon"
+	}
+	if p.Type != "Polygon" {
+		return errors.New("boundary type must be Polygon")
+	}
+	if len(p.Coordinates) == 0 {
+		return errors.New("boundary must have an exterior ring")
+	}
+
+	for i, ring := range p.Coordinates {
+		for _, position := range ring {
+			if len(position) < 2 {
+				return fmt.Errorf("ring %d has a position without longitude and latitude", i)
+			}
+			if err := validateCoordinate(position[0], false); err != nil {
+				return err
+			}
+			if err := validateCoordinate(position[1], true); err != nil {
+				return err
+			}
+		}
+		if len(ring) > 0 {
+			first, last := ring[0], ring[len(ring)-1]
+			if first[0] != last[0] || first[1] != last[1] {
+				ring = append(ring, []float64{first[0], first[1]})
+				p.Coordinates[i] = ring
+			}
+		}
+		if len(ring) < 4 {
+			return fmt.Errorf("ring %d needs at least three distinct positions", i)
+		}
+	}
+	return nil
+}
+
+// bounds returns the bounding box of the exterior ring
+func (p *Polygon) bounds() BoundingBox {
+	ring := p.Coordinates[0]
+	box := pointBBox(ring[0][1], ring[0][0])
+	for _, position := range ring[1:] {
+		box.Extend(position[1], position[0])
+	}
+	return box
+}
+
+// contains reports whether a position is inside the exterior ring and outside every hole
+func (p *Polygon) contains(lat, lng float64) bool {
+	if len(p.Coordinates) == 0 || !ringContains(p.Coordinates[0], lat, lng) {
+		return false
+	}
+	for _, hole := range p.Coordinates[1:] {
+		if ringContains(hole, lat, lng) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains is a ray casting point-in-ring test on longitude/latitude
+func ringContains(ring [][]float64, lat, lng float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lng < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// distanceMeters returns the distance from a position to the polygon, zero when it is inside
+func (p *Polygon) distanceMeters(lat, lng float64) float64 {
+	if p.contains(lat, lng) {
+		return 0
+	}
+
+	// Project every ring onto a plane centred on the position, the nearest edge of any ring is the answer
+	origin := planarPoint{}
+	scale := math.Cos(lat * math.Pi / 180)
+	project := func(position []float64) planarPoint {
+		return planarPoint{
+			x: math.Remainder(position[0]-lng, 360) * math.Pi / 180 * earthRadiusMeters * scale,
+			y: (position[1] - lat) * math.Pi / 180 * earthRadiusMeters,
+		}
+	}
+	nearest := math.Inf(1)
+	for _, ring := range p.Coordinates {
+		for i := 1; i < len(ring); i++ {
+			nearest = math.Min(nearest, segmentDistance(origin, project(ring[i-1]), project(ring[i])))
+		}
+	}
+	return nearest
+}
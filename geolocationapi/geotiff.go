@@ -0,0 +1,481 @@
+package geolocationapi
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TIFF tags read from elevation GeoTIFFs
+const (
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagPredictor       = 317
+	tiffTagTileWidth       = 322
+	tiffTagTileLength      = 323
+	tiffTagTileOffsets     = 324
+	tiffTagTileByteCounts  = 325
+	tiffTagSampleFormat    = 339
+	tiffTagPixelScale      = 33550
+	tiffTagTiepoint        = 33922
+	tiffTagGeoKeys         = 34735
+	tiffTagGDALNoData      = 42113
+)
+
+// TIFF header values
+const (
+	tiffHeaderLittleEndian = "II"
+	tiffHeaderBigEndian    = "MM"
+	tiffMagic              = 42
+	tiffBigTIFFMagic       = 43
+	tiffEntrySize          = 12
+)
+
+// TIFF compression schemes, predictors and sample formats the reader can decode
+const (
+	tiffCompressionNone       = 1
+	tiffCompressionLZW        = 5
+	tiffCompressionDeflate    = 8
+	tiffCompressionDeflateOld = 32946
+	tiffPredictorNone         = 1
+	tiffPredictorHorizontal   = 2
+	tiffSampleFormatUnsigned  = 1
+	tiffSampleFormatSigned    = 2
+	tiffSampleFormatFloat     = 3
+)
+
+// GeoTIFF keys and values that decide how pixels map to positions
+const (
+	geoKeyModelType           = 1024
+	geoKeyRasterType          = 1025
+	geoModelTypeGeographic    = 2
+	geoRasterTypePixelIsPoint = 2
+)
+
+// TIFF LZW codes and code widths
+const (
+	tiffLZWClear              = 256
+	tiffLZWEnd                = 257
+	tiffLZWFirstAvailableCode = 258
+	tiffLZWFirstCodeWidth     = 9
+	tiffLZWMaxCodeWidth       = 12
+	tiffLZWMaxTableSize       = 1 << tiffLZWMaxCodeWidth
+)
+
+// tiffFieldSizes is the size in bytes of the TIFF field types, indexed by type
+var tiffFieldSizes = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+// geoTIFF is a single band GeoTIFF in geographic coordinates, only its layout is kept in memory
+type geoTIFF struct {
+	order        binary.ByteOrder
+	width        int
+	height       int
+	bits         int
+	sampleFormat int
+	compression  int
+	predictor    int
+	// chunks are strips, one chunkWidth wide, or tiles
+	chunkWidth  int
+	chunkHeight int
+	offsets     []uint64
+	byteCounts  []uint64
+	noData      float64
+	hasNoData   bool
+	// originLng and originLat are the centre of the first pixel, stepLng and stepLat the pixel size in degrees
+	originLng, originLat float64
+	stepLng, stepLat     float64
+}
+
+// tiffField is a decoded IFD entry
+type tiffField struct {
+	fieldType uint16
+	count     uint32
+	data      []byte
+}
+
+// readGeoTIFF reads the first image of a GeoTIFF, which must hold a single band of integer or
+// floating point samples in WGS84 longitude and latitude
+func readGeoTIFF(file io.ReaderAt) (*geoTIFF, error) {
+	header := make([]byte, 8)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	t := &geoTIFF{}
+	switch string(header[:2]) {
+	case tiffHeaderLittleEndian:
+		t.order = binary.LittleEndian
+	case tiffHeaderBigEndian:
+		t.order = binary.BigEndian
+	default:
+		return nil, errors.New("not a TIFF file")
+	}
+	switch t.order.Uint16(header[2:]) {
+	case tiffMagic:
+	case tiffBigTIFFMagic:
+		return nil, errors.New("BigTIFF is not supported")
+	default:
+		return nil, errors.New("not a TIFF file")
+	}
+
+	fields, err := readTIFFDirectory(file, t.order, int64(t.order.Uint32(header[4:])))
+	if err != nil {
+		return nil, err
+	}
+	if err := t.readLayout(fields); err != nil {
+		return nil, err
+	}
+	if err := t.readGeoreference(fields); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// readTIFFDirectory reads the entries of the image file directory at offset
+func readTIFFDirectory(file io.ReaderAt, order binary.ByteOrder, offset int64) (map[uint16]tiffField, error) {
+	countData := make([]byte, 2)
+	if _, err := file.ReadAt(countData, offset); err != nil {
+		return nil, fmt.Errorf("reading directory: %v", err)
+	}
+	entries := make([]byte, int(order.Uint16(countData))*tiffEntrySize)
+	if _, err := file.ReadAt(entries, offset+2); err != nil {
+		return nil, fmt.Errorf("reading directory: %v", err)
+	}
+
+	fields := map[uint16]tiffField{}
+	for i := 0; i < len(entries); i += tiffEntrySize {
+		entry := entries[i : i+tiffEntrySize]
+		field := tiffField{fieldType: order.Uint16(entry[2:]), count: order.Uint32(entry[4:])}
+		if int(field.fieldType) >= len(tiffFieldSizes) || tiffFieldSizes[field.fieldType] == 0 {
+			continue
+		}
+		size := int64(tiffFieldSizes[field.fieldType]) * int64(field.count)
+		if size <= 4 {
+			// Values of up to four bytes are stored in the entry itself
+			field.data = entry[8 : 8+size]
+		} else {
+			field.data = make([]byte, size)
+			if _, err := file.ReadAt(field.data, int64(order.Uint32(entry[8:]))); err != nil {
+				return nil, fmt.Errorf("reading tag %d: %v", order.Uint16(entry), err)
+			}
+		}
+		fields[order.Uint16(entry)] = field
+	}
+	return fields, nil
+}
+
+// numbers returns the values of a numeric field
+func (f tiffField) numbers(order binary.ByteOrder) []float64 {
+	size := tiffFieldSizes[f.fieldType]
+	values := make([]float64, 0, f.count)
+	for i := 0; i+size <= len(f.data); i += size {
+		data := f.data[i:]
+		switch f.fieldType {
+		case 1, 7:
+			values = append(values, float64(data[0]))
+		case 6:
+			values = append(values, float64(int8(data[0])))
+		case 3:
+			values = append(values, float64(order.Uint16(data)))
+		case 8:
+			values = append(values, float64(int16(order.Uint16(data))))
+		case 4:
+			values = append(values, float64(order.Uint32(data)))
+		case 9:
+			values = append(values, float64(int32(order.Uint32(data))))
+		case 5:
+			values = append(values, float64(order.Uint32(data))/float64(order.Uint32(data[4:])))
+		case 10:
+			values = append(values, float64(int32(order.Uint32(data)))/float64(int32(order.Uint32(data[4:]))))
+		case 11:
+			values = append(values, float64(math.Float32frombits(order.Uint32(data))))
+		case 12:
+			values = append(values, math.Float64frombits(order.Uint64(data)))
+		}
+	}
+	return values
+}
+
+// tiffNumbers returns the values of a tag, or nil when the tag is missing
+func tiffNumbers(fields map[uint16]tiffField, order binary.ByteOrder, tag uint16) []float64 {
+	field, ok := fields[tag]
+	if !ok {
+		return nil
+	}
+	return field.numbers(order)
+}
+
+// tiffNumber returns the first value of a tag, or fallback when the tag is missing
+func tiffNumber(fields map[uint16]tiffField, order binary.ByteOrder, tag uint16, fallback int) int {
+	values := tiffNumbers(fields, order, tag)
+	if len(values) == 0 {
+		return fallback
+	}
+	return int(values[0])
+}
+
+// readLayout reads the size, sample type, compression and chunk positions of the image
+func (t *geoTIFF) readLayout(fields map[uint16]tiffField) error {
+	t.width = tiffNumber(fields, t.order, tiffTagImageWidth, 0)
+	t.height = tiffNumber(fields, t.order, tiffTagImageLength, 0)
+	if t.width < 2 || t.height < 2 {
+		return errors.New("image must be at least 2 by 2 pixels")
+	}
+	if samples := tiffNumber(fields, t.order, tiffTagSamplesPerPixel, 1); samples != 1 {
+		return fmt.Errorf("only single band images are supported, found %d bands", samples)
+	}
+
+	t.bits = tiffNumber(fields, t.order, tiffTagBitsPerSample, 1)
+	t.sampleFormat = tiffNumber(fields, t.order, tiffTagSampleFormat, tiffSampleFormatUnsigned)
+	switch {
+	case t.sampleFormat == tiffSampleFormatFloat && (t.bits == 32 || t.bits == 64):
+	case (t.sampleFormat == tiffSampleFormatUnsigned || t.sampleFormat == tiffSampleFormatSigned) &&
+		(t.bits == 8 || t.bits == 16 || t.bits == 32):
+	default:
+		return fmt.Errorf("unsupported sample format %d with %d bits", t.sampleFormat, t.bits)
+	}
+
+	t.compression = tiffNumber(fields, t.order, tiffTagCompression, tiffCompressionNone)
+	switch t.compression {
+	case tiffCompressionNone, tiffCompressionLZW, tiffCompressionDeflate, tiffCompressionDeflateOld:
+	default:
+		return fmt.Errorf("unsupported compression %d", t.compression)
+	}
+	t.predictor = tiffNumber(fields, t.order, tiffTagPredictor, tiffPredictorNone)
+	if t.predictor != tiffPredictorNone && (t.predictor != tiffPredictorHorizontal || t.sampleFormat == tiffSampleFormatFloat) {
+		return fmt.Errorf("unsupported predictor %d", t.predictor)
+	}
+
+	offsetTag, countTag := uint16(tiffTagStripOffsets), uint16(tiffTagStripByteCounts)
+	if _, tiled := fields[tiffTagTileOffsets]; tiled {
+		offsetTag, countTag = tiffTagTileOffsets, tiffTagTileByteCounts
+		t.chunkWidth = tiffNumber(fields, t.order, tiffTagTileWidth, 0)
+		t.chunkHeight = tiffNumber(fields, t.order, tiffTagTileLength, 0)
+	} else {
+		t.chunkWidth = t.width
+		t.chunkHeight = tiffNumber(fields, t.order, tiffTagRowsPerStrip, t.height)
+		if t.chunkHeight > t.height {
+			t.chunkHeight = t.height
+		}
+	}
+	if t.chunkWidth <= 0 || t.chunkHeight <= 0 {
+		return errors.New("invalid strip or tile size")
+	}
+	for _, value := range tiffNumbers(fields, t.order, offsetTag) {
+		t.offsets = append(t.offsets, uint64(value))
+	}
+	for _, value := range tiffNumbers(fields, t.order, countTag) {
+		t.byteCounts = append(t.byteCounts, uint64(value))
+	}
+	if len(t.offsets) != t.chunksAcross()*t.chunksDown() || len(t.byteCounts) != len(t.offsets) {
+		return errors.New("strip or tile offsets do not match the image size")
+	}
+
+	if field, ok := fields[tiffTagGDALNoData]; ok {
+		value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimRight(string(field.data), "\x00")), 64)
+		if err == nil {
+			t.noData, t.hasNoData = value, true
+		}
+	}
+	return nil
+}
+
+// readGeoreference reads the pixel scale and tie point, the image must not be rotated
+func (t *geoTIFF) readGeoreference(fields map[uint16]tiffField) error {
+	scale := tiffNumbers(fields, t.order, tiffTagPixelScale)
+	tiepoint := tiffNumbers(fields, t.order, tiffTagTiepoint)
+	if len(scale) < 2 || len(tiepoint) < 6 || scale[0] <= 0 || scale[1] <= 0 {
+		return errors.New("missing ModelPixelScale or ModelTiepoint, rotated images are not supported")
+	}
+
+	// Geo keys are a header of four shorts followed by entries of key, location, count and value
+	pixelIsPoint := false
+	keys := tiffNumbers(fields, t.order, tiffTagGeoKeys)
+	for i := 4; i+3 < len(keys); i += 4 {
+		if keys[i+1] != 0 {
+			continue
+		}
+		switch int(keys[i]) {
+		case geoKeyModelType:
+			if int(keys[i+3]) != geoModelTypeGeographic {
+				return errors.New("only geographic (longitude and latitude) images are supported")
+			}
+		case geoKeyRasterType:
+			pixelIsPoint = int(keys[i+3]) == geoRasterTypePixelIsPoint
+		}
+	}
+
+	t.stepLng, t.stepLat = scale[0], scale[1]
+	// The tie point maps the raster position (i, j) to (x, y), a pixel corner unless pixels are points
+	t.originLng = tiepoint[3] - tiepoint[0]*t.stepLng
+	t.originLat = tiepoint[4] + tiepoint[1]*t.stepLat
+	if !pixelIsPoint {
+		t.originLng += t.stepLng / 2
+		t.originLat -= t.stepLat / 2
+	}
+	return nil
+}
+
+// chunksAcross returns the number of strips or tiles in a row of the image
+func (t *geoTIFF) chunksAcross() int {
+	return (t.width + t.chunkWidth - 1) / t.chunkWidth
+}
+
+// chunksDown returns the number of strips or tiles in a column of the image
+func (t *geoTIFF) chunksDown() int {
+	return (t.height + t.chunkHeight - 1) / t.chunkHeight
+}
+
+// readChunk decodes a strip or tile into row-major samples, NaN marks no data
+func (t *geoTIFF) readChunk(file io.ReaderAt, index int) ([]float64, error) {
+	data := make([]byte, t.byteCounts[index])
+	if _, err := file.ReadAt(data, int64(t.offsets[index])); err != nil {
+		return nil, err
+	}
+
+	size := t.chunkWidth * t.chunkHeight * t.bits / 8
+	var err error
+	switch t.compression {
+	case tiffCompressionLZW:
+		data, err = decodeTIFFLZW(data, size)
+	case tiffCompressionDeflate, tiffCompressionDeflateOld:
+		var reader io.ReadCloser
+		if reader, err = zlib.NewReader(bytes.NewReader(data)); err == nil {
+			data, err = io.ReadAll(reader)
+			reader.Close()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decompressing chunk %d: %v", index, err)
+	}
+
+	bytesPerSample := t.bits / 8
+	values := make([]float64, len(data)/bytesPerSample)
+	raw := make([]uint64, t.chunkWidth)
+	mask := uint64(1)<<t.bits - 1
+	for start := 0; start < len(values); start += t.chunkWidth {
+		end := start + t.chunkWidth
+		if end > len(values) {
+			end = len(values)
+		}
+		for i := start; i < end; i++ {
+			sample := data[i*bytesPerSample:]
+			switch t.bits {
+			case 8:
+				raw[i-start] = uint64(sample[0])
+			case 16:
+				raw[i-start] = uint64(t.order.Uint16(sample))
+			case 32:
+				raw[i-start] = uint64(t.order.Uint32(sample))
+			case 64:
+				raw[i-start] = t.order.Uint64(sample)
+			}
+			// Horizontal differencing stores each sample as the difference from its left neighbour
+			if t.predictor == tiffPredictorHorizontal && i > start {
+				raw[i-start] = (raw[i-start] + raw[i-start-1]) & mask
+			}
+			values[i] = t.sampleValue(raw[i-start])
+		}
+	}
+	return values, nil
+}
+
+// sampleValue converts the bits of a sample to its value
+func (t *geoTIFF) sampleValue(bits uint64) float64 {
+	var value float64
+	switch {
+	case t.sampleFormat == tiffSampleFormatFloat && t.bits == 32:
+		value = float64(math.Float32frombits(uint32(bits)))
+	case t.sampleFormat == tiffSampleFormatFloat:
+		value = math.Float64frombits(bits)
+	case t.sampleFormat == tiffSampleFormatSigned:
+		// Shift the sign bit of the sample into the sign bit of an int64
+		shift := 64 - t.bits
+		value = float64(int64(bits<<shift) >> shift)
+	default:
+		value = float64(bits)
+	}
+	if t.hasNoData && value == t.noData {
+		return math.NaN()
+	}
+	return value
+}
+
+// decodeTIFFLZW decompresses TIFF LZW data, which unlike GIF LZW writes codes most significant bit
+// first and widens them one code early
+func decodeTIFFLZW(src []byte, sizeHint int) ([]byte, error) {
+	out := make([]byte, 0, sizeHint)
+	table := make([][]byte, tiffLZWFirstAvailableCode, tiffLZWMaxTableSize)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+	width := tiffLZWFirstCodeWidth
+	var previous []byte
+	var buffer uint32
+	var buffered int
+
+	for position := 0; ; {
+		// Fill the bit buffer, data that ends without an end code is accepted
+		for buffered < width {
+			if position >= len(src) {
+				return out, nil
+			}
+			buffer = buffer<<8 | uint32(src[position])
+			position++
+			buffered += 8
+		}
+		code := int(buffer>>(buffered-width)) & (1<<width - 1)
+		buffered -= width
+
+		switch {
+		case code == tiffLZWEnd:
+			return out, nil
+		case code == tiffLZWClear:
+			table = table[:tiffLZWFirstAvailableCode]
+			width = tiffLZWFirstCodeWidth
+			previous = nil
+			continue
+		}
+
+		var entry []byte
+		switch {
+		case code < len(table) && code >= tiffLZWFirstAvailableCode || code < 256:
+			entry = table[code]
+		case code == len(table) && previous != nil:
+			entry = append(previous[:len(previous):len(previous)], previous[0])
+		default:
+			return nil, fmt.Errorf("invalid LZW code %d", code)
+		}
+		out = append(out, entry...)
+
+		if previous != nil && len(table) < tiffLZWMaxTableSize {
+			table = append(table, append(previous[:len(previous):len(previous)], entry[0]))
+		}
+		previous = entry
+		if len(table)+1 >= 1<<width && width < tiffLZWMaxCodeWidth {
+			width++
+		}
+	}
+}
+
+// openGeoTIFF reads the layout of a GeoTIFF file
+func openGeoTIFF(path string) (*geoTIFF, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readGeoTIFF(file)
+}
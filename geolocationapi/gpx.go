@@ -0,0 +1,115 @@
+package geolocationapi
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"time"
+)
+
+// gpxNamespace is the GPX 1.1 schema namespace
+const gpxNamespace = "http://www.topografix.com/GPX/1/1"
+
+// gpxDocument is the subset of GPX 1.1 read and written by the API
+type gpxDocument struct {
+	XMLName   xml.Name     `xml:"gpx"`
+	Xmlns     string       `xml:"xmlns,attr,omitempty"`
+	Version   string       `xml:"version,attr,omitempty"`
+	Creator   string       `xml:"creator,attr,omitempty"`
+	Metadata  *gpxMetadata `xml:"metadata,omitempty"`
+	Waypoints []gpxPoint   `xml:"wpt"`
+	Routes    []gpxRoute   `xml:"rte"`
+	Tracks    []gpxTrack   `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+}
+
+type gpxRoute struct {
+	Name   string     `xml:"name,omitempty"`
+	Points []gpxPoint `xml:"rtept"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name,omitempty"`
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+// gpxExtensionNamespace is the namespace of the API's own GPX extension elements
+const gpxExtensionNamespace = "urn:temprest:geolocationapi"
+
+// gpxPoint is a wpt, rtept or trkpt element
+type gpxPoint struct {
+	Lat         float64        `xml:"lat,attr"`
+	Lon         float64        `xml:"lon,attr"`
+	Elevation   *float64       `xml:"ele,omitempty"`
+	Time        *time.Time     `xml:"time,omitempty"`
+	Name        string         `xml:"name,omitempty"`
+	Description string         `xml:"desc,omitempty"`
+	Extensions  *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+// gpxExtensions carries the location id so exported waypoints import back onto the same location
+type gpxExtensions struct {
+	ID string `xml:"urn:temprest:geolocationapi id,omitempty"`
+}
+
+// readGPX decodes a GPX document
+func readGPX(r io.Reader) (*gpxDocument, error) {
+	var doc gpxDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// writeGPX encodes a GPX 1.1 document with an XML declaration
+func writeGPX(w io.Writer, doc *gpxDocument) error {
+	doc.Xmlns = gpxNamespace
+	doc.Version = "1.1"
+	doc.Creator = "geolocationapi"
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// gpxTrackPoints returns the name and points of the first track of a document, joining its
+// segments, and falls back to the first route
+func gpxTrackPoints(doc *gpxDocument) (string, []TrackPoint, error) {
+	name := ""
+	if doc.Metadata != nil {
+		name = doc.Metadata.Name
+	}
+
+	var source []gpxPoint
+	switch {
+	case len(doc.Tracks) > 0:
+		if doc.Tracks[0].Name != "" {
+			name = doc.Tracks[0].Name
+		}
+		for _, segment := range doc.Tracks[0].Segments {
+			source = append(source, segment.Points...)
+		}
+	case len(doc.Routes) > 0:
+		if doc.Routes[0].Name != "" {
+			name = doc.Routes[0].Name
+		}
+		source = doc.Routes[0].Points
+	default:
+		return "", nil, errors.New("GPX document has no track or route")
+	}
+
+	points := make([]TrackPoint, len(source))
+	for i, p := range source {
+		points[i] = TrackPoint{Latitude: p.Lat, Longitude: p.Lon, Elevation: p.Elevation, Time: p.Time}
+	}
+	return name, points, nil
+}
@@ -0,0 +1,442 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"temprest/config"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Heatmap defaults used when the Heatmap config section is missing
+const (
+	defaultHeatmapCellsAcross = 64
+	defaultHeatmapMaxCells    = 100000
+)
+
+// Heatmap grids and sources
+const (
+	HeatmapGridSquare      = "square"
+	HeatmapGridHex         = "hex"
+	HeatmapSourceLocations = "locations"
+	HeatmapSourcePositions = "positions"
+)
+
+// mercatorMaxLat is the latitude where the Web Mercator square ends
+const mercatorMaxLat = 85.0511287798066
+
+// heatmapHexBinsPerCell is how many square bins across a hexagon the database aggregates positions
+// into before they are assigned to hexagons
+const heatmapHexBinsPerCell = 4
+
+// HeatmapCell is a grid cell with the number of points in it, the boundary is a closed ring of
+// [longitude, latitude] positions
+type HeatmapCell struct {
+	ID        string      `json:"id"`
+	Latitude  float64     `json:"latitude"`
+	Longitude float64     `json:"longitude"`
+	Count     int         `json:"count"`
+	Boundary  [][]float64 `json:"boundary"`
+}
+
+// Heatmap is the non-empty cells of a grid over a bounding box
+type Heatmap struct {
+	Grid   string `json:"grid"`
+	Source string `json:"source"`
+	// Resolution is the cell size in meters at the centre of the box
+	Resolution float64       `json:"resolution"`
+	Total      int           `json:"total"`
+	MaxCount   int           `json:"maxCount"`
+	Cells      []HeatmapCell `json:"cells"`
+}
+
+// heatmapGrid bins unit Web Mercator coordinates into squares, or pointy-top hexagons whose size is
+// the distance from the centre to a corner, so cells look regular on web maps
+type heatmapGrid struct {
+	hex  bool
+	size float64
+}
+
+// cell returns the key of the cell containing a point
+func (g heatmapGrid) cell(x, y float64) [2]int {
+	if !g.hex {
+		return [2]int{int(math.Floor(x / g.size)), int(math.Floor(y / g.size))}
+	}
+
+	// Axial coordinates, rounded through cube coordinates
+	q := (math.Sqrt(3)/3*x - y/3) / g.size
+	r := (2.0 / 3 * y) / g.size
+	s := -q - r
+	rq, rr, rs := math.Round(q), math.Round(r), math.Round(s)
+	dq, dr, ds := math.Abs(rq-q), math.Abs(rr-r), math.Abs(rs-s)
+	if dq > dr && dq > ds {
+		rq = -rr - rs
+	} else if dr > ds {
+		rr = -rq - rs
+	}
+	return [2]int{int(rq), int(rr)}
+}
+
+// center returns the centre of a cell
+func (g heatmapGrid) center(key [2]int) (x, y float64) {
+	if !g.hex {
+		return (float64(key[0]) + 0.5) * g.size, (float64(key[1]) + 0.5) * g.size
+	}
+	q, r := float64(key[0]), float64(key[1])
+	return g.size * (math.Sqrt(3)*q + math.Sqrt(3)/2*r), g.size * 1.5 * r
+}
+
+// ring returns the closed boundary of a cell as [longitude, latitude] positions, counterclockwise on the map
+func (g heatmapGrid) ring(key [2]int) [][]float64 {
+	var corners [][2]float64
+	if !g.hex {
+		x0, y0 := float64(key[0])*g.size, float64(key[1])*g.size
+		x1, y1 := x0+g.size, y0+g.size
+		corners = [][2]float64{{x0, y0}, {x0, y1}, {x1, y1}, {x1, y0}}
+	} else {
+		cx, cy := g.center(key)
+		// y grows southward, so walking the angles backwards runs counterclockwise on the map
+		for i := 0; i < 6; i++ {
+			angle := (30 - 60*float64(i)) * math.Pi / 180
+			corners = append(corners, [2]float64{cx + g.size*math.Cos(angle), cy + g.size*math.Sin(angle)})
+		}
+	}
+
+	ring := make([][]float64, 0, len(corners)+1)
+	for _, c := range corners {
+		ring = append(ring, []float64{mercatorLng(c[0]), mercatorLat(c[1])})
+	}
+	return append(ring, ring[0])
+}
+
+// heatmapCells turns counts per cell into cells sorted by decreasing count
+func heatmapCells(grid heatmapGrid, counts map[[2]int]int) (cells []HeatmapCell, total, maxCount int) {
+	prefix := "s"
+	if grid.hex {
+		prefix = "h"
+	}
+	cells = make([]HeatmapCell, 0, len(counts))
+	for key, count := range counts {
+		x, y := grid.center(key)
+		cells = append(cells, HeatmapCell{
+			ID:        fmt.Sprintf("%s:%d:%d", prefix, key[0], key[1]),
+			Latitude:  mercatorLat(y),
+			Longitude: mercatorLng(x),
+			Count:     count,
+			Boundary:  grid.ring(key),
+		})
+		total += count
+		maxCount = max(maxCount, count)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Count != cells[j].Count {
+			return cells[i].Count > cells[j].Count
+		}
+		return cells[i].ID < cells[j].ID
+	})
+	return cells, total, maxCount
+}
+
+// heatmapLocationCounts bins the locations inside a box, using the spatial index when it is loaded,
+// private locations are binned by the position the audience of ctx may see
+func heatmapLocationCounts(ctx context.Context, grid heatmapGrid, box BoundingBox, fence *geofence) (map[[2]int]int, error) {
+	candidates := privacySearchBBox(ctx, box)
+	locations, ok := locationIndex.within(candidates)
+	if !ok {
+		filter := bson.M{
+			"latitude":  bson.M{"$gte": candidates.MinLat, "$lte": candidates.MaxLat},
+			"longitude": bson.M{"$gte": candidates.MinLng, "$lte": candidates.MaxLng},
+		}
+		cursor, err := client.Database("geolocapi").Collection("locations").Find(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+		if err := cursor.All(ctx, &locations); err != nil {
+			return nil, err
+		}
+	}
+
+	obfuscateLocations(ctx, locations)
+
+	counts := map[[2]int]int{}
+	for _, l := range locations {
+		if !box.Contains(l.Latitude, l.Longitude) {
+			continue
+		}
+		if fence != nil && !fence.contains(l.Latitude, l.Longitude) {
+			continue
+		}
+		counts[grid.cell(mercatorX(l.Longitude), mercatorY(l.Latitude))]++
+	}
+	return counts, nil
+}
+
+// heatmapPositionCounts bins tracked positions inside a box and time range with a database
+// aggregation, hexagons are filled from finer square bins computed by the database
+func heatmapPositionCounts(ctx context.Context, grid heatmapGrid, box BoundingBox, from, to time.Time, memberIDs []string) (map[[2]int]int, error) {
+	match := bson.M{
+		"timestamp": bson.M{"$gte": from, "$lte": to},
+		"latitude":  bson.M{"$gte": box.MinLat, "$lte": box.MaxLat},
+		"longitude": bson.M{"$gte": box.MinLng, "$lte": box.MaxLng},
+	}
+	if memberIDs != nil {
+		match["memberid"] = bson.M{"$in": memberIDs}
+	}
+
+	bin := grid.size
+	if grid.hex {
+		bin = grid.size / heatmapHexBinsPerCell
+	}
+
+	// Web Mercator x and y of each position, as in mercatorX and mercatorY
+	x := bson.M{"$add": bson.A{bson.M{"$divide": bson.A{"$longitude", 360}}, 0.5}}
+	sin := bson.M{"$sin": bson.M{"$multiply": bson.A{"$latitude", math.Pi / 180}}}
+	y := bson.M{"$let": bson.M{
+		"vars": bson.M{"sin": sin},
+		"in": bson.M{"$subtract": bson.A{0.5, bson.M{"$divide": bson.A{
+			bson.M{"$multiply": bson.A{0.25, bson.M{"$ln": bson.M{"$divide": bson.A{
+				bson.M{"$add": bson.A{1, "$$sin"}},
+				bson.M{"$subtract": bson.A{1, "$$sin"}},
+			}}}}},
+			math.Pi,
+		}}}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"x": bson.M{"$floor": bson.M{"$divide": bson.A{x, bin}}},
+				"y": bson.M{"$floor": bson.M{"$divide": bson.A{y, bin}}},
+			},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := positionsCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := map[[2]int]int{}
+	for cursor.Next(ctx) {
+		var bucket struct {
+			ID struct {
+				X float64 `bson:"x"`
+				Y float64 `bson:"y"`
+			} `bson:"_id"`
+			Count int `bson:"count"`
+		}
+		if err := cursor.Decode(&bucket); err != nil {
+			return nil, err
+		}
+		if grid.hex {
+			counts[grid.cell((bucket.ID.X+0.5)*bin, (bucket.ID.Y+0.5)*bin)] += bucket.Count
+		} else {
+			counts[[2]int{int(bucket.ID.X), int(bucket.ID.Y)}] += bucket.Count
+		}
+	}
+	return counts, cursor.Err()
+}
+
+// communityMemberIDs returns the ids of the memberships of a community
+func communityMemberIDs(ctx context.Context, communityID string) ([]string, error) {
+	cursor, err := client.Database("geolocapi").Collection("memberships").Find(ctx, bson.M{"communityid": communityID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var memberships []Membership
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(memberships))
+	for i, m := range memberships {
+		ids[i] = m.ID
+	}
+	return ids, nil
+}
+
+// GetHeatmap godoc
+// @Summary Get a density heatmap
+// @Description Counts locations, or tracked member positions, per square or hexagonal grid cell inside a bounding box, optionally limited to a community's area or members
+// @Tags analytics
+// @Accept json
+// @Produce json
+// @Param bbox query string true "minLng,minLat,maxLng,maxLat"
+// @Param resolution query number false "Cell size in meters at the centre of the box, defaults to 64 cells across"
+// @Param grid query string false "square (default) or hex"
+// @Param source query string false "locations (default) or positions"
+// @Param communityId query string false "Only count locations in this community's geofence, or positions of its members"
+// @Param from query string false "Start of the position time range (RFC 3339), defaults to 24 hours ago"
+// @Param to query string false "End of the position time range (RFC 3339), defaults to now"
+// @Param X-API-Key header string false "Privileged API key, private locations are counted by their obfuscated position without one"
+// @Success 200 {object} Heatmap
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/analytics/heatmap [get]
+func GetHeatmap(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Parse the bounding box, clamped to the Web Mercator square
+	box, err := parseBBox(query.Get("bbox"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid bbox: %v", err)
+		return
+	}
+	if box.MinLng > box.MaxLng {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid bbox: boxes crossing the antimeridian are not supported")
+		return
+	}
+	box.MinLat = math.Max(box.MinLat, -mercatorMaxLat)
+	box.MaxLat = math.Min(box.MaxLat, mercatorMaxLat)
+
+	// Parse the grid and source
+	heatmap := Heatmap{Grid: query.Get("grid"), Source: query.Get("source")}
+	if heatmap.Grid == "" {
+		heatmap.Grid = HeatmapGridSquare
+	}
+	if heatmap.Grid != HeatmapGridSquare && heatmap.Grid != HeatmapGridHex {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid grid: must be %s or %s", HeatmapGridSquare, HeatmapGridHex)
+		return
+	}
+	if heatmap.Source == "" {
+		heatmap.Source = HeatmapSourceLocations
+	}
+	if heatmap.Source != HeatmapSourceLocations && heatmap.Source != HeatmapSourcePositions {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid source: must be %s or %s", HeatmapSourceLocations, HeatmapSourcePositions)
+		return
+	}
+
+	// Parse the resolution and turn it into a size in Web Mercator units
+	minX, maxX := mercatorX(box.MinLng), mercatorX(box.MaxLng)
+	minY, maxY := mercatorY(box.MaxLat), mercatorY(box.MinLat)
+	metersPerUnit := 2 * math.Pi * earthRadiusMeters * math.Cos((box.MinLat+box.MaxLat)/2*math.Pi/180)
+	grid := heatmapGrid{hex: heatmap.Grid == HeatmapGridHex, size: (maxX - minX) / defaultHeatmapCellsAcross}
+	if value := query.Get("resolution"); value != "" {
+		resolution, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(resolution > 0) || math.IsInf(resolution, 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid resolution: must be a positive number of meters")
+			return
+		}
+		grid.size = resolution / metersPerUnit
+	}
+	if grid.size <= 0 || maxY <= minY {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid bbox: the box has no area")
+		return
+	}
+	heatmap.Resolution = grid.size * metersPerUnit
+
+	// Keep the grid to a size that can be answered
+	maxCells := config.GetFloat64("Heatmap.MaxCells")
+	if maxCells <= 0 {
+		maxCells = defaultHeatmapMaxCells
+	}
+	cellArea := grid.size * grid.size
+	if grid.hex {
+		cellArea = 3 * math.Sqrt(3) / 2 * grid.size * grid.size
+	}
+	if cells := (maxX - minX) * (maxY - minY) / cellArea; cells > maxCells {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid resolution: about %.0f cells would cover the box, the limit is %.0f", cells, maxCells)
+		return
+	}
+
+	// Parse the position time range
+	to := time.Now().UTC()
+	from := to.Add(-24 * time.Hour)
+	for _, bound := range []struct {
+		param string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if value := query.Get(bound.param); value != "" {
+			if *bound.value, err = time.Parse(time.RFC3339, value); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Invalid %s: %v", bound.param, err)
+				return
+			}
+		}
+	}
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context, keeping the audience of the request
+	ctx, cancel := context.WithTimeout(WithPrivilegedAudience(context.Background(), isPrivileged(r.Context())), 30*time.Second)
+	defer cancel()
+
+	// Look up the community filter
+	var fence *geofence
+	var memberIDs []string
+	if communityID := query.Get("communityId"); communityID != "" {
+		var community Community
+		err := client.Database("geolocapi").Collection("communities").FindOne(ctx, bson.M{"id": communityID}).Decode(&community)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Community not found"))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Error retrieving community: %v", err)
+			return
+		}
+		f := communityGeofence(community)
+		fence = &f
+		if heatmap.Source == HeatmapSourcePositions {
+			if memberIDs, err = communityMemberIDs(ctx, communityID); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "Error retrieving members: %v", err)
+				return
+			}
+		}
+	}
+
+	// Count the points per cell
+	var counts map[[2]int]int
+	if heatmap.Source == HeatmapSourcePositions {
+		counts, err = heatmapPositionCounts(ctx, grid, box, from, to, memberIDs)
+	} else {
+		counts, err = heatmapLocationCounts(ctx, grid, box, fence)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error computing heatmap: %v", err)
+		return
+	}
+	heatmap.Cells, heatmap.Total, heatmap.MaxCount = heatmapCells(grid, counts)
+
+	// Marshal the heatmap to JSON
+	jsonData, err := json.Marshal(heatmap)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
@@ -0,0 +1,33 @@
+package geolocationapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetHeatmapRejectsInvalidResolutions(t *testing.T) {
+	for _, resolution := range []string{"NaN", "nan", "0", "-100", "+Inf", "ten"} {
+		w := httptest.NewRecorder()
+		GetHeatmap(w, httptest.NewRequest(http.MethodGet, "/geolocationapi/analytics/heatmap?bbox=13.3,52.4,13.5,52.6&resolution="+resolution, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("resolution %s: status = %d, want %d", resolution, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHeatmapGridCell(t *testing.T) {
+	for _, grid := range []heatmapGrid{{size: 0.01}, {hex: true, size: 0.01}} {
+		for _, p := range [][2]float64{{0.5, 0.5}, {0.123, 0.987}, {0.0049, 0.0051}, {0.99, 0.01}} {
+			// A point lies in the cell whose centre is nearest, within the size of a cell
+			key := grid.cell(p[0], p[1])
+			x, y := grid.center(key)
+			if dx, dy := x-p[0], y-p[1]; dx*dx+dy*dy > grid.size*grid.size {
+				t.Errorf("hex %v: %v is in cell %v centred at %v,%v", grid.hex, p, key, x, y)
+			}
+			if again := grid.cell(x, y); again != key {
+				t.Errorf("hex %v: centre of cell %v falls in cell %v", grid.hex, key, again)
+			}
+		}
+	}
+}
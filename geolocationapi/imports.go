@@ -0,0 +1,161 @@
+package geolocationapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"temprest/logging"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Outcomes of importing one record
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportError   = "error"
+	// ImportValid is reported for records that would be imported by a dry run
+	ImportValid = "valid"
+)
+
+// ImportResult is the outcome of importing one record, Index is its position in the upload
+type ImportResult struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportReport summarises an import with one result per record
+type ImportReport struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Valid   int `json:"valid,omitempty"`
+	Failed  int `json:"failed"`
+	// Truncated is set when there were more results than the report keeps
+	Truncated bool           `json:"truncated,omitempty"`
+	Results   []ImportResult `json:"results"`
+}
+
+// add records the outcome of one record
+func (r *ImportReport) add(result ImportResult) {
+	switch result.Status {
+	case ImportCreated:
+		r.Created++
+	case ImportUpdated:
+		r.Updated++
+	case ImportValid:
+		r.Valid++
+	case ImportError:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
+
+// upsertLocation validates an imported location and upserts it by id. The fields the import
+// supplied and those derived from the position are set, the other fields of an existing location,
+// such as the address and privacy level a KML or GPX file cannot carry, are kept. created reports
+// whether the location is new.
+func upsertLocation(ctx context.Context, l Location) (created bool, err error) {
+	privacySupplied := strings.TrimSpace(l.Privacy) != ""
+	if err := validateCoordinate(l.Latitude, true); err != nil {
+		return false, err
+	}
+	if err := validateCoordinate(l.Longitude, false); err != nil {
+		return false, err
+	}
+	if err := validateLocationAddress(&l); err != nil {
+		return false, fmt.Errorf("invalid address: %v", err)
+	}
+	if err := validatePrivacyLevel(&l); err != nil {
+		return false, err
+	}
+	if err := validateLocationElevation(&l); err != nil {
+		return false, err
+	}
+	setLocationDerivedFields(&l)
+
+	collection := client.Database("geolocapi").Collection("locations")
+	result, err := collection.UpdateOne(ctx, bson.M{"id": l.ID}, locationImportUpdate(l, privacySupplied), options.Update().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+
+	// Keep caches and the spatial index in step with this change
+	onImportedLocationsSaved(ctx, []Location{l})
+	return result.UpsertedCount > 0, nil
+}
+
+// locationImportUpdate sets the fields of an imported location, empty fields were not supplied by
+// the import and are left as they are. The time zone follows the position and is removed when the
+// new position has none, privacySupplied marks an explicit exact level that removes the privacy.
+func locationImportUpdate(l Location, privacySupplied bool) bson.M {
+	set := bson.M{"latitude": l.Latitude, "longitude": l.Longitude, "geohash": l.Geohash}
+	unset := bson.M{}
+	setOnInsert := bson.M{}
+	if l.Name != "" {
+		set["name"] = l.Name
+	} else {
+		setOnInsert["name"] = ""
+	}
+	if l.Description != "" {
+		set["description"] = l.Description
+	}
+	if l.Address != nil {
+		set["address"] = l.Address
+	}
+	if l.Elevation != nil {
+		set["elevation"] = *l.Elevation
+	}
+	if l.Privacy != "" {
+		set["privacy"] = l.Privacy
+	} else if privacySupplied {
+		unset["privacy"] = ""
+	}
+	if l.TimeZone != "" {
+		set["timezone"] = l.TimeZone
+	} else {
+		unset["timezone"] = ""
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	if len(setOnInsert) > 0 {
+		update["$setOnInsert"] = setOnInsert
+	}
+	return update
+}
+
+// onImportedLocationsSaved reads upserted locations back, as an import only sets some of their
+// fields, and keeps caches and the spatial index in step with them. A location that cannot be read
+// back is indexed with the fields of the import.
+func onImportedLocationsSaved(ctx context.Context, imported []Location) {
+	ids := make([]string, len(imported))
+	for i, l := range imported {
+		ids[i] = l.ID
+	}
+	stored := map[string]Location{}
+	cursor, err := client.Database("geolocapi").Collection("locations").Find(ctx, bson.M{"id": bson.M{"$in": ids}})
+	if err == nil {
+		var locations []Location
+		if err = cursor.All(ctx, &locations); err == nil {
+			for _, l := range locations {
+				stored[l.ID] = l
+			}
+		}
+	}
+	if err != nil {
+		logging.DoLoggingLevelBasedLogs(logging.Warn, "", logging.EnrichErrorWithStackTrace(errors.New("error reading imported locations back: "+err.Error())))
+	}
+
+	for _, l := range imported {
+		if s, ok := stored[l.ID]; ok {
+			l = s
+		}
+		onLocationSaved(l)
+	}
+}
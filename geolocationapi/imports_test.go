@@ -0,0 +1,101 @@
+package geolocationapi
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestLocationImportUpdate(t *testing.T) {
+	elevation := 34.5
+	address := &Address{Street: "Unter den Linden 1", Locality: "Berlin", CountryCode: "DE"}
+	tests := []struct {
+		name            string
+		location        Location
+		privacySupplied bool
+		want            bson.M
+	}{
+		{
+			"kml placemark keeps the address and privacy",
+			Location{ID: "l1", Name: "Office", Description: "Front door", Latitude: 52.52, Longitude: 13.40, Geohash: "u33dc0", Elevation: &elevation, TimeZone: "Europe/Berlin"},
+			false,
+			bson.M{"$set": bson.M{"latitude": 52.52, "longitude": 13.40, "geohash": "u33dc0", "name": "Office", "description": "Front door", "elevation": 34.5, "timezone": "Europe/Berlin"}},
+		},
+		{
+			"gpx waypoint without a name",
+			Location{ID: "l2", Latitude: 0, Longitude: -160, Geohash: "8000"},
+			false,
+			bson.M{"$set": bson.M{"latitude": 0.0, "longitude": -160.0, "geohash": "8000"}, "$unset": bson.M{"timezone": ""}, "$setOnInsert": bson.M{"name": ""}},
+		},
+		{
+			"geojson feature with an address and privacy",
+			Location{ID: "l3", Name: "Home", Latitude: 52.52, Longitude: 13.40, Geohash: "u33dc0", Address: address, Privacy: PrivacyCity, TimeZone: "Europe/Berlin"},
+			true,
+			bson.M{"$set": bson.M{"latitude": 52.52, "longitude": 13.40, "geohash": "u33dc0", "name": "Home", "address": address, "privacy": PrivacyCity, "timezone": "Europe/Berlin"}},
+		},
+		{
+			"explicit exact privacy",
+			Location{ID: "l4", Name: "Shop", Latitude: 52.52, Longitude: 13.40, Geohash: "u33dc0", TimeZone: "Europe/Berlin"},
+			true,
+			bson.M{"$set": bson.M{"latitude": 52.52, "longitude": 13.40, "geohash": "u33dc0", "name": "Shop", "timezone": "Europe/Berlin"}, "$unset": bson.M{"privacy": ""}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := locationImportUpdate(tt.location, tt.privacySupplied); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("locationImportUpdate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildLocationCSVRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		set    []string
+		unset  []string
+	}{
+		{"position only", map[string]string{"id": "l1", "latitude": "52.52", "longitude": "13.40"}, []string{"latitude", "longitude", "geohash"}, nil},
+		{"empty mapped cells", map[string]string{"id": "l1", "name": "", "coordinates": "52.52, 13.40", "street": "", "privacy": ""}, []string{"latitude", "longitude", "geohash"}, nil},
+		{"address and privacy", map[string]string{"id": "l1", "name": "Home", "latitude": "52.52", "longitude": "13.40", "locality": "Berlin", "privacy": "city"}, []string{"name", "address", "privacy"}, nil},
+		{"exact privacy", map[string]string{"id": "l1", "latitude": "52.52", "longitude": "13.40", "privacy": "exact"}, nil, []string{"privacy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := buildLocationCSVRecord(tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			model, ok := record.model.(*mongo.UpdateOneModel)
+			if !ok || model.Upsert == nil || !*model.Upsert {
+				t.Fatalf("model = %#v, want an upsert", record.model)
+			}
+			update := model.Update.(bson.M)
+			set, _ := update["$set"].(bson.M)
+			unset, _ := update["$unset"].(bson.M)
+			for _, field := range tt.set {
+				if _, ok := set[field]; !ok {
+					t.Errorf("%s is not set by %v", field, update)
+				}
+			}
+			for _, field := range tt.unset {
+				if _, ok := unset[field]; !ok {
+					t.Errorf("%s is not unset by %v", field, update)
+				}
+			}
+			// Unmapped and empty columns must not overwrite the stored location
+			for field := range set {
+				switch field {
+				case "latitude", "longitude", "geohash", "timezone", "elevation":
+				default:
+					if value := tt.values[field]; field != "address" && value == "" {
+						t.Errorf("%s is set without a value in the row: %v", field, update)
+					}
+				}
+			}
+		})
+	}
+}
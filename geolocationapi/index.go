@@ -11,6 +11,8 @@ import (
 func GetRoutes() http.Handler {
 
 	r := chi.NewRouter()
+	// Decide per request whether private locations are shown exactly
+	r.Use(PrivacyAudience)
 
 	r.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("/swagger.json"), // The path to your swagger.json file
@@ -27,20 +29,67 @@ func GetRoutes() http.Handler {
 	r.Post("/membership", CreateMembership)
 	r.Put("/membership/{id}", UpdateMembershipByID)
 	r.Delete("/membership/{id}", DeleteMembershipByID)
+	r.Get("/membership/{id}/track", GetMemberTrack)
+	r.Get("/membership/{id}/geofence-events", GetMemberGeofenceEvents)
+
+	//Endpoints for tracked positions
+	r.Get("/positions/latest", GetLatestPositions)
+	r.Post("/positions", CreatePositions)
 
 	//Endpoints for location
+	r.Get("/location/geohash/neighbors/{hash}", GetGeohashNeighbors)
+	r.Get("/location/clusters", GetLocationClusters)
+	r.Get("/location/nearest", GetNearestLocations)
+	r.Get("/location/search", SearchLocations)
+	r.Get("/location/duplicates", GetLocationDuplicates)
+	r.Post("/location/merge", MergeLocations)
+	r.Post("/location/import", ImportLocationsGeoJSON)
+	r.Post("/location/import/csv", ImportLocationsCSV)
+	r.Post("/location/import/kml", ImportLocationsKML)
+	r.Post("/location/import/gpx", ImportLocationsGPX)
 	r.Get("/location/{id}", GetLocationByID)
 	r.Get("/location", GetLocation)
+	r.Get("/location.geojson", ExportLocationsGeoJSON)
+	r.Get("/location.kml", ExportLocationsKML)
+	r.Get("/location.gpx", ExportLocationsGPX)
 	r.Post("/location", CreateLocation)
 	r.Put("/location/{id}", UpdateLocationByID)
 	r.Delete("/location/{id}", DeleteLocationByID)
 
 	//Endpoints for membership
 	r.Get("/community", GetCommunity)
+	r.Get("/community.geojson", ExportCommunitiesGeoJSON)
+	r.Get("/community/recommend", RecommendCommunities)
+	r.Get("/community/location-report", GetLocationJoinReport)
+	r.Get("/community/{id}/geofence-events", GetCommunityGeofenceEvents)
+	r.Get("/community/{id}/spatial-stats", GetCommunitySpatialStats)
+	r.Get("/community/{id}/service-area", GetCommunityServiceArea)
 	r.Get("/community/{id}", GetCommunityByID)
 	r.Post("/community", CreateCommunity)
+	r.Post("/community/import/csv", ImportCommunitiesCSV)
 	r.Put("/community/{id}", UpdateCommunityByID)
 	r.Delete("/community/{id}", DeleteCommunityByID)
 
+	//Endpoints for geofencing
+	r.Post("/geofence/reports", ReportGeofencePositions)
+
+	//Endpoints for tracks
+	r.Get("/tracks", GetTracks)
+	r.Get("/tracks/{id}", GetTrackByID)
+	r.Post("/tracks", CreateTrack)
+	r.Delete("/tracks/{id}", DeleteTrackByID)
+
+	//Endpoints for analytics
+	r.Get("/analytics/heatmap", GetHeatmap)
+
+	//Endpoints for geocoding
+	r.Get("/geocode/reverse", GetReverseGeocode)
+	r.Get("/geocode/timezone", GetTimeZone)
+	r.Get("/geocode/elevation", GetElevation)
+	r.Post("/geocode/elevation", GetElevations)
+
+	//Endpoints for vector tiles
+	r.Get("/tiles/{layer}/{z}/{x}/{y}.mvt", GetTile)
+
 	return r
 }
@@ -0,0 +1,130 @@
+package geolocationapi
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// kmlNamespace is the KML 2.2 schema namespace
+const kmlNamespace = "http://www.opengis.net/kml/2.2"
+
+// kmlDocument is the subset of KML 2.2 read and written by the API
+type kmlDocument struct {
+	XMLName  xml.Name  `xml:"kml"`
+	Xmlns    string    `xml:"xmlns,attr,omitempty"`
+	Document kmlFolder `xml:"Document"`
+	// Placemarks and folders may also sit directly under the kml element
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+	Folders    []kmlFolder    `xml:"Folder"`
+}
+
+// kmlFolder is a Document or Folder element
+type kmlFolder struct {
+	Name       string         `xml:"name,omitempty"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+	Folders    []kmlFolder    `xml:"Folder"`
+}
+
+type kmlPlacemark struct {
+	ID          string         `xml:"id,attr,omitempty"`
+	Name        string         `xml:"name,omitempty"`
+	Description string         `xml:"description,omitempty"`
+	Point       *kmlPoint      `xml:"Point,omitempty"`
+	LineString  *kmlLineString `xml:"LineString,omitempty"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate,omitempty"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// readKML decodes a KML document
+func readKML(r io.Reader) (*kmlDocument, error) {
+	var doc kmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// placemarks returns every placemark of a document, descending into folders
+func (doc *kmlDocument) placemarks() []kmlPlacemark {
+	root := kmlFolder{
+		Placemarks: append(doc.Placemarks, doc.Document.Placemarks...),
+		Folders:    append(doc.Folders, doc.Document.Folders...),
+	}
+	var placemarks []kmlPlacemark
+	var walk func(folder kmlFolder)
+	walk = func(folder kmlFolder) {
+		placemarks = append(placemarks, folder.Placemarks...)
+		for _, child := range folder.Folders {
+			walk(child)
+		}
+	}
+	walk(root)
+	return placemarks
+}
+
+// parseKMLCoordinate reads the first longitude,latitude[,altitude] tuple of a coordinates element,
+// altitude is nil when the tuple has none
+func parseKMLCoordinate(s string) (lat, lng float64, altitude *float64, err error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, 0, nil, errors.New("empty coordinates")
+	}
+	parts := strings.Split(fields[0], ",")
+	if len(parts) < 2 {
+		return 0, 0, nil, errors.New("coordinates need a longitude and a latitude")
+	}
+	if lng, err = strconv.ParseFloat(parts[0], 64); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid longitude: %v", err)
+	}
+	if lat, err = strconv.ParseFloat(parts[1], 64); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid latitude: %v", err)
+	}
+	if len(parts) > 2 {
+		value, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("invalid altitude: %v", err)
+		}
+		altitude = &value
+	}
+	return lat, lng, altitude, nil
+}
+
+// writeKML encodes a KML 2.2 document with an XML declaration
+func writeKML(w io.Writer, doc *kmlDocument) error {
+	doc.Xmlns = kmlNamespace
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// kmlCoordinate formats a KML longitude,latitude[,altitude] tuple
+func kmlCoordinate(lat, lng float64, elevation *float64) string {
+	tuple := strconv.FormatFloat(lng, 'f', -1, 64) + "," + strconv.FormatFloat(lat, 'f', -1, 64)
+	if elevation != nil {
+		tuple += "," + strconv.FormatFloat(*elevation, 'f', -1, 64)
+	}
+	return tuple
+}
+
+// kmlTrackCoordinates formats track points as a KML coordinates list
+func kmlTrackCoordinates(points []TrackPoint) string {
+	tuples := make([]string, len(points))
+	for i, p := range points {
+		tuples[i] = kmlCoordinate(p.Latitude, p.Longitude, p.Elevation)
+	}
+	return strings.Join(tuples, " ")
+}
@@ -0,0 +1,402 @@
+package geolocationapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Location exchange formats
+const (
+	LocationFormatGeoJSON = "geojson"
+	LocationFormatKML     = "kml"
+	LocationFormatGPX     = "gpx"
+)
+
+// locationContentTypes are the media types of the exchange formats
+var locationContentTypes = map[string]string{
+	LocationFormatGeoJSON: "application/geo+json",
+	LocationFormatKML:     "application/vnd.google-earth.kml+xml",
+	LocationFormatGPX:     "application/gpx+xml",
+}
+
+// defaultImportMaxBodyBytes caps an uploaded location file when Import.MaxBodyBytes is not set
+const defaultImportMaxBodyBytes = 32 << 20
+
+// importedLocation is a location read from a file, or the reason it could not be read
+type importedLocation struct {
+	location Location
+	err      error
+}
+
+// ExportLocations writes every location, or those inside box when it is not nil, in an exchange format,
+// private locations are obfuscated unless ctx was marked with WithPrivilegedAudience
+func ExportLocations(ctx context.Context, w io.Writer, format string, box *BoundingBox) error {
+	if _, ok := locationContentTypes[format]; !ok {
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	all, err := loadAllLocations(ctx)
+	if err != nil {
+		return err
+	}
+	locations := make([]Location, 0, len(all))
+	for _, l := range all {
+		// Private locations are obfuscated unless ctx is privileged, and boxed by the position the reader sees
+		obfuscateLocation(ctx, &l)
+		if box == nil || box.Contains(l.Latitude, l.Longitude) {
+			locations = append(locations, l)
+		}
+	}
+
+	switch format {
+	case LocationFormatKML:
+		return writeKML(w, locationsKML(locations))
+	case LocationFormatGPX:
+		return writeGPX(w, locationsGPX(locations))
+	}
+	features := make([]GeoJSONFeature, 0, len(locations))
+	for _, l := range locations {
+		feature, err := locationFeature(l)
+		if err != nil {
+			return err
+		}
+		features = append(features, feature)
+	}
+	return json.NewEncoder(w).Encode(GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features})
+}
+
+// ImportLocations reads locations in an exchange format and upserts them by id
+func ImportLocations(ctx context.Context, r io.Reader, format string) (ImportReport, error) {
+	var items []importedLocation
+	var err error
+	switch format {
+	case LocationFormatKML:
+		items, err = readLocationsKML(r)
+	case LocationFormatGPX:
+		items, err = readLocationsGPX(r)
+	case LocationFormatGeoJSON:
+		items, err = readLocationsGeoJSON(r)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return ImportReport{}, err
+	}
+	if client == nil {
+		return ImportReport{}, errors.New("MongoDB client is not initialized")
+	}
+	return importLocations(ctx, items), nil
+}
+
+// importLocations upserts the locations that were read and records the outcome of each
+func importLocations(ctx context.Context, items []importedLocation) ImportReport {
+	report := ImportReport{Results: []ImportResult{}}
+	for i, item := range items {
+		if item.err != nil {
+			report.add(ImportResult{Index: i, ID: item.location.ID, Status: ImportError, Error: item.err.Error()})
+			continue
+		}
+		created, err := upsertLocation(ctx, item.location)
+		if err != nil {
+			report.add(ImportResult{Index: i, ID: item.location.ID, Status: ImportError, Error: err.Error()})
+			continue
+		}
+		status := ImportUpdated
+		if created {
+			status = ImportCreated
+		}
+		report.add(ImportResult{Index: i, ID: item.location.ID, Status: status})
+	}
+	return report
+}
+
+// locationsKML converts locations to a KML document of Point placemarks
+func locationsKML(locations []Location) *kmlDocument {
+	placemarks := make([]kmlPlacemark, len(locations))
+	for i, l := range locations {
+		placemarks[i] = kmlPlacemark{
+			ID:          l.ID,
+			Name:        l.Name,
+			Description: l.Description,
+			Point:       &kmlPoint{Coordinates: kmlCoordinate(l.Latitude, l.Longitude, l.Elevation)},
+		}
+	}
+	return &kmlDocument{Document: kmlFolder{Name: "Locations", Placemarks: placemarks}}
+}
+
+// locationsGPX converts locations to a GPX document of waypoints
+func locationsGPX(locations []Location) *gpxDocument {
+	waypoints := make([]gpxPoint, len(locations))
+	for i, l := range locations {
+		waypoints[i] = gpxPoint{
+			Lat:         l.Latitude,
+			Lon:         l.Longitude,
+			Elevation:   l.Elevation,
+			Name:        l.Name,
+			Description: l.Description,
+			Extensions:  &gpxExtensions{ID: l.ID},
+		}
+	}
+	return &gpxDocument{Metadata: &gpxMetadata{Name: "Locations"}, Waypoints: waypoints}
+}
+
+// readLocationsKML reads a location from every Point placemark, the placemark id attribute is the
+// location id and placemarks without one get a new id
+func readLocationsKML(r io.Reader) ([]importedLocation, error) {
+	doc, err := readKML(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KML: %w", err)
+	}
+
+	var items []importedLocation
+	for _, placemark := range doc.placemarks() {
+		l := Location{ID: placemark.ID, Name: placemark.Name, Description: placemark.Description}
+		if l.ID == "" {
+			l.ID = primitive.NewObjectID().Hex()
+		}
+		if placemark.Point == nil {
+			items = append(items, importedLocation{location: l, err: errors.New("placemark is not a Point")})
+			continue
+		}
+		l.Latitude, l.Longitude, l.Elevation, err = parseKMLCoordinate(placemark.Point.Coordinates)
+		items = append(items, importedLocation{location: l, err: err})
+	}
+	return items, nil
+}
+
+// readLocationsGPX reads a location from every waypoint, waypoints exported by the API keep their
+// id in an extension and others get a new id
+func readLocationsGPX(r io.Reader) ([]importedLocation, error) {
+	doc, err := readGPX(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GPX: %w", err)
+	}
+
+	items := make([]importedLocation, len(doc.Waypoints))
+	for i, waypoint := range doc.Waypoints {
+		l := Location{Name: waypoint.Name, Description: waypoint.Description, Latitude: waypoint.Lat, Longitude: waypoint.Lon, Elevation: waypoint.Elevation}
+		if waypoint.Extensions != nil {
+			l.ID = waypoint.Extensions.ID
+		}
+		if l.ID == "" {
+			l.ID = primitive.NewObjectID().Hex()
+		}
+		items[i] = importedLocation{location: l}
+	}
+	return items, nil
+}
+
+// readLocationsGeoJSON reads a location from every Point feature of a FeatureCollection or a single
+// Feature. The features of a collection are decoded one at a time, so only the locations read from
+// them are held in memory rather than the whole document.
+func readLocationsGeoJSON(r io.Reader) ([]importedLocation, error) {
+	decoder := json.NewDecoder(r)
+	if err := expectJSONDelim(decoder, '{'); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+
+	var items []importedLocation
+	members := map[string]json.RawMessage{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+		}
+		key, _ := token.(string)
+		if key != "features" {
+			// Keep the other members, a single Feature is decoded from them at the end
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+			}
+			members[key] = value
+			continue
+		}
+
+		if err := expectJSONDelim(decoder, '['); err != nil {
+			return nil, fmt.Errorf("invalid GeoJSON features: %w", err)
+		}
+		for decoder.More() {
+			var feature geoJSONObject
+			if err := decoder.Decode(&feature); err != nil {
+				return nil, fmt.Errorf("invalid GeoJSON feature %d: %w", len(items), err)
+			}
+			l, err := featureLocation(feature)
+			items = append(items, importedLocation{location: l, err: err})
+		}
+		if err := expectJSONDelim(decoder, ']'); err != nil {
+			return nil, fmt.Errorf("invalid GeoJSON features: %w", err)
+		}
+	}
+	if err := expectJSONDelim(decoder, '}'); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+
+	var object geoJSONObject
+	data, err := json.Marshal(members)
+	if err == nil {
+		err = json.Unmarshal(data, &object)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+	switch object.Type {
+	case "FeatureCollection":
+		return items, nil
+	case "Feature":
+		l, err := featureLocation(object)
+		return []importedLocation{{location: l, err: err}}, nil
+	}
+	return nil, fmt.Errorf("expected a FeatureCollection, got %q", object.Type)
+}
+
+// expectJSONDelim reads the next token of a decoder and checks it is the given delimiter
+func expectJSONDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
+
+// exportLocationsHTTP answers a location export in one exchange format
+func exportLocationsHTTP(w http.ResponseWriter, r *http.Request, format string) {
+	// Parse the optional bounding box
+	var box *BoundingBox
+	if value := r.URL.Query().Get("bbox"); value != "" {
+		parsed, err := parseBBox(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid bbox: %v", err)
+			return
+		}
+		box = &parsed
+	}
+
+	// Get the MongoDB context, keeping the audience of the request
+	ctx, cancel := context.WithTimeout(WithPrivilegedAudience(context.Background(), isPrivileged(r.Context())), 30*time.Second)
+	defer cancel()
+
+	// Write the locations to a buffer first so errors can still change the status code
+	var buffer bytes.Buffer
+	if err := ExportLocations(ctx, &buffer, format, box); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error exporting locations: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", locationContentTypes[format])
+	// Write the export
+	w.Write(buffer.Bytes())
+}
+
+// importLocationsHTTP answers a location import in one exchange format
+func importLocationsHTTP(w http.ResponseWriter, r *http.Request, format string) {
+	// Limit the size of the upload before reading it
+	maxBytes := limitRequestBody(w, r, "Import.MaxBodyBytes", defaultImportMaxBodyBytes)
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// Import the locations
+	report, err := ImportLocations(ctx, r.Body, format)
+	if writeBodyTooLarge(w, err, maxBytes) {
+		return
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if client == nil {
+			status = http.StatusInternalServerError
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "Error importing locations: %v", err)
+		return
+	}
+
+	// Marshal the report to JSON
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
+
+// ExportLocationsKML godoc
+// @Summary Export locations as KML
+// @Description Returns every location as a Point placemark with its name and description
+// @Tags locations
+// @Produce application/vnd.google-earth.kml+xml
+// @Param bbox query string false "Only export locations in minLng,minLat,maxLng,maxLat"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Success 200 {string} string "KML document"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location.kml [get]
+func ExportLocationsKML(w http.ResponseWriter, r *http.Request) {
+	exportLocationsHTTP(w, r, LocationFormatKML)
+}
+
+// ExportLocationsGPX godoc
+// @Summary Export locations as GPX
+// @Description Returns every location as a GPX waypoint with its name and description
+// @Tags locations
+// @Produce application/gpx+xml
+// @Param bbox query string false "Only export locations in minLng,minLat,maxLng,maxLat"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Success 200 {string} string "GPX document"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location.gpx [get]
+func ExportLocationsGPX(w http.ResponseWriter, r *http.Request) {
+	exportLocationsHTTP(w, r, LocationFormatGPX)
+}
+
+// ImportLocationsKML godoc
+// @Summary Import locations from KML
+// @Description Upserts a location for every Point placemark, using the placemark id attribute as the location id, and reports the outcome of each placemark. Existing locations keep the address, privacy level and other fields the placemark does not carry
+// @Tags locations
+// @Accept application/vnd.google-earth.kml+xml
+// @Produce json
+// @Param file body string true "KML document"
+// @Success 200 {object} ImportReport
+// @Failure 400 {string} string "Bad Request"
+// @Failure 413 {string} string "Request Entity Too Large"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location/import/kml [post]
+func ImportLocationsKML(w http.ResponseWriter, r *http.Request) {
+	importLocationsHTTP(w, r, LocationFormatKML)
+}
+
+// ImportLocationsGPX godoc
+// @Summary Import locations from GPX
+// @Description Upserts a location for every GPX waypoint and reports the outcome of each waypoint. Existing locations keep the address, privacy level and other fields the waypoint does not carry
+// @Tags locations
+// @Accept application/gpx+xml
+// @Produce json
+// @Param file body string true "GPX document"
+// @Success 200 {object} ImportReport
+// @Failure 400 {string} string "Bad Request"
+// @Failure 413 {string} string "Request Entity Too Large"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location/import/gpx [post]
+func ImportLocationsGPX(w http.ResponseWriter, r *http.Request) {
+	importLocationsHTTP(w, r, LocationFormatGPX)
+}
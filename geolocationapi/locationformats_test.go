@@ -0,0 +1,78 @@
+package geolocationapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestImportLocationsHTTPRejectsLargeBodies(t *testing.T) {
+	feature := `{"type":"Feature","geometry":{"type":"Point","coordinates":[13.40,52.52]},"properties":{"name":"Berlin"}},`
+	placemark := `<Placemark><name>Berlin</name><Point><coordinates>13.40,52.52</coordinates></Point></Placemark>`
+	waypoint := `<wpt lat="52.52" lon="13.40"><name>Berlin</name></wpt>`
+	tests := []struct {
+		name   string
+		format string
+		body   string
+		status int
+	}{
+		{"malformed geojson", LocationFormatGeoJSON, `{"type":`, http.StatusBadRequest},
+		{"geojson over the byte limit", LocationFormatGeoJSON,
+			`{"type":"FeatureCollection","features":[` + strings.Repeat(feature, defaultImportMaxBodyBytes/len(feature)+1), http.StatusRequestEntityTooLarge},
+		{"kml over the byte limit", LocationFormatKML,
+			`<kml><Document>` + strings.Repeat(placemark, defaultImportMaxBodyBytes/len(placemark)+1), http.StatusRequestEntityTooLarge},
+		{"gpx over the byte limit", LocationFormatGPX,
+			`<gpx>` + strings.Repeat(waypoint, defaultImportMaxBodyBytes/len(waypoint)+1), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			importLocationsHTTP(w, httptest.NewRequest(http.MethodPost, "/geolocationapi/location/import", strings.NewReader(tt.body)), tt.format)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %.200s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestReadLocationsGeoJSON(t *testing.T) {
+	point := `{"type":"Feature","id":"l1","geometry":{"type":"Point","coordinates":[13.40,52.52,34]},"properties":{"name":"Berlin"}}`
+	line := `{"type":"Feature","geometry":{"type":"LineString","coordinates":[[0,0],[1,1]]},"properties":{}}`
+	tests := []struct {
+		name    string
+		body    string
+		items   int
+		invalid int
+		wantErr bool
+	}{
+		{"collection", `{"type":"FeatureCollection","features":[` + point + `,` + line + `]}`, 2, 1, false},
+		{"type after the features", `{"features":[` + point + `],"bbox":[13,52,14,53],"type":"FeatureCollection"}`, 1, 0, false},
+		{"single feature", point, 1, 0, false},
+		{"empty collection", `{"type":"FeatureCollection","features":[]}`, 0, 0, false},
+		{"not a collection", `{"type":"Point","coordinates":[13.40,52.52]}`, 0, 0, true},
+		{"features not an array", `{"type":"FeatureCollection","features":{}}`, 0, 0, true},
+		{"truncated", `{"type":"FeatureCollection","features":[` + point, 0, 0, true},
+		{"not an object", `[]`, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := readLocationsGeoJSON(strings.NewReader(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			invalid := 0
+			for _, item := range items {
+				if item.err != nil {
+					invalid++
+				}
+			}
+			if len(items) != tt.items || invalid != tt.invalid {
+				t.Errorf("got %d items with %d invalid, want %d with %d invalid", len(items), invalid, tt.items, tt.invalid)
+			}
+			if len(items) > 0 && items[0].err == nil && (items[0].location.ID != "l1" || items[0].location.Latitude != 52.52 || *items[0].location.Elevation != 34) {
+				t.Errorf("first location = %+v", items[0].location)
+			}
+		})
+	}
+}
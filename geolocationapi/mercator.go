@@ -0,0 +1,26 @@
+package geolocationapi
+
+import "math"
+
+// mercatorX projects a longitude onto the unit Web Mercator square (0 west, 1 east)
+func mercatorX(lng float64) float64 {
+	return lng/360 + 0.5
+}
+
+// mercatorY projects a latitude onto the unit Web Mercator square (0 north, 1 south), clamped at the poles
+func mercatorY(lat float64) float64 {
+	sin := math.Sin(lat * math.Pi / 180)
+	y := 0.5 - 0.25*math.Log((1+sin)/(1-sin))/math.Pi
+	return math.Min(math.Max(y, 0), 1)
+}
+
+// mercatorLng converts a unit Web Mercator x back to a longitude
+func mercatorLng(x float64) float64 {
+	return (x - 0.5) * 360
+}
+
+// mercatorLat converts a unit Web Mercator y back to a latitude
+func mercatorLat(y float64) float64 {
+	y2 := (180 - y*360) * math.Pi / 180
+	return 360*math.Atan(math.Exp(y2))/math.Pi - 90
+}
@@ -0,0 +1,215 @@
+package geolocationapi
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// Mapbox Vector Tile geometry types and commands (spec version 2.1)
+const (
+	mvtGeomPoint   = 1
+	mvtGeomPolygon = 3
+
+	mvtCmdMoveTo    = 1
+	mvtCmdLineTo    = 2
+	mvtCmdClosePath = 7
+)
+
+// mvtPoint is a position in tile coordinates
+type mvtPoint struct {
+	X, Y int64
+}
+
+// mvtFeature is a feature ready to be encoded into a layer
+type mvtFeature struct {
+	geomType   int
+	points     []mvtPoint   // for points
+	rings      [][]mvtPoint // for polygons, the first ring is the exterior
+	attributes map[string]interface{}
+}
+
+// mvtLayer collects features and their deduplicated keys and values
+type mvtLayer struct {
+	name     string
+	extent   uint32
+	features []mvtFeature
+}
+
+// encodeMVTTile encodes layers into a vector tile, layers without features are skipped
+func encodeMVTTile(layers ...mvtLayer) []byte {
+	var tile []byte
+	for _, layer := range layers {
+		if len(layer.features) == 0 {
+			continue
+		}
+		tile = appendProtoBytes(tile, 3, encodeMVTLayer(layer))
+	}
+	return tile
+}
+
+// encodeMVTLayer encodes a single Layer message
+func encodeMVTLayer(layer mvtLayer) []byte {
+	var keys []string
+	keyIndex := map[string]uint64{}
+	var values [][]byte
+	valueIndex := map[string]uint64{}
+
+	var out []byte
+	out = appendProtoVarintField(out, 15, 2)
+	out = appendProtoBytes(out, 1, []byte(layer.name))
+
+	for _, f := range layer.features {
+		var tags []uint64
+		for _, k := range sortedKeys(f.attributes) {
+			encoded, ok := encodeMVTValue(f.attributes[k])
+			if !ok {
+				continue
+			}
+			ki, found := keyIndex[k]
+			if !found {
+				ki = uint64(len(keys))
+				keyIndex[k] = ki
+				keys = append(keys, k)
+			}
+			vi, found := valueIndex[string(encoded)]
+			if !found {
+				vi = uint64(len(values))
+				valueIndex[string(encoded)] = vi
+				values = append(values, encoded)
+			}
+			tags = append(tags, ki, vi)
+		}
+
+		var feature []byte
+		if len(tags) > 0 {
+			feature = appendProtoPacked(feature, 2, tags)
+		}
+		feature = appendProtoVarintField(feature, 3, uint64(f.geomType))
+		feature = appendProtoPacked(feature, 4, encodeMVTGeometry(f))
+		out = appendProtoBytes(out, 2, feature)
+	}
+
+	for _, k := range keys {
+		out = appendProtoBytes(out, 3, []byte(k))
+	}
+	for _, v := range values {
+		out = appendProtoBytes(out, 4, v)
+	}
+	out = appendProtoVarintField(out, 5, uint64(layer.extent))
+	return out
+}
+
+// encodeMVTValue encodes a Value message, unsupported types are skipped
+func encodeMVTValue(v interface{}) ([]byte, bool) {
+	var out []byte
+	switch value := v.(type) {
+	case string:
+		out = appendProtoBytes(out, 1, []byte(value))
+	case bool:
+		b := uint64(0)
+		if value {
+			b = 1
+		}
+		out = appendProtoVarintField(out, 7, b)
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			out = appendProtoVarintField(out, 6, zigzag(int64(value)))
+		} else {
+			out = appendProtoKey(out, 3, 1)
+			out = binary.LittleEndian.AppendUint64(out, math.Float64bits(value))
+		}
+	case int:
+		out = appendProtoVarintField(out, 6, zigzag(int64(value)))
+	default:
+		// Nested values such as arrays and objects cannot be tile attributes
+		return nil, false
+	}
+	return out, true
+}
+
+// encodeMVTGeometry encodes the command stream of a feature
+func encodeMVTGeometry(f mvtFeature) []uint64 {
+	var cmds []uint64
+	var cursor mvtPoint
+	moveTo := func(p mvtPoint) {
+		cmds = append(cmds, zigzag(p.X-cursor.X), zigzag(p.Y-cursor.Y))
+		cursor = p
+	}
+
+	switch f.geomType {
+	case mvtGeomPoint:
+		cmds = append(cmds, mvtCommand(mvtCmdMoveTo, len(f.points)))
+		for _, p := range f.points {
+			moveTo(p)
+		}
+	case mvtGeomPolygon:
+		for _, ring := range f.rings {
+			cmds = append(cmds, mvtCommand(mvtCmdMoveTo, 1))
+			moveTo(ring[0])
+			cmds = append(cmds, mvtCommand(mvtCmdLineTo, len(ring)-1))
+			for _, p := range ring[1:] {
+				moveTo(p)
+			}
+			cmds = append(cmds, mvtCommand(mvtCmdClosePath, 1))
+		}
+	}
+	return cmds
+}
+
+// mvtCommand packs a command id and repeat count
+func mvtCommand(id, count int) uint64 {
+	return uint64(id&0x7) | uint64(count)<<3
+}
+
+// mvtRingArea returns twice the signed area of a ring in tile coordinates
+func mvtRingArea(ring []mvtPoint) int64 {
+	var area int64
+	for i := range ring {
+		j := (i + 1) % len(ring)
+		area += ring[i].X*ring[j].Y - ring[j].X*ring[i].Y
+	}
+	return area
+}
+
+// zigzag maps signed integers to unsigned so small magnitudes stay small
+func zigzag(n int64) uint64 {
+	return uint64((n << 1) ^ (n >> 63))
+}
+
+// appendProtoKey appends a protobuf field key
+func appendProtoKey(b []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+// appendProtoVarintField appends a varint field
+func appendProtoVarintField(b []byte, field int, v uint64) []byte {
+	b = appendProtoKey(b, field, 0)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendProtoBytes appends a length-delimited field
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = appendProtoKey(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// appendProtoPacked appends a packed repeated varint field
+func appendProtoPacked(b []byte, field int, values []uint64) []byte {
+	var packed []byte
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, v)
+	}
+	return appendProtoBytes(b, field, packed)
+}
+
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,189 @@
+package geolocationapi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// protoField is a decoded protobuf field, varint fields keep their value and length-delimited ones their bytes
+type protoField struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+// decodeProto splits a protobuf message into its fields
+func decodeProto(t *testing.T, b []byte) []protoField {
+	t.Helper()
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad field key in %x", b)
+		}
+		b = b[n:]
+		field := protoField{number: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			field.value, n = binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("bad varint in %x", b)
+			}
+			b = b[n:]
+		case 1:
+			field.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || int(length) > len(b)-n {
+				t.Fatalf("bad length in %x", b)
+			}
+			field.data = b[n : n+int(length)]
+			b = b[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// decodePacked reads a packed repeated varint field
+func decodePacked(t *testing.T, b []byte) []uint64 {
+	t.Helper()
+	var values []uint64
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad packed varint in %x", b)
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values
+}
+
+func TestZigzag(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want uint64
+	}{
+		{0, 0}, {-1, 1}, {1, 2}, {-2, 3}, {2147483647, 4294967294}, {-2147483648, 4294967295},
+	}
+	for _, tt := range tests {
+		if got := zigzag(tt.in); got != tt.want {
+			t.Errorf("zigzag(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeMVTGeometry(t *testing.T) {
+	// The command streams are the examples of the vector tile specification 2.1, section 4.3.5
+	tests := []struct {
+		name    string
+		feature mvtFeature
+		want    []uint64
+	}{
+		{"point", mvtFeature{geomType: mvtGeomPoint, points: []mvtPoint{{25, 17}}}, []uint64{9, 50, 34}},
+		{"multi point", mvtFeature{geomType: mvtGeomPoint, points: []mvtPoint{{5, 7}, {3, 2}}}, []uint64{17, 10, 14, 3, 9}},
+		{"polygon", mvtFeature{geomType: mvtGeomPolygon, rings: [][]mvtPoint{{{3, 6}, {8, 12}, {20, 34}}}}, []uint64{9, 6, 12, 18, 10, 12, 24, 44, 15}},
+		{"polygon with a hole", mvtFeature{geomType: mvtGeomPolygon, rings: [][]mvtPoint{
+			{{0, 0}, {10, 0}, {10, 10}, {0, 10}},
+			{{11, 11}, {20, 11}, {20, 20}, {11, 20}},
+			{{13, 13}, {13, 17}, {17, 17}, {17, 13}},
+		}}, []uint64{9, 0, 0, 26, 20, 0, 0, 20, 19, 0, 15, 9, 22, 2, 26, 18, 0, 0, 18, 17, 0, 15, 9, 4, 13, 26, 0, 8, 8, 0, 0, 7, 15}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeMVTGeometry(tt.feature); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("encodeMVTGeometry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeMVTTile(t *testing.T) {
+	layer := mvtLayer{name: "locations", extent: 4096, features: []mvtFeature{
+		{geomType: mvtGeomPoint, points: []mvtPoint{{25, 17}}, attributes: map[string]interface{}{"id": "l1", "name": "Berlin", "rank": 3.0}},
+		{geomType: mvtGeomPoint, points: []mvtPoint{{5, 7}}, attributes: map[string]interface{}{"id": "l2", "name": "Berlin", "tags": []interface{}{"x"}}},
+	}}
+	tile := decodeProto(t, encodeMVTTile(layer, mvtLayer{name: "communities", extent: 4096}))
+
+	// Layers without features are left out
+	if len(tile) != 1 || tile[0].number != 3 {
+		t.Fatalf("tile fields = %+v, want one layer", tile)
+	}
+
+	var name string
+	var version, extent uint64
+	var keys []string
+	var values [][]byte
+	var features [][]protoField
+	for _, f := range decodeProto(t, tile[0].data) {
+		switch f.number {
+		case 1:
+			name = string(f.data)
+		case 2:
+			features = append(features, decodeProto(t, f.data))
+		case 3:
+			keys = append(keys, string(f.data))
+		case 4:
+			values = append(values, f.data)
+		case 5:
+			extent = f.value
+		case 15:
+			version = f.value
+		}
+	}
+	if name != "locations" || version != 2 || extent != 4096 {
+		t.Errorf("layer name %q, version %d, extent %d", name, version, extent)
+	}
+	// Keys and values are shared between features, the array attribute cannot be encoded
+	if fmt.Sprint(keys) != "[id name rank]" || len(values) != 4 {
+		t.Fatalf("keys %v and %d values, want [id name rank] and 4 values", keys, len(values))
+	}
+
+	// Attribute values decode back to what was encoded
+	decodeValue := func(b []byte) interface{} {
+		f := decodeProto(t, b)[0]
+		switch f.number {
+		case 1:
+			return string(f.data)
+		case 6:
+			return int64(f.value>>1) ^ -int64(f.value&1)
+		}
+		return nil
+	}
+	wantTags := []map[string]interface{}{
+		{"id": "l1", "name": "Berlin", "rank": int64(3)},
+		{"id": "l2", "name": "Berlin"},
+	}
+	wantGeometry := [][]uint64{{9, 50, 34}, {9, 10, 14}}
+	if len(features) != 2 {
+		t.Fatalf("got %d features, want 2", len(features))
+	}
+	for i, feature := range features {
+		tags := map[string]interface{}{}
+		for _, f := range feature {
+			switch f.number {
+			case 2:
+				packed := decodePacked(t, f.data)
+				for j := 0; j+1 < len(packed); j += 2 {
+					tags[keys[packed[j]]] = decodeValue(values[packed[j+1]])
+				}
+			case 3:
+				if f.value != mvtGeomPoint {
+					t.Errorf("feature %d has geometry type %d", i, f.value)
+				}
+			case 4:
+				if got := decodePacked(t, f.data); fmt.Sprint(got) != fmt.Sprint(wantGeometry[i]) {
+					t.Errorf("feature %d geometry = %v, want %v", i, got, wantGeometry[i])
+				}
+			}
+		}
+		if fmt.Sprint(tags) != fmt.Sprint(wantTags[i]) {
+			t.Errorf("feature %d tags = %v, want %v", i, tags, wantTags[i])
+		}
+	}
+}
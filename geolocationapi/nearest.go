@@ -0,0 +1,365 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"temprest/config"
+	"temprest/logging"
+	"time"
+)
+
+// Nearest neighbour defaults used when the Nearest config section is missing
+const (
+	defaultNearestK    = 5
+	defaultNearestMaxK = 100
+)
+
+// NearestLocation is a location with its distance from the query point in meters
+type NearestLocation struct {
+	Location
+	Distance float64 `json:"distance"`
+}
+
+// locationSpatialIndex keeps every location in an R-tree for low latency nearest neighbour queries
+type locationSpatialIndex struct {
+	mu      sync.RWMutex
+	tree    rtree[Location]
+	boxes   map[string]BoundingBox
+	ready   bool
+	loading bool
+	// pending holds writes that arrive while the index is loading from the database
+	pending []func()
+}
+
+var locationIndex = &locationSpatialIndex{boxes: map[string]BoundingBox{}}
+
+// load fills the index from the database, it does nothing when the index is ready or already loading
+func (i *locationSpatialIndex) load() {
+	i.mu.Lock()
+	if i.ready || i.loading {
+		i.mu.Unlock()
+		return
+	}
+	i.loading = true
+	i.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	locations, err := loadAllLocations(ctx)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.loading = false
+	if err != nil {
+		i.pending = nil
+		logging.DoLoggingLevelBasedLogs(logging.Warn, "", logging.EnrichErrorWithStackTrace(errors.New("error loading location index: "+err.Error())))
+		return
+	}
+
+	// Keep the last document for each id
+	byID := make(map[string]Location, len(locations))
+	for _, l := range locations {
+		byID[l.ID] = l
+	}
+	ids := make([]string, 0, len(byID))
+	boxes := make([]BoundingBox, 0, len(byID))
+	items := make([]Location, 0, len(byID))
+	i.boxes = make(map[string]BoundingBox, len(byID))
+	for id, l := range byID {
+		box := pointBBox(l.Latitude, l.Longitude)
+		ids = append(ids, id)
+		boxes = append(boxes, box)
+		items = append(items, l)
+		i.boxes[id] = box
+	}
+	i.tree.Load(ids, boxes, items)
+
+	for _, apply := range i.pending {
+		apply()
+	}
+	i.pending = nil
+	i.ready = true
+	logging.DoLoggingLevelBasedLogs(logging.Info, fmt.Sprintf("location index loaded with %d locations", i.tree.Len()), nil)
+}
+
+// upsert adds or moves a location in the index
+func (i *locationSpatialIndex) upsert(l Location) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	apply := func() {
+		if box, ok := i.boxes[l.ID]; ok {
+			i.tree.Delete(l.ID, box)
+		}
+		box := pointBBox(l.Latitude, l.Longitude)
+		i.tree.Insert(l.ID, box, l)
+		i.boxes[l.ID] = box
+	}
+	if i.loading {
+		i.pending = append(i.pending, apply)
+		return
+	}
+	apply()
+}
+
+// remove deletes a location from the index
+func (i *locationSpatialIndex) remove(id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	apply := func() {
+		if box, ok := i.boxes[id]; ok {
+			i.tree.Delete(id, box)
+			delete(i.boxes, id)
+		}
+	}
+	if i.loading {
+		i.pending = append(i.pending, apply)
+		return
+	}
+	apply()
+}
+
+// nearest queries the index, ok is false while the index is not loaded yet
+func (i *locationSpatialIndex) nearest(lat, lng float64, k int, maxDistance float64, accept func(Location) bool) (results []NearestLocation, ok bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if !i.ready {
+		return nil, false
+	}
+	for _, r := range i.tree.Nearest(lat, lng, k, maxDistance, accept) {
+		results = append(results, NearestLocation{Location: r.Item, Distance: r.Distance})
+	}
+	return results, true
+}
+
+// all returns every indexed location, ok is false while the index is not loaded yet
+func (i *locationSpatialIndex) all() (locations []Location, ok bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if !i.ready {
+		return nil, false
+	}
+	locations = make([]Location, 0, i.tree.Len())
+	i.tree.Search(BoundingBox{MinLng: -180, MinLat: -90, MaxLng: 180, MaxLat: 90}, func(l Location) bool {
+		locations = append(locations, l)
+		return true
+	})
+	return locations, true
+}
+
+// within returns the indexed locations inside a box, ok is false while the index is not loaded yet
+func (i *locationSpatialIndex) within(box BoundingBox) (locations []Location, ok bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if !i.ready {
+		return nil, false
+	}
+	i.tree.Search(box, func(l Location) bool {
+		locations = append(locations, l)
+		return true
+	})
+	return locations, true
+}
+
+// findNearestLocations returns the k locations nearest to a point as the audience of ctx sees them.
+// Private locations are obfuscated before they are filtered, measured and ranked, so neither the
+// filters nor the order of the results reveal their exact position.
+func findNearestLocations(ctx context.Context, lat, lng float64, k int, maxDistance float64, accept func(Location) bool) ([]NearestLocation, error) {
+	// Obfuscation moves a position at most offset meters, so candidates are searched that much further
+	offset := privacyMaxOffset(ctx)
+	searchDistance := maxDistance
+	if maxDistance > 0 {
+		searchDistance += offset
+	}
+	// Public locations are seen at their exact position and can be filtered by the index right away
+	candidateAccept := func(l Location) bool {
+		return (offset > 0 && l.Privacy != "") || accept(l)
+	}
+
+	// Over-fetch until no location beyond the candidates can be seen closer than the k-th result
+	for fetch := k; ; fetch *= 2 {
+		candidates, ok := locationIndex.nearest(lat, lng, fetch, searchDistance, candidateAccept)
+		if !ok {
+			go locationIndex.load()
+			return nearestFromDatabase(ctx, lat, lng, k, maxDistance, accept)
+		}
+		results := rankNearestLocations(ctx, candidates, lat, lng, maxDistance, accept)
+		if len(candidates) < fetch || (len(results) >= k && results[k-1].Distance <= candidates[len(candidates)-1].Distance-offset) {
+			if len(results) > k {
+				results = results[:k]
+			}
+			return results, nil
+		}
+	}
+}
+
+// nearestFromDatabase answers a nearest neighbour query by scanning the collection
+func nearestFromDatabase(ctx context.Context, lat, lng float64, k int, maxDistance float64, accept func(Location) bool) ([]NearestLocation, error) {
+	// The query runs on its own deadline, keeping the audience of the request
+	dbCtx, cancel := context.WithTimeout(WithPrivilegedAudience(context.Background(), isPrivileged(ctx)), 10*time.Second)
+	defer cancel()
+	locations, err := loadAllLocations(dbCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]NearestLocation, len(locations))
+	for i, l := range locations {
+		candidates[i] = NearestLocation{Location: l}
+	}
+	results := rankNearestLocations(ctx, candidates, lat, lng, maxDistance, accept)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// rankNearestLocations obfuscates candidates for the audience of ctx, then filters them and sorts
+// them by the distance from the query point to the position the audience sees
+func rankNearestLocations(ctx context.Context, candidates []NearestLocation, lat, lng, maxDistance float64, accept func(Location) bool) []NearestLocation {
+	var results []NearestLocation
+	for _, candidate := range candidates {
+		l := candidate.Location
+		obfuscateLocation(ctx, &l)
+		if accept != nil && !accept(l) {
+			continue
+		}
+		distance := haversineMeters(lat, lng, l.Latitude, l.Longitude)
+		if maxDistance > 0 && distance > maxDistance {
+			continue
+		}
+		results = append(results, NearestLocation{Location: l, Distance: distance})
+	}
+	// Obfuscated locations often share a position, their id keeps the order of ties stable
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Distance != results[b].Distance {
+			return results[a].Distance < results[b].Distance
+		}
+		return results[a].ID < results[b].ID
+	})
+	return results
+}
+
+// parseLatLngQuery reads the lat and lng query parameters
+func parseLatLngQuery(r *http.Request) (lat, lng float64, err error) {
+	lat, err = strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	if err != nil {
+		return 0, 0, errors.New("lat must be a number")
+	}
+	lng, err = strconv.ParseFloat(r.URL.Query().Get("lng"), 64)
+	if err != nil {
+		return 0, 0, errors.New("lng must be a number")
+	}
+	if err = validateCoordinate(lat, true); err != nil {
+		return 0, 0, err
+	}
+	if err = validateCoordinate(lng, false); err != nil {
+		return 0, 0, err
+	}
+	return lat, lng, nil
+}
+
+// GetNearestLocations godoc
+// @Summary Get the nearest locations to a point
+// @Description Returns the k closest locations from the in-process spatial index, using the database until the index is loaded
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param lat query number true "Latitude"
+// @Param lng query number true "Longitude"
+// @Param k query int false "Number of locations to return (default 5)"
+// @Param maxDistance query number false "Only return locations within this many meters"
+// @Param geohash query string false "Only return locations whose geohash starts with this prefix"
+// @Param name query string false "Only return locations whose name contains this text"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Success 200 {object} []NearestLocation
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location/nearest [get]
+func GetNearestLocations(w http.ResponseWriter, r *http.Request) {
+	// Parse the query point
+	lat, lng, err := parseLatLngQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid point: %v", err)
+		return
+	}
+
+	// Parse the number of results
+	maxK := config.GetInt("Nearest.MaxK")
+	if maxK <= 0 {
+		maxK = defaultNearestMaxK
+	}
+	k := defaultNearestK
+	if value := r.URL.Query().Get("k"); value != "" {
+		k, err = strconv.Atoi(value)
+		if err != nil || k < 1 || k > maxK {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid k: must be between 1 and %d", maxK)
+			return
+		}
+	}
+
+	// Parse the optional filters
+	var maxDistance float64
+	if value := r.URL.Query().Get("maxDistance"); value != "" {
+		maxDistance, err = strconv.ParseFloat(value, 64)
+		if err != nil || !(maxDistance >= 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid maxDistance: must be a positive number of meters")
+			return
+		}
+	}
+	prefix := strings.ToLower(r.URL.Query().Get("geohash"))
+	if prefix != "" && !isGeohash(prefix) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid geohash prefix: %v", prefix)
+		return
+	}
+	name := strings.ToLower(r.URL.Query().Get("name"))
+	accept := func(l Location) bool {
+		if prefix != "" && !strings.HasPrefix(l.Geohash, prefix) {
+			return false
+		}
+		if name != "" && !strings.Contains(strings.ToLower(l.Name), name) {
+			return false
+		}
+		return true
+	}
+
+	// Query the index, falling back to the database while it is loading. Private locations are
+	// filtered and ranked by the position the caller sees.
+	results, err := findNearestLocations(r.Context(), lat, lng, k, maxDistance, accept)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error finding nearest locations: %v", err)
+		return
+	}
+	if results == nil {
+		results = []NearestLocation{}
+	}
+
+	// Marshal results to JSON
+	jsonData, err := json.Marshal(results)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
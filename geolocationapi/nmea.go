@@ -0,0 +1,302 @@
+package geolocationapi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// knotsToMetersPerSecond converts the speed over ground of RMC sentences
+const knotsToMetersPerSecond = 1852.0 / 3600
+
+// nmeaDeviceSentence is the proprietary sentence a device sends to name itself, $PDEVID,<device id>*hh
+// or $PDEVID,<device id>,<secret>*hh
+const nmeaDeviceSentence = "PDEVID"
+
+// Errors of sentences that are well formed but carry no position
+var (
+	errNMEAUnsupported = errors.New("unsupported sentence")
+	errNMEANoFix       = errors.New("receiver has no fix")
+)
+
+// nmeaSentence is a checksummed NMEA 0183 sentence split into its fields
+type nmeaSentence struct {
+	// address is the talker and sentence type, such as GPGGA or GNRMC, or a proprietary P... address
+	address string
+	fields  []string
+}
+
+// kind returns the sentence type without the talker, GGA for both GPGGA and GNGGA
+func (s nmeaSentence) kind() string {
+	if strings.HasPrefix(s.address, "P") || len(s.address) != 5 {
+		return s.address
+	}
+	return s.address[2:]
+}
+
+// nmeaChecksum is the XOR of every byte between $ and *
+func nmeaChecksum(body string) byte {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return sum
+}
+
+// formatNMEASentence adds the $ and checksum to the comma separated fields of a sentence
+func formatNMEASentence(fields ...string) string {
+	body := strings.Join(fields, ",")
+	return fmt.Sprintf("$%s*%02X\r\n", body, nmeaChecksum(body))
+}
+
+// parseNMEASentence checks the framing and checksum of a sentence, the checksum is required
+func parseNMEASentence(line string) (nmeaSentence, error) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "$") {
+		return nmeaSentence{}, errors.New("sentence must start with $")
+	}
+	star := strings.LastIndexByte(line, '*')
+	if star < 0 || len(line)-star != 3 {
+		return nmeaSentence{}, errors.New("sentence must end with a *hh checksum")
+	}
+	body := line[1:star]
+	expected, err := strconv.ParseUint(line[star+1:], 16, 8)
+	if err != nil {
+		return nmeaSentence{}, fmt.Errorf("invalid checksum %q", line[star+1:])
+	}
+	if actual := nmeaChecksum(body); byte(expected) != actual {
+		return nmeaSentence{}, fmt.Errorf("checksum mismatch, sentence has %02X but the data sums to %02X", expected, actual)
+	}
+
+	fields := strings.Split(body, ",")
+	if fields[0] == "" {
+		return nmeaSentence{}, errors.New("sentence has no address")
+	}
+	return nmeaSentence{address: fields[0], fields: fields[1:]}, nil
+}
+
+// nmeaFix is a position reported by a GGA or RMC sentence, the two sentences of one epoch are merged
+type nmeaFix struct {
+	// timeOfDay since midnight UTC, every fix sentence carries it
+	timeOfDay time.Duration
+	// date is midnight UTC of the fix, only RMC sentences carry it
+	date      time.Time
+	latitude  float64
+	longitude float64
+	// altitude above mean sea level in meters from GGA
+	altitude *float64
+	// speed over ground in meters per second and heading, the course over ground, from RMC
+	speed   *float64
+	heading *float64
+}
+
+// parseNMEAFix reads the position of a GGA or RMC sentence, other sentences return errNMEAUnsupported
+// and sentences reporting an invalid fix errNMEANoFix
+func parseNMEAFix(s nmeaSentence) (*nmeaFix, error) {
+	switch s.kind() {
+	case "GGA":
+		return parseNMEAGGA(s.fields)
+	case "RMC":
+		return parseNMEARMC(s.fields)
+	}
+	return nil, errNMEAUnsupported
+}
+
+// parseNMEAGGA reads time, lat, N/S, lng, E/W, quality, satellites, HDOP, altitude, M, ...
+func parseNMEAGGA(fields []string) (*nmeaFix, error) {
+	if len(fields) < 9 {
+		return nil, fmt.Errorf("GGA needs at least 9 fields, got %d", len(fields))
+	}
+	if fields[5] == "" || fields[5] == "0" {
+		return nil, errNMEANoFix
+	}
+	fix, err := parseNMEAPosition(fields[0], fields[1], fields[2], fields[3], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	if fields[8] != "" {
+		altitude, err := strconv.ParseFloat(fields[8], 64)
+		if err != nil || math.IsNaN(altitude) || math.IsInf(altitude, 0) {
+			return nil, fmt.Errorf("invalid altitude %q", fields[8])
+		}
+		fix.altitude = &altitude
+	}
+	return fix, nil
+}
+
+// parseNMEARMC reads time, status, lat, N/S, lng, E/W, speed in knots, course, date, ...
+func parseNMEARMC(fields []string) (*nmeaFix, error) {
+	if len(fields) < 9 {
+		return nil, fmt.Errorf("RMC needs at least 9 fields, got %d", len(fields))
+	}
+	// NMEA 2.3 adds a mode indicator, N marks data that is not valid despite an A status
+	if fields[1] != "A" || (len(fields) > 11 && fields[11] == "N") {
+		return nil, errNMEANoFix
+	}
+	fix, err := parseNMEAPosition(fields[0], fields[2], fields[3], fields[4], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	if fields[6] != "" {
+		knots, err := strconv.ParseFloat(fields[6], 64)
+		if err != nil || !(knots >= 0) || math.IsInf(knots, 0) {
+			return nil, fmt.Errorf("invalid speed %q", fields[6])
+		}
+		speed := knots * knotsToMetersPerSecond
+		fix.speed = &speed
+	}
+	if fields[7] != "" {
+		heading, err := strconv.ParseFloat(fields[7], 64)
+		if err != nil || !(heading >= 0 && heading <= 360) {
+			return nil, fmt.Errorf("invalid course %q", fields[7])
+		}
+		// A course of 360 is north, stored positions keep headings below 360
+		heading = math.Mod(heading, 360)
+		fix.heading = &heading
+	}
+	if fix.date, err = time.Parse("020106", fields[8]); err != nil {
+		return nil, fmt.Errorf("invalid date %q", fields[8])
+	}
+	return fix, nil
+}
+
+// parseNMEAPosition reads the hhmmss.ss time and the ddmm.mmmm/dddmm.mmmm coordinates every fix has
+func parseNMEAPosition(clock, lat, ns, lng, ew string) (*nmeaFix, error) {
+	timeOfDay, err := parseNMEATime(clock)
+	if err != nil {
+		return nil, err
+	}
+	latitude, err := parseNMEACoordinate(lat, ns, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude: %v", err)
+	}
+	longitude, err := parseNMEACoordinate(lng, ew, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude: %v", err)
+	}
+	return &nmeaFix{timeOfDay: timeOfDay, latitude: latitude, longitude: longitude}, nil
+}
+
+// parseNMEATime reads hhmmss with optional fractional seconds as the time since midnight
+func parseNMEATime(value string) (time.Duration, error) {
+	if len(value) < 6 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	hours, errH := strconv.Atoi(value[0:2])
+	minutes, errM := strconv.Atoi(value[2:4])
+	seconds, errS := strconv.ParseFloat(value[4:], 64)
+	if errH != nil || errM != nil || errS != nil || hours > 23 || minutes > 59 || seconds < 0 || seconds >= 61 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(math.Round(seconds*1000))*time.Millisecond, nil
+}
+
+// parseNMEACoordinate reads degrees and decimal minutes with a hemisphere letter
+func parseNMEACoordinate(value, hemisphere string, isLatitude bool) (float64, error) {
+	degreeDigits, positive, negative := 3, "E", "W"
+	if isLatitude {
+		degreeDigits, positive, negative = 2, "N", "S"
+	}
+	dot := strings.IndexByte(value, '.')
+	if dot < 0 {
+		dot = len(value)
+	}
+	if dot != degreeDigits+2 {
+		return 0, fmt.Errorf("%q is not in degrees and minutes", value)
+	}
+	degrees, err := strconv.Atoi(value[:degreeDigits])
+	if err != nil {
+		return 0, fmt.Errorf("%q is not in degrees and minutes", value)
+	}
+	minutes, err := strconv.ParseFloat(value[degreeDigits:], 64)
+	if err != nil || minutes >= 60 {
+		return 0, fmt.Errorf("%q is not in degrees and minutes", value)
+	}
+
+	coordinate := float64(degrees) + minutes/60
+	switch hemisphere {
+	case positive:
+	case negative:
+		coordinate = -coordinate
+	default:
+		return 0, fmt.Errorf("invalid hemisphere %q", hemisphere)
+	}
+	if err := validateCoordinate(coordinate, isLatitude); err != nil {
+		return 0, err
+	}
+	return coordinate, nil
+}
+
+// merge adds the fields of another sentence of the same epoch that this fix is missing
+func (f *nmeaFix) merge(other *nmeaFix) {
+	if f.date.IsZero() {
+		f.date = other.date
+	}
+	if f.altitude == nil {
+		f.altitude = other.altitude
+	}
+	if f.speed == nil {
+		f.speed = other.speed
+	}
+	if f.heading == nil {
+		f.heading = other.heading
+	}
+}
+
+// timestamp returns the time of the fix, a GGA fix without a date is placed on the UTC day that puts
+// it closest to now so fixes sent just before midnight keep their day
+func (f *nmeaFix) timestamp(now time.Time) time.Time {
+	if !f.date.IsZero() {
+		return f.date.Add(f.timeOfDay)
+	}
+	now = now.UTC()
+	t := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(f.timeOfDay)
+	switch {
+	case t.Sub(now) > 12*time.Hour:
+		t = t.AddDate(0, 0, -1)
+	case now.Sub(t) > 12*time.Hour:
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// formatNMEACoordinate writes degrees and decimal minutes with the hemisphere as two fields
+func formatNMEACoordinate(coordinate float64, isLatitude bool) (string, string) {
+	hemisphere, width := "N", 2
+	if coordinate < 0 {
+		hemisphere = "S"
+	}
+	if !isLatitude {
+		hemisphere, width = "E", 3
+		if coordinate < 0 {
+			hemisphere = "W"
+		}
+	}
+	coordinate = math.Abs(coordinate)
+	degrees := math.Floor(coordinate)
+	minutes := math.Round((coordinate-degrees)*60*1e5) / 1e5
+	if minutes >= 60 {
+		degrees, minutes = degrees+1, 0
+	}
+	return fmt.Sprintf("%0*d%08.5f", width, int(degrees), minutes), hemisphere
+}
+
+// formatNMEAGGA writes a GGA sentence of a GPS fix seen by 8 satellites
+func formatNMEAGGA(t time.Time, lat, lng, altitude float64) string {
+	latitude, ns := formatNMEACoordinate(lat, true)
+	longitude, ew := formatNMEACoordinate(lng, false)
+	return formatNMEASentence("GPGGA", t.UTC().Format("150405.00"), latitude, ns, longitude, ew,
+		"1", "08", "0.9", strconv.FormatFloat(altitude, 'f', 1, 64), "M", "0.0", "M", "", "")
+}
+
+// formatNMEARMC writes an RMC sentence with the speed in meters per second converted to knots
+func formatNMEARMC(t time.Time, lat, lng, speed, heading float64) string {
+	latitude, ns := formatNMEACoordinate(lat, true)
+	longitude, ew := formatNMEACoordinate(lng, false)
+	return formatNMEASentence("GPRMC", t.UTC().Format("150405.00"), "A", latitude, ns, longitude, ew,
+		strconv.FormatFloat(speed/knotsToMetersPerSecond, 'f', 2, 64), strconv.FormatFloat(heading, 'f', 1, 64),
+		t.UTC().Format("020106"), "", "", "A")
+}
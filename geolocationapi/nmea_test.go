@@ -0,0 +1,196 @@
+package geolocationapi
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseNMEASentence(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		address string
+		fields  int
+		wantErr bool
+	}{
+		{"gga", "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47", "GPGGA", 14, false},
+		{"rmc with line ending", "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A\r\n", "GPRMC", 11, false},
+		{"proprietary", "$PDEVID,tracker-1*42", "PDEVID", 1, false},
+		{"checksum mismatch", "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*48", "", 0, true},
+		{"missing checksum", "$GPGGA,123519,4807.038,N", "", 0, true},
+		{"missing dollar", "GPGGA,123519*47", "", 0, true},
+		{"invalid checksum digits", "$GPGGA,123519*ZZ", "", 0, true},
+		{"no address", "$,1*1D", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseNMEASentence(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNMEASentence(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			}
+			if !tt.wantErr && (s.address != tt.address || len(s.fields) != tt.fields) {
+				t.Errorf("parseNMEASentence(%q) = %s with %d fields, want %s with %d", tt.line, s.address, len(s.fields), tt.address, tt.fields)
+			}
+		})
+	}
+}
+
+func TestParseNMEACoordinate(t *testing.T) {
+	tests := []struct {
+		value, hemisphere string
+		isLatitude        bool
+		want              float64
+		wantErr           bool
+	}{
+		{"4807.038", "N", true, 48.1173, false},
+		{"4807.038", "S", true, -48.1173, false},
+		{"01131.000", "E", false, 11.516666666666667, false},
+		{"12000.000", "W", false, -120, false},
+		{"0000.0000", "N", true, 0, false},
+		{"9000.000", "N", true, 90, false},
+		{"9100.000", "N", true, 0, true},
+		{"18100.000", "E", false, 0, true},
+		{"4860.000", "N", true, 0, true},
+		{"480.7038", "N", true, 0, true},
+		{"4807.038", "E", true, 0, true},
+		{"", "N", true, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseNMEACoordinate(tt.value, tt.hemisphere, tt.isLatitude)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseNMEACoordinate(%q, %q) error = %v, wantErr %v", tt.value, tt.hemisphere, err, tt.wantErr)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("parseNMEACoordinate(%q, %q) = %v, want %v", tt.value, tt.hemisphere, got, tt.want)
+		}
+	}
+}
+
+func TestParseNMEATime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"123519", 12*time.Hour + 35*time.Minute + 19*time.Second, false},
+		{"000000.25", 250 * time.Millisecond, false},
+		{"235959.999", 23*time.Hour + 59*time.Minute + 59999*time.Millisecond, false},
+		{"240000", 0, true},
+		{"126000", 0, true},
+		{"1235", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseNMEATime(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseNMEATime(%q) = %v, %v, want %v, wantErr %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// errNMEAInvalid stands for the error of a sentence with a malformed field in test cases
+var errNMEAInvalid = errors.New("invalid field")
+
+func TestParseNMEAFix(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		lat, lng float64
+		altitude bool
+		speed    bool
+		date     bool
+		err      error
+	}{
+		{"gga", "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47", 48.1173, 11.516666666666667, true, false, false, nil},
+		{"rmc", "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A", 48.1173, 11.516666666666667, false, true, true, nil},
+		{"gga without fix", formatNMEASentence("GNGGA", "123519", "", "", "", "", "0", "00", "", "", "M", "", "M", "", ""), 0, 0, false, false, false, errNMEANoFix},
+		{"rmc void", formatNMEASentence("GPRMC", "123519", "V", "4807.038", "N", "01131.000", "E", "", "", "230394", "", ""), 0, 0, false, false, false, errNMEANoFix},
+		{"rmc not valid mode", formatNMEASentence("GPRMC", "123519", "A", "4807.038", "N", "01131.000", "E", "", "", "230394", "", "", "N"), 0, 0, false, false, false, errNMEANoFix},
+		{"unsupported", formatNMEASentence("GPGSV", "3", "1", "11"), 0, 0, false, false, false, errNMEAUnsupported},
+		{"nan altitude", formatNMEASentence("GPGGA", "123519", "4807.038", "N", "01131.000", "E", "1", "08", "0.9", "NaN", "M", "", "M", "", ""), 0, 0, false, false, false, errNMEAInvalid},
+		{"nan speed", formatNMEASentence("GPRMC", "123519", "A", "4807.038", "N", "01131.000", "E", "NaN", "", "230394", "", ""), 0, 0, false, false, false, errNMEAInvalid},
+		{"nan course", formatNMEASentence("GPRMC", "123519", "A", "4807.038", "N", "01131.000", "E", "", "NaN", "230394", "", ""), 0, 0, false, false, false, errNMEAInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseNMEASentence(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fix, err := parseNMEAFix(s)
+			if tt.err == errNMEAInvalid {
+				if err == nil || errors.Is(err, errNMEANoFix) || errors.Is(err, errNMEAUnsupported) {
+					t.Fatalf("parseNMEAFix error = %v, want an invalid field", err)
+				}
+				return
+			}
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("parseNMEAFix error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(fix.latitude-tt.lat) > 1e-9 || math.Abs(fix.longitude-tt.lng) > 1e-9 {
+				t.Errorf("position = %v,%v, want %v,%v", fix.latitude, fix.longitude, tt.lat, tt.lng)
+			}
+			if (fix.altitude != nil) != tt.altitude || (fix.speed != nil) != tt.speed || fix.date.IsZero() == tt.date {
+				t.Errorf("altitude %v, speed %v, date %v do not match the sentence", fix.altitude, fix.speed, fix.date)
+			}
+		})
+	}
+}
+
+func TestFormatNMEARoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 9, 23, 59, 58, 0, time.UTC)
+	positions := [][2]float64{{52.520008, 13.404954}, {-33.86882, 151.209296}, {40.712776, -74.005974}, {-0.000001, -179.999999}}
+	for _, p := range positions {
+		gga, err := parseNMEASentence(formatNMEAGGA(at, p[0], p[1], 34.5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rmc, err := parseNMEASentence(formatNMEARMC(at, p[0], p[1], 12.5, 270))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fix, err := parseNMEAFix(gga)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := parseNMEAFix(rmc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fix.merge(other)
+
+		// Five decimals of minutes keep the position within a few centimeters
+		if d := haversineMeters(p[0], p[1], fix.latitude, fix.longitude); d > 0.05 {
+			t.Errorf("position %v moved %v m through NMEA", p, d)
+		}
+		if !fix.timestamp(at).Equal(at) || *fix.altitude != 34.5 || math.Abs(*fix.speed-12.5) > 0.01 || *fix.heading != 270 {
+			t.Errorf("fix of %v = %v, %v m, %v m/s, %v°", p, fix.timestamp(at), *fix.altitude, *fix.speed, *fix.heading)
+		}
+	}
+}
+
+func TestNMEAFixTimestampWithoutDate(t *testing.T) {
+	now := time.Date(2024, 3, 10, 0, 0, 5, 0, time.UTC)
+	tests := []struct {
+		timeOfDay time.Duration
+		want      time.Time
+	}{
+		{5 * time.Second, time.Date(2024, 3, 10, 0, 0, 5, 0, time.UTC)},
+		{23*time.Hour + 59*time.Minute + 58*time.Second, time.Date(2024, 3, 9, 23, 59, 58, 0, time.UTC)},
+		{11 * time.Hour, time.Date(2024, 3, 10, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		f := &nmeaFix{timeOfDay: tt.timeOfDay}
+		if got := f.timestamp(now); !got.Equal(tt.want) {
+			t.Errorf("timestamp of %v at %v = %v, want %v", tt.timeOfDay, now, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package geolocationapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"temprest/config"
+	"temprest/logging"
+)
+
+// NMEA listener defaults used when the NMEA config section is missing
+const (
+	defaultNMEAPort        = "10110"
+	defaultNMEAReadTimeout = 2 * time.Minute
+	defaultNMEAMinInterval = time.Second
+)
+
+// maxNMEALineLength rejects connections sending lines far beyond the 82 characters NMEA allows a sentence
+const maxNMEALineLength = 256
+
+// Records an NMEA device may be mapped to
+const (
+	NMEATargetLocation = "location"
+	NMEATargetMember   = "member"
+)
+
+// nmeaTarget is the record the fixes of a device update, a Location whose position follows the device
+// or a membership whose track the fixes are added to
+type nmeaTarget struct {
+	kind string
+	id   string
+	// secret the device must send in its $PDEVID sentence, and from the source addresses it may
+	// connect from, a device named by its IP address is bound to that address
+	secret string
+	from   []netip.Prefix
+}
+
+// allows reports whether a connection from addr that sent secret may update the target
+func (t nmeaTarget) allows(addr netip.Addr, secret string) bool {
+	if t.secret != "" && subtle.ConstantTimeCompare([]byte(t.secret), []byte(secret)) != 1 {
+		return false
+	}
+	if len(t.from) == 0 {
+		return true
+	}
+	for _, prefix := range t.from {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// nmeaTargets parses NMEA.Devices, whose entries read <device id>=location:<location id> or
+// <device id>=member:<membership id> followed by ;secret=<secret> and ;from=<address or CIDR>
+// options. A device is named by its $PDEVID,<device id>,<secret> sentence or else its IP address.
+// $PDEVID is sent in the clear and anyone reaching the port can send it, so devices named by it
+// need a secret or the addresses they connect from.
+func nmeaTargets() (map[string]nmeaTarget, error) {
+	return parseNMEATargets(config.GetStringSlice("NMEA.Devices"))
+}
+
+// parseNMEATargets parses the entries of NMEA.Devices by device id
+func parseNMEATargets(entries []string) (map[string]nmeaTarget, error) {
+	targets := map[string]nmeaTarget{}
+	for _, entry := range entries {
+		mapping, options, _ := strings.Cut(entry, ";")
+		device, target, ok := strings.Cut(mapping, "=")
+		kind, id, ok2 := strings.Cut(target, ":")
+		device, kind, id = strings.TrimSpace(device), strings.TrimSpace(kind), strings.TrimSpace(id)
+		if !ok || !ok2 || device == "" || id == "" || (kind != NMEATargetLocation && kind != NMEATargetMember) {
+			return nil, fmt.Errorf("invalid NMEA device %q, use <device id>=location:<id> or <device id>=member:<id>", entry)
+		}
+		if _, ok := targets[device]; ok {
+			return nil, fmt.Errorf("NMEA device %q is mapped twice", device)
+		}
+
+		t := nmeaTarget{kind: kind, id: id}
+		for _, option := range strings.Split(options, ";") {
+			key, value, _ := strings.Cut(option, "=")
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			switch {
+			case key == "" && value == "":
+			case key == "secret" && value != "":
+				t.secret = value
+			case key == "from":
+				prefix, err := parseNMEASource(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid from address of NMEA device %q: %v", device, err)
+				}
+				t.from = append(t.from, prefix)
+			default:
+				return nil, fmt.Errorf("invalid option %q of NMEA device %q, use secret=<secret> or from=<address or CIDR>", option, device)
+			}
+		}
+		if addr, err := netip.ParseAddr(device); err == nil {
+			t.from = append(t.from, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else if t.secret == "" && len(t.from) == 0 {
+			return nil, fmt.Errorf("NMEA device %q is named by $PDEVID and needs a secret or a from address", device)
+		}
+		targets[device] = t
+	}
+	return targets, nil
+}
+
+// parseNMEASource reads a single address or a CIDR block
+func parseNMEASource(value string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+// NMEAPort returns the configured TCP port of the NMEA listener
+func NMEAPort() string {
+	if port := config.GetString("NMEA.Port"); port != "" {
+		return port
+	}
+	return defaultNMEAPort
+}
+
+// ListenNMEA accepts NMEA 0183 streams of GPS devices on the configured port until ctx is done, and
+// applies their GGA and RMC fixes to the mapped locations and members, it returns nil at once when
+// NMEA.Enabled is off. NMEA has no transport security: the port must only be reachable from the
+// network of the devices, never exposed to the internet.
+func ListenNMEA(ctx context.Context) error {
+	if !config.GetBool("NMEA.Enabled") {
+		return nil
+	}
+	targets, err := nmeaTargets()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", ":"+NMEAPort())
+	if err != nil {
+		return err
+	}
+	logging.DoLoggingLevelBasedLogs(logging.Info, fmt.Sprintf("starting NMEA listener at port: %s with %d devices", NMEAPort(), len(targets)), nil)
+	return serveNMEA(ctx, listener, targets, applyNMEAFix)
+}
+
+// serveNMEA handles every connection of a listener in its own goroutine until ctx is done
+func serveNMEA(ctx context.Context, listener net.Listener, targets map[string]nmeaTarget, apply func(context.Context, nmeaTarget, *nmeaFix) error) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	readTimeout := config.GetDuration("NMEA.ReadTimeout")
+	if readTimeout <= 0 {
+		readTimeout = defaultNMEAReadTimeout
+	}
+	minInterval := config.GetDuration("NMEA.MinInterval")
+	if minInterval <= 0 {
+		minInterval = defaultNMEAMinInterval
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		session := &nmeaSession{
+			conn:        conn,
+			targets:     targets,
+			apply:       apply,
+			readTimeout: readTimeout,
+			minInterval: minInterval,
+		}
+		if addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String()); err == nil {
+			session.addr = addrPort.Addr().Unmap()
+			session.device = session.addr.String()
+		}
+		go session.serve(ctx)
+	}
+}
+
+// nmeaSession reads the sentences of one connection, merging the GGA and RMC sentences of an epoch
+// into one fix before it is applied
+type nmeaSession struct {
+	conn        net.Conn
+	targets     map[string]nmeaTarget
+	apply       func(context.Context, nmeaTarget, *nmeaFix) error
+	readTimeout time.Duration
+	minInterval time.Duration
+
+	// addr is the source address of the connection, device names the sender, its IP address until
+	// it sends $PDEVID, and secret is the secret of that sentence
+	addr   netip.Addr
+	device string
+	secret string
+	// pending is the fix of the current epoch and pendingKinds the sentence types merged into it
+	pending      *nmeaFix
+	pendingKinds map[string]bool
+	// lastApplied is the time of the last fix applied, fixes are dropped until minInterval has passed
+	lastApplied time.Time
+	warned      bool
+}
+
+// serve reads sentences until the connection is closed, idles for longer than the read timeout or
+// sends a line that is too long
+func (s *nmeaSession) serve(ctx context.Context) {
+	defer s.conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.conn.Close()
+		case <-done:
+		}
+	}()
+
+	scanner := bufio.NewScanner(s.conn)
+	scanner.Buffer(make([]byte, 0, 128), maxNMEALineLength)
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(s.readTimeout))
+		if !scanner.Scan() {
+			break
+		}
+		s.handle(ctx, scanner.Text())
+	}
+	s.flush(ctx)
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		logging.DoLoggingLevelBasedLogs(logging.Debug, fmt.Sprintf("NMEA connection from %s closed: %v", s.conn.RemoteAddr(), err), nil)
+	}
+}
+
+// handle reads one line, sentences that fail their checksum or carry no position are skipped
+func (s *nmeaSession) handle(ctx context.Context, line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	sentence, err := parseNMEASentence(line)
+	if err != nil {
+		logging.DoLoggingLevelBasedLogs(logging.Debug, fmt.Sprintf("skipping NMEA line from %s: %v", s.conn.RemoteAddr(), err), nil)
+		return
+	}
+
+	// A device naming itself starts a new stream of fixes, a mapped device must prove its identity
+	if sentence.kind() == nmeaDeviceSentence {
+		if len(sentence.fields) == 0 || strings.TrimSpace(sentence.fields[0]) == "" {
+			return
+		}
+		s.flush(ctx)
+		s.device, s.secret = strings.TrimSpace(sentence.fields[0]), ""
+		if len(sentence.fields) > 1 {
+			s.secret = strings.TrimSpace(sentence.fields[1])
+		}
+		s.lastApplied, s.warned = time.Time{}, false
+		if target, ok := s.targets[s.device]; ok && !target.allows(s.addr, s.secret) {
+			logging.DoLoggingLevelBasedLogs(logging.Warn, fmt.Sprintf("closing NMEA connection from %s claiming device %q without its secret or source address", s.addr, s.device), nil)
+			s.conn.Close()
+		}
+		return
+	}
+
+	fix, err := parseNMEAFix(sentence)
+	if err != nil {
+		if !errors.Is(err, errNMEAUnsupported) && !errors.Is(err, errNMEANoFix) {
+			logging.DoLoggingLevelBasedLogs(logging.Debug, fmt.Sprintf("skipping NMEA %s from %s: %v", sentence.address, s.device, err), nil)
+		}
+		return
+	}
+
+	// Sentences of the same epoch share their time, a new time starts the next fix
+	if s.pending != nil && s.pending.timeOfDay == fix.timeOfDay && !s.pendingKinds[sentence.kind()] {
+		s.pending.merge(fix)
+	} else {
+		s.flush(ctx)
+		s.pending, s.pendingKinds = fix, map[string]bool{}
+	}
+	s.pendingKinds[sentence.kind()] = true
+
+	// Once both sentence types are in there is nothing left to wait for
+	if s.pendingKinds["GGA"] && s.pendingKinds["RMC"] {
+		s.flush(ctx)
+	}
+}
+
+// flush applies the pending fix to the record the device is mapped to
+func (s *nmeaSession) flush(ctx context.Context) {
+	fix := s.pending
+	s.pending, s.pendingKinds = nil, nil
+	if fix == nil {
+		return
+	}
+
+	target, ok := s.targets[s.device]
+	if !ok {
+		if !s.warned {
+			logging.DoLoggingLevelBasedLogs(logging.Warn, fmt.Sprintf("ignoring NMEA fixes of unmapped device %q", s.device), nil)
+			s.warned = true
+		}
+		return
+	}
+	if !target.allows(s.addr, s.secret) {
+		if !s.warned {
+			logging.DoLoggingLevelBasedLogs(logging.Warn, fmt.Sprintf("ignoring NMEA fixes of device %q from %s without its secret", s.device, s.addr), nil)
+			s.warned = true
+		}
+		return
+	}
+	timestamp := fix.timestamp(time.Now())
+	if !s.lastApplied.IsZero() && timestamp.Sub(s.lastApplied) < s.minInterval {
+		return
+	}
+
+	applyCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := s.apply(applyCtx, target, fix); err != nil {
+		logging.DoLoggingLevelBasedLogs(logging.Warn, fmt.Sprintf("could not apply NMEA fix of device %q to %s %s: %v", s.device, target.kind, target.id, err), nil)
+		return
+	}
+	s.lastApplied = timestamp
+}
+
+// applyNMEAFix moves a mapped location to the fix, or stores the fix as a tracked position of a member
+func applyNMEAFix(ctx context.Context, target nmeaTarget, fix *nmeaFix) error {
+	if client == nil {
+		return errors.New("MongoDB client is not initialized")
+	}
+	if target.kind == NMEATargetMember {
+		position := TrackedPosition{
+			MemberID:  target.id,
+			Latitude:  fix.latitude,
+			Longitude: fix.longitude,
+			Altitude:  fix.altitude,
+			Speed:     fix.speed,
+			Heading:   fix.heading,
+			Timestamp: fix.timestamp(time.Now()),
+		}
+		if err := position.validate(); err != nil {
+			return err
+		}
+		_, err := insertPositions(ctx, []TrackedPosition{position})
+		return err
+	}
+
+	collection := client.Database("geolocapi").Collection("locations")
+	var l Location
+	if err := collection.FindOne(ctx, bson.M{"id": target.id}).Decode(&l); err != nil {
+		return err
+	}
+	l.Latitude, l.Longitude = fix.latitude, fix.longitude
+	// The receiver altitude replaces the old elevation, the elevation tiles fill it when there is none
+	l.Elevation = fix.altitude
+	if validateLocationElevation(&l) != nil {
+		l.Elevation = nil
+	}
+	setLocationDerivedFields(&l)
+	if _, err := collection.ReplaceOne(ctx, bson.M{"id": target.id}, l); err != nil {
+		return err
+	}
+
+	// Keep caches and the spatial index in step with this change
+	onLocationSaved(l)
+	return nil
+}
@@ -0,0 +1,113 @@
+package geolocationapi
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParseNMEATargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		wantErr bool
+	}{
+		{"named by address", []string{"192.0.2.10=location:l1"}, false},
+		{"named by $PDEVID with a secret", []string{"tracker-1=member:m1;secret=s3cret"}, false},
+		{"named by $PDEVID with a source network", []string{"tracker-1 = member:m1 ; from=10.0.0.0/8; from=2001:db8::1"}, false},
+		{"named by $PDEVID without a secret", []string{"tracker-1=member:m1"}, true},
+		{"empty secret", []string{"tracker-1=member:m1;secret="}, true},
+		{"invalid source", []string{"tracker-1=member:m1;from=somewhere"}, true},
+		{"unknown option", []string{"tracker-1=member:m1;key=value"}, true},
+		{"unknown target", []string{"192.0.2.10=vehicle:v1"}, true},
+		{"mapped twice", []string{"192.0.2.10=location:l1", "192.0.2.10=member:m1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseNMEATargets(tt.entries); (err != nil) != tt.wantErr {
+				t.Errorf("parseNMEATargets(%q) error = %v, wantErr %v", tt.entries, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNMEATargetAllows(t *testing.T) {
+	targets, err := parseNMEATargets([]string{
+		"192.0.2.10=location:l1",
+		"tracker-1=member:m1;secret=s3cret",
+		"tracker-2=member:m2;from=10.0.0.0/8",
+		"tracker-3=member:m3;secret=s3cret;from=10.1.2.3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		device, addr, secret string
+		want                 bool
+	}{
+		{"192.0.2.10", "192.0.2.10", "", true},
+		{"192.0.2.10", "::ffff:192.0.2.10", "", true},
+		{"192.0.2.10", "192.0.2.11", "", false},
+		{"tracker-1", "203.0.113.5", "s3cret", true},
+		{"tracker-1", "203.0.113.5", "guess", false},
+		{"tracker-1", "203.0.113.5", "", false},
+		{"tracker-2", "10.20.30.40", "", true},
+		{"tracker-2", "11.20.30.40", "", false},
+		{"tracker-3", "10.1.2.3", "s3cret", true},
+		{"tracker-3", "10.1.2.4", "s3cret", false},
+		{"tracker-3", "10.1.2.3", "", false},
+	}
+	for _, tt := range tests {
+		if got := targets[tt.device].allows(netip.MustParseAddr(tt.addr), tt.secret); got != tt.want {
+			t.Errorf("%s from %s with secret %q allowed = %v, want %v", tt.device, tt.addr, tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestNMEASessionRequiresDeviceSecret(t *testing.T) {
+	targets, err := parseNMEATargets([]string{"tracker-1=member:m1;secret=s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().UTC().Truncate(time.Second)
+	fix := formatNMEAGGA(at, 52.52, 13.40, 34) + formatNMEARMC(at, 52.52, 13.40, 0, 0)
+
+	tests := []struct {
+		name    string
+		devID   string
+		applied int
+	}{
+		{"with the secret", formatNMEASentence(nmeaDeviceSentence, "tracker-1", "s3cret"), 1},
+		{"with a wrong secret", formatNMEASentence(nmeaDeviceSentence, "tracker-1", "guess"), 0},
+		{"without a secret", formatNMEASentence(nmeaDeviceSentence, "tracker-1"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, device := net.Pipe()
+			applied := 0
+			session := &nmeaSession{
+				conn:        server,
+				targets:     targets,
+				apply:       func(context.Context, nmeaTarget, *nmeaFix) error { applied++; return nil },
+				readTimeout: time.Second,
+				minInterval: time.Second,
+			}
+			done := make(chan struct{})
+			go func() {
+				session.serve(context.Background())
+				close(done)
+			}()
+
+			// The session closes the connection of a device claiming an id it cannot prove
+			device.Write([]byte(tt.devID))
+			device.Write([]byte(fix))
+			device.Close()
+			<-done
+			if applied != tt.applied {
+				t.Errorf("applied %d fixes, want %d", applied, tt.applied)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package geolocationapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// NMEASimulation describes a simulated GPS device driving at a constant speed and heading
+type NMEASimulation struct {
+	// DeviceID is sent in a $PDEVID sentence first with the Secret of the device, the listener falls
+	// back to the IP address without it
+	DeviceID  string
+	Secret    string
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	// Speed in meters per second and Heading in degrees clockwise from north
+	Speed   float64
+	Heading float64
+	// Interval between fixes, and Count the number of fixes to send, 0 sends until ctx is done
+	Interval time.Duration
+	Count    int
+}
+
+// validate checks a simulation before any sentence is written
+func (sim *NMEASimulation) validate() error {
+	if err := validateCoordinate(sim.Latitude, true); err != nil {
+		return err
+	}
+	if err := validateCoordinate(sim.Longitude, false); err != nil {
+		return err
+	}
+	if sim.Speed < 0 {
+		return errors.New("speed must not be negative")
+	}
+	if sim.Interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	if sim.Count < 0 {
+		return errors.New("count must not be negative")
+	}
+	return nil
+}
+
+// SimulateNMEA writes the sentences of a simulated device to w, a GGA and an RMC sentence per fix
+// every interval, as field hardware sends them to the NMEA listener
+func SimulateNMEA(ctx context.Context, w io.Writer, sim NMEASimulation) error {
+	if err := sim.validate(); err != nil {
+		return err
+	}
+	if sim.DeviceID != "" {
+		fields := []string{nmeaDeviceSentence, sim.DeviceID}
+		if sim.Secret != "" {
+			fields = append(fields, sim.Secret)
+		}
+		if _, err := io.WriteString(w, formatNMEASentence(fields...)); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(sim.Interval)
+	defer ticker.Stop()
+	lat, lng, heading := sim.Latitude, sim.Longitude, math.Mod(math.Mod(sim.Heading, 360)+360, 360)
+	for sent := 1; ; sent++ {
+		now := time.Now().UTC()
+		if _, err := io.WriteString(w, formatNMEAGGA(now, lat, lng, sim.Altitude)+formatNMEARMC(now, lat, lng, sim.Speed, heading)); err != nil {
+			return err
+		}
+		if sent == sim.Count {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// Drive on at the same heading
+		lat, lng = destinationPoint(lat, lng, heading, sim.Speed*sim.Interval.Seconds())
+		lng = normalizeLongitude(lng)
+	}
+}
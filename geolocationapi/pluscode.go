@@ -0,0 +1,152 @@
+package geolocationapi
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// Open Location Code (Plus Code) constants
+const (
+	plusCodeAlphabet   = "23456789CFGHJMPQRVWX"
+	plusCodeSeparator  = '+'
+	plusCodePadding    = '0'
+	plusCodePairLength = 10
+	plusCodeGridRows   = 5
+	plusCodeGridCols   = 4
+	plusCodeMaxLength  = 15
+)
+
+// plusCodePairResolutions holds the size in degrees of each digit pair
+var plusCodePairResolutions = []float64{20.0, 1.0, .05, .0025, .000125}
+
+// encodePlusCode encodes a latitude/longitude pair into a full plus code of the given length
+func encodePlusCode(lat, lng float64, codeLength int) string {
+	if codeLength < plusCodePairLength {
+		codeLength = plusCodePairLength
+	}
+	if codeLength > plusCodeMaxLength {
+		codeLength = plusCodeMaxLength
+	}
+
+	// Clip latitude and normalise longitude
+	lat = math.Min(math.Max(lat, -90), 90)
+	for lng < -180 {
+		lng += 360
+	}
+	for lng >= 180 {
+		lng -= 360
+	}
+
+	// Latitude 90 has to be moved just inside the last cell
+	if lat == 90 {
+		lat -= plusCodeResolution(codeLength) / 2
+	}
+
+	// Work with integer units to avoid floating point drift
+	const finalLatPrecision = 8000 * 3125 // 1 / (0.000125 / 5^5)
+	const finalLngPrecision = 8000 * 1024 // 1 / (0.000125 / 4^5)
+	latVal := int64(math.Floor((lat + 90) * finalLatPrecision))
+	lngVal := int64(math.Floor((lng + 180) * finalLngPrecision))
+
+	code := make([]byte, 0, plusCodeMaxLength+1)
+	digits := make([]byte, plusCodeMaxLength)
+
+	// Grid digits, refining the last pair cell
+	for i := plusCodeMaxLength - 1; i >= plusCodePairLength; i-- {
+		latDigit := latVal % plusCodeGridRows
+		lngDigit := lngVal % plusCodeGridCols
+		digits[i] = plusCodeAlphabet[latDigit*plusCodeGridCols+lngDigit]
+		latVal /= plusCodeGridRows
+		lngVal /= plusCodeGridCols
+	}
+
+	// Pair digits, alternating latitude and longitude
+	for i := plusCodePairLength/2 - 1; i >= 0; i-- {
+		digits[i*2+1] = plusCodeAlphabet[lngVal%20]
+		digits[i*2] = plusCodeAlphabet[latVal%20]
+		latVal /= 20
+		lngVal /= 20
+	}
+
+	code = append(code, digits[:8]...)
+	code = append(code, plusCodeSeparator)
+	code = append(code, digits[8:codeLength]...)
+	return string(code)
+}
+
+// plusCodeResolution returns the latitude size in degrees of a code of the given length
+func plusCodeResolution(codeLength int) float64 {
+	if codeLength <= plusCodePairLength {
+		return plusCodePairResolutions[codeLength/2-1]
+	}
+	return plusCodePairResolutions[len(plusCodePairResolutions)-1] / math.Pow(plusCodeGridRows, float64(codeLength-plusCodePairLength))
+}
+
+// decodePlusCode decodes a full plus code and returns the centre of its area
+func decodePlusCode(code string) (lat, lng float64, err error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	sep := strings.IndexRune(code, plusCodeSeparator)
+	if sep < 0 || sep != strings.LastIndexByte(code, plusCodeSeparator) {
+		return 0, 0, errors.New("plus code must contain exactly one '+' separator")
+	}
+	if sep < 8 {
+		return 0, 0, errors.New("short plus codes need a reference location and are not supported")
+	}
+	if sep > 8 {
+		return 0, 0, errors.New("invalid plus code: separator is in the wrong position")
+	}
+
+	// Remove separator and padding
+	digits := strings.TrimRight(strings.Replace(code, string(plusCodeSeparator), "", 1), string(plusCodePadding))
+	if len(digits) < 2 || len(digits)%2 == 1 && len(digits) < plusCodePairLength {
+		return 0, 0, errors.New("invalid plus code length")
+	}
+	if len(digits) > plusCodeMaxLength {
+		digits = digits[:plusCodeMaxLength]
+	}
+
+	lat, lng = -90.0, -180.0
+	latRes, lngRes := 0.0, 0.0
+	for i := 0; i < len(digits); i++ {
+		idx := strings.IndexByte(plusCodeAlphabet, digits[i])
+		if idx < 0 {
+			return 0, 0, errors.New("invalid plus code character: " + string(digits[i]))
+		}
+		if i < plusCodePairLength {
+			res := plusCodePairResolutions[i/2]
+			if i%2 == 0 {
+				latRes = res
+				lat += float64(idx) * res
+			} else {
+				lngRes = res
+				lng += float64(idx) * res
+			}
+			continue
+		}
+		latRes /= plusCodeGridRows
+		lngRes /= plusCodeGridCols
+		lat += float64(idx/plusCodeGridCols) * latRes
+		lng += float64(idx%plusCodeGridCols) * lngRes
+	}
+
+	if lat+latRes > 90.0+1e-9 || lng+lngRes > 180.0+1e-9 {
+		return 0, 0, errors.New("plus code is outside the valid range")
+	}
+	return lat + latRes/2, lng + lngRes/2, nil
+}
+
+// isPlusCode reports whether s looks like a plus code
+func isPlusCode(s string) bool {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if !strings.ContainsRune(s, plusCodeSeparator) {
+		return false
+	}
+	for _, c := range s {
+		if c != plusCodeSeparator && c != plusCodePadding && !strings.ContainsRune(plusCodeAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,474 @@
+package geolocationapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"temprest/config"
+	"temprest/logging"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Position defaults used when the Positions config section is missing
+const (
+	defaultPositionMaxBatchSize = 10000
+	defaultPositionMaxBodyBytes = 8 << 20
+	defaultTrackLimit           = 10000
+)
+
+// TrackedPosition is a reported position of a member at a point in time
+type TrackedPosition struct {
+	MemberID  string    `json:"memberId" bson:"memberid"`
+	Latitude  float64   `json:"latitude" bson:"latitude"`
+	Longitude float64   `json:"longitude" bson:"longitude"`
+	Altitude  *float64  `json:"altitude,omitempty" bson:"altitude,omitempty"`
+	Accuracy  *float64  `json:"accuracy,omitempty" bson:"accuracy,omitempty"`
+	Speed     *float64  `json:"speed,omitempty" bson:"speed,omitempty"`
+	Heading   *float64  `json:"heading,omitempty" bson:"heading,omitempty"`
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+}
+
+// PositionIngestResult reports how many positions of a batch were stored
+type PositionIngestResult struct {
+	Inserted int `json:"inserted"`
+}
+
+// positionsCollection returns the time series collection of tracked positions
+func positionsCollection() *mongo.Collection {
+	return client.Database("geolocapi").Collection("positions")
+}
+
+// latestPositionsCollection returns the collection holding the latest position of each member, it
+// is updated on every insert so reading the latest positions does not scan the time series
+func latestPositionsCollection() *mongo.Collection {
+	return client.Database("geolocapi").Collection("latestpositions")
+}
+
+// ensurePositionsCollection creates the positions time series collection when it does not exist,
+// and the unique member index of the latest positions
+func ensurePositionsCollection(ctx context.Context) error {
+	tsOptions := options.TimeSeries().SetTimeField("timestamp").SetMetaField("memberid").SetGranularity("seconds")
+	err := client.Database("geolocapi").CreateCollection(ctx, "positions", options.CreateCollection().SetTimeSeriesOptions(tsOptions))
+	var commandErr mongo.CommandError
+	if err != nil && !(errors.As(err, &commandErr) && commandErr.Name == "NamespaceExists") {
+		return err
+	}
+	_, err = latestPositionsCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "memberid", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// backfillLatestPositions fills the latest positions from the time series once, for positions that
+// were stored before the latest positions were kept
+func backfillLatestPositions() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	count, err := latestPositionsCollection().EstimatedDocumentCount(ctx)
+	if err != nil || count > 0 {
+		return
+	}
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "memberid", Value: 1}, {Key: "timestamp", Value: -1}}}},
+		bson.D{{Key: "$group", Value: bson.M{"_id": "$memberid", "position": bson.M{"$first": "$$ROOT"}}}},
+		bson.D{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$position"}}},
+		bson.D{{Key: "$unset", Value: "_id"}},
+		// Positions inserted meanwhile are newer than the backfill
+		bson.D{{Key: "$merge", Value: bson.M{"into": "latestpositions", "on": "memberid", "whenMatched": "keepExisting", "whenNotMatched": "insert"}}},
+	}
+	cursor, err := positionsCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		logging.DoLoggingLevelBasedLogs(logging.Warn, "", logging.EnrichErrorWithStackTrace(errors.New("error backfilling latest positions: "+err.Error())))
+		return
+	}
+	cursor.Close(ctx)
+}
+
+// insertPositions stores positions in the time series and keeps the latest position of their
+// members, it returns the number of positions stored
+func insertPositions(ctx context.Context, positions []TrackedPosition) (int, error) {
+	documents := make([]interface{}, len(positions))
+	for i := range positions {
+		documents[i] = positions[i]
+	}
+	// Insert unordered so the server can parallelise the batch
+	result, err := positionsCollection().InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		return 0, err
+	}
+
+	newest := map[string]TrackedPosition{}
+	for _, p := range positions {
+		if current, ok := newest[p.MemberID]; !ok || p.Timestamp.After(current.Timestamp) {
+			newest[p.MemberID] = p
+		}
+	}
+	models := make([]mongo.WriteModel, 0, len(newest))
+	for memberID, p := range newest {
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.M{"memberid": memberID}).SetUpdate(latestPositionUpdate(p)).SetUpsert(true))
+	}
+	if _, err := latestPositionsCollection().BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return len(result.InsertedIDs), fmt.Errorf("updating latest positions: %v", err)
+	}
+	return len(result.InsertedIDs), nil
+}
+
+// latestPositionUpdate is an update pipeline taking the fields of p only when the stored position
+// of the member is older, so batches arriving out of order keep the newest position
+func latestPositionUpdate(p TrackedPosition) mongo.Pipeline {
+	newer := bson.M{"$or": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$type": "$timestamp"}, "missing"}},
+		bson.M{"$lt": bson.A{"$timestamp", p.Timestamp}},
+	}}
+	field := func(name string, value interface{}) bson.E {
+		return bson.E{Key: name, Value: bson.M{"$cond": bson.A{newer, value, "$" + name}}}
+	}
+	// Optional fields missing from p are removed from the stored position
+	optional := func(name string, value *float64) bson.E {
+		if value == nil {
+			return field(name, "$$REMOVE")
+		}
+		return field(name, *value)
+	}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		field("latitude", p.Latitude),
+		field("longitude", p.Longitude),
+		optional("altitude", p.Altitude),
+		optional("accuracy", p.Accuracy),
+		optional("speed", p.Speed),
+		optional("heading", p.Heading),
+		field("timestamp", p.Timestamp),
+	}}}}
+}
+
+// validate checks a position before it is stored
+func (p *TrackedPosition) validate() error {
+	if p.MemberID == "" {
+		return errors.New("memberId is required")
+	}
+	if err := validateCoordinate(p.Latitude, true); err != nil {
+		return err
+	}
+	if err := validateCoordinate(p.Longitude, false); err != nil {
+		return err
+	}
+	if p.Timestamp.IsZero() {
+		return errors.New("timestamp is required")
+	}
+	if p.Accuracy != nil && *p.Accuracy < 0 {
+		return errors.New("accuracy must not be negative")
+	}
+	if p.Speed != nil && *p.Speed < 0 {
+		return errors.New("speed must not be negative")
+	}
+	if p.Heading != nil && (*p.Heading < 0 || *p.Heading >= 360) {
+		return errors.New("heading must be between 0 and 360")
+	}
+	return nil
+}
+
+// decodePositions reads a single position object or an array of positions
+func decodePositions(r *http.Request) ([]TrackedPosition, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var positions []TrackedPosition
+		err := json.Unmarshal(trimmed, &positions)
+		return positions, err
+	}
+	var position TrackedPosition
+	if err := json.Unmarshal(trimmed, &position); err != nil {
+		return nil, err
+	}
+	return []TrackedPosition{position}, nil
+}
+
+// limitRequestBody caps the request body at the size configured under key, or fallback bytes, and
+// returns the limit. Reads past it fail with an *http.MaxBytesError.
+func limitRequestBody(w http.ResponseWriter, r *http.Request, key string, fallback int64) int64 {
+	maxBytes := config.GetInt64(key)
+	if maxBytes <= 0 {
+		maxBytes = fallback
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	return maxBytes
+}
+
+// writeBodyTooLarge answers 413 and reports true when err comes from a body over the limit
+func writeBodyTooLarge(w http.ResponseWriter, err error, maxBytes int64) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	fmt.Fprintf(w, "Request body exceeds the limit of %d bytes", maxBytes)
+	return true
+}
+
+// CreatePositions godoc
+// @Summary Ingest tracked positions
+// @Description Stores one position or a batch of member positions in the positions time series collection
+// @Tags positions
+// @Accept json
+// @Produce json
+// @Param positions body []TrackedPosition true "Position or array of positions"
+// @Success 201 {object} PositionIngestResult "positions stored"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 413 {string} string "Request Entity Too Large"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/positions [post]
+func CreatePositions(w http.ResponseWriter, r *http.Request) {
+	// Limit the size of the request body before decoding it
+	maxBytes := limitRequestBody(w, r, "Positions.MaxBodyBytes", defaultPositionMaxBodyBytes)
+
+	// Decode the request body into positions
+	positions, err := decodePositions(r)
+	if writeBodyTooLarge(w, err, maxBytes) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error decoding request body: %v", err)
+		return
+	}
+
+	// Check the batch size
+	maxBatch := config.GetInt("Positions.MaxBatchSize")
+	if maxBatch <= 0 {
+		maxBatch = defaultPositionMaxBatchSize
+	}
+	if len(positions) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No positions in request body")
+		return
+	}
+	if len(positions) > maxBatch {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		fmt.Fprintf(w, "Batch of %d positions exceeds the limit of %d", len(positions), maxBatch)
+		return
+	}
+
+	// Validate every position before storing any of them
+	for i := range positions {
+		if err := positions[i].validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid position at index %d: %v", i, err)
+			return
+		}
+		positions[i].Timestamp = positions[i].Timestamp.UTC()
+	}
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Insert the batch and move the latest position of its members
+	inserted, err := insertPositions(ctx, positions)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error inserting positions: %v", err)
+		return
+	}
+
+	// Marshal the result to JSON
+	jsonData, err := json.Marshal(PositionIngestResult{Inserted: inserted})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header and status code
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	// Write JSON response
+	w.Write(jsonData)
+}
+
+// GetLatestPositions godoc
+// @Summary Get the latest position of members
+// @Description Returns the most recent position of each member, optionally limited to the given member IDs
+// @Tags positions
+// @Accept json
+// @Produce json
+// @Param memberId query []string false "Member IDs" collectionFormat(multi)
+// @Success 200 {object} []TrackedPosition
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/positions/latest [get]
+func GetLatestPositions(w http.ResponseWriter, r *http.Request) {
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get the latest positions
+	positions, err := latestPositions(ctx, r.URL.Query()["memberId"])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error retrieving latest positions: %v", err)
+		return
+	}
+
+	// Marshal positions to JSON
+	jsonData, err := json.Marshal(positions)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
+
+// latestPositions returns the most recent position of each member, or of the given members
+func latestPositions(ctx context.Context, memberIDs []string) ([]TrackedPosition, error) {
+	filter := bson.M{}
+	if len(memberIDs) > 0 {
+		filter["memberid"] = bson.M{"$in": memberIDs}
+	}
+	cursor, err := latestPositionsCollection().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "memberid", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	positions := []TrackedPosition{}
+	if err := cursor.All(ctx, &positions); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// GetMemberTrack godoc
+// @Summary Get the track of a member
+// @Description Returns the positions of a member between two times in chronological order
+// @Tags positions
+// @Accept json
+// @Produce json
+// @Param id path string true "Member ID"
+// @Param from query string false "Start time (RFC 3339), defaults to 24 hours ago"
+// @Param to query string false "End time (RFC 3339), defaults to now"
+// @Param limit query int false "Maximum number of positions"
+// @Success 200 {object} []TrackedPosition
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/membership/{id}/track [get]
+func GetMemberTrack(w http.ResponseWriter, r *http.Request) {
+	// Get the member ID from the URL
+	id := chi.URLParam(r, "id")
+
+	// Parse the time range
+	to := time.Now().UTC()
+	from := to.Add(-24 * time.Hour)
+	var err error
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid to: %v", err)
+			return
+		}
+		if r.URL.Query().Get("from") == "" {
+			from = to.Add(-24 * time.Hour)
+		}
+	}
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid from: %v", err)
+			return
+		}
+	}
+	if from.After(to) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "from must not be after to")
+		return
+	}
+
+	// Parse the limit
+	limit := config.GetInt64("Positions.MaxTrackLength")
+	if limit <= 0 {
+		limit = defaultTrackLimit
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		requested, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || requested < 1 || requested > limit {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid limit: must be between 1 and %d", limit)
+			return
+		}
+		limit = requested
+	}
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Find the positions of the member in the time range
+	filter := bson.M{"memberid": id, "timestamp": bson.M{"$gte": from, "$lte": to}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}).SetLimit(limit)
+	cursor, err := positionsCollection().Find(ctx, filter, findOptions)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error retrieving track: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	positions := []TrackedPosition{}
+	if err := cursor.All(ctx, &positions); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error decoding track: %v", err)
+		return
+	}
+
+	// Marshal positions to JSON
+	jsonData, err := json.Marshal(positions)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
@@ -0,0 +1,30 @@
+package geolocationapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreatePositionsRejectsLargeBodies(t *testing.T) {
+	position := `{"memberId":"m1","latitude":52.52,"longitude":13.40,"timestamp":"2024-03-09T12:00:00Z"},`
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"malformed", `[{"memberId":`, http.StatusBadRequest},
+		{"empty batch", `[]`, http.StatusBadRequest},
+		{"body over the byte limit", "[" + strings.Repeat(position, defaultPositionMaxBodyBytes/len(position)+1) + "]", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			CreatePositions(w, httptest.NewRequest(http.MethodPost, "/geolocationapi/positions", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
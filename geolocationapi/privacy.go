@@ -0,0 +1,226 @@
+package geolocationapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"temprest/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Privacy levels of a location, exact is the default
+const (
+	PrivacyExact        = "exact"
+	PrivacyNeighborhood = "neighborhood"
+	PrivacyCity         = "city"
+)
+
+// Ways of hiding the position of a location from callers without elevated rights
+const (
+	PrivacyMethodSnap   = "snap"
+	PrivacyMethodJitter = "jitter"
+)
+
+// Privacy defaults used when the Privacy config section is missing
+const (
+	defaultPrivacyNeighborhoodSize = 500
+	defaultPrivacyCitySize         = 5000
+	defaultPrivacyMethod           = PrivacyMethodSnap
+	// privacyKeyHeader carries the API key of a privileged caller
+	privacyKeyHeader = "X-API-Key"
+)
+
+// privilegedAudienceKey is the context key recording whether the caller may see exact positions
+type privilegedAudienceKey struct{}
+
+// WithPrivilegedAudience records in a context whether the caller may see exact positions,
+// command line tools run by operators use it to export exact positions
+func WithPrivilegedAudience(ctx context.Context, privileged bool) context.Context {
+	return context.WithValue(ctx, privilegedAudienceKey{}, privileged)
+}
+
+// isPrivileged reports whether a context belongs to a caller that may see exact positions,
+// callers are not privileged unless a context says otherwise
+func isPrivileged(ctx context.Context) bool {
+	privileged, _ := ctx.Value(privilegedAudienceKey{}).(bool)
+	return privileged
+}
+
+// PrivacyAudience marks requests carrying one of the Privacy.PrivilegedKeys in the X-API-Key header
+// as privileged, every other request only sees obfuscated positions of private locations
+func PrivacyAudience(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		privileged := false
+		if key := r.Header.Get(privacyKeyHeader); key != "" {
+			for _, allowed := range config.GetStringSlice("Privacy.PrivilegedKeys") {
+				if allowed != "" && subtle.ConstantTimeCompare([]byte(key), []byte(allowed)) == 1 {
+					privileged = true
+					break
+				}
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrivilegedAudience(r.Context(), privileged)))
+	})
+}
+
+// validatePrivacyLevel checks a privacy level is supported and lower-cases it, empty means exact
+func validatePrivacyLevel(l *Location) error {
+	l.Privacy = strings.ToLower(strings.TrimSpace(l.Privacy))
+	switch l.Privacy {
+	case "", PrivacyNeighborhood, PrivacyCity:
+		return nil
+	case PrivacyExact:
+		// Exact is the default and is not stored
+		l.Privacy = ""
+		return nil
+	}
+	return fmt.Errorf("privacy must be %s, %s or %s", PrivacyExact, PrivacyNeighborhood, PrivacyCity)
+}
+
+// privacyCellSize returns the size in meters positions of a privacy level are blurred to
+func privacyCellSize(level string) float64 {
+	if level == PrivacyCity {
+		return configFloat("Privacy.CitySize", defaultPrivacyCitySize)
+	}
+	return configFloat("Privacy.NeighborhoodSize", defaultPrivacyNeighborhoodSize)
+}
+
+// obfuscateLocation hides the exact position of a private location from callers without elevated
+// rights: the coordinates are snapped to a grid or jittered, the geohash is shortened to the blurred
+// area, the elevation is dropped as it narrows the position down within that area, and the street,
+// and at city level the postal code, are dropped from the address
+func obfuscateLocation(ctx context.Context, l *Location) {
+	if l.Privacy == "" || l.Privacy == PrivacyExact || isPrivileged(ctx) {
+		return
+	}
+	size := privacyCellSize(l.Privacy)
+	l.Latitude, l.Longitude = obfuscatePosition(l.ID, l.Privacy, size, l.Latitude, l.Longitude)
+	l.Geohash = encodeGeohash(l.Latitude, l.Longitude, privacyGeohashPrecision(size))
+	l.Elevation = nil
+
+	if l.Address != nil {
+		address := *l.Address
+		address.Street = ""
+		if l.Privacy == PrivacyCity {
+			address.PostalCode = ""
+		}
+		l.Address = &address
+	}
+}
+
+// obfuscateLocations applies obfuscateLocation to every location of a slice
+func obfuscateLocations(ctx context.Context, locations []Location) {
+	for i := range locations {
+		obfuscateLocation(ctx, &locations[i])
+	}
+}
+
+// obfuscateCommunity applies obfuscateLocation to the location a community embeds, it can be a copy
+// of a private location
+func obfuscateCommunity(ctx context.Context, c *Community) {
+	obfuscateLocation(ctx, &c.Location)
+}
+
+// privacyMaxOffset returns the furthest in meters obfuscation moves a position the audience of ctx sees
+func privacyMaxOffset(ctx context.Context) float64 {
+	if isPrivileged(ctx) {
+		return 0
+	}
+	return math.Max(privacyCellSize(PrivacyCity), privacyCellSize(PrivacyNeighborhood))
+}
+
+// privacySearchBBox widens a box by the furthest obfuscation moves a position, so a query on exact
+// positions finds every private location whose blurred position may fall inside the box
+func privacySearchBBox(ctx context.Context, box BoundingBox) BoundingBox {
+	if isPrivileged(ctx) {
+		return box
+	}
+	return padBBox(box, privacyMaxOffset(ctx))
+}
+
+// restrictPrivateLocationFilter stops callers without elevated rights from finding private locations
+// through the street, or at city level the postal code, that is hidden from them
+func restrictPrivateLocationFilter(ctx context.Context, filter bson.M) {
+	if isPrivileged(ctx) {
+		return
+	}
+	if _, ok := filter["address.street"]; ok {
+		filter["privacy"] = bson.M{"$exists": false}
+	} else if _, ok := filter["address.postalcode"]; ok {
+		filter["privacy"] = bson.M{"$ne": PrivacyCity}
+	}
+}
+
+// dropHiddenGeohashMatches removes the obfuscated locations a geohash prefix only matched through
+// their exact position, their shortened geohash must still start with the prefix
+func dropHiddenGeohashMatches(locations []Location, prefix string) []Location {
+	if prefix == "" {
+		return locations
+	}
+	visible := locations[:0]
+	for _, l := range locations {
+		if strings.HasPrefix(l.Geohash, prefix) {
+			visible = append(visible, l)
+		}
+	}
+	return visible
+}
+
+// obfuscatePosition blurs a position with the configured method. Both methods are deterministic,
+// so repeated requests cannot be averaged back to the exact position.
+func obfuscatePosition(id, level string, size, lat, lng float64) (float64, float64) {
+	method := config.GetString("Privacy.Method")
+	if method == "" {
+		method = defaultPrivacyMethod
+	}
+	if method == PrivacyMethodJitter {
+		return jitterPosition(id, level, size, lat, lng)
+	}
+	return snapPosition(size, lat, lng)
+}
+
+// snapPosition moves a position to the centre of its cell on a grid of size meters
+func snapPosition(size, lat, lng float64) (float64, float64) {
+	latStep := size / metersPerDegree
+	snappedLat := math.Max(-90, math.Min(90, (math.Floor(lat/latStep)+0.5)*latStep))
+
+	// Columns are measured at the snapped latitude so every position of a cell lands on the same centre
+	lngStep := math.Min(360, size/(metersPerDegree*math.Max(math.Cos(snappedLat*math.Pi/180), 1e-6)))
+	snappedLng := (math.Floor((lng+180)/lngStep)+0.5)*lngStep - 180
+	return snappedLat, normalizeLongitude(snappedLng)
+}
+
+// jitterPosition moves a position up to size meters in a direction and distance derived from the
+// location id, the level and Privacy.Salt
+func jitterPosition(id, level string, size, lat, lng float64) (float64, float64) {
+	sum := sha256.Sum256([]byte(config.GetString("Privacy.Salt") + "\x00" + id + "\x00" + level))
+	angle := float64(binary.BigEndian.Uint64(sum[0:8])) / math.MaxUint64 * 2 * math.Pi
+	// The square root spreads offsets evenly over the disk instead of bunching them near the centre
+	distance := math.Sqrt(float64(binary.BigEndian.Uint64(sum[8:16]))/math.MaxUint64) * size
+
+	jitteredLat := lat + distance*math.Cos(angle)/metersPerDegree
+	jitteredLat = math.Max(-90, math.Min(90, jitteredLat))
+	jitteredLng := lng + distance*math.Sin(angle)/(metersPerDegree*math.Max(math.Cos(lat*math.Pi/180), 1e-6))
+	return jitteredLat, normalizeLongitude(jitteredLng)
+}
+
+// metersPerDegree is the length of a degree of latitude
+const metersPerDegree = earthRadiusMeters * math.Pi / 180
+
+// privacyGeohashPrecision returns the longest geohash whose cells are at least size meters wide
+func privacyGeohashPrecision(size float64) int {
+	for precision := geohashMaxPrecision; precision > 1; precision-- {
+		// Odd bits of a geohash are longitude, so a cell spans 360° / 2^ceil(5p/2) at the equator
+		lngBits := (5*precision + 1) / 2
+		if 2*math.Pi*earthRadiusMeters/math.Pow(2, float64(lngBits)) >= size {
+			return precision
+		}
+	}
+	return 1
+}
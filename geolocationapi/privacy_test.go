@@ -0,0 +1,198 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestSnapPosition(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     float64
+		lat, lng float64
+	}{
+		{"neighborhood", 500, 52.520008, 13.404954},
+		{"city", 5000, -33.868820, 151.209296},
+		{"near the antimeridian", 5000, 64.8378, -179.999},
+		{"near a pole", 5000, 89.99, 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lng := snapPosition(tt.size, tt.lat, tt.lng)
+			if d := haversineMeters(tt.lat, tt.lng, lat, lng); d > tt.size {
+				t.Errorf("snapPosition moved the position %v m, more than the cell size %v m", d, tt.size)
+			}
+			// Every position of a cell lands on its centre, so the centre snaps to itself
+			if againLat, againLng := snapPosition(tt.size, lat, lng); againLat != lat || againLng != lng {
+				t.Errorf("snapPosition is not stable: %v,%v then %v,%v", lat, lng, againLat, againLng)
+			}
+		})
+	}
+}
+
+func TestJitterPosition(t *testing.T) {
+	tests := []struct {
+		id       string
+		level    string
+		size     float64
+		lat, lng float64
+	}{
+		{"home-1", PrivacyNeighborhood, 500, 48.8566, 2.3522},
+		{"home-2", PrivacyCity, 5000, 35.6762, 139.6503},
+		{"home-3", PrivacyCity, 5000, 0, 179.99},
+	}
+	for _, tt := range tests {
+		lat, lng := jitterPosition(tt.id, tt.level, tt.size, tt.lat, tt.lng)
+		if d := haversineMeters(tt.lat, tt.lng, lat, lng); d > tt.size*1.001 {
+			t.Errorf("jitterPosition(%q) moved the position %v m, more than %v m", tt.id, d, tt.size)
+		}
+		if againLat, againLng := jitterPosition(tt.id, tt.level, tt.size, tt.lat, tt.lng); againLat != lat || againLng != lng {
+			t.Errorf("jitterPosition(%q) is not deterministic", tt.id)
+		}
+	}
+}
+
+func TestObfuscateLocation(t *testing.T) {
+	elevation := 34.0
+	tests := []struct {
+		name       string
+		privacy    string
+		privileged bool
+		exact      bool
+	}{
+		{"exact location", "", false, true},
+		{"private location for a privileged caller", PrivacyCity, true, true},
+		{"neighborhood location", PrivacyNeighborhood, false, false},
+		{"city location", PrivacyCity, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := Location{ID: "l1", Latitude: 52.520008, Longitude: 13.404954, Elevation: &elevation, Privacy: tt.privacy,
+				Geohash: "u33dc0cpp", Address: &Address{Street: "Unter den Linden 1", PostalCode: "10117"}}
+			obfuscateLocation(WithPrivilegedAudience(context.Background(), tt.privileged), &l)
+			moved := l.Latitude != 52.520008 || l.Longitude != 13.404954
+			if moved == tt.exact {
+				t.Errorf("position moved = %v, want %v", moved, !tt.exact)
+			}
+			if !tt.exact && (l.Elevation != nil || l.Address.Street != "" || l.Geohash == "u33dc0cpp") {
+				t.Errorf("obfuscated location still reveals elevation, street or geohash: %+v", l)
+			}
+			if !tt.exact && (l.Address.PostalCode == "") != (tt.privacy == PrivacyCity) {
+				t.Errorf("postal code = %q for privacy %q", l.Address.PostalCode, tt.privacy)
+			}
+		})
+	}
+}
+
+func TestPrivacySearchBBox(t *testing.T) {
+	box := BoundingBox{MinLng: 13.3, MinLat: 52.4, MaxLng: 13.5, MaxLat: 52.6}
+	if got := privacySearchBBox(WithPrivilegedAudience(context.Background(), true), box); got != box {
+		t.Errorf("privileged search box = %+v, want %+v", got, box)
+	}
+
+	// Any position blurred into the box is within the padding of it
+	padded := privacySearchBBox(context.Background(), box)
+	size := privacyCellSize(PrivacyCity)
+	for _, corner := range [][2]float64{{box.MinLat, box.MinLng}, {box.MaxLat, box.MaxLng}} {
+		for _, bearing := range []float64{0, 90, 180, 270} {
+			lat, lng := destinationPoint(corner[0], corner[1], bearing, size)
+			if !padded.Contains(lat, lng) {
+				t.Errorf("padded box %+v misses %v,%v", padded, lat, lng)
+			}
+		}
+	}
+}
+
+func TestFindNearestLocationsRanksObfuscatedPositions(t *testing.T) {
+	// Locations around Berlin, every third one private, indexed at their exact positions
+	random := rand.New(rand.NewSource(1))
+	var locations []NearestLocation
+	index := &locationSpatialIndex{boxes: map[string]BoundingBox{}, ready: true}
+	for i := 0; i < 300; i++ {
+		l := Location{ID: fmt.Sprintf("l%d", i), Name: fmt.Sprintf("place %d", i),
+			Latitude: 52.52 + (random.Float64()-0.5)*0.2, Longitude: 13.40 + (random.Float64()-0.5)*0.3}
+		switch i % 3 {
+		case 1:
+			l.Privacy = PrivacyCity
+		case 2:
+			l.Privacy = PrivacyNeighborhood
+		}
+		l.Geohash = encodeGeohash(l.Latitude, l.Longitude, 9)
+		index.upsert(l)
+		locations = append(locations, NearestLocation{Location: l})
+	}
+	previous := locationIndex
+	locationIndex = index
+	defer func() { locationIndex = previous }()
+
+	tests := []struct {
+		name        string
+		privileged  bool
+		k           int
+		maxDistance float64
+		prefix      string
+	}{
+		{"privileged", true, 5, 0, ""},
+		{"nearest", false, 5, 0, ""},
+		{"many", false, 40, 0, ""},
+		{"within a distance", false, 10, 2000, ""},
+		{"geohash prefix", false, 10, 0, encodeGeohash(52.52, 13.40, 5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithPrivilegedAudience(context.Background(), tt.privileged)
+			accept := func(l Location) bool {
+				return len(l.Geohash) >= len(tt.prefix) && l.Geohash[:len(tt.prefix)] == tt.prefix
+			}
+
+			for q := 0; q < 20; q++ {
+				lat, lng := 52.52+(random.Float64()-0.5)*0.2, 13.40+(random.Float64()-0.5)*0.3
+				got, err := findNearestLocations(ctx, lat, lng, tt.k, tt.maxDistance, accept)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Ranking every location by the position the caller sees is the expected answer
+				want := rankNearestLocations(ctx, locations, lat, lng, tt.maxDistance, accept)
+				if len(want) > tt.k {
+					want = want[:tt.k]
+				}
+				if len(got) != len(want) {
+					t.Fatalf("got %d locations near %v,%v, want %d", len(got), lat, lng, len(want))
+				}
+				for i := range want {
+					if got[i].ID != want[i].ID || got[i].Latitude != want[i].Latitude || got[i].Distance != want[i].Distance {
+						t.Errorf("result %d near %v,%v = %s at %v m, want %s at %v m", i, lat, lng, got[i].ID, got[i].Distance, want[i].ID, want[i].Distance)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestObfuscateCommunity(t *testing.T) {
+	for _, privileged := range []bool{false, true} {
+		ctx := WithPrivilegedAudience(context.Background(), privileged)
+		c := Community{ID: "c1", Location: Location{ID: "home", Latitude: 52.520008, Longitude: 13.404954, Privacy: PrivacyNeighborhood}}
+		obfuscateCommunity(ctx, &c)
+		feature, err := communityFeature(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Every community response and derived geometry follows the embedded location
+		var position []float64
+		if err := json.Unmarshal(feature.Geometry.Coordinates, &position); err != nil {
+			t.Fatal(err)
+		}
+		exact := position[0] == 13.404954 && position[1] == 52.520008
+		if exact != privileged {
+			t.Errorf("privileged %v: community feature at the exact position = %v", privileged, exact)
+		}
+		distance := communityCandidate(c, 52.520008, 13.404954, nil, "").Distance
+		if (distance == 0) != privileged {
+			t.Errorf("privileged %v: recommendation distance from the exact position = %v m", privileged, distance)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"temprest/config"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Recommendation defaults used when the Recommend config section is missing
+const (
+	defaultRecommendLimit          = 10
+	defaultRecommendMaxLimit       = 50
+	defaultRecommendMaxDistance    = 50000
+	defaultRecommendDistanceScale  = 5000
+	defaultRecommendMemberScale    = 20
+	defaultRecommendDistanceWeight = 0.6
+	defaultRecommendMemberWeight   = 0.3
+	defaultRecommendVacancyWeight  = 0.1
+	defaultRecommendScorer         = "balanced"
+)
+
+// CommunityCandidate is what a scorer knows about a community near the person looking for one
+type CommunityCandidate struct {
+	Community Community
+	// Distance in meters from the person to the community boundary, or its location when it has none
+	Distance float64
+	Members  int
+	// Vacancies holds the open seats of every limited role
+	Vacancies map[string]int
+	// Role is the role the person is looking for, empty when any role will do
+	Role string
+}
+
+// HasVacancy reports whether the person could join in the requested role, any role when none is requested
+func (c CommunityCandidate) HasVacancy() bool {
+	if c.Role != "" {
+		open, limited := c.Vacancies[c.Role]
+		return !limited || open > 0
+	}
+	if len(c.Vacancies) == 0 {
+		return true
+	}
+	for _, open := range c.Vacancies {
+		if open > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CommunityScorer rates a candidate community, higher scores are recommended first
+type CommunityScorer func(c CommunityCandidate) float64
+
+// CommunityRecommendation is a recommended community with the figures it was scored on
+type CommunityRecommendation struct {
+	Community Community      `json:"community"`
+	Distance  float64        `json:"distance"`
+	Members   int            `json:"members"`
+	Vacancies map[string]int `json:"vacancies,omitempty"`
+	Score     float64        `json:"score"`
+}
+
+var (
+	communityScorersMu sync.RWMutex
+	communityScorers   = map[string]CommunityScorer{
+		"balanced": balancedCommunityScore,
+		"distance": func(c CommunityCandidate) float64 { return proximityScore(c.Distance) },
+		"size":     func(c CommunityCandidate) float64 { return float64(c.Members) },
+	}
+)
+
+// RegisterCommunityScorer makes a scoring function selectable with the scorer query parameter,
+// registering an existing name replaces its function
+func RegisterCommunityScorer(name string, scorer CommunityScorer) {
+	communityScorersMu.Lock()
+	communityScorers[name] = scorer
+	communityScorersMu.Unlock()
+}
+
+// lookupCommunityScorer returns the scoring function registered under a name
+func lookupCommunityScorer(name string) (CommunityScorer, bool) {
+	communityScorersMu.RLock()
+	defer communityScorersMu.RUnlock()
+	scorer, ok := communityScorers[name]
+	return scorer, ok
+}
+
+// balancedCommunityScore weighs closeness, community size and open seats with the configured weights
+func balancedCommunityScore(c CommunityCandidate) float64 {
+	distanceWeight := configFloat("Recommend.DistanceWeight", defaultRecommendDistanceWeight)
+	memberWeight := configFloat("Recommend.MemberWeight", defaultRecommendMemberWeight)
+	vacancyWeight := configFloat("Recommend.VacancyWeight", defaultRecommendVacancyWeight)
+	memberScale := configFloat("Recommend.MemberScale", defaultRecommendMemberScale)
+
+	size := float64(c.Members) / (float64(c.Members) + memberScale)
+	vacancy := 0.0
+	if c.HasVacancy() {
+		vacancy = 1
+	}
+	return distanceWeight*proximityScore(c.Distance) + memberWeight*size + vacancyWeight*vacancy
+}
+
+// proximityScore maps a distance to (0, 1], halving at the configured distance scale
+func proximityScore(distance float64) float64 {
+	return 1 / (1 + distance/configFloat("Recommend.DistanceScale", defaultRecommendDistanceScale))
+}
+
+// configFloat reads a positive number from the configuration, or returns the default
+func configFloat(key string, fallback float64) float64 {
+	if value := config.GetFloat64(key); value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// validateRoleLimits checks every role limit names a role and is not negative
+func validateRoleLimits(limits map[string]int) error {
+	for role, limit := range limits {
+		if role == "" {
+			return errors.New("role names must not be empty")
+		}
+		if limit < 0 {
+			return fmt.Errorf("limit of role %q must not be negative", role)
+		}
+	}
+	return nil
+}
+
+// communityRoleCounts counts the memberships of every community by role
+func communityRoleCounts(ctx context.Context) (map[string]map[string]int, error) {
+	pipeline := []bson.M{
+		{"$group": bson.M{
+			"_id":   bson.M{"community": "$communityid", "role": "$role"},
+			"count": bson.M{"$sum": 1},
+		}},
+	}
+	cursor, err := client.Database("geolocapi").Collection("memberships").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[string]map[string]int)
+	for cursor.Next(ctx) {
+		var group struct {
+			ID struct {
+				Community string `bson:"community"`
+				Role      string `bson:"role"`
+			} `bson:"_id"`
+			Count int `bson:"count"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		if counts[group.ID.Community] == nil {
+			counts[group.ID.Community] = make(map[string]int)
+		}
+		counts[group.ID.Community][group.ID.Role] = group.Count
+	}
+	return counts, cursor.Err()
+}
+
+// memberCommunityIDs returns the communities a member already belongs to
+func memberCommunityIDs(ctx context.Context, memberID string) (map[string]bool, error) {
+	cursor, err := client.Database("geolocapi").Collection("memberships").Find(ctx, bson.M{"id": memberID})
+	if err != nil {
+		return nil, err
+	}
+	var memberships []Membership
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(memberships))
+	for _, m := range memberships {
+		ids[m.CommunityID] = true
+	}
+	return ids, nil
+}
+
+// communityCandidate describes a community as seen from a position
+func communityCandidate(c Community, lat, lng float64, roles map[string]int, role string) CommunityCandidate {
+	candidate := CommunityCandidate{Community: c, Role: role}
+	if c.Boundary != nil {
+		candidate.Distance = c.Boundary.distanceMeters(lat, lng)
+	} else {
+		candidate.Distance = haversineMeters(lat, lng, c.Location.Latitude, c.Location.Longitude)
+	}
+	for _, count := range roles {
+		candidate.Members += count
+	}
+	if len(c.RoleLimits) > 0 {
+		candidate.Vacancies = make(map[string]int, len(c.RoleLimits))
+		for name, limit := range c.RoleLimits {
+			candidate.Vacancies[name] = max(0, limit-roles[name])
+		}
+	}
+	return candidate
+}
+
+// recommendCommunities scores the communities within maxDistance of a position, leaving out those
+// a member already belongs to and those without a seat for the requested role
+func recommendCommunities(communities []Community, counts map[string]map[string]int, joined map[string]bool,
+	lat, lng, maxDistance float64, role string, scorer CommunityScorer) []CommunityRecommendation {
+	recommendations := []CommunityRecommendation{}
+	for _, c := range communities {
+		if joined[c.ID] {
+			continue
+		}
+		candidate := communityCandidate(c, lat, lng, counts[c.ID], role)
+		if candidate.Distance > maxDistance || role != "" && !candidate.HasVacancy() {
+			continue
+		}
+		score := scorer(candidate)
+		if math.IsNaN(score) {
+			continue
+		}
+		recommendations = append(recommendations, CommunityRecommendation{
+			Community: c,
+			Distance:  candidate.Distance,
+			Members:   candidate.Members,
+			Vacancies: candidate.Vacancies,
+			Score:     score,
+		})
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		if recommendations[i].Score != recommendations[j].Score {
+			return recommendations[i].Score > recommendations[j].Score
+		}
+		return recommendations[i].Distance < recommendations[j].Distance
+	})
+	return recommendations
+}
+
+// RecommendCommunities godoc
+// @Summary Recommend communities near a position
+// @Description Ranks communities by distance from their boundary or location, member count and open seats for a role, leaving out communities the member already belongs to
+// @Tags Community
+// @Accept json
+// @Produce json
+// @Param lat query number true "Latitude"
+// @Param lng query number true "Longitude"
+// @Param limit query int false "Number of communities to return (default 10)"
+// @Param maxDistance query number false "Only recommend communities within this many meters (default 50000)"
+// @Param memberId query string false "Leave out communities this membership ID already belongs to"
+// @Param role query string false "Only recommend communities with an open seat for this role"
+// @Param scorer query string false "Scoring function: balanced (default), distance or size"
+// @Param X-API-Key header string false "Privileged API key, private community locations are obfuscated without one"
+// @Success 200 {object} []CommunityRecommendation
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/community/recommend [get]
+func RecommendCommunities(w http.ResponseWriter, r *http.Request) {
+	// Parse the position of the person looking for a community
+	lat, lng, err := parseLatLngQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid point: %v", err)
+		return
+	}
+
+	// Parse the number of results
+	maxLimit := config.GetInt("Recommend.MaxLimit")
+	if maxLimit <= 0 {
+		maxLimit = defaultRecommendMaxLimit
+	}
+	limit := config.GetInt("Recommend.DefaultLimit")
+	if limit <= 0 || limit > maxLimit {
+		limit = min(defaultRecommendLimit, maxLimit)
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid limit: must be between 1 and %d", maxLimit)
+			return
+		}
+	}
+
+	// Parse the search radius
+	maxDistance := configFloat("Recommend.MaxDistance", defaultRecommendMaxDistance)
+	if value := r.URL.Query().Get("maxDistance"); value != "" {
+		maxDistance, err = strconv.ParseFloat(value, 64)
+		if err != nil || !(maxDistance >= 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid maxDistance: must be a positive number of meters")
+			return
+		}
+	}
+
+	// Pick the scoring function
+	name := r.URL.Query().Get("scorer")
+	if name == "" {
+		name = config.GetString("Recommend.Scorer")
+	}
+	if name == "" {
+		name = defaultRecommendScorer
+	}
+	scorer, ok := lookupCommunityScorer(name)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid scorer: %v", name)
+		return
+	}
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Load the communities, their members and the communities to leave out
+	communities, err := loadAllCommunities(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error finding communities: %v", err)
+		return
+	}
+	counts, err := communityRoleCounts(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error counting members: %v", err)
+		return
+	}
+	var joined map[string]bool
+	if memberID := r.URL.Query().Get("memberId"); memberID != "" {
+		if joined, err = memberCommunityIDs(ctx, memberID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Error finding memberships: %v", err)
+			return
+		}
+	}
+
+	// Measure from the position the caller may see, so distances do not reveal private community locations
+	for i := range communities {
+		obfuscateCommunity(r.Context(), &communities[i])
+	}
+
+	// Score and rank the communities
+	recommendations := recommendCommunities(communities, counts, joined, lat, lng, maxDistance, r.URL.Query().Get("role"), scorer)
+	if len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+
+	// Marshal recommendations to JSON
+	jsonData, err := json.Marshal(recommendations)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
@@ -0,0 +1,17 @@
+package geolocationapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecommendCommunitiesRejectsInvalidMaxDistances(t *testing.T) {
+	for _, maxDistance := range []string{"NaN", "-1", "-Inf", "far"} {
+		w := httptest.NewRecorder()
+		RecommendCommunities(w, httptest.NewRequest(http.MethodGet, "/geolocationapi/community/recommend?lat=52.52&lng=13.40&maxDistance="+maxDistance, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("maxDistance %s: status = %d, want %d", maxDistance, w.Code, http.StatusBadRequest)
+		}
+	}
+}
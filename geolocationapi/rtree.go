@@ -0,0 +1,372 @@
+package geolocationapi
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// R-tree node fan-out
+const (
+	rtreeMaxEntries = 16
+	rtreeMinEntries = 6
+)
+
+// rtree is an in-memory R-tree of items keyed by id, boxes are in decimal degrees
+type rtree[T any] struct {
+	root *rtreeNode[T]
+	size int
+}
+
+type rtreeNode[T any] struct {
+	leaf    bool
+	entries []rtreeEntry[T]
+}
+
+// rtreeEntry points at a child node, or at an item in leaf nodes
+type rtreeEntry[T any] struct {
+	box   BoundingBox
+	child *rtreeNode[T]
+	id    string
+	item  T
+}
+
+// rtreeResult is an item found by a nearest neighbour search
+type rtreeResult[T any] struct {
+	Item     T
+	Distance float64
+}
+
+// Len returns the number of items in the tree
+func (t *rtree[T]) Len() int {
+	return t.size
+}
+
+// Insert adds an item covering box
+func (t *rtree[T]) Insert(id string, box BoundingBox, item T) {
+	if t.root == nil {
+		t.root = &rtreeNode[T]{leaf: true}
+	}
+	t.insertEntry(rtreeEntry[T]{box: box, id: id, item: item})
+	t.size++
+}
+
+func (t *rtree[T]) insertEntry(e rtreeEntry[T]) {
+	if sibling := t.insertInto(t.root, e); sibling != nil {
+		// The root was split, grow the tree by one level
+		t.root = &rtreeNode[T]{entries: []rtreeEntry[T]{
+			{box: t.root.bounds(), child: t.root},
+			{box: sibling.bounds(), child: sibling},
+		}}
+	}
+}
+
+// insertInto adds a leaf entry below n and returns the new sibling when n had to be split
+func (t *rtree[T]) insertInto(n *rtreeNode[T], e rtreeEntry[T]) *rtreeNode[T] {
+	if n.leaf {
+		n.entries = append(n.entries, e)
+	} else {
+		// Descend into the child needing the least enlargement
+		best, bestGrowth, bestArea := 0, math.Inf(1), math.Inf(1)
+		for i, child := range n.entries {
+			area := bboxArea(child.box)
+			grown := child.box
+			grown.Union(e.box)
+			growth := bboxArea(grown) - area
+			if growth < bestGrowth || growth == bestGrowth && area < bestArea {
+				best, bestGrowth, bestArea = i, growth, area
+			}
+		}
+
+		child := n.entries[best].child
+		sibling := t.insertInto(child, e)
+		n.entries[best].box = child.bounds()
+		if sibling != nil {
+			n.entries = append(n.entries, rtreeEntry[T]{box: sibling.bounds(), child: sibling})
+		}
+	}
+
+	if len(n.entries) > rtreeMaxEntries {
+		return n.split()
+	}
+	return nil
+}
+
+// split divides an overfull node with the quadratic split, n keeps one group and the other is returned
+func (n *rtreeNode[T]) split() *rtreeNode[T] {
+	entries := n.entries
+
+	// Pick the two entries that would waste the most area together
+	seedA, seedB, worst := 0, 1, math.Inf(-1)
+	for i := 0; i < len(entries); i++ {
+		for j := i + 1; j < len(entries); j++ {
+			combined := entries[i].box
+			combined.Union(entries[j].box)
+			waste := bboxArea(combined) - bboxArea(entries[i].box) - bboxArea(entries[j].box)
+			if waste > worst {
+				seedA, seedB, worst = i, j, waste
+			}
+		}
+	}
+
+	groupA := []rtreeEntry[T]{entries[seedA]}
+	groupB := []rtreeEntry[T]{entries[seedB]}
+	boxA, boxB := entries[seedA].box, entries[seedB].box
+	for i, e := range entries {
+		if i == seedA || i == seedB {
+			continue
+		}
+		remaining := len(entries) - i
+		// Make sure both groups end up with the minimum number of entries
+		switch {
+		case len(groupA)+remaining <= rtreeMinEntries:
+			groupA = append(groupA, e)
+			boxA.Union(e.box)
+			continue
+		case len(groupB)+remaining <= rtreeMinEntries:
+			groupB = append(groupB, e)
+			boxB.Union(e.box)
+			continue
+		}
+
+		grownA, grownB := boxA, boxB
+		grownA.Union(e.box)
+		grownB.Union(e.box)
+		if bboxArea(grownA)-bboxArea(boxA) <= bboxArea(grownB)-bboxArea(boxB) {
+			groupA = append(groupA, e)
+			boxA = grownA
+		} else {
+			groupB = append(groupB, e)
+			boxB = grownB
+		}
+	}
+
+	n.entries = groupA
+	return &rtreeNode[T]{leaf: n.leaf, entries: groupB}
+}
+
+// Delete removes the item with the given id that was inserted with box
+func (t *rtree[T]) Delete(id string, box BoundingBox) bool {
+	if t.root == nil {
+		return false
+	}
+
+	var orphans []rtreeEntry[T]
+	if !t.deleteFrom(t.root, id, box, &orphans) {
+		return false
+	}
+	t.size--
+
+	// Shrink the tree while the root only has one child
+	for !t.root.leaf && len(t.root.entries) == 1 {
+		t.root = t.root.entries[0].child
+	}
+	if !t.root.leaf && len(t.root.entries) == 0 {
+		t.root = &rtreeNode[T]{leaf: true}
+	}
+
+	// Reinsert the items of nodes that became too small
+	for _, e := range orphans {
+		t.insertEntry(e)
+	}
+	return true
+}
+
+func (t *rtree[T]) deleteFrom(n *rtreeNode[T], id string, box BoundingBox, orphans *[]rtreeEntry[T]) bool {
+	if n.leaf {
+		for i, e := range n.entries {
+			if e.id == id {
+				n.entries = append(n.entries[:i], n.entries[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+
+	for i, e := range n.entries {
+		if !bboxIntersects(e.box, box) || !t.deleteFrom(e.child, id, box, orphans) {
+			continue
+		}
+		if len(e.child.entries) < rtreeMinEntries {
+			e.child.collectLeaves(orphans)
+			n.entries = append(n.entries[:i], n.entries[i+1:]...)
+		} else {
+			n.entries[i].box = e.child.bounds()
+		}
+		return true
+	}
+	return false
+}
+
+// collectLeaves appends every leaf entry below n
+func (n *rtreeNode[T]) collectLeaves(out *[]rtreeEntry[T]) {
+	if n.leaf {
+		*out = append(*out, n.entries...)
+		return
+	}
+	for _, e := range n.entries {
+		e.child.collectLeaves(out)
+	}
+}
+
+// bounds returns the box covering every entry of a node
+func (n *rtreeNode[T]) bounds() BoundingBox {
+	if len(n.entries) == 0 {
+		return BoundingBox{}
+	}
+	box := n.entries[0].box
+	for _, e := range n.entries[1:] {
+		box.Union(e.box)
+	}
+	return box
+}
+
+// Load replaces the content of the tree with the given items using Sort-Tile-Recursive packing
+func (t *rtree[T]) Load(ids []string, boxes []BoundingBox, items []T) {
+	entries := make([]rtreeEntry[T], len(items))
+	for i := range items {
+		entries[i] = rtreeEntry[T]{box: boxes[i], id: ids[i], item: items[i]}
+	}
+	t.size = len(entries)
+
+	leaf := true
+	for {
+		nodes := packRTreeLevel(entries, leaf)
+		if len(nodes) <= 1 {
+			if len(nodes) == 0 {
+				t.root = &rtreeNode[T]{leaf: true}
+			} else {
+				t.root = nodes[0]
+			}
+			return
+		}
+		entries = make([]rtreeEntry[T], len(nodes))
+		for i, n := range nodes {
+			entries[i] = rtreeEntry[T]{box: n.bounds(), child: n}
+		}
+		leaf = false
+	}
+}
+
+// packRTreeLevel groups entries into nodes by slicing them by longitude then latitude
+func packRTreeLevel[T any](entries []rtreeEntry[T], leaf bool) []*rtreeNode[T] {
+	if len(entries) == 0 {
+		return nil
+	}
+	nodeCount := int(math.Ceil(float64(len(entries)) / rtreeMaxEntries))
+	sliceCount := int(math.Ceil(math.Sqrt(float64(nodeCount))))
+	sliceSize := sliceCount * rtreeMaxEntries
+
+	sort.Slice(entries, func(i, j int) bool { return bboxCenterLng(entries[i].box) < bboxCenterLng(entries[j].box) })
+
+	var nodes []*rtreeNode[T]
+	for start := 0; start < len(entries); start += sliceSize {
+		end := int(math.Min(float64(start+sliceSize), float64(len(entries))))
+		slice := entries[start:end]
+		sort.Slice(slice, func(i, j int) bool { return bboxCenterLat(slice[i].box) < bboxCenterLat(slice[j].box) })
+		for n := 0; n < len(slice); n += rtreeMaxEntries {
+			m := int(math.Min(float64(n+rtreeMaxEntries), float64(len(slice))))
+			nodes = append(nodes, &rtreeNode[T]{leaf: leaf, entries: append([]rtreeEntry[T]{}, slice[n:m]...)})
+		}
+	}
+	return nodes
+}
+
+// Search calls fn for every item whose box intersects box until fn returns false
+func (t *rtree[T]) Search(box BoundingBox, fn func(item T) bool) {
+	if t.root == nil {
+		return
+	}
+	t.root.search(box, fn)
+}
+
+func (n *rtreeNode[T]) search(box BoundingBox, fn func(item T) bool) bool {
+	for _, e := range n.entries {
+		if !bboxIntersects(e.box, box) {
+			continue
+		}
+		if n.leaf {
+			if !fn(e.item) {
+				return false
+			}
+		} else if !e.child.search(box, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// Nearest returns up to k items closest to a position ordered by distance in meters,
+// items rejected by accept are skipped and a maxDistance of zero means unlimited
+func (t *rtree[T]) Nearest(lat, lng float64, k int, maxDistance float64, accept func(item T) bool) []rtreeResult[T] {
+	if t.root == nil || k <= 0 {
+		return nil
+	}
+
+	queue := &rtreeQueue[T]{}
+	heap.Push(queue, rtreeQueueItem[T]{node: t.root})
+
+	var results []rtreeResult[T]
+	for queue.Len() > 0 && len(results) < k {
+		next := heap.Pop(queue).(rtreeQueueItem[T])
+		if maxDistance > 0 && next.distance > maxDistance {
+			break
+		}
+		if next.node == nil {
+			results = append(results, rtreeResult[T]{Item: next.entry.item, Distance: next.distance})
+			continue
+		}
+		for i := range next.node.entries {
+			e := &next.node.entries[i]
+			distance := distanceToBBoxMeters(lat, lng, e.box)
+			if next.node.leaf {
+				if accept != nil && !accept(e.item) {
+					continue
+				}
+				heap.Push(queue, rtreeQueueItem[T]{entry: e, distance: distance})
+			} else {
+				heap.Push(queue, rtreeQueueItem[T]{node: e.child, distance: distance})
+			}
+		}
+	}
+	return results
+}
+
+// rtreeQueueItem is a node or leaf entry waiting in the best-first search
+type rtreeQueueItem[T any] struct {
+	node     *rtreeNode[T]
+	entry    *rtreeEntry[T]
+	distance float64
+}
+
+// rtreeQueue is a min-heap ordered by distance
+type rtreeQueue[T any] []rtreeQueueItem[T]
+
+func (q rtreeQueue[T]) Len() int            { return len(q) }
+func (q rtreeQueue[T]) Less(i, j int) bool  { return q[i].distance < q[j].distance }
+func (q rtreeQueue[T]) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *rtreeQueue[T]) Push(x interface{}) { *q = append(*q, x.(rtreeQueueItem[T])) }
+func (q *rtreeQueue[T]) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// bboxArea returns the area of a box in square degrees
+func bboxArea(b BoundingBox) float64 {
+	return (b.MaxLat - b.MinLat) * (b.MaxLng - b.MinLng)
+}
+
+// bboxIntersects reports whether two boxes overlap
+func bboxIntersects(a, b BoundingBox) bool {
+	return a.MinLat <= b.MaxLat && a.MaxLat >= b.MinLat && a.MinLng <= b.MaxLng && a.MaxLng >= b.MinLng
+}
+
+func bboxCenterLat(b BoundingBox) float64 {
+	return (b.MinLat + b.MaxLat) / 2
+}
+
+func bboxCenterLng(b BoundingBox) float64 {
+	return (b.MinLng + b.MaxLng) / 2
+}
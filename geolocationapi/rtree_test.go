@@ -0,0 +1,140 @@
+package geolocationapi
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestRTree(t *testing.T) {
+	// Points around Europe, a third of them deleted again after building the tree
+	random := rand.New(rand.NewSource(1))
+	ids := make([]string, 500)
+	boxes := make([]BoundingBox, len(ids))
+	items := make([]int, len(ids))
+	for i := range ids {
+		lat, lng := 35+random.Float64()*30, -10+random.Float64()*40
+		ids[i], boxes[i], items[i] = fmt.Sprintf("p%d", i), BoundingBox{MinLng: lng, MinLat: lat, MaxLng: lng, MaxLat: lat}, i
+	}
+
+	tests := []struct {
+		name  string
+		build func(tree *rtree[int])
+	}{
+		{"inserted", func(tree *rtree[int]) {
+			for i := range ids {
+				tree.Insert(ids[i], boxes[i], items[i])
+			}
+		}},
+		{"loaded", func(tree *rtree[int]) { tree.Load(ids, boxes, items) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := &rtree[int]{}
+			tt.build(tree)
+			live := map[int]bool{}
+			for i := range ids {
+				live[i] = true
+			}
+			for i := 0; i < len(ids); i += 3 {
+				if !tree.Delete(ids[i], boxes[i]) {
+					t.Fatalf("Delete(%q) found nothing", ids[i])
+				}
+				delete(live, i)
+			}
+			if tree.Delete(ids[0], boxes[0]) {
+				t.Errorf("Delete(%q) succeeded twice", ids[0])
+			}
+			if tree.Len() != len(live) {
+				t.Errorf("Len() = %d, want %d", tree.Len(), len(live))
+			}
+
+			query := BoundingBox{MinLng: 0, MinLat: 45, MaxLng: 15, MaxLat: 55}
+			var found []int
+			tree.Search(query, func(i int) bool {
+				found = append(found, i)
+				return true
+			})
+			var want []int
+			for i := range live {
+				if query.Contains(boxes[i].MinLat, boxes[i].MinLng) {
+					want = append(want, i)
+				}
+			}
+			sort.Ints(found)
+			sort.Ints(want)
+			if fmt.Sprint(found) != fmt.Sprint(want) {
+				t.Errorf("Search found %v, want %v", found, want)
+			}
+
+			even := func(i int) bool { return i%2 == 0 }
+			for _, nearest := range []struct {
+				k           int
+				maxDistance float64
+				accept      func(int) bool
+			}{
+				{10, 0, nil},
+				{400, 0, nil},
+				{50, 300000, nil},
+				{10, 0, even},
+			} {
+				got := tree.Nearest(50, 8, nearest.k, nearest.maxDistance, nearest.accept)
+				// Ranking every live point by distance is the expected answer
+				var ranked []rtreeResult[int]
+				for i := range live {
+					d := haversineMeters(50, 8, boxes[i].MinLat, boxes[i].MinLng)
+					if (nearest.maxDistance > 0 && d > nearest.maxDistance) || (nearest.accept != nil && !nearest.accept(i)) {
+						continue
+					}
+					ranked = append(ranked, rtreeResult[int]{Item: i, Distance: d})
+				}
+				sort.Slice(ranked, func(a, b int) bool { return ranked[a].Distance < ranked[b].Distance })
+				if len(ranked) > nearest.k {
+					ranked = ranked[:nearest.k]
+				}
+				if len(got) != len(ranked) {
+					t.Fatalf("Nearest(k=%d, maxDistance=%v) returned %d items, want %d", nearest.k, nearest.maxDistance, len(got), len(ranked))
+				}
+				for i := range ranked {
+					if got[i].Item != ranked[i].Item {
+						t.Errorf("Nearest(k=%d, maxDistance=%v) result %d = %d at %v m, want %d at %v m",
+							nearest.k, nearest.maxDistance, i, got[i].Item, got[i].Distance, ranked[i].Item, ranked[i].Distance)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRTreeEmpty(t *testing.T) {
+	tree := &rtree[int]{}
+	if got := tree.Nearest(0, 0, 5, 0, nil); len(got) != 0 {
+		t.Errorf("Nearest on an empty tree = %v", got)
+	}
+	tree.Search(BoundingBox{MinLng: -180, MinLat: -90, MaxLng: 180, MaxLat: 90}, func(int) bool {
+		t.Error("Search on an empty tree called fn")
+		return false
+	})
+	if tree.Delete("missing", BoundingBox{}) {
+		t.Error("Delete on an empty tree succeeded")
+	}
+}
+
+func TestDistanceToBBoxMetersIsALowerBound(t *testing.T) {
+	// Nearest prunes nodes by this distance, so no point of a box may be closer than it
+	random := rand.New(rand.NewSource(2))
+	for i := 0; i < 2000; i++ {
+		lat, lng := -80+random.Float64()*160, -180+random.Float64()*360
+		minLat, minLng := -80+random.Float64()*150, -180+random.Float64()*340
+		box := BoundingBox{MinLng: minLng, MinLat: minLat, MaxLng: minLng + random.Float64()*20, MaxLat: minLat + random.Float64()*10}
+		bound := distanceToBBoxMeters(lat, lng, box)
+		for j := 0; j < 20; j++ {
+			pLat := box.MinLat + random.Float64()*(box.MaxLat-box.MinLat)
+			pLng := box.MinLng + random.Float64()*(box.MaxLng-box.MinLng)
+			if d := haversineMeters(lat, lng, pLat, pLng); d < bound-1e-6 {
+				t.Fatalf("%v,%v is %v m from %v,%v inside %+v, but the box distance is %v m", lat, lng, d, pLat, pLng, box, bound)
+			}
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"temprest/config"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Search defaults used when the Search config section is missing
+const (
+	defaultSearchLimit       = 10
+	defaultSearchMaxLimit    = 100
+	defaultSearchMinScore    = 0.3
+	defaultSearchBiasScaleKm = 50.0
+)
+
+// Result types of a search
+const (
+	SearchResultLocation  = "location"
+	SearchResultGazetteer = "gazetteer"
+)
+
+// SearchResult is a location or gazetteer place matching a search query
+type SearchResult struct {
+	Type     string          `json:"type"`
+	Score    float64         `json:"score"`
+	Distance *float64        `json:"distance,omitempty"`
+	Location *Location       `json:"location,omitempty"`
+	Place    *GazetteerPlace `json:"place,omitempty"`
+}
+
+// foldText lower-cases text, strips accents and turns punctuation into single spaces
+func foldText(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+
+	var b strings.Builder
+	space := true
+	for _, r := range strings.ToLower(folded) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+		} else if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// trigrams returns the set of padded trigrams of folded text
+func trigrams(s string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, word := range strings.Fields(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
+
+// trigramSimilarity is the Jaccard similarity of two trigram sets
+func trigramSimilarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range a {
+		if _, ok := b[t]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// editSimilarity turns the edit distance into a 0..1 similarity
+func editSimilarity(a, b string) float64 {
+	longest := max(len([]rune(a)), len([]rune(b)))
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+// searchQuery is a folded query with its precomputed runes and trigrams
+type searchQuery struct {
+	text     string
+	runes    []rune
+	trigrams map[string]struct{}
+}
+
+func newSearchQuery(q string) searchQuery {
+	text := foldText(q)
+	return searchQuery{text: text, runes: []rune(text), trigrams: trigrams(text)}
+}
+
+// score rates how well a name matches the query between 0 and 1
+func (q searchQuery) score(name string) float64 {
+	folded := foldText(name)
+	if folded == "" || q.text == "" {
+		return 0
+	}
+	if folded == q.text {
+		return 1
+	}
+
+	// Prefix matches drive autocomplete, lengths are counted in runes so accented and CJK names rank alike
+	words := strings.Fields(folded)
+	if strings.HasPrefix(folded, q.text) {
+		return 0.9 + 0.1*float64(len(q.runes))/float64(utf8.RuneCountInString(folded))
+	}
+	for _, word := range words {
+		if strings.HasPrefix(word, q.text) {
+			return 0.8 + 0.1*float64(len(q.runes))/float64(utf8.RuneCountInString(word))
+		}
+	}
+
+	// Typos: compare against the whole name and each word, and blend with trigram overlap
+	best := editSimilarity(q.text, folded)
+	for _, word := range words {
+		best = math.Max(best, editSimilarity(q.text, word))
+		if wordRunes := []rune(word); len(wordRunes) > len(q.runes) {
+			best = math.Max(best, editSimilarity(q.text, string(wordRunes[:len(q.runes)]))*0.95)
+		}
+	}
+	return 0.6*best + 0.4*trigramSimilarity(q.trigrams, trigrams(folded))
+}
+
+// searchOptions holds the parsed parameters of a search request
+type searchOptions struct {
+	query            searchQuery
+	limit            int
+	minScore         float64
+	includeGazetteer bool
+	biased           bool
+	lat, lng         float64
+	biasScaleKm      float64
+}
+
+// bias lowers the score of results far from the bias point and returns the distance in meters
+func (o searchOptions) bias(score, lat, lng float64) (float64, *float64) {
+	if !o.biased {
+		return score, nil
+	}
+	distance := haversineMeters(o.lat, o.lng, lat, lng)
+	proximity := 1 / (1 + distance/1000/o.biasScaleKm)
+	return score * (0.7 + 0.3*proximity), &distance
+}
+
+// searchLocations ranks locations and optionally gazetteer places against the query
+func searchLocations(ctx context.Context, opts searchOptions) ([]SearchResult, error) {
+	locations, ok := locationIndex.all()
+	if !ok {
+		var err error
+		if locations, err = loadAllLocations(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []SearchResult
+	for i := range locations {
+		l := locations[i]
+		score := opts.query.score(l.Name)
+		if score < opts.minScore {
+			continue
+		}
+		// Private locations are biased by the position the caller sees, not the exact one
+		obfuscateLocation(ctx, &l)
+		score, distance := opts.bias(score, l.Latitude, l.Longitude)
+		results = append(results, SearchResult{Type: SearchResultLocation, Score: score, Distance: distance, Location: &l})
+	}
+
+	if opts.includeGazetteer {
+		g, err := getGazetteer()
+		if err != nil {
+			return nil, err
+		}
+		for i := range g.places {
+			p := &g.places[i]
+			score := opts.query.score(p.Name)
+			if p.AsciiName != p.Name {
+				score = math.Max(score, opts.query.score(p.AsciiName))
+			}
+			for _, alternate := range p.AlternateNames {
+				score = math.Max(score, 0.95*opts.query.score(alternate))
+			}
+			if score < opts.minScore {
+				continue
+			}
+			score, distance := opts.bias(score, p.Latitude, p.Longitude)
+			results = append(results, SearchResult{Type: SearchResultGazetteer, Score: score, Distance: distance, Place: p})
+		}
+	}
+
+	sort.SliceStable(results, func(a, b int) bool { return results[a].Score > results[b].Score })
+	if len(results) > opts.limit {
+		results = results[:opts.limit]
+	}
+	return results, nil
+}
+
+// SearchLocations godoc
+// @Summary Search locations by name
+// @Description Fuzzy, accent-insensitive name search with prefix autocomplete, optionally including gazetteer places and biased toward a point
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param q query string true "Search text"
+// @Param limit query int false "Maximum number of results (default 10)"
+// @Param includeGazetteer query bool false "Also search the offline gazetteer"
+// @Param lat query number false "Latitude to bias results toward"
+// @Param lng query number false "Longitude to bias results toward"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Success 200 {object} []SearchResult
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/location/search [get]
+func SearchLocations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Parse the search text
+	opts := searchOptions{
+		query:       newSearchQuery(query.Get("q")),
+		limit:       defaultSearchLimit,
+		minScore:    config.GetFloat64("Search.MinScore"),
+		biasScaleKm: config.GetFloat64("Search.BiasScaleKm"),
+	}
+	if opts.query.text == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Query parameter q is required")
+		return
+	}
+	if opts.minScore <= 0 {
+		opts.minScore = defaultSearchMinScore
+	}
+	if opts.biasScaleKm <= 0 {
+		opts.biasScaleKm = defaultSearchBiasScaleKm
+	}
+
+	// Parse the limit
+	maxLimit := config.GetInt("Search.MaxLimit")
+	if maxLimit <= 0 {
+		maxLimit = defaultSearchMaxLimit
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid limit: must be between 1 and %d", maxLimit)
+			return
+		}
+		opts.limit = limit
+	}
+
+	// Parse the optional gazetteer and bias parameters
+	if value := query.Get("includeGazetteer"); value != "" {
+		include, err := strconv.ParseBool(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid includeGazetteer: must be true or false")
+			return
+		}
+		opts.includeGazetteer = include
+	}
+	if query.Get("lat") != "" || query.Get("lng") != "" {
+		lat, lng, err := parseLatLngQuery(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid bias point: %v", err)
+			return
+		}
+		opts.biased, opts.lat, opts.lng = true, lat, lng
+	}
+
+	// Get the MongoDB context, keeping the audience of the request
+	ctx, cancel := context.WithTimeout(WithPrivilegedAudience(context.Background(), isPrivileged(r.Context())), 10*time.Second)
+	defer cancel()
+
+	// Rank the candidates, private locations are obfuscated for callers without elevated rights
+	results, err := searchLocations(ctx, opts)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error searching locations: %v", err)
+		return
+	}
+
+	if results == nil {
+		results = []SearchResult{}
+	}
+
+	// Marshal results to JSON
+	jsonData, err := json.Marshal(results)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
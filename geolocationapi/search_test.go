@@ -0,0 +1,103 @@
+package geolocationapi
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestFoldText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Café Münster", "cafe munster"},
+		{"São Paulo", "sao paulo"},
+		{"  Saint-Étienne!! ", "saint etienne"},
+		{"Łódź", "łodz"},
+		{"北京市", "北京市"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := foldText(tt.in); got != tt.want {
+			t.Errorf("foldText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSearchQueryScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		location string
+		min, max float64
+	}{
+		{"exact after folding", "zurich", "Zürich", 1, 1},
+		{"accented prefix", "muns", "Münster", 0.9, 1},
+		{"word prefix", "etien", "Saint-Étienne", 0.8, 0.9},
+		{"cjk prefix", "北京", "北京市", 0.9, 1},
+		{"cjk word shorter in runes than the query", "tokyo", "東京 駅", 0, 0.3},
+		{"accented word longer in bytes than the query", "abcdefg", "ééé ü", 0, 0.3},
+		{"query longer in bytes than the word", "東京都庁舎", "東京都 庁", 0.3, 0.9},
+		{"long query against a cjk word longer in bytes", strings.Repeat("tokyo ", 8), strings.Repeat("東京都", 5), 0, 0.3},
+		{"long accented query against a shorter word", strings.Repeat("é", 40), strings.Repeat("東", 14), 0, 0.3},
+		{"typo", "amsterdm", "Amsterdam", 0.6, 0.9},
+		{"unrelated", "berlin", "Lisboa", 0, 0.3},
+		{"empty name", "berlin", "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newSearchQuery(tt.query).score(tt.location)
+			if got < tt.min || got > tt.max {
+				t.Errorf("score(%q, %q) = %v, want between %v and %v", tt.query, tt.location, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestEditSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"münster", "munster", 1 - 1.0/7},
+		{"東京", "東京", 1},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		if got := editSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("editSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSearchLocationsBiasesObfuscatedPositions(t *testing.T) {
+	index := &locationSpatialIndex{boxes: map[string]BoundingBox{}, ready: true}
+	index.upsert(Location{ID: "home", Name: "Home", Latitude: 52.520008, Longitude: 13.404954, Privacy: PrivacyCity})
+	index.upsert(Location{ID: "office", Name: "Home office", Latitude: 52.53, Longitude: 13.41})
+	previous := locationIndex
+	locationIndex = index
+	defer func() { locationIndex = previous }()
+
+	opts := searchOptions{query: newSearchQuery("home"), limit: 10, minScore: 0.1, biased: true,
+		lat: 52.520008, lng: 13.404954, biasScaleKm: 1}
+	for _, privileged := range []bool{false, true} {
+		ctx := WithPrivilegedAudience(context.Background(), privileged)
+		results, err := searchLocations(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			// The distance and the bias must follow the position returned to the caller
+			l := result.Location
+			if want := haversineMeters(opts.lat, opts.lng, l.Latitude, l.Longitude); result.Distance == nil || *result.Distance != want {
+				t.Errorf("privileged %v: distance of %s = %v, want %v", privileged, l.ID, result.Distance, want)
+			}
+			if exact := l.Latitude == 52.520008 && l.Longitude == 13.404954; l.ID == "home" && exact != privileged {
+				t.Errorf("privileged %v: home at its exact position = %v", privileged, exact)
+			}
+		}
+	}
+}
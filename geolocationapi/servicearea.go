@@ -0,0 +1,275 @@
+package geolocationapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"temprest/config"
+)
+
+// Service area defaults used when the ServiceArea config section is missing
+const (
+	defaultServiceAreaSegments    = 64
+	defaultServiceAreaMaxSegments = 720
+	defaultServiceAreaMaxDistance = 100000
+	minServiceAreaSegments        = 8
+)
+
+// serviceArea is a geodesic circle approximated by a polygon, ring holds [longitude, latitude]
+// positions unwrapped around the centre so it may run past the antimeridian
+type serviceArea struct {
+	lat, lng float64
+	distance float64
+	ring     [][]float64
+}
+
+// newServiceArea places segments vertices distance meters from the centre along evenly spaced bearings,
+// counterclockwise as GeoJSON expects of an exterior ring
+func newServiceArea(lat, lng, distance float64, segments int) (*serviceArea, error) {
+	// The polygon stops being a ring once the circle reaches a pole
+	angular := distance / earthRadiusMeters
+	if angular >= (90-math.Abs(lat))*math.Pi/180 {
+		return nil, errors.New("the service area must not reach a pole")
+	}
+
+	ring := make([][]float64, 0, segments+1)
+	for i := 0; i < segments; i++ {
+		vertexLat, vertexLng := destinationPoint(lat, lng, -360*float64(i)/float64(segments), distance)
+		ring = append(ring, []float64{roundCoordinate(vertexLng), roundCoordinate(vertexLat)})
+	}
+	ring = append(ring, []float64{ring[0][0], ring[0][1]})
+	return &serviceArea{lat: lat, lng: lng, distance: distance, ring: ring}, nil
+}
+
+// roundCoordinate keeps 7 decimals of a degree, about a centimeter, without a negative zero
+func roundCoordinate(degrees float64) float64 {
+	rounded := math.Round(degrees*1e7) / 1e7
+	if rounded == 0 {
+		return 0
+	}
+	return rounded
+}
+
+// bounds returns the box around the polygon, spanning every longitude when it crosses the antimeridian
+func (a *serviceArea) bounds() BoundingBox {
+	box := BoundingBox{MinLat: 90, MaxLat: -90, MinLng: math.Inf(1), MaxLng: math.Inf(-1)}
+	for _, position := range a.ring {
+		box.MinLng, box.MaxLng = math.Min(box.MinLng, position[0]), math.Max(box.MaxLng, position[0])
+		box.MinLat, box.MaxLat = math.Min(box.MinLat, position[1]), math.Max(box.MaxLat, position[1])
+	}
+	if box.MinLng < -180 || box.MaxLng > 180 {
+		box.MinLng, box.MaxLng = -180, 180
+	}
+	return box
+}
+
+// contains tests a position against the polygon, moving its longitude next to the centre first
+func (a *serviceArea) contains(lat, lng float64) bool {
+	return ringContains(a.ring, lat, a.lng+math.Remainder(lng-a.lng, 360))
+}
+
+// geometry returns the polygon as GeoJSON, split in two along the antimeridian when it crosses it
+func (a *serviceArea) geometry() (*GeoJSONGeometry, error) {
+	box := BoundingBox{MinLng: math.Inf(1), MaxLng: math.Inf(-1)}
+	for _, position := range a.ring {
+		box.MinLng, box.MaxLng = math.Min(box.MinLng, position[0]), math.Max(box.MaxLng, position[0])
+	}
+	switch {
+	case box.MaxLng > 180:
+		west := clipRingLongitude(a.ring, 180, false, -360)
+		return newGeoJSONGeometry("MultiPolygon", [][][][]float64{{clipRingLongitude(a.ring, 180, true, 0)}, {west}})
+	case box.MinLng < -180:
+		east := clipRingLongitude(a.ring, -180, true, 360)
+		return newGeoJSONGeometry("MultiPolygon", [][][][]float64{{clipRingLongitude(a.ring, -180, false, 0)}, {east}})
+	}
+	return newGeoJSONGeometry("Polygon", [][][]float64{a.ring})
+}
+
+// clipRingLongitude keeps the part of a ring east of edge, or west of it when west is set, and shifts the
+// kept longitudes by shift, the crossing latitude of each cut edge is interpolated linearly
+func clipRingLongitude(ring [][]float64, edge float64, west bool, shift float64) [][]float64 {
+	inside := func(position []float64) bool {
+		if west {
+			return position[0] <= edge
+		}
+		return position[0] >= edge
+	}
+
+	var clipped [][]float64
+	for i := 1; i < len(ring); i++ {
+		from, to := ring[i-1], ring[i]
+		if inside(from) {
+			clipped = append(clipped, []float64{from[0] + shift, from[1]})
+		}
+		if inside(from) != inside(to) {
+			lat := from[1] + (to[1]-from[1])*(edge-from[0])/(to[0]-from[0])
+			clipped = append(clipped, []float64{edge + shift, roundCoordinate(lat)})
+		}
+	}
+	if len(clipped) > 0 {
+		clipped = append(clipped, []float64{clipped[0][0], clipped[0][1]})
+	}
+	return clipped
+}
+
+// serviceAreaLocations returns the locations inside an area sorted by distance from its centre, private
+// locations are tested by the position the audience of ctx may see
+func serviceAreaLocations(ctx context.Context, area *serviceArea) ([]Location, error) {
+	// Private locations are placed by their obfuscated position, which may lie inside the area while
+	// the exact position lies just outside of it
+	box := privacySearchBBox(ctx, area.bounds())
+	candidates, ok := locationIndex.within(box)
+	if !ok {
+		var err error
+		if candidates, err = findLocationsInBBox(ctx, box); err != nil {
+			return nil, err
+		}
+	}
+	obfuscateLocations(ctx, candidates)
+
+	locations := []Location{}
+	distances := map[string]float64{}
+	for _, l := range candidates {
+		if area.contains(l.Latitude, l.Longitude) {
+			locations = append(locations, l)
+			distances[l.ID] = haversineMeters(area.lat, area.lng, l.Latitude, l.Longitude)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if distances[locations[i].ID] != distances[locations[j].ID] {
+			return distances[locations[i].ID] < distances[locations[j].ID]
+		}
+		return locations[i].ID < locations[j].ID
+	})
+	return locations, nil
+}
+
+// GetCommunityServiceArea godoc
+// @Summary Get the service area of a community
+// @Description Returns a GeoJSON FeatureCollection whose first feature is a polygon approximating the geodesic circle of the given distance around the community location, split into a MultiPolygon along the antimeridian, followed by a Point feature for every location inside it, nearest first
+// @Tags Community
+// @Produce application/geo+json
+// @Param id path string true "Community ID"
+// @Param distance query number true "Radius of the service area in meters"
+// @Param segments query int false "Number of polygon vertices, defaults to the configured segment count"
+// @Param X-API-Key header string false "Privileged API key, private locations are placed by their obfuscated position without one"
+// @Success 200 {object} GeoJSONFeatureCollection
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Item not found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/community/{id}/service-area [get]
+func GetCommunityServiceArea(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	// Validate the distance
+	maxDistance := configFloat("ServiceArea.MaxDistance", defaultServiceAreaMaxDistance)
+	distance, err := strconv.ParseFloat(r.URL.Query().Get("distance"), 64)
+	if err != nil || !(distance > 0) || distance > maxDistance {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid distance: must be a number of meters above 0 and at most %v", maxDistance)
+		return
+	}
+
+	// Validate the segment count
+	segments := config.GetInt("ServiceArea.Segments")
+	if segments <= 0 {
+		segments = defaultServiceAreaSegments
+	}
+	maxSegments := config.GetInt("ServiceArea.MaxSegments")
+	if maxSegments <= 0 {
+		maxSegments = defaultServiceAreaMaxSegments
+	}
+	if value := r.URL.Query().Get("segments"); value != "" {
+		segments, err = strconv.Atoi(value)
+		if err != nil || segments < minServiceAreaSegments || segments > maxSegments {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid segments: must be an integer from %d to %d", minServiceAreaSegments, maxSegments)
+			return
+		}
+	}
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context, keeping the audience of the request
+	ctx, cancel := context.WithTimeout(WithPrivilegedAudience(context.Background(), isPrivileged(r.Context())), 10*time.Second)
+	defer cancel()
+
+	// Find the community
+	var community Community
+	err = client.Database("geolocapi").Collection("communities").FindOne(ctx, bson.M{"id": id}).Decode(&community)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Item not found"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error retrieving community: %v", err)
+		return
+	}
+
+	// Buffer the community location the caller may see, centring the area on a private location
+	// would reveal its exact position
+	obfuscateCommunity(ctx, &community)
+	area, err := newServiceArea(community.Location.Latitude, community.Location.Longitude, distance, segments)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid distance: %v", err)
+		return
+	}
+	geometry, err := area.geometry()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error converting service area: %v", err)
+		return
+	}
+
+	// Find the locations inside it
+	locations, err := serviceAreaLocations(ctx, area)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error retrieving locations: %v", err)
+		return
+	}
+
+	// Convert them to features, the service area first
+	features := []GeoJSONFeature{{
+		Type:     "Feature",
+		ID:       community.ID,
+		Geometry: geometry,
+		Properties: map[string]interface{}{
+			"communityId": community.ID,
+			"name":        community.Name,
+			"distance":    distance,
+			"segments":    segments,
+			"locations":   len(locations),
+		},
+	}}
+	for _, l := range locations {
+		feature, err := locationFeature(l)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Error converting location %v: %v", l.ID, err)
+			return
+		}
+		feature.Properties["distance"] = math.Round(haversineMeters(area.lat, area.lng, l.Latitude, l.Longitude)*100) / 100
+		features = append(features, feature)
+	}
+
+	writeFeatureCollection(w, features)
+}
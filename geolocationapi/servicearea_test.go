@@ -0,0 +1,77 @@
+package geolocationapi
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestNewServiceArea(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		distance float64
+		segments int
+		wantErr  bool
+	}{
+		{"city", 52.52, 13.40, 5000, 32, false},
+		{"across the antimeridian", -16.5, 179.9, 50000, 64, false},
+		{"reaching a pole", 89.9, 0, 50000, 32, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			area, err := newServiceArea(tt.lat, tt.lng, tt.distance, tt.segments)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newServiceArea error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(area.ring) != tt.segments+1 {
+				t.Errorf("ring has %d positions, want %d", len(area.ring), tt.segments+1)
+			}
+			for _, position := range area.ring {
+				if d := haversineMeters(tt.lat, tt.lng, position[1], position[0]); math.Abs(d-tt.distance) > 1 {
+					t.Errorf("vertex %v is %v m from the centre, want %v", position, d, tt.distance)
+				}
+			}
+			if !area.contains(tt.lat, tt.lng) {
+				t.Error("the area does not contain its centre")
+			}
+			if lat, lng := destinationPoint(tt.lat, tt.lng, 45, tt.distance*1.1); area.contains(lat, normalizeLongitude(lng)) {
+				t.Errorf("the area contains %v,%v beyond its distance", lat, lng)
+			}
+		})
+	}
+}
+
+func TestServiceAreaLocationsFindsObfuscatedPositions(t *testing.T) {
+	// A private location whose blurred position is the centre of an area too small to reach its exact one
+	home := Location{ID: "home", Name: "Home", Latitude: 52.5412, Longitude: 13.3711, Privacy: PrivacyCity}
+	blurred := home
+	obfuscateLocation(context.Background(), &blurred)
+	offset := haversineMeters(home.Latitude, home.Longitude, blurred.Latitude, blurred.Longitude)
+	if offset < 100 {
+		t.Fatalf("the blurred position is only %v m away, pick another position", offset)
+	}
+	area, err := newServiceArea(blurred.Latitude, blurred.Longitude, offset/2, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := &locationSpatialIndex{boxes: map[string]BoundingBox{}, ready: true}
+	index.upsert(home)
+	previous := locationIndex
+	locationIndex = index
+	defer func() { locationIndex = previous }()
+
+	for _, privileged := range []bool{false, true} {
+		locations, err := serviceAreaLocations(WithPrivilegedAudience(context.Background(), privileged), area)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := len(locations) == 1; found == privileged {
+			t.Errorf("privileged %v: found the location = %v", privileged, found)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package geolocationapi
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Track simplification algorithms
+const (
+	SimplifyDouglasPeucker = "douglas-peucker"
+	SimplifyVisvalingam    = "visvalingam"
+)
+
+// planarPoint is a point projected to meters on a plane tangent near the track
+type planarPoint struct {
+	x, y float64
+}
+
+// projectTrackPoints projects points onto an equirectangular plane centred on the first point,
+// which keeps distances accurate to well under a percent over the length of a walking route
+func projectTrackPoints(points []TrackPoint) []planarPoint {
+	projected := make([]planarPoint, len(points))
+	if len(points) == 0 {
+		return projected
+	}
+	originLat, originLng := points[0].Latitude, points[0].Longitude
+	scale := math.Cos(originLat * math.Pi / 180)
+	for i, p := range points {
+		dLng := math.Remainder(p.Longitude-originLng, 360)
+		projected[i] = planarPoint{
+			x: dLng * math.Pi / 180 * earthRadiusMeters * scale,
+			y: (p.Latitude - originLat) * math.Pi / 180 * earthRadiusMeters,
+		}
+	}
+	return projected
+}
+
+// simplifyTrack keeps the points needed to stay within tolerance meters of the original line,
+// for Visvalingam the tolerance is turned into the minimum triangle area tolerance²
+func simplifyTrack(points []TrackPoint, tolerance float64, algorithm string) []TrackPoint {
+	if len(points) < 3 || tolerance <= 0 {
+		return points
+	}
+
+	var keep []bool
+	if algorithm == SimplifyVisvalingam {
+		keep = visvalingam(projectTrackPoints(points), tolerance*tolerance)
+	} else {
+		keep = douglasPeucker(projectTrackPoints(points), tolerance)
+	}
+
+	simplified := make([]TrackPoint, 0, len(points))
+	for i, p := range points {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// douglasPeucker marks the points kept by the Ramer-Douglas-Peucker algorithm
+func douglasPeucker(points []planarPoint, tolerance float64) []bool {
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	// Walk the segments with an explicit stack so long tracks cannot overflow the call stack
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := span[0], span[1]
+
+		farthest, maxDistance := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(points[i], points[first], points[last]); d > maxDistance {
+				farthest, maxDistance = i, d
+			}
+		}
+		if farthest < 0 {
+			continue
+		}
+		keep[farthest] = true
+		stack = append(stack, [2]int{first, farthest}, [2]int{farthest, last})
+	}
+	return keep
+}
+
+// segmentDistance returns the distance from p to the segment a-b
+func segmentDistance(p, a, b planarPoint) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p.x-a.x, p.y-a.y)
+	}
+	t := ((p.x-a.x)*dx + (p.y-a.y)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.x-(a.x+t*dx), p.y-(a.y+t*dy))
+}
+
+// triangleArea returns the area of the triangle a, b, c
+func triangleArea(a, b, c planarPoint) float64 {
+	return math.Abs((b.x-a.x)*(c.y-a.y)-(c.x-a.x)*(b.y-a.y)) / 2
+}
+
+// visvalingam marks the points kept by the Visvalingam-Whyatt algorithm, repeatedly dropping the
+// point whose triangle with its neighbours is smallest until every remaining triangle reaches minArea
+func visvalingam(points []planarPoint, minArea float64) []bool {
+	n := len(points)
+	keep := make([]bool, n)
+	prev := make([]int, n)
+	next := make([]int, n)
+	version := make([]int, n)
+	for i := range points {
+		keep[i] = true
+		prev[i], next[i] = i-1, i+1
+	}
+
+	queue := &visvalingamQueue{}
+	for i := 1; i < n-1; i++ {
+		heap.Push(queue, visvalingamItem{index: i, area: triangleArea(points[i-1], points[i], points[i+1])})
+	}
+
+	// The area of a removed point carries over so later removals never look cheaper than earlier ones
+	removedArea := 0.0
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(visvalingamItem)
+		if !keep[item.index] || item.version != version[item.index] {
+			continue
+		}
+		if item.area >= minArea {
+			break
+		}
+		removedArea = math.Max(removedArea, item.area)
+
+		i := item.index
+		keep[i] = false
+		p, q := prev[i], next[i]
+		next[p], prev[q] = q, p
+		for _, j := range []int{p, q} {
+			if j <= 0 || j >= n-1 {
+				continue
+			}
+			version[j]++
+			area := math.Max(removedArea, triangleArea(points[prev[j]], points[j], points[next[j]]))
+			heap.Push(queue, visvalingamItem{index: j, area: area, version: version[j]})
+		}
+	}
+	return keep
+}
+
+// visvalingamItem is a point waiting for removal, stale entries are skipped by version
+type visvalingamItem struct {
+	index   int
+	area    float64
+	version int
+}
+
+// visvalingamQueue is a min-heap ordered by effective area
+type visvalingamQueue []visvalingamItem
+
+func (q visvalingamQueue) Len() int            { return len(q) }
+func (q visvalingamQueue) Less(i, j int) bool  { return q[i].area < q[j].area }
+func (q visvalingamQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *visvalingamQueue) Push(x interface{}) { *q = append(*q, x.(visvalingamItem)) }
+func (q *visvalingamQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
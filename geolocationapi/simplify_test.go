@@ -0,0 +1,89 @@
+package geolocationapi
+
+import (
+	"fmt"
+	"testing"
+)
+
+// zigzagLine is a planar line whose reduced forms are worked out by hand in the tests below
+var zigzagLine = []planarPoint{{0, 0}, {10, 1}, {20, 0}, {30, 10}, {40, 0}}
+
+func TestDouglasPeucker(t *testing.T) {
+	tests := []struct {
+		name      string
+		points    []planarPoint
+		tolerance float64
+		want      []bool
+	}{
+		{"two points", []planarPoint{{0, 0}, {10, 0}}, 1, []bool{true, true}},
+		{"collinear", []planarPoint{{0, 0}, {10, 0}, {20, 0}, {30, 0}}, 0.5, []bool{true, false, false, true}},
+		{"zero tolerance keeps every bend", zigzagLine, 0, []bool{true, true, true, true, true}},
+		// (30,10) is 10 m from the chord, then (20,0) is 2.2 m from (0,0)-(30,10) and (10,1) 1 m from (0,0)-(20,0)
+		{"known reduction", zigzagLine, 2, []bool{true, false, true, true, true}},
+		{"large tolerance", zigzagLine, 20, []bool{true, false, false, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := douglasPeucker(tt.points, tt.tolerance); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("douglasPeucker() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisvalingam(t *testing.T) {
+	tests := []struct {
+		name    string
+		points  []planarPoint
+		minArea float64
+		want    []bool
+	}{
+		{"two points", []planarPoint{{0, 0}, {10, 0}}, 1, []bool{true, true}},
+		{"collinear", []planarPoint{{0, 0}, {10, 0}, {20, 0}, {30, 0}}, 0.25, []bool{true, false, false, true}},
+		{"zero area keeps every bend", zigzagLine, 0, []bool{true, true, true, true, true}},
+		// The triangle areas are 10, 55 and 100, dropping (10,1) raises the area of (20,0) to 100
+		{"known reduction", zigzagLine, 60, []bool{true, false, true, true, true}},
+		// Dropping (20,0) next raises the area of (30,10) to 200
+		{"effective area carries over", zigzagLine, 150, []bool{true, false, false, true, true}},
+		{"large area", zigzagLine, 1000, []bool{true, false, false, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := visvalingam(tt.points, tt.minArea); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("visvalingam() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimplifyTrack(t *testing.T) {
+	// A meridian projects to a straight line, the bend is about 70 m east of it
+	meridian := []TrackPoint{{Latitude: 52.50, Longitude: 13.4}, {Latitude: 52.51, Longitude: 13.4}, {Latitude: 52.52, Longitude: 13.4}, {Latitude: 52.53, Longitude: 13.4}}
+	bend := []TrackPoint{{Latitude: 52.50, Longitude: 13.4}, {Latitude: 52.51, Longitude: 13.401}, {Latitude: 52.52, Longitude: 13.4}}
+	tests := []struct {
+		name      string
+		points    []TrackPoint
+		tolerance float64
+		want      int
+	}{
+		{"two points", meridian[:2], 10, 2},
+		{"zero tolerance", meridian, 0, 4},
+		{"negative tolerance", meridian, -1, 4},
+		{"collinear", meridian, 1, 2},
+		{"bend above the tolerance", bend, 50, 3},
+		{"bend below the tolerance", bend, 300, 2},
+	}
+	for _, tt := range tests {
+		for _, algorithm := range []string{SimplifyDouglasPeucker, SimplifyVisvalingam} {
+			t.Run(tt.name+" "+algorithm, func(t *testing.T) {
+				got := simplifyTrack(tt.points, tt.tolerance, algorithm)
+				if len(got) != tt.want {
+					t.Fatalf("simplifyTrack() kept %d points, want %d", len(got), tt.want)
+				}
+				if got[0] != tt.points[0] || got[len(got)-1] != tt.points[len(tt.points)-1] {
+					t.Errorf("simplifyTrack() dropped an end point: %v", got)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package geolocationapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Location join report formats
+const (
+	ReportFormatJSON = "json"
+	ReportFormatCSV  = "csv"
+)
+
+// reportContentTypes are the media types of the report formats
+var reportContentTypes = map[string]string{
+	ReportFormatJSON: "application/json",
+	ReportFormatCSV:  "text/csv",
+}
+
+// Zones a location join matched locations against
+const (
+	JoinZoneBoundary = "boundary"
+	JoinZoneRadius   = "radius"
+)
+
+// CommunityLocations lists the locations inside the area of one community
+type CommunityLocations struct {
+	CommunityID string `json:"communityId"`
+	Name        string `json:"name"`
+	// Zone is boundary, or radius when the community has no boundary and Radius meters around its location is used
+	Zone        string   `json:"zone"`
+	Radius      float64  `json:"radius,omitempty"`
+	Count       int      `json:"count"`
+	LocationIDs []string `json:"locationIds"`
+}
+
+// UnassignedLocations lists the locations outside every community area
+type UnassignedLocations struct {
+	Count       int      `json:"count"`
+	LocationIDs []string `json:"locationIds"`
+}
+
+// LocationJoinReport is the result of joining every location against the community areas, a location
+// inside several areas is listed under each of them
+type LocationJoinReport struct {
+	GeneratedAt time.Time            `json:"generatedAt"`
+	Locations   int                  `json:"locations"`
+	Assigned    int                  `json:"assigned"`
+	Communities []CommunityLocations `json:"communities"`
+	Unassigned  UnassignedLocations  `json:"unassigned"`
+}
+
+// joinLocationsToCommunities matches every location against the community geofences, private
+// locations are matched by the position the audience of ctx may see
+func joinLocationsToCommunities(ctx context.Context) (*LocationJoinReport, error) {
+	communities, err := loadAllCommunities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(communities, func(a, b int) bool { return communities[a].ID < communities[b].ID })
+
+	// Index the community areas by their bounding boxes
+	report := &LocationJoinReport{GeneratedAt: time.Now().UTC(), Communities: make([]CommunityLocations, len(communities))}
+	fences := make([]geofence, len(communities))
+	ids := make([]string, len(communities))
+	boxes := make([]BoundingBox, len(communities))
+	items := make([]int, len(communities))
+	for i, c := range communities {
+		fences[i] = communityGeofence(c)
+		report.Communities[i] = CommunityLocations{CommunityID: c.ID, Name: c.Name, Zone: JoinZoneBoundary, LocationIDs: []string{}}
+		if fences[i].boundary == nil {
+			report.Communities[i].Zone = JoinZoneRadius
+			report.Communities[i].Radius = fences[i].radius
+		}
+		ids[i], boxes[i], items[i] = c.ID, fences[i].bounds(), i
+	}
+	var tree rtree[int]
+	tree.Load(ids, boxes, items)
+
+	// Stream the locations, only the fields needed to place them are read
+	if client == nil {
+		return nil, errors.New("MongoDB client is not initialized")
+	}
+	projection := bson.M{"id": 1, "latitude": 1, "longitude": 1, "privacy": 1}
+	cursor, err := client.Database("geolocapi").Collection("locations").Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	report.Unassigned.LocationIDs = []string{}
+	for cursor.Next(ctx) {
+		var l Location
+		if err := cursor.Decode(&l); err != nil {
+			return nil, err
+		}
+		obfuscateLocation(ctx, &l)
+		report.Locations++
+
+		assigned := false
+		tree.Search(pointBBox(l.Latitude, l.Longitude), func(i int) bool {
+			if fences[i].contains(l.Latitude, l.Longitude) {
+				report.Communities[i].LocationIDs = append(report.Communities[i].LocationIDs, l.ID)
+				assigned = true
+			}
+			return true
+		})
+		if assigned {
+			report.Assigned++
+		} else {
+			report.Unassigned.LocationIDs = append(report.Unassigned.LocationIDs, l.ID)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range report.Communities {
+		sort.Strings(report.Communities[i].LocationIDs)
+		report.Communities[i].Count = len(report.Communities[i].LocationIDs)
+	}
+	sort.Strings(report.Unassigned.LocationIDs)
+	report.Unassigned.Count = len(report.Unassigned.LocationIDs)
+	return report, nil
+}
+
+// WriteLocationJoinReport joins every location against the community areas and writes the report as
+// JSON or CSV, private locations are obfuscated unless ctx was marked with WithPrivilegedAudience
+func WriteLocationJoinReport(ctx context.Context, w io.Writer, format string) error {
+	if _, ok := reportContentTypes[format]; !ok {
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	report, err := joinLocationsToCommunities(ctx)
+	if err != nil {
+		return err
+	}
+	return writeLocationJoinReport(w, report, format)
+}
+
+// writeLocationJoinReport streams a report, one community at a time
+func writeLocationJoinReport(w io.Writer, report *LocationJoinReport, format string) error {
+	if format == ReportFormatCSV {
+		return writeLocationJoinCSV(w, report)
+	}
+	return writeLocationJoinJSON(w, report)
+}
+
+// writeLocationJoinJSON writes a report as one JSON object, encoding one community at a time
+func writeLocationJoinJSON(w io.Writer, report *LocationJoinReport) error {
+	buffered := bufio.NewWriter(w)
+	generatedAt, err := json.Marshal(report.GeneratedAt)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(buffered, `{"generatedAt":%s,"locations":%d,"assigned":%d,"communities":[`, generatedAt, report.Locations, report.Assigned)
+	for i, community := range report.Communities {
+		if i > 0 {
+			buffered.WriteByte(',')
+		}
+		data, err := json.Marshal(community)
+		if err != nil {
+			return err
+		}
+		buffered.Write(data)
+	}
+	unassigned, err := json.Marshal(report.Unassigned)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(buffered, `],"unassigned":%s}`+"\n", unassigned)
+	return buffered.Flush()
+}
+
+// writeLocationJoinCSV writes a row per community with its location ids separated by spaces, and a
+// last row with an empty community id and the unassigned zone for the locations outside every area
+func writeLocationJoinCSV(w io.Writer, report *LocationJoinReport) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"communityId", "name", "zone", "radius", "count", "locationIds"})
+	for _, community := range report.Communities {
+		radius := ""
+		if community.Zone == JoinZoneRadius {
+			radius = strconv.FormatFloat(community.Radius, 'f', -1, 64)
+		}
+		writer.Write([]string{community.CommunityID, community.Name, community.Zone, radius,
+			strconv.Itoa(community.Count), strings.Join(community.LocationIDs, " ")})
+	}
+	writer.Write([]string{"", "", "unassigned", "", strconv.Itoa(report.Unassigned.Count), strings.Join(report.Unassigned.LocationIDs, " ")})
+	writer.Flush()
+	return writer.Error()
+}
+
+// GetLocationJoinReport godoc
+// @Summary Report which locations fall inside each community area
+// @Description Joins every location against the community boundaries, or the radius around the community location when there is no boundary, and streams the location ids and counts per community and the unassigned locations
+// @Tags Community
+// @Produce json,text/csv
+// @Param format query string false "json (default) or csv"
+// @Param X-API-Key header string false "Privileged API key, private locations are placed by their obfuscated position without one"
+// @Success 200 {object} LocationJoinReport
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/community/location-report [get]
+func GetLocationJoinReport(w http.ResponseWriter, r *http.Request) {
+	// Validate the requested format
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = ReportFormatJSON
+	}
+	if _, ok := reportContentTypes[format]; !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid format: must be %s or %s", ReportFormatJSON, ReportFormatCSV)
+		return
+	}
+
+	// Get the MongoDB context, keeping the audience of the request
+	ctx, cancel := context.WithTimeout(WithPrivilegedAudience(context.Background(), isPrivileged(r.Context())), time.Minute)
+	defer cancel()
+
+	// Join before writing anything so errors can still change the status code
+	report, err := joinLocationsToCommunities(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error joining locations to communities: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", reportContentTypes[format])
+	if format == ReportFormatCSV {
+		w.Header().Set("Content-Disposition", `attachment; filename="location-report.csv"`)
+	}
+	// Stream the report
+	writeLocationJoinReport(w, report, format)
+}
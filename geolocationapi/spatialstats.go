@@ -0,0 +1,323 @@
+package geolocationapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LatLng is a position in decimal degrees
+type LatLng struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// MemberDistance is a member's home location and its distance from the community location
+type MemberDistance struct {
+	MemberID   string  `json:"memberId"`
+	LocationID string  `json:"locationId"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Distance   float64 `json:"distance"`
+}
+
+// CommunitySpatialStats describes where the members of a community live, derived from their home locations
+type CommunitySpatialStats struct {
+	CommunityID string `json:"communityId"`
+	// Members counts every membership, LocatedMembers those with a home location that exists
+	Members        int `json:"members"`
+	LocatedMembers int `json:"locatedMembers"`
+	// Centroid is the spherical mean of the home locations
+	Centroid *LatLng `json:"centroid,omitempty"`
+	// ConvexHull is omitted when fewer than three home locations are distinct and not collinear
+	ConvexHull *Polygon `json:"convexHull,omitempty"`
+	// BoundingBox has a west edge greater than the east edge when it crosses the antimeridian
+	BoundingBox *BoundingBox `json:"boundingBox,omitempty"`
+	// AverageDistance is the mean distance in meters between the community location and the home locations
+	AverageDistance float64         `json:"averageDistance"`
+	FarthestMember  *MemberDistance `json:"farthestMember,omitempty"`
+	ComputedAt      time.Time       `json:"computedAt"`
+}
+
+// errCommunityNotFound is returned when statistics are requested for a community that does not exist
+var errCommunityNotFound = errors.New("community not found")
+
+// spatialStatsCache holds computed statistics per community until memberships, locations or communities change
+type spatialStatsCache struct {
+	mu    sync.Mutex
+	stats map[string]CommunitySpatialStats
+}
+
+var communityStats = &spatialStatsCache{}
+
+// get returns the statistics of a community, computing them from the database when needed. Callers
+// without elevated rights get statistics of the obfuscated home locations, cached separately.
+func (c *spatialStatsCache) get(ctx context.Context, communityID string) (CommunitySpatialStats, error) {
+	key := communityID
+	if isPrivileged(ctx) {
+		key += "\x00" + PrivacyExact
+	}
+	c.mu.Lock()
+	stats, ok := c.stats[key]
+	c.mu.Unlock()
+	if ok {
+		return stats, nil
+	}
+
+	stats, err := computeCommunitySpatialStats(ctx, communityID)
+	if err != nil {
+		return CommunitySpatialStats{}, err
+	}
+
+	c.mu.Lock()
+	if c.stats == nil {
+		c.stats = make(map[string]CommunitySpatialStats)
+	}
+	c.stats[key] = stats
+	c.mu.Unlock()
+	return stats, nil
+}
+
+// invalidate drops every cached community, a location can be the home of members of several communities
+func (c *spatialStatsCache) invalidate() {
+	c.mu.Lock()
+	c.stats = nil
+	c.mu.Unlock()
+}
+
+// computeCommunitySpatialStats loads a community, its memberships and their home locations
+func computeCommunitySpatialStats(ctx context.Context, communityID string) (CommunitySpatialStats, error) {
+	db := client.Database("geolocapi")
+
+	var community Community
+	err := db.Collection("communities").FindOne(ctx, bson.M{"id": communityID}).Decode(&community)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return CommunitySpatialStats{}, errCommunityNotFound
+		}
+		return CommunitySpatialStats{}, err
+	}
+	// Distances are measured from the community location the caller may see
+	obfuscateCommunity(ctx, &community)
+
+	cursor, err := db.Collection("memberships").Find(ctx, bson.M{"communityid": communityID})
+	if err != nil {
+		return CommunitySpatialStats{}, err
+	}
+	var memberships []Membership
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return CommunitySpatialStats{}, err
+	}
+
+	var locationIDs []string
+	for _, m := range memberships {
+		if m.HomeLocationID != "" {
+			locationIDs = append(locationIDs, m.HomeLocationID)
+		}
+	}
+	homes := make(map[string]Location, len(locationIDs))
+	if len(locationIDs) > 0 {
+		cursor, err := db.Collection("locations").Find(ctx, bson.M{"id": bson.M{"$in": locationIDs}})
+		if err != nil {
+			return CommunitySpatialStats{}, err
+		}
+		var locations []Location
+		if err := cursor.All(ctx, &locations); err != nil {
+			return CommunitySpatialStats{}, err
+		}
+		for _, l := range locations {
+			obfuscateLocation(ctx, &l)
+			homes[l.ID] = l
+		}
+	}
+
+	return communitySpatialStats(community, memberships, homes), nil
+}
+
+// communitySpatialStats derives the statistics of a community from its memberships and their home locations
+func communitySpatialStats(community Community, memberships []Membership, homes map[string]Location) CommunitySpatialStats {
+	stats := CommunitySpatialStats{CommunityID: community.ID, Members: len(memberships), ComputedAt: time.Now().UTC()}
+
+	var members []MemberDistance
+	for _, m := range memberships {
+		home, ok := homes[m.HomeLocationID]
+		if !ok {
+			continue
+		}
+		members = append(members, MemberDistance{
+			MemberID:   m.ID,
+			LocationID: home.ID,
+			Latitude:   home.Latitude,
+			Longitude:  home.Longitude,
+			Distance:   haversineMeters(community.Location.Latitude, community.Location.Longitude, home.Latitude, home.Longitude),
+		})
+	}
+	stats.LocatedMembers = len(members)
+	if len(members) == 0 {
+		return stats
+	}
+
+	// Average the positions as unit vectors so members either side of the antimeridian do not pull the centroid to 0°
+	var x, y, z, total float64
+	for i, m := range members {
+		phi := m.Latitude * math.Pi / 180
+		lambda := m.Longitude * math.Pi / 180
+		x += math.Cos(phi) * math.Cos(lambda)
+		y += math.Cos(phi) * math.Sin(lambda)
+		z += math.Sin(phi)
+		total += m.Distance
+		if stats.FarthestMember == nil || m.Distance > stats.FarthestMember.Distance {
+			stats.FarthestMember = &members[i]
+		}
+	}
+	centroid := LatLng{
+		Latitude:  math.Atan2(z, math.Hypot(x, y)) * 180 / math.Pi,
+		Longitude: math.Atan2(y, x) * 180 / math.Pi,
+	}
+	stats.Centroid = &centroid
+	stats.AverageDistance = total / float64(len(members))
+
+	// Measure longitudes relative to the centroid so the box and hull stay continuous across the antimeridian
+	points := make([]planarPoint, len(members))
+	box := BoundingBox{MinLng: math.Inf(1), MinLat: math.Inf(1), MaxLng: math.Inf(-1), MaxLat: math.Inf(-1)}
+	for i, m := range members {
+		offset := math.Remainder(m.Longitude-centroid.Longitude, 360)
+		points[i] = planarPoint{x: offset, y: m.Latitude}
+		box.Extend(m.Latitude, offset)
+	}
+	box.MinLng = normalizeLongitude(centroid.Longitude + box.MinLng)
+	box.MaxLng = normalizeLongitude(centroid.Longitude + box.MaxLng)
+	stats.BoundingBox = &box
+
+	if hull := convexHull(points); len(hull) >= 3 {
+		ring := make([][]float64, 0, len(hull)+1)
+		for _, p := range hull {
+			ring = append(ring, []float64{normalizeLongitude(centroid.Longitude + p.x), p.y})
+		}
+		ring = append(ring, ring[0])
+		stats.ConvexHull = &Polygon{Type: "Polygon", Coordinates: [][][]float64{ring}}
+	}
+	return stats
+}
+
+// normalizeLongitude wraps a longitude into [-180, 180]
+func normalizeLongitude(lng float64) float64 {
+	lng = math.Remainder(lng, 360)
+	if lng == -180 {
+		return 180
+	}
+	return lng
+}
+
+// convexHull returns the counter-clockwise hull of a set of points using Andrew's monotone chain,
+// collinear and duplicate points are left out
+func convexHull(points []planarPoint) []planarPoint {
+	sorted := append([]planarPoint(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].x != sorted[j].x {
+			return sorted[i].x < sorted[j].x
+		}
+		return sorted[i].y < sorted[j].y
+	})
+	if len(sorted) < 3 {
+		return sorted
+	}
+
+	cross := func(o, a, b planarPoint) float64 {
+		return (a.x-o.x)*(b.y-o.y) - (a.y-o.y)*(b.x-o.x)
+	}
+	hull := make([]planarPoint, 0, 2*len(sorted))
+	for _, p := range sorted {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	for i, lower := len(sorted)-2, len(hull)+1; i >= 0; i-- {
+		p := sorted[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	// The last point repeats the first
+	return hull[:len(hull)-1]
+}
+
+// checkHomeLocation verifies the home location a membership references exists
+func checkHomeLocation(ctx context.Context, locationID string) error {
+	if locationID == "" {
+		return nil
+	}
+	count, err := client.Database("geolocapi").Collection("locations").CountDocuments(ctx, bson.M{"id": locationID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("home location %q does not exist", locationID)
+	}
+	return nil
+}
+
+// GetCommunitySpatialStats godoc
+// @Summary Get spatial statistics of a community
+// @Description Returns the centroid, convex hull and bounding box of the members' home locations, with the average and largest distance from the community location
+// @Tags Community
+// @Accept json
+// @Produce json
+// @Param id path string true "Community ID"
+// @Param X-API-Key header string false "Privileged API key, private locations are obfuscated without one"
+// @Success 200 {object} CommunitySpatialStats
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/community/{id}/spatial-stats [get]
+func GetCommunitySpatialStats(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context, keeping the audience of the request
+	ctx, cancel := context.WithTimeout(WithPrivilegedAudience(context.Background(), isPrivileged(r.Context())), 10*time.Second)
+	defer cancel()
+
+	// Get the statistics, computing them when they are not cached
+	stats, err := communityStats.get(ctx, id)
+	if err != nil {
+		if errors.Is(err, errCommunityNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Item not found"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error computing spatial statistics: %v", err)
+		return
+	}
+
+	// Marshal the statistics to JSON
+	jsonData, err := json.Marshal(stats)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
@@ -0,0 +1,455 @@
+package geolocationapi
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"temprest/config"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Tile layers served by GetTile
+const (
+	TileLayerLocations   = "locations"
+	TileLayerCommunities = "communities"
+)
+
+// Tile defaults used when the Tiles config section is missing
+const (
+	defaultTileExtent    = 4096
+	defaultTileBuffer    = 64
+	defaultTileMaxZoom   = 22
+	defaultTileCacheSize = 1024
+	defaultTileMaxAge    = 5 * time.Minute
+)
+
+// defaultTileAttributes are the properties encoded when a layer has no Attributes configured
+var defaultTileAttributes = []string{"id", "name"}
+
+// tileOptions configures tile generation
+type tileOptions struct {
+	extent  int
+	buffer  int
+	maxZoom int
+	maxAge  time.Duration
+}
+
+// loadTileOptions reads the tile options from config
+func loadTileOptions() tileOptions {
+	opts := tileOptions{
+		extent:  config.GetInt("Tiles.Extent"),
+		buffer:  config.GetInt("Tiles.Buffer"),
+		maxZoom: config.GetInt("Tiles.MaxZoom"),
+		maxAge:  config.GetDuration("Tiles.MaxAge"),
+	}
+	if opts.extent <= 0 {
+		opts.extent = defaultTileExtent
+	}
+	if opts.buffer < 0 {
+		opts.buffer = defaultTileBuffer
+	}
+	if opts.maxZoom <= 0 {
+		opts.maxZoom = defaultTileMaxZoom
+	}
+	if opts.maxAge <= 0 {
+		opts.maxAge = defaultTileMaxAge
+	}
+	return opts
+}
+
+// tileLayerAttributes returns the configured attribute names of a layer
+func tileLayerAttributes(layer string) []string {
+	attributes := config.GetStringSlice("Tiles.Layers." + layer + ".Attributes")
+	if len(attributes) == 0 {
+		return defaultTileAttributes
+	}
+	return attributes
+}
+
+// tileAddress identifies a tile of a layer as seen by an audience, tiles built for callers without
+// elevated rights hold obfuscated private locations
+type tileAddress struct {
+	layer      string
+	z, x, y    int
+	privileged bool
+}
+
+func (t tileAddress) String() string {
+	return fmt.Sprintf("%s/%d/%d/%d", t.layer, t.z, t.x, t.y)
+}
+
+// tileProjector converts positions to the coordinate space of one tile
+type tileProjector struct {
+	scale  float64
+	x, y   float64
+	extent float64
+}
+
+func newTileProjector(t tileAddress, extent int) tileProjector {
+	return tileProjector{scale: math.Pow(2, float64(t.z)), x: float64(t.x), y: float64(t.y), extent: float64(extent)}
+}
+
+// project returns unrounded tile coordinates of a position
+func (p tileProjector) project(lat, lng float64) (float64, float64) {
+	return (mercatorX(lng)*p.scale - p.x) * p.extent, (mercatorY(lat)*p.scale - p.y) * p.extent
+}
+
+// bounds returns the area of the tile including the buffer in degrees
+func (p tileProjector) bounds(buffer int) BoundingBox {
+	b := float64(buffer) / p.extent
+	return BoundingBox{
+		MinLng: mercatorLng((p.x - b) / p.scale),
+		MaxLng: mercatorLng((p.x + 1 + b) / p.scale),
+		MinLat: mercatorLat((p.y + 1 + b) / p.scale),
+		MaxLat: mercatorLat((p.y - b) / p.scale),
+	}
+}
+
+// buildTile encodes the features of a layer that fall inside a tile
+func buildTile(ctx context.Context, t tileAddress, opts tileOptions) ([]byte, error) {
+	projector := newTileProjector(t, opts.extent)
+	bounds := projector.bounds(opts.buffer)
+	attributes := tileLayerAttributes(t.layer)
+	layer := mvtLayer{name: t.layer, extent: uint32(opts.extent)}
+
+	switch t.layer {
+	case TileLayerLocations:
+		// Private locations are placed by the position the audience of ctx may see
+		locations, err := findLocationsInBBox(ctx, privacySearchBBox(ctx, bounds))
+		if err != nil {
+			return nil, err
+		}
+		obfuscateLocations(ctx, locations)
+		for _, l := range locations {
+			if !bounds.Contains(l.Latitude, l.Longitude) {
+				continue
+			}
+			x, y := projector.project(l.Latitude, l.Longitude)
+			layer.features = append(layer.features, mvtFeature{
+				geomType:   mvtGeomPoint,
+				points:     []mvtPoint{{X: int64(math.Round(x)), Y: int64(math.Round(y))}},
+				attributes: tileAttributes(l, attributes),
+			})
+		}
+
+	case TileLayerCommunities:
+		communities, err := loadAllCommunities(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range communities {
+			// Communities without a boundary are placed by the position the audience of ctx may see
+			obfuscateCommunity(ctx, &c)
+			feature, ok := communityTileFeature(c, projector, bounds, opts)
+			if !ok {
+				continue
+			}
+			feature.attributes = tileAttributes(c, attributes)
+			layer.features = append(layer.features, feature)
+		}
+	}
+	return encodeMVTTile(layer), nil
+}
+
+// findLocationsInBBox queries the locations whose coordinates fall inside a box
+func findLocationsInBBox(ctx context.Context, box BoundingBox) ([]Location, error) {
+	if client == nil {
+		return nil, fmt.Errorf("MongoDB client is not initialized")
+	}
+
+	filter := bson.M{
+		"latitude":  bson.M{"$gte": box.MinLat, "$lte": box.MaxLat},
+		"longitude": bson.M{"$gte": box.MinLng, "$lte": box.MaxLng},
+	}
+	cursor, err := client.Database("geolocapi").Collection("locations").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var locations []Location
+	if err := cursor.All(ctx, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// communityTileFeature returns the boundary polygon of a community clipped to the tile,
+// or its location as a point when it has no boundary
+func communityTileFeature(c Community, projector tileProjector, bounds BoundingBox, opts tileOptions) (mvtFeature, bool) {
+	if c.Boundary == nil || len(c.Boundary.Coordinates) == 0 {
+		if !bounds.Contains(c.Location.Latitude, c.Location.Longitude) {
+			return mvtFeature{}, false
+		}
+		x, y := projector.project(c.Location.Latitude, c.Location.Longitude)
+		return mvtFeature{geomType: mvtGeomPoint, points: []mvtPoint{{X: int64(math.Round(x)), Y: int64(math.Round(y))}}}, true
+	}
+
+	min, max := float64(-opts.buffer), float64(opts.extent+opts.buffer)
+	var rings [][]mvtPoint
+	for i, ring := range c.Boundary.Coordinates {
+		projected := make([][2]float64, 0, len(ring))
+		for _, position := range ring {
+			x, y := projector.project(position[1], position[0])
+			projected = append(projected, [2]float64{x, y})
+		}
+
+		tileRing := roundTileRing(clipRing(projected, min, max))
+		if len(tileRing) < 3 {
+			if i == 0 {
+				// Exterior ring is outside the tile
+				return mvtFeature{}, false
+			}
+			continue
+		}
+
+		// Exterior rings have positive area in tile coordinates, holes negative
+		area := mvtRingArea(tileRing)
+		if area == 0 {
+			continue
+		}
+		if i == 0 && area < 0 || i > 0 && area > 0 {
+			for l, r := 0, len(tileRing)-1; l < r; l, r = l+1, r-1 {
+				tileRing[l], tileRing[r] = tileRing[r], tileRing[l]
+			}
+		}
+		rings = append(rings, tileRing)
+	}
+	if len(rings) == 0 {
+		return mvtFeature{}, false
+	}
+	return mvtFeature{geomType: mvtGeomPolygon, rings: rings}, true
+}
+
+// clipRing clips a ring against the square [min, max] with the Sutherland-Hodgman algorithm
+func clipRing(ring [][2]float64, min, max float64) [][2]float64 {
+	type edge struct {
+		inside func(p [2]float64) bool
+		cross  func(a, b [2]float64) [2]float64
+	}
+	lerp := func(a, b [2]float64, t float64) [2]float64 {
+		return [2]float64{a[0] + (b[0]-a[0])*t, a[1] + (b[1]-a[1])*t}
+	}
+	edges := []edge{
+		{func(p [2]float64) bool { return p[0] >= min }, func(a, b [2]float64) [2]float64 { return lerp(a, b, (min-a[0])/(b[0]-a[0])) }},
+		{func(p [2]float64) bool { return p[0] <= max }, func(a, b [2]float64) [2]float64 { return lerp(a, b, (max-a[0])/(b[0]-a[0])) }},
+		{func(p [2]float64) bool { return p[1] >= min }, func(a, b [2]float64) [2]float64 { return lerp(a, b, (min-a[1])/(b[1]-a[1])) }},
+		{func(p [2]float64) bool { return p[1] <= max }, func(a, b [2]float64) [2]float64 { return lerp(a, b, (max-a[1])/(b[1]-a[1])) }},
+	}
+
+	out := ring
+	for _, e := range edges {
+		if len(out) == 0 {
+			break
+		}
+		in := out
+		out = nil
+		prev := in[len(in)-1]
+		for _, p := range in {
+			if e.inside(p) {
+				if !e.inside(prev) {
+					out = append(out, e.cross(prev, p))
+				}
+				out = append(out, p)
+			} else if e.inside(prev) {
+				out = append(out, e.cross(prev, p))
+			}
+			prev = p
+		}
+	}
+	return out
+}
+
+// roundTileRing rounds a ring to integer tile coordinates, dropping repeated and closing positions
+func roundTileRing(ring [][2]float64) []mvtPoint {
+	points := make([]mvtPoint, 0, len(ring))
+	for _, p := range ring {
+		point := mvtPoint{X: int64(math.Round(p[0])), Y: int64(math.Round(p[1]))}
+		if len(points) > 0 && points[len(points)-1] == point {
+			continue
+		}
+		points = append(points, point)
+	}
+	if len(points) > 1 && points[0] == points[len(points)-1] {
+		points = points[:len(points)-1]
+	}
+	return points
+}
+
+// tileAttributes picks the configured properties from the JSON form of a record
+func tileAttributes(record interface{}, names []string) map[string]interface{} {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil
+	}
+
+	attributes := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if v, ok := all[name]; ok {
+			attributes[name] = v
+		}
+	}
+	return attributes
+}
+
+// tileCache is a least recently used cache of encoded tiles
+type tileCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[tileAddress]*list.Element
+}
+
+type tileCacheEntry struct {
+	address tileAddress
+	data    []byte
+	etag    string
+}
+
+var tiles = &tileCache{order: list.New(), entries: map[tileAddress]*list.Element{}}
+
+// get returns a cached tile and moves it to the front
+func (c *tileCache) get(t tileAddress) (*tileCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[t]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*tileCacheEntry), true
+}
+
+// put stores a tile, evicting the least recently used one when full
+func (c *tileCache) put(entry *tileCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity == 0 {
+		c.capacity = config.GetInt("Tiles.CacheSize")
+		if c.capacity <= 0 {
+			c.capacity = defaultTileCacheSize
+		}
+	}
+
+	if element, ok := c.entries[entry.address]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[entry.address] = c.order.PushFront(entry)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tileCacheEntry).address)
+	}
+}
+
+// invalidate drops every cached tile of a layer
+func (c *tileCache) invalidate(layer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for address, element := range c.entries {
+		if address.layer == layer {
+			c.order.Remove(element)
+			delete(c.entries, address)
+		}
+	}
+}
+
+// GetTile godoc
+// @Summary Get a Mapbox Vector Tile
+// @Description Encodes locations as points or community boundaries as polygons into a Mapbox Vector Tile
+// @Tags tiles
+// @Produce application/vnd.mapbox-vector-tile
+// @Param layer path string true "Layer name (locations or communities)"
+// @Param z path int true "Zoom level"
+// @Param x path int true "Tile column"
+// @Param y path int true "Tile row"
+// @Param X-API-Key header string false "Privileged API key, private locations are placed by their obfuscated position without one"
+// @Success 200 {file} binary "vector tile"
+// @Success 204 "Empty tile"
+// @Success 304 "Not Modified"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/tiles/{layer}/{z}/{x}/{y}.mvt [get]
+func GetTile(w http.ResponseWriter, r *http.Request) {
+	opts := loadTileOptions()
+
+	// Get the layer and tile address from the URL
+	layer := chi.URLParam(r, "layer")
+	if layer != TileLayerLocations && layer != TileLayerCommunities {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Unknown layer: %v", layer)
+		return
+	}
+	z, errZ := strconv.Atoi(chi.URLParam(r, "z"))
+	x, errX := strconv.Atoi(chi.URLParam(r, "x"))
+	y, errY := strconv.Atoi(chi.URLParam(r, "y"))
+	if errZ != nil || errX != nil || errY != nil || z < 0 || z > opts.maxZoom || x < 0 || y < 0 || x >= 1<<uint(z) || y >= 1<<uint(z) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid tile address")
+		return
+	}
+	address := tileAddress{layer: layer, z: z, x: x, y: y, privileged: isPrivileged(r.Context())}
+
+	// Build the tile unless it is cached
+	entry, ok := tiles.get(address)
+	if !ok {
+		ctx, cancel := context.WithTimeout(WithPrivilegedAudience(context.Background(), address.privileged), 10*time.Second)
+		defer cancel()
+
+		data, err := buildTile(ctx, address, opts)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Error building tile: %v", err)
+			return
+		}
+
+		hash := fnv.New64a()
+		hash.Write(data)
+		entry = &tileCacheEntry{address: address, data: data, etag: fmt.Sprintf(`"%x"`, hash.Sum64())}
+		tiles.put(entry)
+	}
+
+	// Set caching headers, shared caches must not hand exact private locations to other callers
+	cacheScope := "public"
+	if address.privileged {
+		cacheScope = "private"
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", cacheScope, int(opts.maxAge.Seconds())))
+	w.Header().Set("Vary", privacyKeyHeader)
+	w.Header().Set("ETag", entry.etag)
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimSpace(tag) == entry.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if len(entry.data) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Write the tile
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Write(entry.data)
+}
@@ -0,0 +1,166 @@
+package geolocationapi
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestClipRing(t *testing.T) {
+	square := func(min, max float64) [][2]float64 {
+		return [][2]float64{{min, min}, {max, min}, {max, max}, {min, max}}
+	}
+	tests := []struct {
+		name string
+		ring [][2]float64
+		// area is the absolute area of the clipped ring, zero when it is clipped away
+		area float64
+		want [2][2]float64
+	}{
+		{"inside", square(10, 20), 100, [2][2]float64{{10, 10}, {20, 20}}},
+		{"on the edges", square(0, 100), 10000, [2][2]float64{{0, 0}, {100, 100}}},
+		{"across one edge", square(90, 110), 100, [2][2]float64{{90, 90}, {100, 100}}},
+		{"across a corner", square(-10, 10), 100, [2][2]float64{{0, 0}, {10, 10}}},
+		{"covering the tile", square(-50, 150), 10000, [2][2]float64{{0, 0}, {100, 100}}},
+		{"outside", square(120, 130), 0, [2][2]float64{}},
+		{"triangle across two edges", [][2]float64{{50, 50}, {130, 50}, {50, 130}}, 2300, [2][2]float64{{50, 50}, {100, 100}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clipRing(tt.ring, 0, 100)
+			var area float64
+			min, max := [2]float64{math.Inf(1), math.Inf(1)}, [2]float64{math.Inf(-1), math.Inf(-1)}
+			for i, p := range got {
+				q := got[(i+1)%len(got)]
+				area += p[0]*q[1] - q[0]*p[1]
+				for axis := 0; axis < 2; axis++ {
+					min[axis] = math.Min(min[axis], p[axis])
+					max[axis] = math.Max(max[axis], p[axis])
+				}
+			}
+			if area = math.Abs(area) / 2; math.Abs(area-tt.area) > 1e-9 {
+				t.Errorf("clipped area = %v, want %v: %v", area, tt.area, got)
+			}
+			if tt.area > 0 && (min != tt.want[0] || max != tt.want[1]) {
+				t.Errorf("clipped extent = %v to %v, want %v to %v", min, max, tt.want[0], tt.want[1])
+			}
+		})
+	}
+}
+
+func TestCommunityTileFeature(t *testing.T) {
+	opts := tileOptions{extent: 4096, buffer: 64}
+	address := tileAddress{layer: TileLayerCommunities, z: 10, x: 550, y: 335}
+	projector := newTileProjector(address, opts.extent)
+	bounds := projector.bounds(opts.buffer)
+	// A position in the middle of the tile and offsets of a quarter tile in degrees
+	lat, lng := (bounds.MinLat+bounds.MaxLat)/2, (bounds.MinLng+bounds.MaxLng)/2
+	dLat, dLng := (bounds.MaxLat-bounds.MinLat)/4, (bounds.MaxLng-bounds.MinLng)/4
+	box := func(minLat, minLng, maxLat, maxLng float64) *Polygon {
+		// Boundaries are stored counter-clockwise, holes clockwise
+		return &Polygon{Coordinates: [][][]float64{{{minLng, minLat}, {maxLng, minLat}, {maxLng, maxLat}, {minLng, maxLat}, {minLng, minLat}}}}
+	}
+
+	tests := []struct {
+		name  string
+		c     Community
+		ok    bool
+		geom  int
+		rings int
+	}{
+		{"location inside", Community{Location: Location{Latitude: lat, Longitude: lng}}, true, mvtGeomPoint, 0},
+		{"location outside", Community{Location: Location{Latitude: lat + 10*dLat, Longitude: lng}}, false, 0, 0},
+		{"boundary inside", Community{Boundary: box(lat-dLat, lng-dLng, lat+dLat, lng+dLng)}, true, mvtGeomPolygon, 1},
+		{"boundary across the tile edge", Community{Boundary: box(lat-dLat, lng, lat+dLat, lng+4*dLng)}, true, mvtGeomPolygon, 1},
+		{"boundary outside", Community{Boundary: box(lat+5*dLat, lng, lat+6*dLat, lng+dLng)}, false, 0, 0},
+		{"boundary with a hole", Community{Boundary: &Polygon{Coordinates: append(box(lat-dLat, lng-dLng, lat+dLat, lng+dLng).Coordinates,
+			[][]float64{{lng - dLng/2, lat - dLat/2}, {lng - dLng/2, lat + dLat/2}, {lng + dLng/2, lat + dLat/2}, {lng + dLng/2, lat - dLat/2}, {lng - dLng/2, lat - dLat/2}})}},
+			true, mvtGeomPolygon, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feature, ok := communityTileFeature(tt.c, projector, bounds, opts)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if feature.geomType != tt.geom || len(feature.rings) != tt.rings {
+				t.Fatalf("feature is type %d with %d rings, want type %d with %d rings", feature.geomType, len(feature.rings), tt.geom, tt.rings)
+			}
+			for i, ring := range feature.rings {
+				// Exterior rings are positive in tile coordinates and holes negative, whatever the input winding
+				for _, p := range ring {
+					if p.X < -int64(opts.buffer) || p.X > int64(opts.extent+opts.buffer) || p.Y < -int64(opts.buffer) || p.Y > int64(opts.extent+opts.buffer) {
+						t.Errorf("ring %d point %v is outside the buffered tile", i, p)
+					}
+				}
+				if area := mvtRingArea(ring); (i == 0) != (area > 0) {
+					t.Errorf("ring %d has area %d", i, area)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTileCaching(t *testing.T) {
+	tile := func(privileged bool) tileAddress {
+		return tileAddress{layer: TileLayerLocations, z: 3, x: 4, y: 2, privileged: privileged}
+	}
+	// Cached tiles keep the handler away from the database
+	tiles.put(&tileCacheEntry{address: tile(false), data: []byte{0x1a, 0x00}, etag: `"public"`})
+	tiles.put(&tileCacheEntry{address: tile(true), data: []byte{0x1a, 0x01, 0x00}, etag: `"exact"`})
+	defer tiles.invalidate(TileLayerLocations)
+
+	tests := []struct {
+		name        string
+		privileged  bool
+		ifNoneMatch string
+		status      int
+		etag        string
+		cache       string
+	}{
+		{"first request", false, "", http.StatusOK, `"public"`, "public, max-age=300"},
+		{"revalidation", false, `"other", "public"`, http.StatusNotModified, `"public"`, "public, max-age=300"},
+		{"stale etag", false, `"exact"`, http.StatusOK, `"public"`, "public, max-age=300"},
+		{"privileged", true, "", http.StatusOK, `"exact"`, "private, max-age=300"},
+		{"privileged revalidation", true, `"exact"`, http.StatusNotModified, `"exact"`, "private, max-age=300"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeContext := chi.NewRouteContext()
+			for key, value := range map[string]string{"layer": TileLayerLocations, "z": "3", "x": "4", "y": "2"} {
+				routeContext.URLParams.Add(key, value)
+			}
+			ctx := context.WithValue(WithPrivilegedAudience(context.Background(), tt.privileged), chi.RouteCtxKey, routeContext)
+			r := httptest.NewRequest(http.MethodGet, "/geolocationapi/tiles/locations/3/4/2.mvt", nil).WithContext(ctx)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			GetTile(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("ETag"); got != tt.etag {
+				t.Errorf("ETag = %s, want %s", got, tt.etag)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.cache {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cache)
+			}
+			// Shared caches key tiles on the API key, they differ between audiences
+			if got := w.Header().Get("Vary"); got != privacyKeyHeader {
+				t.Errorf("Vary = %q, want %q", got, privacyKeyHeader)
+			}
+			if tt.status == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 response has a body of %d bytes", w.Body.Len())
+			}
+		})
+	}
+}
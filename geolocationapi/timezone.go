@@ -0,0 +1,267 @@
+package geolocationapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"temprest/config"
+	"temprest/logging"
+	"time"
+
+	// Embed the IANA database so offsets do not depend on the zoneinfo files of the host
+	_ "time/tzdata"
+)
+
+// TimeZoneResult is the IANA time zone of a position and its offset from UTC at a given time
+type TimeZoneResult struct {
+	TimeZone         string    `json:"timeZone"`
+	UTCOffset        string    `json:"utcOffset"`
+	UTCOffsetSeconds int       `json:"utcOffsetSeconds"`
+	Abbreviation     string    `json:"abbreviation"`
+	DST              bool      `json:"dst"`
+	LocalTime        time.Time `json:"localTime"`
+}
+
+// errTimeZonesNotConfigured is returned when Geocoder.TimeZonePath is not set
+var errTimeZonesNotConfigured = errors.New("time zone boundaries are not configured")
+
+// timeZoneArea is one polygon of a time zone, zones made of several polygons have one area each
+type timeZoneArea struct {
+	zone    string
+	polygon Polygon
+}
+
+// timeZoneIndex holds the time zone polygons in an R-tree of their bounding boxes
+type timeZoneIndex struct {
+	tree rtree[*timeZoneArea]
+}
+
+// timeZonesRetryInterval is how long a failed load is remembered before the boundaries are read
+// again, so a file fetched after the server started is picked up without a restart
+const timeZonesRetryInterval = time.Minute
+
+var (
+	timeZonesMu       sync.Mutex
+	loadedTimeZones   *timeZoneIndex
+	timeZonesErr      error
+	timeZonesFailedAt time.Time
+)
+
+// getTimeZones loads the configured time zone boundaries the first time they are needed, a failed
+// load is retried once timeZonesRetryInterval has passed
+func getTimeZones() (*timeZoneIndex, error) {
+	timeZonesMu.Lock()
+	defer timeZonesMu.Unlock()
+
+	if loadedTimeZones != nil {
+		return loadedTimeZones, nil
+	}
+	if timeZonesErr != nil && time.Since(timeZonesFailedAt) < timeZonesRetryInterval {
+		return nil, timeZonesErr
+	}
+	loadedTimeZones, timeZonesErr = loadTimeZones(config.GetString("Geocoder.TimeZonePath"))
+	if timeZonesErr != nil {
+		timeZonesFailedAt = time.Now()
+		if timeZonesErr != errTimeZonesNotConfigured {
+			logging.DoLoggingLevelBasedLogs(logging.Error, "", logging.EnrichErrorWithStackTrace(errors.New("error loading time zone boundaries: "+timeZonesErr.Error())))
+		}
+	}
+	return loadedTimeZones, timeZonesErr
+}
+
+// loadTimeZones reads a timezone-boundary-builder GeoJSON release, a FeatureCollection of Polygon
+// and MultiPolygon features with the IANA zone name in the tzid property
+func loadTimeZones(path string) (*timeZoneIndex, error) {
+	if path == "" {
+		return nil, errTimeZonesNotConfigured
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s does not exist, download it with the fetch-timezones command", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var collection struct {
+		Features []struct {
+			Properties struct {
+				TZID string `json:"tzid"`
+			} `json:"properties"`
+			Geometry GeoJSONGeometry `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(file).Decode(&collection); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var ids []string
+	var boxes []BoundingBox
+	var items []*timeZoneArea
+	for _, feature := range collection.Features {
+		var polygons [][][][]float64
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var rings [][][]float64
+			err = json.Unmarshal(feature.Geometry.Coordinates, &rings)
+			polygons = [][][][]float64{rings}
+		case "MultiPolygon":
+			err = json.Unmarshal(feature.Geometry.Coordinates, &polygons)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: zone %s: %v", path, feature.Properties.TZID, err)
+		}
+		for i, rings := range polygons {
+			if len(rings) == 0 || len(rings[0]) == 0 {
+				continue
+			}
+			area := &timeZoneArea{zone: feature.Properties.TZID, polygon: Polygon{Type: "Polygon", Coordinates: rings}}
+			ids = append(ids, fmt.Sprintf("%s/%d", area.zone, i))
+			boxes = append(boxes, area.polygon.bounds())
+			items = append(items, area)
+		}
+	}
+
+	index := &timeZoneIndex{}
+	index.tree.Load(ids, boxes, items)
+	logging.DoLoggingLevelBasedLogs(logging.Info, fmt.Sprintf("time zone boundaries loaded with %d polygons", len(items)), nil)
+	return index, nil
+}
+
+// lookup returns the zone whose polygon contains a position
+func (i *timeZoneIndex) lookup(lat, lng float64) (zone string, ok bool) {
+	i.tree.Search(pointBBox(lat, lng), func(area *timeZoneArea) bool {
+		if area.polygon.contains(lat, lng) {
+			zone, ok = area.zone, true
+			return false
+		}
+		return true
+	})
+	return zone, ok
+}
+
+// nauticalTimeZone returns the Etc/GMT zone of the 15° band a longitude falls in, used at sea when
+// the boundaries do not cover oceans. The Etc zones use POSIX signs, so UTC-5 is Etc/GMT+5.
+func nauticalTimeZone(lng float64) string {
+	hours := int(math.Round(lng / 15))
+	if hours == 0 {
+		return "Etc/GMT"
+	}
+	return fmt.Sprintf("Etc/GMT%+d", -hours)
+}
+
+// resolveTimeZone returns the IANA time zone of a position
+func resolveTimeZone(lat, lng float64) (string, error) {
+	index, err := getTimeZones()
+	if err != nil {
+		return "", err
+	}
+	if zone, ok := index.lookup(lat, lng); ok {
+		return zone, nil
+	}
+	return nauticalTimeZone(lng), nil
+}
+
+// setLocationTimeZone stores the time zone of a location, it is left empty when the boundaries are unavailable
+func setLocationTimeZone(l *Location) {
+	zone, err := resolveTimeZone(l.Latitude, l.Longitude)
+	if err != nil {
+		l.TimeZone = ""
+		return
+	}
+	l.TimeZone = zone
+}
+
+// timeZoneAt describes a zone at an instant
+func timeZoneAt(zone string, at time.Time) (TimeZoneResult, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return TimeZoneResult{}, err
+	}
+	local := at.In(loc)
+	abbreviation, offset := local.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+	}
+	abs := offset
+	if abs < 0 {
+		abs = -abs
+	}
+	return TimeZoneResult{
+		TimeZone:         zone,
+		UTCOffset:        fmt.Sprintf("%c%02d:%02d", sign, abs/3600, abs%3600/60),
+		UTCOffsetSeconds: offset,
+		Abbreviation:     abbreviation,
+		DST:              local.IsDST(),
+		LocalTime:        local,
+	}, nil
+}
+
+// GetTimeZone godoc
+// @Summary Get the time zone of a position
+// @Description Looks up the IANA time zone from the offline time zone boundaries and returns its current UTC offset, or the offset at a given time
+// @Tags geocode
+// @Accept json
+// @Produce json
+// @Param lat query number true "Latitude"
+// @Param lng query number true "Longitude"
+// @Param at query string false "RFC 3339 time to compute the offset for (default now)"
+// @Success 200 {object} TimeZoneResult
+// @Failure 400 {string} string "Bad Request"
+// @Failure 503 {string} string "Service Unavailable"
+// @Router /geolocationapi/geocode/timezone [get]
+func GetTimeZone(w http.ResponseWriter, r *http.Request) {
+	// Parse the query point
+	lat, lng, err := parseLatLngQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid point: %v", err)
+		return
+	}
+
+	// Parse the optional time
+	at := time.Now()
+	if value := r.URL.Query().Get("at"); value != "" {
+		if at, err = time.Parse(time.RFC3339, value); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid at: must be an RFC 3339 time")
+			return
+		}
+	}
+
+	// Look up the zone
+	zone, err := resolveTimeZone(lat, lng)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "Time zone lookup is unavailable: %v", err)
+		return
+	}
+	result, err := timeZoneAt(zone, at)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "Time zone %s is not in the time zone database: %v", zone, err)
+		return
+	}
+
+	// Marshal result to JSON
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
@@ -0,0 +1,130 @@
+package geolocationapi
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"temprest/config"
+)
+
+// DefaultTimeZoneRelease is the timezone-boundary-builder release fetched when none is given
+const DefaultTimeZoneRelease = "2024b"
+
+// timeZoneReleaseURL is the download of the boundaries including the ocean zones of a release
+const timeZoneReleaseURL = "https://github.com/evansiroky/timezone-boundary-builder/releases/download/%s/timezones-with-oceans.geojson.zip"
+
+// FetchTimeZones downloads a timezone-boundary-builder release to Geocoder.TimeZonePath and returns
+// the path. The file is only replaced once the download loads as time zone boundaries, so a failed
+// fetch keeps the boundaries in use.
+func FetchTimeZones(ctx context.Context, release string) (string, error) {
+	path := config.GetString("Geocoder.TimeZonePath")
+	if path == "" {
+		return "", errTimeZonesNotConfigured
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	// Download the release archive next to the target so the final rename stays on one file system
+	archive, err := os.CreateTemp(dir, ".timezones-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	if err := downloadTimeZoneRelease(ctx, release, archive); err != nil {
+		return "", err
+	}
+	if err := archive.Close(); err != nil {
+		return "", err
+	}
+
+	// Extract the GeoJSON file of the archive
+	reader, err := zip.OpenReader(archive.Name())
+	if err != nil {
+		return "", fmt.Errorf("release %s is not a zip archive: %v", release, err)
+	}
+	defer reader.Close()
+	var entry *zip.File
+	for _, f := range reader.File {
+		if strings.HasSuffix(f.Name, ".json") {
+			entry = f
+			break
+		}
+	}
+	if entry == nil {
+		return "", fmt.Errorf("release %s has no GeoJSON file", release)
+	}
+	extracted, err := os.CreateTemp(dir, ".timezones-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(extracted.Name())
+	defer extracted.Close()
+	if err := extractZipFile(entry, extracted); err != nil {
+		return "", fmt.Errorf("extracting %s: %v", entry.Name, err)
+	}
+	if err := extracted.Close(); err != nil {
+		return "", err
+	}
+
+	// Check the boundaries load before they replace the current file
+	if _, err := loadTimeZones(extracted.Name()); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(extracted.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(extracted.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// downloadTimeZoneRelease writes the archive of a release to w
+func downloadTimeZoneRelease(ctx context.Context, release string, w io.Writer) error {
+	return downloadURL(ctx, fmt.Sprintf(timeZoneReleaseURL, release), w)
+}
+
+// downloadURL writes the body of a successful GET request to w
+func downloadURL(ctx context.Context, url string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("downloading %s: %v", url, err)
+	}
+	return nil
+}
+
+// extractZipFile copies the uncompressed content of an archive entry to w
+func extractZipFile(f *zip.File, w io.Writer) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if _, err := io.Copy(w, rc); err != nil {
+		return err
+	}
+	if f.UncompressedSize64 == 0 {
+		return errors.New("entry is empty")
+	}
+	return nil
+}
@@ -0,0 +1,622 @@
+package geolocationapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"temprest/config"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Track defaults used when the Tracks config section is missing
+const (
+	defaultTrackMaxUploadBytes = 10 << 20
+	defaultTrackMaxPoints      = 100000
+)
+
+// Track export formats
+const (
+	TrackExportGeoJSON = "geojson"
+	TrackExportGPX     = "gpx"
+	TrackExportKML     = "kml"
+)
+
+// TrackPoint is a position along a track
+type TrackPoint struct {
+	Latitude  float64    `json:"latitude"`
+	Longitude float64    `json:"longitude"`
+	Elevation *float64   `json:"elevation,omitempty" bson:"elevation,omitempty"`
+	Time      *time.Time `json:"time,omitempty" bson:"time,omitempty"`
+}
+
+// Track is an ordered route published by a community
+type Track struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	CommunityID string       `json:"communityId"`
+	Points      []TrackPoint `json:"points,omitempty"`
+	// Distance in meters, elevation gain in meters and duration in seconds are computed on upload
+	// from the full resolution points
+	Distance      float64 `json:"distance"`
+	ElevationGain float64 `json:"elevationGain"`
+	Duration      float64 `json:"duration"`
+}
+
+// tracksCollection returns the collection of community tracks
+func tracksCollection() *mongo.Collection {
+	return client.Database("geolocapi").Collection("tracks")
+}
+
+// validateTrackPoints checks a track has enough valid, chronologically ordered points
+func validateTrackPoints(points []TrackPoint) error {
+	maxPoints := config.GetInt("Tracks.MaxPoints")
+	if maxPoints <= 0 {
+		maxPoints = defaultTrackMaxPoints
+	}
+	if len(points) < 2 {
+		return errors.New("a track needs at least two points")
+	}
+	if len(points) > maxPoints {
+		return fmt.Errorf("a track can have at most %d points", maxPoints)
+	}
+
+	var last *time.Time
+	for i, p := range points {
+		if err := validateCoordinate(p.Latitude, true); err != nil {
+			return fmt.Errorf("point %d: %v", i, err)
+		}
+		if err := validateCoordinate(p.Longitude, false); err != nil {
+			return fmt.Errorf("point %d: %v", i, err)
+		}
+		if p.Time != nil {
+			if last != nil && p.Time.Before(*last) {
+				return fmt.Errorf("point %d is earlier than the point before it", i)
+			}
+			last = p.Time
+		}
+	}
+	return nil
+}
+
+// computeTrackStats sets the distance, elevation gain and duration of a track
+func computeTrackStats(t *Track) {
+	t.Distance, t.ElevationGain, t.Duration = 0, 0, 0
+
+	var first, last *time.Time
+	for i, p := range t.Points {
+		if i > 0 {
+			previous := t.Points[i-1]
+			t.Distance += haversineMeters(previous.Latitude, previous.Longitude, p.Latitude, p.Longitude)
+			if previous.Elevation != nil && p.Elevation != nil && *p.Elevation > *previous.Elevation {
+				t.ElevationGain += *p.Elevation - *previous.Elevation
+			}
+		}
+		if p.Time != nil {
+			if first == nil {
+				first = p.Time
+			}
+			last = p.Time
+		}
+	}
+	if first != nil {
+		t.Duration = last.Sub(*first).Seconds()
+	}
+}
+
+// readTrackUpload reads a GPX or GeoJSON track from the request body, the format is taken from the
+// Content-Type header and sniffed from the body when the header does not say
+func readTrackUpload(r *http.Request) (Track, error) {
+	maxBytes := config.GetInt64("Tracks.MaxUploadBytes")
+	if maxBytes <= 0 {
+		maxBytes = defaultTrackMaxUploadBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return Track{}, err
+	}
+	if int64(len(data)) > maxBytes {
+		return Track{}, fmt.Errorf("upload is larger than %d bytes", maxBytes)
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	trimmed := bytes.TrimSpace(data)
+	isXML := strings.Contains(contentType, "xml") || (!strings.Contains(contentType, "json") && len(trimmed) > 0 && trimmed[0] == '<')
+
+	var track Track
+	if isXML {
+		doc, err := readGPX(bytes.NewReader(trimmed))
+		if err != nil {
+			return Track{}, fmt.Errorf("invalid GPX: %v", err)
+		}
+		if track.Name, track.Points, err = gpxTrackPoints(doc); err != nil {
+			return Track{}, err
+		}
+		return track, nil
+	}
+	return readGeoJSONTrack(trimmed)
+}
+
+// readGeoJSONTrack reads a LineString or MultiLineString geometry, feature or the first line
+// feature of a collection, point times come from the coordTimes or times property
+func readGeoJSONTrack(data []byte) (Track, error) {
+	var object geoJSONObject
+	if err := json.Unmarshal(data, &object); err != nil {
+		return Track{}, fmt.Errorf("invalid GeoJSON: %v", err)
+	}
+
+	if object.Type == "FeatureCollection" {
+		found := false
+		for _, feature := range object.Features {
+			if feature.Geometry != nil && (feature.Geometry.Type == "LineString" || feature.Geometry.Type == "MultiLineString") {
+				object, found = feature, true
+				break
+			}
+		}
+		if !found {
+			return Track{}, errors.New("feature collection has no LineString feature")
+		}
+	}
+
+	track := Track{}
+	geometry := &GeoJSONGeometry{Type: object.Type, Coordinates: object.Coordinates}
+	if object.Type == "Feature" {
+		if object.Geometry == nil {
+			return Track{}, errors.New("feature has no geometry")
+		}
+		geometry = object.Geometry
+		track.ID = geoJSONID(object.ID)
+		track.Name, _ = object.Properties["name"].(string)
+		track.CommunityID, _ = object.Properties["communityId"].(string)
+	}
+
+	var lines [][][]float64
+	switch geometry.Type {
+	case "LineString":
+		var line [][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &line); err != nil {
+			return Track{}, fmt.Errorf("invalid LineString coordinates: %v", err)
+		}
+		lines = [][][]float64{line}
+	case "MultiLineString":
+		if err := json.Unmarshal(geometry.Coordinates, &lines); err != nil {
+			return Track{}, fmt.Errorf("invalid MultiLineString coordinates: %v", err)
+		}
+	default:
+		return Track{}, fmt.Errorf("unsupported geometry type %q, expected LineString or MultiLineString", geometry.Type)
+	}
+
+	for _, line := range lines {
+		for _, position := range line {
+			if len(position) < 2 {
+				return Track{}, errors.New("position without longitude and latitude")
+			}
+			point := TrackPoint{Longitude: position[0], Latitude: position[1]}
+			if len(position) > 2 {
+				elevation := position[2]
+				point.Elevation = &elevation
+			}
+			track.Points = append(track.Points, point)
+		}
+	}
+
+	// Times are a flat list, or one list per line as written by togeojson for MultiLineStrings
+	times, ok := object.Properties["coordTimes"].([]interface{})
+	if !ok {
+		times, _ = object.Properties["times"].([]interface{})
+	}
+	if len(times) > 0 {
+		if _, nested := times[0].([]interface{}); nested {
+			var flat []interface{}
+			for _, lineTimes := range times {
+				values, _ := lineTimes.([]interface{})
+				flat = append(flat, values...)
+			}
+			times = flat
+		}
+		if len(times) != len(track.Points) {
+			return Track{}, fmt.Errorf("got %d times for %d points", len(times), len(track.Points))
+		}
+		for i, value := range times {
+			text, _ := value.(string)
+			timestamp, err := time.Parse(time.RFC3339, text)
+			if err != nil {
+				return Track{}, fmt.Errorf("invalid time at point %d: %v", i, err)
+			}
+			track.Points[i].Time = &timestamp
+		}
+	}
+	return track, nil
+}
+
+// trackGeoJSON converts a track to a GeoJSON LineString feature
+func trackGeoJSON(t Track) (GeoJSONFeature, error) {
+	coordinates := make([][]float64, len(t.Points))
+	var times []string
+	for i, p := range t.Points {
+		coordinates[i] = []float64{p.Longitude, p.Latitude}
+		if p.Elevation != nil {
+			coordinates[i] = append(coordinates[i], *p.Elevation)
+		}
+		if p.Time != nil {
+			times = append(times, p.Time.UTC().Format(time.RFC3339))
+		}
+	}
+	geometry, err := newGeoJSONGeometry("LineString", coordinates)
+	if err != nil {
+		return GeoJSONFeature{}, err
+	}
+
+	properties := map[string]interface{}{
+		"name":          t.Name,
+		"communityId":   t.CommunityID,
+		"distance":      t.Distance,
+		"elevationGain": t.ElevationGain,
+		"duration":      t.Duration,
+	}
+	// Only every point having a time keeps coordTimes aligned with the coordinates
+	if len(times) == len(t.Points) {
+		properties["coordTimes"] = times
+	}
+	return GeoJSONFeature{Type: "Feature", ID: t.ID, Geometry: geometry, Properties: properties}, nil
+}
+
+// trackGPX converts a track to a GPX document with one track segment
+func trackGPX(t Track) *gpxDocument {
+	segment := gpxSegment{Points: make([]gpxPoint, len(t.Points))}
+	for i, p := range t.Points {
+		segment.Points[i] = gpxPoint{Lat: p.Latitude, Lon: p.Longitude, Elevation: p.Elevation, Time: p.Time}
+	}
+	return &gpxDocument{
+		Metadata: &gpxMetadata{Name: t.Name},
+		Tracks:   []gpxTrack{{Name: t.Name, Segments: []gpxSegment{segment}}},
+	}
+}
+
+// trackKML converts a track to a KML document with one LineString placemark
+func trackKML(t Track) *kmlDocument {
+	description := fmt.Sprintf("Distance: %.0f m, elevation gain: %.0f m, duration: %s",
+		t.Distance, t.ElevationGain, time.Duration(t.Duration*float64(time.Second)))
+	return &kmlDocument{Document: kmlFolder{
+		Name: t.Name,
+		Placemarks: []kmlPlacemark{{
+			ID:          t.ID,
+			Name:        t.Name,
+			Description: description,
+			LineString:  &kmlLineString{Tessellate: 1, Coordinates: kmlTrackCoordinates(t.Points)},
+		}},
+	}}
+}
+
+// writeTrack writes a track as JSON or in an export format
+func writeTrack(w http.ResponseWriter, t Track, export string) error {
+	switch export {
+	case TrackExportGeoJSON:
+		feature, err := trackGeoJSON(t)
+		if err != nil {
+			return err
+		}
+		jsonData, err := json.Marshal(feature)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/geo+json")
+		_, err = w.Write(jsonData)
+		return err
+	case TrackExportGPX:
+		var buffer bytes.Buffer
+		if err := writeGPX(&buffer, trackGPX(t)); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/gpx+xml")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", t.ID+".gpx"))
+		_, err := w.Write(buffer.Bytes())
+		return err
+	case TrackExportKML:
+		var buffer bytes.Buffer
+		if err := writeKML(&buffer, trackKML(t)); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/vnd.google-earth.kml+xml")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", t.ID+".kml"))
+		_, err := w.Write(buffer.Bytes())
+		return err
+	}
+
+	jsonData, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(jsonData)
+	return err
+}
+
+// CreateTrack godoc
+// @Summary Upload a track
+// @Description Stores a community track uploaded as GPX or as a GeoJSON LineString and computes its distance, elevation gain and duration
+// @Tags tracks
+// @Accept json,application/gpx+xml
+// @Produce json
+// @Param track body GeoJSONFeature true "GeoJSON LineString feature or GPX document"
+// @Param id query string false "Track ID, generated when missing"
+// @Param name query string false "Track name, overrides the name in the upload"
+// @Param communityId query string false "Owning community ID, required unless the GeoJSON properties have it"
+// @Success 201 {object} Track "track created"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/tracks [post]
+func CreateTrack(w http.ResponseWriter, r *http.Request) {
+	// Read the uploaded track
+	track, err := readTrackUpload(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error reading track: %v", err)
+		return
+	}
+
+	// Query parameters override what the upload says
+	query := r.URL.Query()
+	if value := query.Get("id"); value != "" {
+		track.ID = value
+	}
+	if value := query.Get("name"); value != "" {
+		track.Name = value
+	}
+	if value := query.Get("communityId"); value != "" {
+		track.CommunityID = value
+	}
+	if track.ID == "" {
+		track.ID = primitive.NewObjectID().Hex()
+	}
+	if track.CommunityID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "communityId is required")
+		return
+	}
+
+	// Validate the points and compute the statistics
+	if err := validateTrackPoints(track.Points); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid track: %v", err)
+		return
+	}
+	computeTrackStats(&track)
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Check the owning community exists
+	count, err := client.Database("geolocapi").Collection("communities").CountDocuments(ctx, bson.M{"id": track.CommunityID})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error retrieving community: %v", err)
+		return
+	}
+	if count == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Unknown community: %v", track.CommunityID)
+		return
+	}
+
+	// Insert the track into the collection
+	_, err = tracksCollection().InsertOne(ctx, track)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error inserting track: %v", err)
+		return
+	}
+
+	// Marshal the track to JSON
+	jsonData, err := json.Marshal(track)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header and status code
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	// Write JSON response
+	w.Write(jsonData)
+}
+
+// GetTracks godoc
+// @Summary Get tracks
+// @Description Retrieves track summaries without their points, optionally for one community
+// @Tags tracks
+// @Accept json
+// @Produce json
+// @Param communityId query string false "Only return tracks of this community"
+// @Success 200 {object} []Track
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/tracks [get]
+func GetTracks(w http.ResponseWriter, r *http.Request) {
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Find the tracks, leaving out the points
+	filter := bson.M{}
+	if communityID := r.URL.Query().Get("communityId"); communityID != "" {
+		filter["communityid"] = communityID
+	}
+	cursor, err := tracksCollection().Find(ctx, filter, options.Find().SetProjection(bson.M{"points": 0}))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error retrieving tracks: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	tracks := []Track{}
+	if err := cursor.All(ctx, &tracks); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error decoding tracks: %v", err)
+		return
+	}
+
+	// Marshal tracks to JSON
+	jsonData, err := json.Marshal(tracks)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error marshaling JSON: %v", err)
+		return
+	}
+
+	// Set response header
+	w.Header().Set("Content-Type", "application/json")
+	// Write JSON response
+	w.Write(jsonData)
+}
+
+// GetTrackByID godoc
+// @Summary Get a track by ID
+// @Description Retrieves a track, optionally simplified, as JSON or exported to GeoJSON, GPX or KML
+// @Tags tracks
+// @Accept json
+// @Produce json,application/geo+json,application/gpx+xml,application/vnd.google-earth.kml+xml
+// @Param id path string true "ID"
+// @Param simplify query number false "Simplification tolerance in meters"
+// @Param algorithm query string false "Simplification algorithm: douglas-peucker (default) or visvalingam"
+// @Param export query string false "Export format: geojson, gpx or kml"
+// @Success 200 {object} Track
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/tracks/{id} [get]
+func GetTrackByID(w http.ResponseWriter, r *http.Request) {
+	// Get the ID parameter from the URL
+	id := chi.URLParam(r, "id")
+	query := r.URL.Query()
+
+	// Parse the simplification and export parameters
+	var tolerance float64
+	if value := query.Get("simplify"); value != "" {
+		var err error
+		tolerance, err = strconv.ParseFloat(value, 64)
+		if err != nil || !(tolerance >= 0) || math.IsInf(tolerance, 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid simplify: must be a tolerance in meters")
+			return
+		}
+	}
+	algorithm := query.Get("algorithm")
+	if algorithm == "" {
+		algorithm = SimplifyDouglasPeucker
+	}
+	if algorithm != SimplifyDouglasPeucker && algorithm != SimplifyVisvalingam {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid algorithm: must be %s or %s", SimplifyDouglasPeucker, SimplifyVisvalingam)
+		return
+	}
+	export := strings.ToLower(query.Get("export"))
+	if export != "" && export != TrackExportGeoJSON && export != TrackExportGPX && export != TrackExportKML {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid export: must be %s, %s or %s", TrackExportGeoJSON, TrackExportGPX, TrackExportKML)
+		return
+	}
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Find the track by ID
+	var track Track
+	err := tracksCollection().FindOne(ctx, bson.M{"id": id}).Decode(&track)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Track not found"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error retrieving track: %v", err)
+		return
+	}
+
+	// Simplify the points, the statistics stay those of the full track
+	track.Points = simplifyTrack(track.Points, tolerance, algorithm)
+
+	// Write the track in the requested format
+	if err := writeTrack(w, track, export); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error writing track: %v", err)
+	}
+}
+
+// DeleteTrackByID godoc
+// @Summary Delete a track by ID
+// @Description Deletes a track from the MongoDB collection by its ID
+// @Tags tracks
+// @Param id path string true "ID"
+// @Success 204 "No Content"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /geolocationapi/tracks/{id} [delete]
+func DeleteTrackByID(w http.ResponseWriter, r *http.Request) {
+	// Get the ID parameter from the URL
+	id := chi.URLParam(r, "id")
+
+	// Check if the MongoDB client is nil
+	if client == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "MongoDB client is not initialized")
+		return
+	}
+
+	// Get the MongoDB context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Delete the track by ID
+	result, err := tracksCollection().DeleteOne(ctx, bson.M{"id": id})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Error deleting track: %v", err)
+		return
+	}
+	if result.DeletedCount == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Track not found"))
+		return
+	}
+
+	// Set response status code
+	w.WriteHeader(http.StatusNoContent)
+}
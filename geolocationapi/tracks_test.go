@@ -0,0 +1,57 @@
+package geolocationapi
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestComputeTrackStats(t *testing.T) {
+	elevation := func(v float64) *float64 { return &v }
+	at := func(seconds int) *time.Time {
+		v := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC).Add(time.Duration(seconds) * time.Second)
+		return &v
+	}
+	tests := []struct {
+		name          string
+		points        []TrackPoint
+		distance      float64
+		elevationGain float64
+		duration      float64
+	}{
+		{"no points", nil, 0, 0, 0},
+		{"single point", []TrackPoint{{Latitude: 52.50, Longitude: 13.4, Elevation: elevation(100), Time: at(0)}}, 0, 0, 0},
+		{"climbs and descents", []TrackPoint{
+			{Latitude: 52.50, Longitude: 13.4, Elevation: elevation(100), Time: at(0)},
+			{Latitude: 52.51, Longitude: 13.4, Elevation: elevation(150), Time: at(60)},
+			{Latitude: 52.52, Longitude: 13.4, Elevation: elevation(120)},
+			{Latitude: 52.53, Longitude: 13.4, Elevation: elevation(130), Time: at(180)},
+		}, haversineMeters(52.50, 13.4, 52.53, 13.4), 60, 180},
+		{"missing elevations are skipped", []TrackPoint{
+			{Latitude: 52.50, Longitude: 13.4, Elevation: elevation(100)},
+			{Latitude: 52.51, Longitude: 13.4},
+			{Latitude: 52.52, Longitude: 13.4, Elevation: elevation(200)},
+		}, haversineMeters(52.50, 13.4, 52.52, 13.4), 0, 0},
+		{"back and forth", []TrackPoint{
+			{Latitude: 52.50, Longitude: 13.4, Time: at(0)},
+			{Latitude: 52.51, Longitude: 13.4},
+			{Latitude: 52.50, Longitude: 13.4, Time: at(90)},
+		}, 2 * haversineMeters(52.50, 13.4, 52.51, 13.4), 0, 90},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Stale statistics are reset
+			track := Track{Points: tt.points, Distance: 1, ElevationGain: 1, Duration: 1}
+			computeTrackStats(&track)
+			if math.Abs(track.Distance-tt.distance) > 1e-6 {
+				t.Errorf("Distance = %v, want %v", track.Distance, tt.distance)
+			}
+			if track.ElevationGain != tt.elevationGain {
+				t.Errorf("ElevationGain = %v, want %v", track.ElevationGain, tt.elevationGain)
+			}
+			if track.Duration != tt.duration {
+				t.Errorf("Duration = %v, want %v", track.Duration, tt.duration)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package geolocationapi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WGS84 ellipsoid and UTM projection constants
+const (
+	wgs84SemiMajorAxis = 6378137.0
+	wgs84Flattening    = 1 / 298.257223563
+	utmScaleFactor     = 0.9996
+	utmFalseEasting    = 500000.0
+	utmFalseNorthing   = 10000000.0
+)
+
+// utmBandLetters are the latitude bands from 80°S to 84°N, 8° each (X is 12°)
+const utmBandLetters = "CDEFGHJKLMNPQRSTUVWX"
+
+// MGRS 100km square letters
+var (
+	mgrsColumnLetters = []string{"ABCDEFGH", "JKLMNPQR", "STUVWXYZ"}
+	mgrsRowLetters    = "ABCDEFGHJKLMNPQRSTUV"
+)
+
+// UTMCoordinate is a position in the Universal Transverse Mercator grid
+type UTMCoordinate struct {
+	Zone     int
+	Band     byte
+	Easting  float64
+	Northing float64
+}
+
+// North reports whether the coordinate is in the northern hemisphere
+func (u UTMCoordinate) North() bool {
+	return u.Band >= 'N'
+}
+
+// String renders the coordinate as "17T 589000 4477000"
+func (u UTMCoordinate) String() string {
+	return fmt.Sprintf("%d%c %.0f %.0f", u.Zone, u.Band, math.Floor(u.Easting), math.Floor(u.Northing))
+}
+
+// utmZone returns the UTM zone for a position, including the Norway and Svalbard exceptions
+func utmZone(lat, lng float64) int {
+	zone := int(math.Floor((lng+180)/6)) + 1
+	if zone > 60 {
+		zone = 60
+	}
+	if lat >= 56 && lat < 64 && lng >= 3 && lng < 12 {
+		zone = 32
+	}
+	if lat >= 72 && lat < 84 {
+		switch {
+		case lng >= 0 && lng < 9:
+			zone = 31
+		case lng >= 9 && lng < 21:
+			zone = 33
+		case lng >= 21 && lng < 33:
+			zone = 35
+		case lng >= 33 && lng < 42:
+			zone = 37
+		}
+	}
+	return zone
+}
+
+// utmBand returns the latitude band letter for a latitude
+func utmBand(lat float64) byte {
+	idx := int(math.Floor((lat + 80) / 8))
+	if idx < 0 {
+		idx = 0
+	}
+	if idx > len(utmBandLetters)-1 {
+		idx = len(utmBandLetters) - 1
+	}
+	return utmBandLetters[idx]
+}
+
+// latLngToUTM projects a WGS84 position into its natural UTM zone
+func latLngToUTM(lat, lng float64) (UTMCoordinate, error) {
+	if lat < -80 || lat > 84 {
+		return UTMCoordinate{}, errors.New("UTM is only defined between 80°S and 84°N")
+	}
+	zone := utmZone(lat, lng)
+	easting, northing := latLngToUTMZone(lat, lng, zone)
+	return UTMCoordinate{Zone: zone, Band: utmBand(lat), Easting: easting, Northing: northing}, nil
+}
+
+// latLngToUTMZone projects a WGS84 position into the given UTM zone
+func latLngToUTMZone(lat, lng float64, zone int) (easting, northing float64) {
+	a := wgs84SemiMajorAxis
+	e2 := wgs84Flattening * (2 - wgs84Flattening)
+	ep2 := e2 / (1 - e2)
+
+	phi := lat * math.Pi / 180
+	lambda0 := float64((zone-1)*6-180+3) * math.Pi / 180
+	lambda := lng * math.Pi / 180
+
+	sinPhi, cosPhi := math.Sincos(phi)
+	n := a / math.Sqrt(1-e2*sinPhi*sinPhi)
+	t := math.Tan(phi) * math.Tan(phi)
+	c := ep2 * cosPhi * cosPhi
+	aa := cosPhi * (lambda - lambda0)
+	m := utmMeridianArc(phi)
+
+	easting = utmScaleFactor*n*(aa+(1-t+c)*math.Pow(aa, 3)/6+
+		(5-18*t+t*t+72*c-58*ep2)*math.Pow(aa, 5)/120) + utmFalseEasting
+	northing = utmScaleFactor * (m + n*math.Tan(phi)*(aa*aa/2+
+		(5-t+9*c+4*c*c)*math.Pow(aa, 4)/24+
+		(61-58*t+t*t+600*c-330*ep2)*math.Pow(aa, 6)/720))
+	if lat < 0 {
+		northing += utmFalseNorthing
+	}
+	return easting, northing
+}
+
+// utmMeridianArc returns the meridian distance from the equator to latitude phi (radians)
+func utmMeridianArc(phi float64) float64 {
+	e2 := wgs84Flattening * (2 - wgs84Flattening)
+	e4 := e2 * e2
+	e6 := e4 * e2
+	return wgs84SemiMajorAxis * ((1-e2/4-3*e4/64-5*e6/256)*phi -
+		(3*e2/8+3*e4/32+45*e6/1024)*math.Sin(2*phi) +
+		(15*e4/256+45*e6/1024)*math.Sin(4*phi) -
+		(35*e6/3072)*math.Sin(6*phi))
+}
+
+// utmToLatLng converts a UTM position back to WGS84 latitude/longitude
+func utmToLatLng(zone int, north bool, easting, northing float64) (lat, lng float64, err error) {
+	if zone < 1 || zone > 60 {
+		return 0, 0, errors.New("UTM zone must be between 1 and 60")
+	}
+
+	a := wgs84SemiMajorAxis
+	e2 := wgs84Flattening * (2 - wgs84Flattening)
+	ep2 := e2 / (1 - e2)
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+
+	x := easting - utmFalseEasting
+	y := northing
+	if !north {
+		y -= utmFalseNorthing
+	}
+
+	// Footprint latitude
+	m := y / utmScaleFactor
+	mu := m / (a * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+	phi1 := mu + (3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+
+	sinPhi1, cosPhi1 := math.Sincos(phi1)
+	n1 := a / math.Sqrt(1-e2*sinPhi1*sinPhi1)
+	t1 := math.Tan(phi1) * math.Tan(phi1)
+	c1 := ep2 * cosPhi1 * cosPhi1
+	r1 := a * (1 - e2) / math.Pow(1-e2*sinPhi1*sinPhi1, 1.5)
+	d := x / (n1 * utmScaleFactor)
+
+	phi := phi1 - (n1*math.Tan(phi1)/r1)*(d*d/2-
+		(5+3*t1+10*c1-4*c1*c1-9*ep2)*math.Pow(d, 4)/24+
+		(61+90*t1+298*c1+45*t1*t1-252*ep2-3*c1*c1)*math.Pow(d, 6)/720)
+	lambda := (d - (1+2*t1+c1)*math.Pow(d, 3)/6 +
+		(5-2*c1+28*t1-3*c1*c1+8*ep2+24*t1*t1)*math.Pow(d, 5)/120) / cosPhi1
+
+	lat = phi * 180 / math.Pi
+	lng = float64((zone-1)*6-180+3) + lambda*180/math.Pi
+	return lat, lng, nil
+}
+
+// utmPattern matches "17T 589000 4477000" with optional mE/mN suffixes
+var utmPattern = regexp.MustCompile(`^(\d{1,2})\s*([C-HJ-NP-Xc-hj-np-x])\s+(\d+(?:\.\d+)?)\s*(?:mE|E)?\s+(\d+(?:\.\d+)?)\s*(?:mN|N)?$`)
+
+// parseUTM parses a UTM string into latitude/longitude
+func parseUTM(s string) (lat, lng float64, err error) {
+	m := utmPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, 0, errors.New("invalid UTM coordinate: " + s)
+	}
+	zone, _ := strconv.Atoi(m[1])
+	band := strings.ToUpper(m[2])[0]
+	easting, _ := strconv.ParseFloat(m[3], 64)
+	northing, _ := strconv.ParseFloat(m[4], 64)
+	return utmToLatLng(zone, band >= 'N', easting, northing)
+}
+
+// latLngToMGRS renders a position as an MGRS reference with 1m precision, e.g. "17T NE 89000 77000"
+func latLngToMGRS(lat, lng float64) (string, error) {
+	u, err := latLngToUTM(lat, lng)
+	if err != nil {
+		return "", err
+	}
+
+	col := int(math.Floor(u.Easting / 100000))
+	row := int(math.Floor(u.Northing/100000)) % 20
+	columnLetters := mgrsColumnLetters[(u.Zone-1)%3]
+	if u.Zone%2 == 0 {
+		row = (row + 5) % 20
+	}
+	if col < 1 || col > len(columnLetters) {
+		return "", errors.New("easting is outside the MGRS grid")
+	}
+
+	easting := int(math.Floor(u.Easting)) % 100000
+	northing := int(math.Floor(u.Northing)) % 100000
+	return fmt.Sprintf("%d%c %c%c %05d %05d", u.Zone, u.Band, columnLetters[col-1], mgrsRowLetters[row], easting, northing), nil
+}
+
+// mgrsPattern matches "17TNE8900077000" with optional spaces between the parts
+var mgrsPattern = regexp.MustCompile(`^(\d{1,2})\s*([C-HJ-NP-X])\s*([A-HJ-NP-Z])([A-HJ-NP-V])\s*(\d*)\s*(\d*)$`)
+
+// parseMGRS parses an MGRS reference into latitude/longitude (centre of the referenced square)
+func parseMGRS(s string) (lat, lng float64, err error) {
+	m := mgrsPattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, 0, errors.New("invalid MGRS reference: " + s)
+	}
+	zone, _ := strconv.Atoi(m[1])
+	if zone < 1 || zone > 60 {
+		return 0, 0, errors.New("MGRS zone must be between 1 and 60")
+	}
+	band := m[2][0]
+
+	// Digits may be split by a space or given as one even-length run
+	digits := m[5] + m[6]
+	if len(digits)%2 != 0 || len(digits) > 10 {
+		return 0, 0, errors.New("MGRS easting and northing must have the same number of digits")
+	}
+	precision := len(digits) / 2
+	scale := math.Pow(10, float64(5-precision))
+	var e, n float64
+	if precision > 0 {
+		ev, _ := strconv.Atoi(digits[:precision])
+		nv, _ := strconv.Atoi(digits[precision:])
+		// Use the centre of the referenced square
+		e = (float64(ev) + 0.5) * scale
+		n = (float64(nv) + 0.5) * scale
+	} else {
+		e, n = 50000, 50000
+	}
+
+	columnLetters := mgrsColumnLetters[(zone-1)%3]
+	col := strings.IndexByte(columnLetters, m[3][0])
+	if col < 0 {
+		return 0, 0, errors.New("invalid MGRS column letter for zone")
+	}
+	row := strings.IndexByte(mgrsRowLetters, m[4][0])
+	if zone%2 == 0 {
+		row = (row + 15) % 20
+	}
+
+	easting := float64(col+1)*100000 + e
+	northing := float64(row)*100000 + n
+
+	// Move the northing into the latitude band, which spans less than 2,000km
+	bandIdx := strings.IndexByte(utmBandLetters, band)
+	bandLat := float64(bandIdx*8 - 80)
+	_, bandNorthing := latLngToUTMZone(bandLat, float64((zone-1)*6-180+3), zone)
+	bandNorthing = math.Floor(bandNorthing/100000) * 100000
+	northing += math.Floor(bandNorthing/2000000) * 2000000
+	if northing < bandNorthing {
+		northing += 2000000
+	}
+	return utmToLatLng(zone, band >= 'N', easting, northing)
+}
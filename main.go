@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"os"
 	"temprest/config"
 	"temprest/geolocationapi"
 	"temprest/healthcheck"
@@ -21,6 +23,14 @@ var serverPort = config.GetString("HttpServer.Port")
 // @host localhost:8080
 // @BasePath /
 func main() {
+	// Run a CLI subcommand when one is given
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	// Accept GPS devices speaking NMEA when the listener is enabled
+	go startNMEAListener()
+
 	// Create a new router using Chi
 	startServer()
 }
@@ -51,6 +61,13 @@ func startServer() {
 
 }
 
+// startNMEAListener runs the NMEA listener for the lifetime of the process
+func startNMEAListener() {
+	if err := geolocationapi.ListenNMEA(context.Background()); err != nil {
+		logging.DoLoggingLevelBasedLogs(logging.Error, "", logging.EnrichErrorWithStackTrace(errors.New("NMEA listener error: "+err.Error())))
+	}
+}
+
 // hello godoc
 // @Summary Get a hello message
 // @Description Get a simple hello message